@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !race
+
+package bench
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/token"
+)
+
+// update writes the measured allocations as new baseline of TestAllocations.
+var update = flag.Bool("update", false, "update the allocation baseline in testdata")
+
+// baselineFile contains the allocations per operation of the latest release.
+var baselineFile = filepath.Join("testdata", "baseline.json")
+
+// TestAllocations fails, if parsing or lexing a corpus allocates more than 10% more often than
+// stored in the baseline. Allocations depend on the Go toolchain and on the race detector, so the
+// gate only runs, if it is enabled for CI, which uses the toolchain the baseline was measured with:
+//
+//  TADL_ALLOCATION_GATE=1 go test ./bench -run Allocations
+//
+// After intended changes, or with a new toolchain, update the baseline with:
+//
+//  TADL_ALLOCATION_GATE=1 go test ./bench -run Allocations -update
+func TestAllocations(t *testing.T) {
+	if os.Getenv("TADL_ALLOCATION_GATE") == "" {
+		t.Skip("set TADL_ALLOCATION_GATE to compare allocations with the baseline")
+	}
+
+	var current []Result
+
+	for _, corpus := range Corpora() {
+		corpus := corpus
+
+		current = append(current, Result{
+			Name: "parse/" + corpus.Name,
+			AllocsPerOp: testing.AllocsPerRun(3, func() {
+				if _, err := parser.NewParser(corpus.Name, bytes.NewReader(corpus.Text)).Parse(); err != nil {
+					t.Fatal(err)
+				}
+			}),
+		}, Result{
+			Name: "lex/" + corpus.Name,
+			AllocsPerOp: testing.AllocsPerRun(3, func() {
+				lexer := token.NewLexer(corpus.Name, bytes.NewReader(corpus.Text))
+				for {
+					_, err := lexer.Token()
+					if errors.Is(err, io.EOF) {
+						break
+					}
+
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+			}),
+		})
+	}
+
+	if *update {
+		f, err := os.Create(baselineFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer f.Close()
+
+		if err := WriteResults(f, current); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	f, err := os.Open(baselineFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	baseline, err := ReadResults(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range Compare(baseline, current, 0.1) {
+		t.Error(r)
+	}
+}
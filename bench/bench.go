@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package bench
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/token"
+)
+
+// Parse benchmarks parsing the given corpus into a tree.
+func Parse(b *testing.B, corpus Corpus) {
+	b.Helper()
+	b.SetBytes(int64(len(corpus.Text)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := parser.NewParser(corpus.Name, bytes.NewReader(corpus.Text)).Parse()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Lex benchmarks reading all tokens of the given corpus.
+func Lex(b *testing.B, corpus Corpus) {
+	b.Helper()
+	b.SetBytes(int64(len(corpus.Text)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		lexer := token.NewLexer(corpus.Name, bytes.NewReader(corpus.Text))
+
+		for {
+			_, err := lexer.Token()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// RunAll runs the benchmark function fn as a sub-benchmark for each of the given corpora.
+func RunAll(b *testing.B, corpora []Corpus, fn func(b *testing.B, corpus Corpus)) {
+	b.Helper()
+
+	for _, corpus := range corpora {
+		corpus := corpus
+
+		b.Run(corpus.Name, func(b *testing.B) {
+			fn(b, corpus)
+		})
+	}
+}
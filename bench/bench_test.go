@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package bench
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+)
+
+func TestCorpora(t *testing.T) {
+	for _, corpus := range Corpora() {
+		t.Run(corpus.Name, func(t *testing.T) {
+			_, err := parser.NewParser(corpus.Name, bytes.NewReader(corpus.Text)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	RunAll(b, Corpora(), Parse)
+}
+
+func BenchmarkLex(b *testing.B) {
+	RunAll(b, Corpora(), Lex)
+}
+
+func TestCompare(t *testing.T) {
+	baseline := []Result{
+		{Name: "a", NsPerOp: 100, BytesPerOp: 1000, AllocsPerOp: 10},
+		{Name: "b", AllocsPerOp: 10},
+	}
+
+	current := []Result{
+		{Name: "a", NsPerOp: 150, BytesPerOp: 1050, AllocsPerOp: 12},
+		{Name: "b", NsPerOp: 500, AllocsPerOp: 10},
+		{Name: "new", AllocsPerOp: 1000},
+	}
+
+	var got []string
+	for _, r := range Compare(baseline, current, 0.1) {
+		got = append(got, r.String())
+	}
+
+	want := []string{
+		"a: ns/op increased from 100 to 150 (+50.0%)",
+		"a: allocs/op increased from 10 to 12 (+20.0%)",
+	}
+
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, baseline); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadResults(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(read) != 2 || read[0] != baseline[0] || read[1] != baseline[1] {
+		t.Errorf("expected %+v but got %+v", baseline, read)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	if testing.Short() {
+		t.Skip("benchmarks run for a second")
+	}
+
+	results := Measure([]Corpus{WideChildren(10)}, Parse)
+	if len(results) != 1 || results[0].Name != "WideChildren10" || results[0].NsPerOp <= 0 || results[0].AllocsPerOp <= 0 {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
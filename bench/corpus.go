@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package bench
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Corpus is a named Tadl document used for benchmarking.
+type Corpus struct {
+	Name string
+	Text []byte
+}
+
+// Corpora returns the representative set of corpora that is used by the benchmarks of this package.
+func Corpora() []Corpus {
+	return []Corpus{
+		DeepNesting(10000),
+		WideChildren(10000),
+		AttributeHeavy(1000, 20),
+		TextHeavy(1 << 20),
+	}
+}
+
+// DeepNesting returns a G2 document with elements nested depth levels deep.
+func DeepNesting(depth int) Corpus {
+	var sb strings.Builder
+
+	sb.WriteString("#!{\n")
+	for i := 0; i < depth; i++ {
+		sb.WriteString("item{")
+	}
+
+	for i := 0; i < depth; i++ {
+		sb.WriteString("}")
+	}
+	sb.WriteString("\n}\n")
+
+	return Corpus{
+		Name: "DeepNesting" + strconv.Itoa(depth),
+		Text: []byte(sb.String()),
+	}
+}
+
+// WideChildren returns a G2 document with a single element that has count children.
+func WideChildren(count int) Corpus {
+	var sb strings.Builder
+
+	sb.WriteString("#!{\nlist{\n")
+	for i := 0; i < count; i++ {
+		sb.WriteString("\titem \"")
+		sb.WriteString(strconv.Itoa(i))
+		sb.WriteString("\",\n")
+	}
+	sb.WriteString("}\n}\n")
+
+	return Corpus{
+		Name: "WideChildren" + strconv.Itoa(count),
+		Text: []byte(sb.String()),
+	}
+}
+
+// AttributeHeavy returns a G1 document with count elements, each having attrs attributes.
+func AttributeHeavy(count, attrs int) Corpus {
+	var sb strings.Builder
+
+	for i := 0; i < count; i++ {
+		sb.WriteString("#route")
+		for j := 0; j < attrs; j++ {
+			sb.WriteString(" @key")
+			sb.WriteString(strconv.Itoa(j))
+			sb.WriteString("{value ")
+			sb.WriteString(strconv.Itoa(i))
+			sb.WriteString("}")
+		}
+		sb.WriteString("\n")
+	}
+
+	return Corpus{
+		Name: "AttributeHeavy" + strconv.Itoa(count) + "x" + strconv.Itoa(attrs),
+		Text: []byte(sb.String()),
+	}
+}
+
+// TextHeavy returns a G1 document consisting of paragraphs of prose, which is at least size bytes long.
+func TextHeavy(size int) Corpus {
+	const paragraph = "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor " +
+		"incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud " +
+		"exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat.\n"
+
+	var sb strings.Builder
+
+	sb.WriteString("#book {\n")
+	for sb.Len() < size {
+		sb.WriteString("#p {")
+		sb.WriteString(paragraph)
+		sb.WriteString("}\n")
+	}
+	sb.WriteString("}\n")
+
+	return Corpus{
+		Name: "TextHeavy" + strconv.Itoa(size),
+		Text: []byte(sb.String()),
+	}
+}
@@ -0,0 +1,15 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package bench contains representative Tadl corpora and benchmark helpers.
+// The benchmarks of this package can be run by downstream CI to track the parse
+// throughput and allocations of each release:
+//
+//  go test -run - -bench . -benchmem github.com/golangee/tadl/bench
+//
+// Regressions are gated by comparing results with a baseline. The allocations of parsing and lexing
+// are checked against testdata/baseline.json by the tests of this package, if the environment variable
+// TADL_ALLOCATION_GATE is set, and not with the race detector. Timings depend on the
+// machine, so CI measures them with Measure, keeps the results of a release with WriteResults
+// and fails, if Compare reports regressions of the next one.
+package bench
@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// Result is the measurement of a benchmark for a single corpus.
+type Result struct {
+	Name        string  `json:"name"`
+	NsPerOp     float64 `json:"nsPerOp,omitempty"`
+	BytesPerOp  float64 `json:"bytesPerOp,omitempty"`
+	AllocsPerOp float64 `json:"allocsPerOp"`
+}
+
+// Measure runs the benchmark function fn for each of the given corpora and returns the results.
+// The results of a release can be stored with WriteResults and compared with the ones of the
+// next release by Compare, so that CI fails on regressions.
+func Measure(corpora []Corpus, fn func(b *testing.B, corpus Corpus)) []Result {
+	results := make([]Result, 0, len(corpora))
+
+	for _, corpus := range corpora {
+		corpus := corpus
+
+		r := testing.Benchmark(func(b *testing.B) {
+			fn(b, corpus)
+		})
+
+		results = append(results, Result{
+			Name:        corpus.Name,
+			NsPerOp:     float64(r.NsPerOp()),
+			BytesPerOp:  float64(r.AllocedBytesPerOp()),
+			AllocsPerOp: float64(r.AllocsPerOp()),
+		})
+	}
+
+	return results
+}
+
+// Regression is a metric of a corpus, which got worse than its baseline.
+type Regression struct {
+	Name     string
+	Metric   string
+	Baseline float64
+	Current  float64
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s: %s increased from %.0f to %.0f (%+.1f%%)",
+		r.Name, r.Metric, r.Baseline, r.Current, (r.Current/r.Baseline-1)*100)
+}
+
+// Compare returns the metrics of current, which exceed the ones of the baseline with the same name
+// by more than tolerance, like 0.1 for 10%. Metrics, which are zero in either result, and corpora
+// without a baseline are not compared. Timings depend on the machine, so compare them only for
+// results measured on the same one.
+func Compare(baseline, current []Result, tolerance float64) []Regression {
+	base := make(map[string]Result, len(baseline))
+	for _, r := range baseline {
+		base[r.Name] = r
+	}
+
+	var regressions []Regression
+
+	for _, r := range current {
+		b, ok := base[r.Name]
+		if !ok {
+			continue
+		}
+
+		for _, m := range []struct {
+			metric            string
+			baseline, current float64
+		}{
+			{"ns/op", b.NsPerOp, r.NsPerOp},
+			{"B/op", b.BytesPerOp, r.BytesPerOp},
+			{"allocs/op", b.AllocsPerOp, r.AllocsPerOp},
+		} {
+			if m.baseline > 0 && m.current > 0 && m.current > m.baseline*(1+tolerance) {
+				regressions = append(regressions, Regression{
+					Name:     r.Name,
+					Metric:   m.metric,
+					Baseline: m.baseline,
+					Current:  m.current,
+				})
+			}
+		}
+	}
+
+	return regressions
+}
+
+// ReadResults reads results written by WriteResults.
+func ReadResults(r io.Reader) ([]Result, error) {
+	var results []Result
+	if err := json.NewDecoder(r).Decode(&results); err != nil {
+		return nil, fmt.Errorf("cannot read benchmark results: %w", err)
+	}
+
+	return results, nil
+}
+
+// WriteResults writes results as JSON, which can be kept as the baseline of the next release.
+func WriteResults(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(results)
+}
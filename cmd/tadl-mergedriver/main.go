@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Command tadl-mergedriver is a git merge driver, which merges tadl documents structurally
+// instead of line by line. See package merge for details.
+//
+// Usage:
+//
+//  tadl-mergedriver base.tadl ours.tadl theirs.tadl
+//
+// The merge result is written to ours.tadl. Conflicts are printed with the path of the
+// conflicting element and the driver exits with status 1, which lets git mark the file as
+// conflicted. The merged file contains our side of each conflict. If a file cannot be parsed,
+// the driver falls back to the line based "git merge-file".
+//
+// To use the driver, configure it in git:
+//
+//  # .gitattributes
+//  *.tadl merge=tadl
+//
+//  # .git/config
+//  [merge "tadl"]
+//  	name = structural tadl merge
+//  	driver = tadl-mergedriver %O %A %B
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/golangee/tadl/format"
+	"github.com/golangee/tadl/merge"
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/store"
+)
+
+// errConflicts is returned, if the merge was done but left conflicts.
+var errConflicts = errors.New("merge conflicts")
+
+func main() {
+	if len(os.Args) != 4 {
+		fmt.Fprintln(os.Stderr, "usage: tadl-mergedriver base.tadl ours.tadl theirs.tadl")
+		os.Exit(2)
+	}
+
+	base, ours, theirs := os.Args[1], os.Args[2], os.Args[3]
+
+	err := run(base, ours, theirs, os.Stderr)
+	switch {
+	case errors.Is(err, errConflicts):
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "tadl-mergedriver:", err, "- falling back to git merge-file")
+
+		cmd := exec.Command("git", "merge-file", ours, base, theirs)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// run merges the files and writes the result to the file ours.
+// Conflicts are written to w and reported as errConflicts.
+func run(base, ours, theirs string, w io.Writer) error {
+	baseDoc, _, err := parseFile(base)
+	if err != nil {
+		return err
+	}
+
+	ourDoc, _, err := parseFile(ours)
+	if err != nil {
+		return err
+	}
+
+	theirDoc, theirText, err := parseFile(theirs)
+	if err != nil {
+		return err
+	}
+
+	merged, conflicts := merge.Merge3(baseDoc.Root, ourDoc.Root, theirDoc.Root)
+
+	for _, conflict := range conflicts {
+		fmt.Fprintf(w, "%s: %s\n", ours, conflict)
+	}
+
+	// Keep the formatting of a side, if the merge result is identical to it.
+	switch store.Hash(merged) {
+	case store.Hash(ourDoc.Root):
+	case store.Hash(theirDoc.Root):
+		err = ioutil.WriteFile(ours, theirText, 0o644)
+	default:
+		var buf bytes.Buffer
+
+		ourDoc.Root = merged
+		if err = format.NewSerializer(&buf).SerializeDocument(ourDoc); err == nil {
+			err = ioutil.WriteFile(ours, buf.Bytes(), 0o644)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		return errConflicts
+	}
+
+	return nil
+}
+
+// parseFile reads and parses the file with the given name.
+func parseFile(name string) (*parser.Document, []byte, error) {
+	text, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := parser.NewParser(name, bytes.NewReader(text)).ParseDocument()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return doc, text, nil
+}
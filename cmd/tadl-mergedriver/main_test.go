@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		wantErr            error
+	}{
+		{
+			name:   "merged",
+			base:   `#!{a @k="v", b}`,
+			ours:   `#!{a @k="w", b}`,
+			theirs: "#!{\n  a @k=\"v\",\n  b,\n  c\n}",
+			want:   "#!{\n\ta @k=\"w\",\n\tb,\n\tc\n}\n",
+		},
+		{
+			name:   "theirs kept",
+			base:   `#!{a}`,
+			ours:   `#!{a}`,
+			theirs: "#!{\n  a,\n  b\n}",
+			want:   "#!{\n  a,\n  b\n}",
+		},
+		{
+			name:   "ours kept",
+			base:   `#!{a}`,
+			ours:   "#!{\n  a, b\n}",
+			theirs: "#!{\n  a\n}",
+			want:   "#!{\n  a, b\n}",
+		},
+		{
+			name:    "conflict",
+			base:    `#!{a @k="v"}`,
+			ours:    `#!{a @k="w"}`,
+			theirs:  `#!{a @k="x"}`,
+			want:    `#!{a @k="w"}`,
+			wantErr: errConflicts,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "tadl-mergedriver")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer os.RemoveAll(dir)
+
+			files := map[string]string{"base": tt.base, "ours": tt.ours, "theirs": tt.theirs}
+			for name, text := range files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var buf bytes.Buffer
+
+			err = run(filepath.Join(dir, "base"), filepath.Join(dir, "ours"), filepath.Join(dir, "theirs"), &buf)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v but got %v", tt.wantErr, err)
+			}
+
+			if tt.wantErr != nil && buf.Len() == 0 {
+				t.Error("expected conflicts to be reported")
+			}
+
+			got, err := ioutil.ReadFile(filepath.Join(dir, "ours"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRunSyntaxError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tadl-mergedriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "broken")
+	if err := ioutil.WriteFile(file, []byte(`#!{a`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run(file, file, file, &bytes.Buffer{}); err == nil || errors.Is(err, errConflicts) {
+		t.Errorf("expected syntax error but got %v", err)
+	}
+}
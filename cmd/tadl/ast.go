@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/viz"
+)
+
+// astCmd prints the parse tree of a file as JSON, see writeJSON, or as diagram, see package viz.
+func astCmd(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	format := flags.String("format", "json", "output format, json, dot or mermaid")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("ast requires exactly one file")
+	}
+
+	tree, err := parseFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		return writeJSON(w, tree)
+	case "dot":
+		_, err = io.WriteString(w, viz.Dot(tree))
+		return err
+	case "mermaid":
+		_, err = io.WriteString(w, viz.Mermaid(tree))
+		return err
+	default:
+		return fmt.Errorf("unknown format '%s', use json, dot or mermaid", *format)
+	}
+}
+
+// parseFile parses the file with the given name.
+func parseFile(name string) (*parser.TreeNode, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return parser.NewParser(name, f).Parse()
+}
+
+// jsonNode is the JSON representation of a parser.TreeNode.
+type jsonNode struct {
+	Name       string          `json:"name,omitempty"`
+	Text       *string         `json:"text,omitempty"`
+	Comment    *string         `json:"comment,omitempty"`
+	Attributes []jsonAttribute `json:"attributes,omitempty"`
+	Labels     []string        `json:"labels,omitempty"`
+	BlockType  string          `json:"blockType,omitempty"`
+	Begin      string          `json:"begin,omitempty"`
+	End        string          `json:"end,omitempty"`
+	Synthetic  bool            `json:"synthetic,omitempty"`
+	Children   []*jsonNode     `json:"children,omitempty"`
+}
+
+// jsonAttribute keeps the order of attributes, which a JSON object would not.
+type jsonAttribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// newJSONNode converts a tree into its JSON representation.
+func newJSONNode(node *parser.TreeNode) *jsonNode {
+	n := &jsonNode{
+		Name:      node.Name,
+		Text:      node.Text,
+		Comment:   node.Comment,
+		Labels:    node.Labels,
+		BlockType: string(node.BlockType),
+		Synthetic: node.IsSynthetic(),
+	}
+
+	if node.Range.BeginPos.Line > 0 {
+		n.Begin = node.Range.BeginPos.String()
+	}
+
+	if node.Range.EndPos.Line > 0 {
+		n.End = node.Range.EndPos.String()
+	}
+
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, value := node.Attributes.Get(i)
+		n.Attributes = append(n.Attributes, jsonAttribute{Key: *key, Value: *value})
+	}
+
+	for _, child := range node.Children {
+		n.Children = append(n.Children, newJSONNode(child))
+	}
+
+	return n
+}
+
+// writeJSON writes the tree as indented JSON.
+func writeJSON(w io.Writer, tree *parser.TreeNode) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(newJSONNode(tree))
+}
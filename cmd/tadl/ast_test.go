@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAst(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tadl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "doc.tadl")
+	if err := ioutil.WriteFile(file, []byte("#!{\n\tserver @id=\"1\" \"web\" {\n\t\tport \"80\"\n\t}\n}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "json",
+			args: []string{"ast", "-format", "json", file},
+			want: []string{
+				`"name": "server"`,
+				`"key": "id"`,
+				`"labels": [`,
+				`"text": "80"`,
+				`"begin": "` + file + `:2:2"`,
+			},
+		},
+		{
+			name: "json is default",
+			args: []string{"ast", file},
+			want: []string{`"name": "root"`},
+		},
+		{
+			name: "dot",
+			args: []string{"ast", "--format", "dot", file},
+			want: []string{
+				"digraph tadl {",
+				`n1 [label="server \"web\"{}\n@id=1"];`,
+				"n0 -> n1;",
+				`n3 [label="80", shape=box];`,
+			},
+		},
+		{
+			name: "mermaid",
+			args: []string{"ast", "-format", "mermaid", file},
+			want: []string{
+				"flowchart TD",
+				`n1["server #quot;web#quot;{}<br/>@id=1"]`,
+				"n0 --> n1",
+			},
+		},
+		{
+			name:    "unknown format",
+			args:    []string{"ast", "-format", "xml", file},
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			args:    []string{"ast"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown command",
+			args:    []string{"nope"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			err := run(tt.args, &buf)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, but did not get one")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("expected output to contain %s but got\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/golangee/tadl/format"
+	"github.com/golangee/tadl/parser"
+)
+
+// difftoolCmd prints a file in the canonical format of package format. Used as textconv
+// filter of git, diffs show changes of the tree instead of changes in formatting.
+func difftoolCmd(args []string, w io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("difftool requires exactly one file")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	doc, err := parser.NewParser(args[0], f).ParseDocument()
+	if err != nil {
+		return err
+	}
+
+	return format.NewSerializer(w).SerializeDocument(doc)
+}
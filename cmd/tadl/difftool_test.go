@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDifftool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tadl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	// Both files contain the same tree in a different format.
+	a := filepath.Join(dir, "a.tadl")
+	if err := ioutil.WriteFile(a, []byte(`#!@version{1} {server "web" {port "80"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	b := filepath.Join(dir, "b.tadl")
+	if err := ioutil.WriteFile(b, []byte("#!@version{1} {\n  server \"web\" {\n    port \"80\"\n  }\n}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var bufA, bufB bytes.Buffer
+	if err := run([]string{"difftool", a}, &bufA); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run([]string{"difftool", b}, &bufB); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "#!@version{1} {\n\tserver \"web\" {\n\t\tport \"80\"\n\t}\n}\n"
+	if bufA.String() != want || bufB.String() != want {
+		t.Errorf("expected %q but got %q and %q", want, bufA.String(), bufB.String())
+	}
+
+	if err := run([]string{"difftool"}, &bufA); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
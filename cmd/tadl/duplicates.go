@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/store"
+)
+
+// duplicatesCmd prints the subtrees, which appear in several of the given files, see store.Duplicates.
+func duplicatesCmd(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("duplicates", flag.ContinueOnError)
+	minSize := flags.Int("min", 10, "minimum number of nodes of a reported subtree")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() < 2 {
+		return fmt.Errorf("duplicates requires at least two files")
+	}
+
+	docs := map[string]*parser.TreeNode{}
+
+	for _, name := range flags.Args() {
+		tree, err := parseFile(name)
+		if err != nil {
+			return err
+		}
+
+		docs[name] = tree
+	}
+
+	for _, d := range store.Duplicates(docs, *minSize) {
+		fmt.Fprintf(w, "%s %s, %d nodes\n", d.Digest, d.Occurrences[0].Node.Name, d.Size)
+
+		for _, o := range d.Occurrences {
+			fmt.Fprintf(w, "\t%s\n", o.Node.Range.BeginPos)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDuplicates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tadl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.tadl")
+	if err := ioutil.WriteFile(a, []byte(`#!{db {host "localhost", port "5432"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	b := filepath.Join(dir, "b.tadl")
+	if err := ioutil.WriteFile(b, []byte("#!{\n\tname \"b\"\n\tdb {host \"localhost\", port \"5432\"}\n}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := run([]string{"duplicates", "-min", "3", a, b}, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], " db, 5 nodes") ||
+		lines[1] != "\t"+a+":1:4" || lines[2] != "\t"+b+":3:2" {
+		t.Errorf("unexpected report %q", buf.String())
+	}
+
+	if err := run([]string{"duplicates", a}, &buf); err == nil {
+		t.Error("expected error for a single file")
+	}
+}
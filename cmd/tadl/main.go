@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Command tadl provides tools to work with tadl documents.
+//
+// Usage:
+//
+//  tadl ast [-format json|dot|mermaid] file.tadl
+//  tadl difftool file.tadl
+//  tadl duplicates [-min 10] file.tadl...
+//
+// The ast command prints the parse tree of a document as JSON, as Graphviz DOT graph
+// or as Mermaid flowchart.
+//
+// The difftool command prints a document in canonical format. Configured as textconv
+// filter, git diffs only show changes of the tree and ignore changes in formatting:
+//
+//  # .gitattributes
+//  *.tadl diff=tadl
+//
+//  # .git/config
+//  [diff "tadl"]
+//  	textconv = tadl difftool
+//
+// The duplicates command prints the subtrees with at least -min nodes, which appear in several
+// of the given files. These are candidates to be extracted and referenced, see package store.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// commands maps the name of a subcommand to its implementation.
+// A command gets the arguments after its name and writes its result to w.
+var commands = map[string]func(args []string, w io.Writer) error{
+	"ast":        astCmd,
+	"difftool":   difftoolCmd,
+	"duplicates": duplicatesCmd,
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "tadl:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes the subcommand named by the first argument.
+func run(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command, available commands are %s", commandNames())
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command '%s', available commands are %s", args[0], commandNames())
+	}
+
+	return cmd(args[1:], w)
+}
+
+// commandNames returns a sorted list of all commands.
+func commandNames() string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,573 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	goparser "go/parser"
+	gotoken "go/token"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// decoderDirective annotates the structs, for which decoders are generated.
+const decoderDirective = "//tadl:decoder"
+
+// generatedHeader starts every generated file, so that it is skipped when generating again.
+const generatedHeader = "// Code generated by tadlgen; DO NOT EDIT.\n"
+
+// decoderHelpers are the functions used by the generated decoders. They follow the rules of
+// tadl.Unmarshal for finding elements and converting their text.
+const decoderHelpers = `
+// tadlChildren returns the elements of node with one of the given names.
+func tadlChildren(node *parser.TreeNode, names ...string) []*parser.TreeNode {
+	var children []*parser.TreeNode
+
+	for _, child := range node.Children {
+		for _, name := range names {
+			if child.IsNode() && child.Name == name {
+				children = append(children, child)
+
+				break
+			}
+		}
+	}
+
+	return children
+}
+
+// tadlAttribute returns the value of the first attribute of node with one of the given names as text node.
+func tadlAttribute(node *parser.TreeNode, names ...string) *parser.TreeNode {
+	for _, name := range names {
+		if i := node.Attributes.Index(name); i >= 0 {
+			_, value := node.Attributes.Get(i)
+			_, valueRange := node.Attributes.Range(i)
+
+			attribute := parser.NewStringNode(*value)
+			attribute.Parent, attribute.Range = node, valueRange
+
+			return attribute
+		}
+	}
+
+	return nil
+}
+
+// tadlString returns the text of node, concatenating all of its texts.
+func tadlString(node *parser.TreeNode) string {
+	if node.IsText() {
+		return *node.Text
+	}
+
+	var sb strings.Builder
+
+	for _, child := range node.Children {
+		if child.IsText() {
+			sb.WriteString(*child.Text)
+		}
+	}
+
+	return sb.String()
+}
+
+// tadlText returns the text of node, which is a number or boolean.
+func tadlText(node *parser.TreeNode) (string, error) {
+	switch {
+	case node.IsText():
+		return *node.Text, nil
+	case !node.IsNode():
+		return "", fmt.Errorf("%s: must be node or text-node", node.Range.BeginPos)
+	case len(node.Children) == 0:
+		return node.Name, nil
+	case len(node.Children) > 1:
+		return "", fmt.Errorf("%s: more than one child found", node.Range.BeginPos)
+	}
+
+	switch child := node.Children[0]; {
+	case child.IsText():
+		return *child.Text, nil
+	case child.IsNode() && len(child.Children) == 0:
+		return child.Name, nil
+	case child.IsNode():
+		return "", fmt.Errorf("%s: child must not have children", node.Range.BeginPos)
+	}
+
+	return "", fmt.Errorf("%s: child is not text", node.Range.BeginPos)
+}
+
+// tadlInt returns the integer of node.
+func tadlInt(node *parser.TreeNode, bits int, expected string) (int64, error) {
+	text, err := tadlText(node)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.ParseInt(strings.TrimSpace(text), 10, bits)
+	if err != nil {
+		return 0, tadlError(node, expected, text, err)
+	}
+
+	return i, nil
+}
+
+// tadlUint returns the unsigned integer of node.
+func tadlUint(node *parser.TreeNode, bits int, expected string) (uint64, error) {
+	text, err := tadlText(node)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.ParseUint(strings.TrimSpace(text), 10, bits)
+	if err != nil {
+		return 0, tadlError(node, expected, text, err)
+	}
+
+	return i, nil
+}
+
+// tadlFloat returns the float of node.
+func tadlFloat(node *parser.TreeNode, bits int, expected string) (float64, error) {
+	text, err := tadlText(node)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSpace(text), bits)
+	if err != nil {
+		return 0, tadlError(node, expected, text, err)
+	}
+
+	return f, nil
+}
+
+// tadlBool returns the boolean of node.
+func tadlBool(node *parser.TreeNode, expected string) (bool, error) {
+	text, err := tadlText(node)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := strconv.ParseBool(strings.TrimSpace(text))
+	if err != nil {
+		return false, tadlError(node, expected, text, err)
+	}
+
+	return b, nil
+}
+
+// tadlDuplicate returns the error for an element, which is repeated for a single value.
+func tadlDuplicate(node *parser.TreeNode, name string) error {
+	return fmt.Errorf("%s: cannot unmarshal into '%s', '%s' defined multiple times", node.Range.BeginPos, node.Name, name)
+}
+
+// tadlError returns a DecodeError for text of node, which cannot be converted into the expected type.
+func tadlError(node *parser.TreeNode, expected, text string, err error) error {
+	decodeErr := &tadl.DecodeError{
+		Pos:      node.Range.BeginPos,
+		Expected: expected,
+		Value:    text,
+		Err:      err,
+	}
+
+	if node.Name != "" {
+		decodeErr.NodePath = "/" + node.Name
+	}
+
+	return decodeErr
+}
+
+// tadlPrefix prepends field and the name of node to the paths of a DecodeError, which has been returned
+// while decoding field from a child of node.
+func tadlPrefix(err error, node *parser.TreeNode, field string) error {
+	var decodeErr *tadl.DecodeError
+	if !errors.As(err, &decodeErr) {
+		return err
+	}
+
+	if decodeErr.FieldPath != "" && !strings.HasPrefix(decodeErr.FieldPath, "[") {
+		field += "."
+	}
+
+	decodeErr.FieldPath = field + decodeErr.FieldPath
+	decodeErr.NodePath = "/" + node.Name + decodeErr.NodePath
+
+	return err
+}
+`
+
+// primitive describes how the text of an element is converted into a primitive Go type.
+type primitive struct {
+	// helper is the function converting a node, empty for strings.
+	helper string
+	bits   int
+}
+
+// primitives are the Go types which are decoded from text.
+var primitives = map[string]primitive{
+	"string":  {},
+	"bool":    {helper: "tadlBool"},
+	"int":     {helper: "tadlInt"},
+	"int8":    {helper: "tadlInt", bits: 8},
+	"int16":   {helper: "tadlInt", bits: 16},
+	"int32":   {helper: "tadlInt", bits: 32},
+	"int64":   {helper: "tadlInt", bits: 64},
+	"uint":    {helper: "tadlUint"},
+	"uint8":   {helper: "tadlUint", bits: 8},
+	"uint16":  {helper: "tadlUint", bits: 16},
+	"uint32":  {helper: "tadlUint", bits: 32},
+	"uint64":  {helper: "tadlUint", bits: 64},
+	"float32": {helper: "tadlFloat", bits: 32},
+	"float64": {helper: "tadlFloat", bits: 64},
+}
+
+// positionType is the name of the type tadl.Position, which is set to the range of the element.
+const positionType = "tadl.Position"
+
+// fieldType is the type of a field, which a decoder can be generated for.
+type fieldType struct {
+	// name is the name of a primitive type or an annotated struct.
+	name    string
+	pointer bool
+	slice   bool
+}
+
+// structDecl is a struct annotated with decoderDirective.
+type structDecl struct {
+	name   string
+	fields *ast.FieldList
+}
+
+// generator writes the decoders of a package.
+type generator struct {
+	buf bytes.Buffer
+	// decoders are the names of all annotated structs.
+	decoders map[string]bool
+}
+
+// generateDecoders returns the source of the decoders for the annotated structs in the package in dir.
+func generateDecoders(dir string) ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	fset := gotoken.NewFileSet()
+	pkg := ""
+
+	var structs []structDecl
+
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+
+		f, err := goparser.ParseFile(fset, file, nil, goparser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(f.Comments) > 0 && f.Comments[0].Pos() < f.Package && f.Comments[0].Text() == generatedHeader[3:] {
+			continue
+		}
+
+		pkg = f.Name.Name
+
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != gotoken.TYPE {
+				continue
+			}
+
+			for _, spec := range gen.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+
+				doc := typeSpec.Doc
+				if doc == nil && len(gen.Specs) == 1 {
+					doc = gen.Doc
+				}
+
+				if st, ok := typeSpec.Type.(*ast.StructType); ok && annotated(doc) {
+					structs = append(structs, structDecl{name: typeSpec.Name.Name, fields: st.Fields})
+				}
+			}
+		}
+	}
+
+	if len(structs) == 0 {
+		return nil, fmt.Errorf("no struct annotated with %s in %s", decoderDirective, dir)
+	}
+
+	g := &generator{decoders: map[string]bool{}}
+	for _, s := range structs {
+		g.decoders[s.name] = true
+	}
+
+	g.buf.WriteString(generatedHeader)
+	fmt.Fprintf(&g.buf, "\npackage %s\n\n", pkg)
+	g.buf.WriteString("import (\n\"errors\"\n\"fmt\"\n\"strconv\"\n\"strings\"\n\n" +
+		"\"github.com/golangee/tadl\"\n\"github.com/golangee/tadl/parser\"\n)\n")
+
+	for _, s := range structs {
+		if err := g.decoder(s); err != nil {
+			return nil, err
+		}
+	}
+
+	g.buf.WriteString(decoderHelpers)
+
+	return format.Source(g.buf.Bytes())
+}
+
+// annotated returns true, if doc contains decoderDirective.
+func annotated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == decoderDirective {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decoder writes the UnmarshalTadl method of s.
+func (g *generator) decoder(s structDecl) error {
+	var body bytes.Buffer
+
+	labels := false
+
+	for _, field := range s.fields.List {
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				continue
+			}
+
+			written, err := g.field(&body, ident.Name, field, &labels)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", s.name, ident.Name, err)
+			}
+
+			labels = labels || written
+		}
+	}
+
+	fmt.Fprintf(&g.buf, "\n// UnmarshalTadl decodes node into v like tadl.Unmarshal in non-strict mode.\n")
+	fmt.Fprintf(&g.buf, "func (v *%s) UnmarshalTadl(node *parser.TreeNode) error {\n", s.name)
+	g.buf.Write(bytes.TrimPrefix(body.Bytes(), []byte("\n")))
+	g.buf.WriteString("\nreturn nil\n}\n")
+
+	return nil
+}
+
+// field writes the statements decoding the field name into body. It returns true, if the
+// variable holding the remaining labels has been declared, which happens for the first label.
+func (g *generator) field(body *bytes.Buffer, name string, field *ast.Field, labels *bool) (bool, error) {
+	t, err := g.fieldType(field.Type)
+	if err != nil {
+		return false, err
+	}
+
+	elementName, kind := name, ""
+
+	var aliases []string
+
+	if field.Tag != nil {
+		tag, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return false, err
+		}
+
+		if tadlTag, ok := reflect.StructTag(tag).Lookup("tadl"); ok {
+			tags := strings.Split(tadlTag, ",")
+			if tags[0] != "" {
+				names := strings.Split(tags[0], "|")
+				elementName, aliases = names[0], names[1:]
+			}
+
+			if len(tags) > 1 {
+				kind = tags[1]
+			}
+		}
+	}
+
+	renamed := elementName != name || len(aliases) > 0
+	names := quoteAll(append([]string{elementName}, aliases...))
+	target := "v." + name
+
+	if t.name == positionType || kind == "pos" {
+		if t.name != positionType || kind != "" && kind != "pos" {
+			return false, fmt.Errorf("pos requires tadl.Position")
+		}
+
+		fmt.Fprintf(body, "\n%s = node.Range\n", target)
+
+		return false, nil
+	}
+
+	switch kind {
+	case "label":
+		declared := !*labels
+		if declared {
+			body.WriteString("\nlabels := node.Labels\n")
+		}
+
+		switch {
+		case t == fieldType{name: "string"}:
+			fmt.Fprintf(body, "if len(labels) > 0 {\n%s, labels = labels[0], labels[1:]\n}\n", target)
+		case t == fieldType{name: "string", slice: true}:
+			fmt.Fprintf(body, "if len(labels) > 0 {\n%s, labels = append([]string(nil), labels...), nil\n}\n", target)
+		default:
+			return false, fmt.Errorf("label requires string or []string")
+		}
+
+		return declared, nil
+	case "attr":
+		if t.slice || t.pointer || !g.isPrimitive(t) {
+			return false, fmt.Errorf("attribute requires a primitive type")
+		}
+
+		fmt.Fprintf(body, "\nif attribute := tadlAttribute(node, %s); attribute != nil {\n", names)
+		g.value(body, target, t, "attribute", strconv.Quote(name))
+		body.WriteString("}\n")
+	case "":
+		switch {
+		case t.slice && renamed:
+			fmt.Fprintf(body, "\nfor %s, child := range tadlChildren(node, %s) {\n", g.index(t), names)
+			g.element(body, target, t, name)
+			body.WriteString("}\n")
+		case t.slice:
+			fmt.Fprintf(body, "\nif children := tadlChildren(node, %s); len(children) > 0 {\n", names)
+			fmt.Fprintf(body, "for %s, child := range children[0].Children {\n", g.index(t))
+			g.element(body, target, t, name)
+			body.WriteString("}\n}\n")
+		case g.isPrimitive(t):
+			fmt.Fprintf(body, "\nif children := tadlChildren(node, %s); len(children) > 1 {\n", names)
+			fmt.Fprintf(body, "return tadlDuplicate(node, %q)\n", elementName)
+			body.WriteString("} else if len(children) == 1 {\n")
+			g.value(body, target, t, "children[0]", strconv.Quote(name))
+			body.WriteString("}\n")
+		default:
+			fmt.Fprintf(body, "\nif children := tadlChildren(node, %s); len(children) > 0 {\n", names)
+			g.value(body, target, t, "children[0]", strconv.Quote(name))
+			body.WriteString("}\n")
+		}
+	default:
+		return false, fmt.Errorf("tag '%s' is not supported", kind)
+	}
+
+	return false, nil
+}
+
+// element writes the statements appending the decoded child to the slice target.
+func (g *generator) element(body *bytes.Buffer, target string, t fieldType, name string) {
+	t.slice = false
+
+	if t.pointer {
+		fmt.Fprintf(body, "element := new(%s)\n", t.name)
+		t.pointer = false
+	} else {
+		fmt.Fprintf(body, "var element %s\n", t.name)
+	}
+
+	g.value(body, "element", t, "child", fmt.Sprintf("fmt.Sprintf(\"%s[%%d]\", i)", name))
+	fmt.Fprintf(body, "%s = append(%s, element)\n", target, target)
+}
+
+// value writes the statements decoding node into target of type t. Errors get the field path.
+func (g *generator) value(body *bytes.Buffer, target string, t fieldType, node, path string) {
+	p, ok := primitives[t.name]
+
+	switch {
+	case ok && p.helper == "":
+		fmt.Fprintf(body, "%s = tadlString(%s)\n", target, node)
+	case ok && t.name == "bool":
+		fmt.Fprintf(body, "value, err := %s(%s, %q)\n", p.helper, node, t.name)
+		fmt.Fprintf(body, "if err != nil {\nreturn tadlPrefix(err, node, %s)\n}\n", path)
+		fmt.Fprintf(body, "%s = value\n", target)
+	case ok:
+		fmt.Fprintf(body, "value, err := %s(%s, %d, %q)\n", p.helper, node, p.bits, t.name)
+		fmt.Fprintf(body, "if err != nil {\nreturn tadlPrefix(err, node, %s)\n}\n", path)
+
+		if t.name == "int64" || t.name == "uint64" || t.name == "float64" {
+			fmt.Fprintf(body, "%s = value\n", target)
+		} else {
+			fmt.Fprintf(body, "%s = %s(value)\n", target, t.name)
+		}
+	default:
+		if t.pointer {
+			fmt.Fprintf(body, "if %s == nil {\n%s = new(%s)\n}\n", target, target, t.name)
+		}
+
+		fmt.Fprintf(body, "if err := %s.UnmarshalTadl(%s); err != nil {\nreturn tadlPrefix(err, node, %s)\n}\n", target, node, path)
+	}
+}
+
+// index returns the name of the index variable when iterating the elements of a slice of type t,
+// which is only used in the field path of errors.
+func (g *generator) index(t fieldType) string {
+	if t.name == "string" {
+		return "_"
+	}
+
+	return "i"
+}
+
+// isPrimitive returns true, if t is decoded from text.
+func (g *generator) isPrimitive(t fieldType) bool {
+	_, ok := primitives[t.name]
+
+	return ok
+}
+
+// fieldType returns the type of a field, which must be a primitive type, an annotated struct,
+// a pointer to an annotated struct or a slice of those.
+func (g *generator) fieldType(expr ast.Expr) (fieldType, error) {
+	var t fieldType
+
+	if array, ok := expr.(*ast.ArrayType); ok && array.Len == nil {
+		t.slice = true
+		expr = array.Elt
+	}
+
+	if star, ok := expr.(*ast.StarExpr); ok {
+		t.pointer = true
+		expr = star.X
+	}
+
+	// A tadl.Position is set to the range of the element.
+	if sel, ok := expr.(*ast.SelectorExpr); ok && !t.slice && !t.pointer {
+		if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "tadl" && sel.Sel.Name == "Position" {
+			return fieldType{name: positionType}, nil
+		}
+	}
+
+	if ident, ok := expr.(*ast.Ident); ok {
+		t.name = ident.Name
+
+		_, primitive := primitives[t.name]
+		if primitive && !t.pointer || g.decoders[t.name] {
+			return t, nil
+		}
+	}
+
+	return t, fmt.Errorf("type is not supported, use a primitive type or a struct annotated with %s", decoderDirective)
+}
+
+// quoteAll returns the quoted names separated by commas.
+func quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strconv.Quote(name)
+	}
+
+	return strings.Join(quoted, ", ")
+}
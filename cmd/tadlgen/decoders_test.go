@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateDecodersUpToDate(t *testing.T) {
+	dir := filepath.Join("internal", "example")
+
+	got, err := generateDecoders(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := os.ReadFile(filepath.Join(dir, "tadl_decoders.gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s is outdated, run go generate", filepath.Join(dir, "tadl_decoders.gen.go"))
+	}
+}
+
+func TestGenerateDecodersErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "no annotated struct",
+			src:  "type Config struct {\n\tName string\n}\n",
+			want: "no struct annotated with //tadl:decoder",
+		},
+		{
+			name: "map field",
+			src:  "//tadl:decoder\ntype Config struct {\n\tEnv map[string]string\n}\n",
+			want: "Config.Env: type is not supported",
+		},
+		{
+			name: "struct without decoder",
+			src:  "//tadl:decoder\ntype Config struct {\n\tServer Server\n}\n\ntype Server struct{}\n",
+			want: "Config.Server: type is not supported",
+		},
+		{
+			name: "inner tag",
+			src:  "//tadl:decoder\ntype Config struct {\n\tName string `tadl:\",inner\"`\n}\n",
+			want: "Config.Name: tag 'inner' is not supported",
+		},
+		{
+			name: "attribute of struct",
+			src:  "//tadl:decoder\ntype Config struct {\n\tSub *Config `tadl:\"sub,attr\"`\n}\n",
+			want: "Config.Sub: attribute requires a primitive type",
+		},
+		{
+			name: "pos of string",
+			src:  "//tadl:decoder\ntype Config struct {\n\tPos string `tadl:\",pos\"`\n}\n",
+			want: "Config.Pos: pos requires tadl.Position",
+		},
+		{
+			name: "integer label",
+			src:  "//tadl:decoder\ntype Config struct {\n\tID int `tadl:\",label\"`\n}\n",
+			want: "Config.ID: label requires string or []string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			src := "package config\n\n" + tt.src
+			if err := os.WriteFile(filepath.Join(dir, "config.go"), []byte(src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := generateDecoders(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error '%s' but got '%v'", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+
+	src := "package config\n\n//tadl:decoder\ntype Config struct {\n\tName string `tadl:\"name\"`\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := run([]string{dir}, &out); err == nil {
+		t.Error("expected error without -decoders")
+	}
+
+	// Generating twice must skip the generated file.
+	for i := 0; i < 2; i++ {
+		if err := run([]string{"-decoders", dir}, &out); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "tadl_decoders.gen.go")); err != nil {
+		t.Error(err)
+	}
+}
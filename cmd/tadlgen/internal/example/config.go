@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package example contains structs with generated decoders, which are compared with tadl.Unmarshal.
+package example
+
+import "github.com/golangee/tadl"
+
+//go:generate go run github.com/golangee/tadl/cmd/tadlgen -decoders
+
+//tadl:decoder
+type Config struct {
+	Name    string   `tadl:",label"`
+	Debug   bool     `tadl:"debug"`
+	Workers uint8    `tadl:"workers"`
+	Ratio   float64  `tadl:"ratio"`
+	Timeout int64    `tadl:"timeout|timeout_ms"`
+	Hosts   []string `tadl:"host"`
+	Servers []Server `tadl:"server"`
+	Admin   *User    `tadl:"admin"`
+	Users   []*User
+	comment string
+}
+
+//tadl:decoder
+type Server struct {
+	Pos    tadl.Position
+	Name   string `tadl:",label"`
+	Port   int    `tadl:"port"`
+	Zone   string `tadl:"zone|region,attr"`
+	Weight uint16 `tadl:"weight,attr"`
+}
+
+//tadl:decoder
+type User struct {
+	Labels []string `tadl:",label"`
+	Mail   string   `tadl:"mail"`
+	Level  int32    `tadl:"level"`
+}
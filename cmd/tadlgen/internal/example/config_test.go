@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package example
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl"
+	"github.com/golangee/tadl/parser"
+)
+
+func parse(t *testing.T, text string) *parser.TreeNode {
+	t.Helper()
+
+	tree, err := parser.NewParser("", strings.NewReader(text)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tree
+}
+
+func TestUnmarshalTadl(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "empty",
+			text: `#!{}`,
+		},
+		{
+			name: "primitives",
+			text: `#!{
+				debug true,
+				workers 8,
+				ratio "0.5",
+				timeout 250,
+			}`,
+		},
+		{
+			name: "alias",
+			text: `#!{timeout_ms 250}`,
+		},
+		{
+			name: "slices",
+			text: `#!{
+				host "a.example.com",
+				host "b.example.com",
+				server "primary" {port 8080},
+				server "backup" {port 8081},
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want Config
+			if err := tadl.Unmarshal(strings.NewReader(tt.text), &want, false); err != nil {
+				t.Fatal(err)
+			}
+
+			var got Config
+			if err := got.UnmarshalTadl(parse(t, tt.text)); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %+v but got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestUnmarshalTadlPointersAndAttributes(t *testing.T) {
+	text := `#!{
+		server @region="eu" @weight="10" "primary" {port 8080},
+		admin "root" "local" {mail "root@example.com", level 3},
+		Users {
+			user "alice" {level 1}
+			user "bob" {mail "bob@example.com"}
+		}
+	}`
+
+	var got Config
+	if err := got.UnmarshalTadl(parse(t, text)); err != nil {
+		t.Fatal(err)
+	}
+
+	if pos := got.Servers[0].Pos.BeginPos.String(); pos != ":2:3" {
+		t.Errorf("expected server at ':2:3' but got '%s'", pos)
+	}
+
+	got.Servers[0].Pos = tadl.Position{}
+
+	want := Config{
+		Admin:   &User{Labels: []string{"root", "local"}, Mail: "root@example.com", Level: 3},
+		Users:   []*User{{Labels: []string{"alice"}, Level: 1}, {Labels: []string{"bob"}, Mail: "bob@example.com"}},
+		Servers: []Server{{Name: "primary", Port: 8080, Zone: "eu", Weight: 10}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+}
+
+func TestUnmarshalTadlErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		want      string
+		fieldPath string
+	}{
+		{
+			name:      "invalid integer",
+			text:      `#!{server "web" {port http}}`,
+			want:      ":1:18: cannot decode 'http' at '/root/server/port' into field 'Servers[0].Port' of type int: strconv.ParseInt: parsing \"http\": invalid syntax",
+			fieldPath: "Servers[0].Port",
+		},
+		{
+			name:      "invalid nested integer",
+			text:      `#!{admin {level "high"}}`,
+			fieldPath: "Admin.Level",
+		},
+		{
+			name:      "invalid attribute",
+			text:      `#!{server @weight="heavy"}`,
+			want:      ":1:19: cannot decode 'heavy' at '/root/server' into field 'Servers[0].Weight' of type uint16: strconv.ParseUint: parsing \"heavy\": invalid syntax",
+			fieldPath: "Servers[0].Weight",
+		},
+		{
+			name: "duplicate",
+			text: `#!{debug true, debug false}`,
+			want: ":1:1: cannot unmarshal into 'root', 'debug' defined multiple times",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+
+			err := config.UnmarshalTadl(parse(t, tt.text))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+
+			if tt.want != "" && err.Error() != tt.want {
+				t.Errorf("expected error '%s' but got '%s'", tt.want, err)
+			}
+
+			var decodeErr *tadl.DecodeError
+			if errors.As(err, &decodeErr) != (tt.fieldPath != "") {
+				t.Fatalf("unexpected error type %T", err)
+			}
+
+			if decodeErr != nil && decodeErr.FieldPath != tt.fieldPath {
+				t.Errorf("expected field path '%s' but got '%s'", tt.fieldPath, decodeErr.FieldPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+// Code generated by tadlgen; DO NOT EDIT.
+
+package example
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golangee/tadl"
+	"github.com/golangee/tadl/parser"
+)
+
+// UnmarshalTadl decodes node into v like tadl.Unmarshal in non-strict mode.
+func (v *Config) UnmarshalTadl(node *parser.TreeNode) error {
+	labels := node.Labels
+	if len(labels) > 0 {
+		v.Name, labels = labels[0], labels[1:]
+	}
+
+	if children := tadlChildren(node, "debug"); len(children) > 1 {
+		return tadlDuplicate(node, "debug")
+	} else if len(children) == 1 {
+		value, err := tadlBool(children[0], "bool")
+		if err != nil {
+			return tadlPrefix(err, node, "Debug")
+		}
+		v.Debug = value
+	}
+
+	if children := tadlChildren(node, "workers"); len(children) > 1 {
+		return tadlDuplicate(node, "workers")
+	} else if len(children) == 1 {
+		value, err := tadlUint(children[0], 8, "uint8")
+		if err != nil {
+			return tadlPrefix(err, node, "Workers")
+		}
+		v.Workers = uint8(value)
+	}
+
+	if children := tadlChildren(node, "ratio"); len(children) > 1 {
+		return tadlDuplicate(node, "ratio")
+	} else if len(children) == 1 {
+		value, err := tadlFloat(children[0], 64, "float64")
+		if err != nil {
+			return tadlPrefix(err, node, "Ratio")
+		}
+		v.Ratio = value
+	}
+
+	if children := tadlChildren(node, "timeout", "timeout_ms"); len(children) > 1 {
+		return tadlDuplicate(node, "timeout")
+	} else if len(children) == 1 {
+		value, err := tadlInt(children[0], 64, "int64")
+		if err != nil {
+			return tadlPrefix(err, node, "Timeout")
+		}
+		v.Timeout = value
+	}
+
+	for _, child := range tadlChildren(node, "host") {
+		var element string
+		element = tadlString(child)
+		v.Hosts = append(v.Hosts, element)
+	}
+
+	for i, child := range tadlChildren(node, "server") {
+		var element Server
+		if err := element.UnmarshalTadl(child); err != nil {
+			return tadlPrefix(err, node, fmt.Sprintf("Servers[%d]", i))
+		}
+		v.Servers = append(v.Servers, element)
+	}
+
+	if children := tadlChildren(node, "admin"); len(children) > 0 {
+		if v.Admin == nil {
+			v.Admin = new(User)
+		}
+		if err := v.Admin.UnmarshalTadl(children[0]); err != nil {
+			return tadlPrefix(err, node, "Admin")
+		}
+	}
+
+	if children := tadlChildren(node, "Users"); len(children) > 0 {
+		for i, child := range children[0].Children {
+			element := new(User)
+			if err := element.UnmarshalTadl(child); err != nil {
+				return tadlPrefix(err, node, fmt.Sprintf("Users[%d]", i))
+			}
+			v.Users = append(v.Users, element)
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalTadl decodes node into v like tadl.Unmarshal in non-strict mode.
+func (v *Server) UnmarshalTadl(node *parser.TreeNode) error {
+	v.Pos = node.Range
+
+	labels := node.Labels
+	if len(labels) > 0 {
+		v.Name, labels = labels[0], labels[1:]
+	}
+
+	if children := tadlChildren(node, "port"); len(children) > 1 {
+		return tadlDuplicate(node, "port")
+	} else if len(children) == 1 {
+		value, err := tadlInt(children[0], 0, "int")
+		if err != nil {
+			return tadlPrefix(err, node, "Port")
+		}
+		v.Port = int(value)
+	}
+
+	if attribute := tadlAttribute(node, "zone", "region"); attribute != nil {
+		v.Zone = tadlString(attribute)
+	}
+
+	if attribute := tadlAttribute(node, "weight"); attribute != nil {
+		value, err := tadlUint(attribute, 16, "uint16")
+		if err != nil {
+			return tadlPrefix(err, node, "Weight")
+		}
+		v.Weight = uint16(value)
+	}
+
+	return nil
+}
+
+// UnmarshalTadl decodes node into v like tadl.Unmarshal in non-strict mode.
+func (v *User) UnmarshalTadl(node *parser.TreeNode) error {
+	labels := node.Labels
+	if len(labels) > 0 {
+		v.Labels, labels = append([]string(nil), labels...), nil
+	}
+
+	if children := tadlChildren(node, "mail"); len(children) > 1 {
+		return tadlDuplicate(node, "mail")
+	} else if len(children) == 1 {
+		v.Mail = tadlString(children[0])
+	}
+
+	if children := tadlChildren(node, "level"); len(children) > 1 {
+		return tadlDuplicate(node, "level")
+	} else if len(children) == 1 {
+		value, err := tadlInt(children[0], 32, "int32")
+		if err != nil {
+			return tadlPrefix(err, node, "Level")
+		}
+		v.Level = int32(value)
+	}
+
+	return nil
+}
+
+// tadlChildren returns the elements of node with one of the given names.
+func tadlChildren(node *parser.TreeNode, names ...string) []*parser.TreeNode {
+	var children []*parser.TreeNode
+
+	for _, child := range node.Children {
+		for _, name := range names {
+			if child.IsNode() && child.Name == name {
+				children = append(children, child)
+
+				break
+			}
+		}
+	}
+
+	return children
+}
+
+// tadlAttribute returns the value of the first attribute of node with one of the given names as text node.
+func tadlAttribute(node *parser.TreeNode, names ...string) *parser.TreeNode {
+	for _, name := range names {
+		if i := node.Attributes.Index(name); i >= 0 {
+			_, value := node.Attributes.Get(i)
+			_, valueRange := node.Attributes.Range(i)
+
+			attribute := parser.NewStringNode(*value)
+			attribute.Parent, attribute.Range = node, valueRange
+
+			return attribute
+		}
+	}
+
+	return nil
+}
+
+// tadlString returns the text of node, concatenating all of its texts.
+func tadlString(node *parser.TreeNode) string {
+	if node.IsText() {
+		return *node.Text
+	}
+
+	var sb strings.Builder
+
+	for _, child := range node.Children {
+		if child.IsText() {
+			sb.WriteString(*child.Text)
+		}
+	}
+
+	return sb.String()
+}
+
+// tadlText returns the text of node, which is a number or boolean.
+func tadlText(node *parser.TreeNode) (string, error) {
+	switch {
+	case node.IsText():
+		return *node.Text, nil
+	case !node.IsNode():
+		return "", fmt.Errorf("%s: must be node or text-node", node.Range.BeginPos)
+	case len(node.Children) == 0:
+		return node.Name, nil
+	case len(node.Children) > 1:
+		return "", fmt.Errorf("%s: more than one child found", node.Range.BeginPos)
+	}
+
+	switch child := node.Children[0]; {
+	case child.IsText():
+		return *child.Text, nil
+	case child.IsNode() && len(child.Children) == 0:
+		return child.Name, nil
+	case child.IsNode():
+		return "", fmt.Errorf("%s: child must not have children", node.Range.BeginPos)
+	}
+
+	return "", fmt.Errorf("%s: child is not text", node.Range.BeginPos)
+}
+
+// tadlInt returns the integer of node.
+func tadlInt(node *parser.TreeNode, bits int, expected string) (int64, error) {
+	text, err := tadlText(node)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.ParseInt(strings.TrimSpace(text), 10, bits)
+	if err != nil {
+		return 0, tadlError(node, expected, text, err)
+	}
+
+	return i, nil
+}
+
+// tadlUint returns the unsigned integer of node.
+func tadlUint(node *parser.TreeNode, bits int, expected string) (uint64, error) {
+	text, err := tadlText(node)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.ParseUint(strings.TrimSpace(text), 10, bits)
+	if err != nil {
+		return 0, tadlError(node, expected, text, err)
+	}
+
+	return i, nil
+}
+
+// tadlFloat returns the float of node.
+func tadlFloat(node *parser.TreeNode, bits int, expected string) (float64, error) {
+	text, err := tadlText(node)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSpace(text), bits)
+	if err != nil {
+		return 0, tadlError(node, expected, text, err)
+	}
+
+	return f, nil
+}
+
+// tadlBool returns the boolean of node.
+func tadlBool(node *parser.TreeNode, expected string) (bool, error) {
+	text, err := tadlText(node)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := strconv.ParseBool(strings.TrimSpace(text))
+	if err != nil {
+		return false, tadlError(node, expected, text, err)
+	}
+
+	return b, nil
+}
+
+// tadlDuplicate returns the error for an element, which is repeated for a single value.
+func tadlDuplicate(node *parser.TreeNode, name string) error {
+	return fmt.Errorf("%s: cannot unmarshal into '%s', '%s' defined multiple times", node.Range.BeginPos, node.Name, name)
+}
+
+// tadlError returns a DecodeError for text of node, which cannot be converted into the expected type.
+func tadlError(node *parser.TreeNode, expected, text string, err error) error {
+	decodeErr := &tadl.DecodeError{
+		Pos:      node.Range.BeginPos,
+		Expected: expected,
+		Value:    text,
+		Err:      err,
+	}
+
+	if node.Name != "" {
+		decodeErr.NodePath = "/" + node.Name
+	}
+
+	return decodeErr
+}
+
+// tadlPrefix prepends field and the name of node to the paths of a DecodeError, which has been returned
+// while decoding field from a child of node.
+func tadlPrefix(err error, node *parser.TreeNode, field string) error {
+	var decodeErr *tadl.DecodeError
+	if !errors.As(err, &decodeErr) {
+		return err
+	}
+
+	if decodeErr.FieldPath != "" && !strings.HasPrefix(decodeErr.FieldPath, "[") {
+		field += "."
+	}
+
+	decodeErr.FieldPath = field + decodeErr.FieldPath
+	decodeErr.NodePath = "/" + node.Name + decodeErr.NodePath
+
+	return err
+}
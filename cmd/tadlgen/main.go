@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Command tadlgen generates code for working with tadl documents.
+//
+// Usage:
+//
+//  tadlgen -decoders [-o file] [dir]
+//
+// With -decoders, an UnmarshalTadl method is generated for every struct of the package in dir,
+// which is annotated with a //tadl:decoder comment. The method decodes an element into the struct
+// like tadl.Unmarshal in non-strict mode, but without reflection, which makes it several times faster.
+// The output is written to tadl_decoders.gen.go in dir, unless -o is given. Use it with go generate:
+//
+//  //go:generate tadlgen -decoders
+//
+//  //tadl:decoder
+//  type Server struct {
+//  	Name  string   `tadl:",label"`
+//  	Port  int      `tadl:"port"`
+//  	Hosts []string `tadl:"host"`
+//  }
+//
+//  tree, err := parser.NewParser("server.tadl", r).Parse()
+//  ...
+//  var server Server
+//  err = server.UnmarshalTadl(tree)
+//
+// Fields may be of the primitive types supported by tadl.Unmarshal, of annotated structs, pointers to
+// annotated structs and slices of those. The tags rename, attr, label, pos and aliases are supported,
+// fields of type tadl.Position are set to the range of the element. Other fields are reported as error.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "tadlgen:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the arguments and writes the generated code.
+func run(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("tadlgen", flag.ContinueOnError)
+	flags.SetOutput(w)
+
+	decoders := flags.Bool("decoders", false, "generate UnmarshalTadl methods for structs annotated with //tadl:decoder")
+	out := flags.String("o", "", "output file, tadl_decoders.gen.go in the package directory by default")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if !*decoders {
+		return fmt.Errorf("nothing to generate, use -decoders")
+	}
+
+	dir := "."
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+
+	src, err := generateDecoders(dir)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		*out = filepath.Join(dir, "tadl_decoders.gen.go")
+	}
+
+	return os.WriteFile(*out, src, 0o644)
+}
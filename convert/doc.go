@@ -0,0 +1,19 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package convert translates Tadl trees from and to other configuration formats.
+//
+// Mappings become elements with a {} block, where each key is a child element.
+// Keys starting with AttributePrefix are attributes of the element and the key TextKey holds
+// text that is mixed with child elements. Sequences become elements with a () block,
+// where each item is a child element named ItemName. Scalars become text.
+package convert
+
+const (
+	// AttributePrefix marks a key as an attribute of the surrounding element.
+	AttributePrefix = "@"
+	// TextKey is the key for text of elements, which also have attributes or child elements.
+	TextKey = "#text"
+	// ItemName is the element name for items of a sequence.
+	ItemName = "item"
+)
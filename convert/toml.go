@@ -0,0 +1,431 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/golangee/tadl/parser"
+)
+
+// FromTOML reads a TOML document and returns it as a tree.
+// Tables become elements with a {} block and every table of an array of tables becomes
+// a sibling element with the name of the array. Other arrays are sequences.
+// Keys keep the order of the document, except for keys of inline tables in arrays,
+// which are sorted.
+func FromTOML(r io.Reader) (*parser.TreeNode, error) {
+	var doc map[string]interface{}
+
+	meta, err := toml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode toml: %w", err)
+	}
+
+	t := tomlConverter{order: map[string]int{}}
+	for i, key := range meta.Keys() {
+		if _, ok := t.order[key.String()]; !ok {
+			t.order[key.String()] = i
+		}
+	}
+
+	root := parser.NewNode("root").Block(parser.BlockNormal)
+	if err := t.table(root, nil, doc); err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// tomlConverter knows the position of every key in the document.
+type tomlConverter struct {
+	order map[string]int
+}
+
+// keys returns the keys of table in the order of the document.
+func (t tomlConverter) keys(path toml.Key, table map[string]interface{}) []string {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+
+	position := func(key string) int {
+		if i, ok := t.order[append(path[:len(path):len(path)], key).String()]; ok {
+			return i
+		}
+
+		return len(t.order)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := position(keys[i]), position(keys[j])
+		if pi != pj {
+			return pi < pj
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
+
+// table adds the keys of table to target.
+func (t tomlConverter) table(target *parser.TreeNode, path toml.Key, table map[string]interface{}) error {
+	for _, key := range t.keys(path, table) {
+		value := table[key]
+		text, scalar := tomlScalar(value)
+
+		switch {
+		case key == TextKey && scalar:
+			target.AddChildren(parser.NewStringNode(text))
+		case strings.HasPrefix(key, AttributePrefix) && scalar:
+			target.AddAttribute(strings.TrimPrefix(key, AttributePrefix), text)
+		default:
+			if err := t.value(target, append(path[:len(path):len(path)], key), key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// value adds value as a child element named name to target.
+func (t tomlConverter) value(target *parser.TreeNode, path toml.Key, name string, value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		child := parser.NewNode(name).Block(parser.BlockNormal)
+		if err := t.table(child, path, v); err != nil {
+			return err
+		}
+
+		target.AddChildren(child)
+	case []map[string]interface{}:
+		for _, table := range v {
+			child := parser.NewNode(name).Block(parser.BlockNormal)
+			if err := t.table(child, path, table); err != nil {
+				return err
+			}
+
+			target.AddChildren(child)
+		}
+	case []interface{}:
+		child := parser.NewNode(name).Block(parser.BlockGroup)
+
+		for _, item := range v {
+			if err := t.value(child, path, ItemName, item); err != nil {
+				return err
+			}
+		}
+
+		target.AddChildren(child)
+	default:
+		text, ok := tomlScalar(value)
+		if !ok {
+			return fmt.Errorf("key '%s' has unsupported type %T", path, value)
+		}
+
+		target.AddChildren(parser.NewNode(name).AddChildren(parser.NewStringNode(text)))
+	}
+
+	return nil
+}
+
+// tomlScalar returns the text of a decoded scalar value.
+func tomlScalar(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case time.Time:
+		return v.Format(time.RFC3339Nano), true
+	default:
+		return "", false
+	}
+}
+
+// ToTOML writes tree as a TOML document to w.
+// Elements with attributes or child elements are written as tables, elements sharing a name
+// and elements with a () block containing tables are written as arrays of tables.
+// All other elements are written as key/value pairs and repeated ones are collected into an array.
+// Text that looks like a TOML number, boolean or date is written unquoted, because text in
+// Tadl has no type. Comments are dropped.
+func ToTOML(w io.Writer, tree *parser.TreeNode) error {
+	if tree.BlockType == parser.BlockGroup {
+		return fmt.Errorf("element '%s' is a sequence and cannot be written as a toml document", tree.Name)
+	}
+
+	bw := bufio.NewWriter(w)
+	e := tomlEncoder{w: bw}
+
+	if err := e.table(nil, tree); err != nil {
+		return err
+	}
+
+	if e.err != nil {
+		return e.err
+	}
+
+	return bw.Flush()
+}
+
+// tomlEncoder writes tables and remembers the first write error.
+type tomlEncoder struct {
+	w   *bufio.Writer
+	err error
+	// started is true after the first line has been written.
+	started bool
+}
+
+func (e *tomlEncoder) printf(format string, args ...interface{}) {
+	if e.err == nil {
+		_, e.err = fmt.Fprintf(e.w, format, args...)
+	}
+
+	e.started = true
+}
+
+// tomlGroup holds all child elements of a table with the same name.
+type tomlGroup struct {
+	name     string
+	elements []*parser.TreeNode
+}
+
+// table writes the keys of node, followed by its sub tables.
+func (e *tomlEncoder) table(path []string, node *parser.TreeNode) error {
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, value := node.Attributes.Get(i)
+		e.printf("%s = %s\n", tomlKey(AttributePrefix+*key), tomlQuote(*value))
+	}
+
+	var (
+		text   strings.Builder
+		groups []*tomlGroup
+	)
+
+	index := map[string]*tomlGroup{}
+
+	for _, child := range node.Children {
+		switch {
+		case child.IsText():
+			text.WriteString(*child.Text)
+		case child.IsNode():
+			group, ok := index[child.Name]
+			if !ok {
+				group = &tomlGroup{name: child.Name}
+				index[child.Name] = group
+				groups = append(groups, group)
+			}
+
+			group.elements = append(group.elements, child)
+		}
+	}
+
+	if trimmed := strings.TrimSpace(text.String()); trimmed != "" {
+		e.printf("%s = %s\n", tomlKey(TextKey), tomlQuote(trimmed))
+	}
+
+	var tables []*tomlGroup
+
+	for _, group := range groups {
+		if !allValues(group.elements) {
+			tables = append(tables, group)
+			continue
+		}
+
+		if len(group.elements) == 1 {
+			e.printf("%s = %s\n", tomlKey(group.name), tomlValue(group.elements[0]))
+			continue
+		}
+
+		values := make([]string, 0, len(group.elements))
+		for _, element := range group.elements {
+			values = append(values, tomlValue(element))
+		}
+
+		e.printf("%s = [%s]\n", tomlKey(group.name), strings.Join(values, ", "))
+	}
+
+	for _, group := range tables {
+		sub := append(path[:len(path):len(path)], tomlKey(group.name))
+		elements := group.elements
+		array := len(elements) > 1
+
+		if !array && elements[0].BlockType == parser.BlockGroup {
+			array = true
+			elements = nil
+
+			for _, item := range group.elements[0].Children {
+				if item.IsNode() {
+					elements = append(elements, item)
+				}
+			}
+		}
+
+		for _, element := range elements {
+			if element.BlockType == parser.BlockGroup {
+				return fmt.Errorf("element '%s' is a sequence of tables and cannot be nested into another array", element.Name)
+			}
+
+			if e.started {
+				e.printf("\n")
+			}
+
+			if array {
+				e.printf("[[%s]]\n", strings.Join(sub, "."))
+			} else {
+				e.printf("[%s]\n", strings.Join(sub, "."))
+			}
+
+			if err := e.table(sub, element); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// allValues returns true if all elements can be written as a value.
+func allValues(elements []*parser.TreeNode) bool {
+	for _, element := range elements {
+		if !isValue(element) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isValue returns true if node has no attributes and either contains only text
+// or is a () block of values.
+func isValue(node *parser.TreeNode) bool {
+	if node.Attributes.Len() > 0 {
+		return false
+	}
+
+	for _, child := range node.Children {
+		if child.IsNode() && (node.BlockType != parser.BlockGroup || !isValue(child)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tomlValue returns the value of an element, see isValue.
+func tomlValue(node *parser.TreeNode) string {
+	if node.BlockType == parser.BlockGroup {
+		var values []string
+
+		for _, child := range node.Children {
+			switch {
+			case child.IsNode():
+				values = append(values, tomlValue(child))
+			case child.IsText():
+				if text := strings.TrimSpace(*child.Text); text != "" {
+					values = append(values, tomlLiteral(text))
+				}
+			}
+		}
+
+		return "[" + strings.Join(values, ", ") + "]"
+	}
+
+	var text strings.Builder
+
+	for _, child := range node.Children {
+		if child.IsText() {
+			text.WriteString(*child.Text)
+		}
+	}
+
+	if text.Len() == 0 && node.BlockType == parser.BlockNormal {
+		return "{}"
+	}
+
+	return tomlLiteral(strings.TrimSpace(text.String()))
+}
+
+// tomlLiteral writes text unquoted, if it is a number, boolean or date.
+// Only the form FromTOML reads back as text is left unquoted, so that "01234" or "+1", which are
+// no valid TOML or would lose their sign, stay strings.
+func tomlLiteral(text string) string {
+	if text == "true" || text == "false" {
+		return text
+	}
+
+	if v, err := strconv.ParseInt(text, 10, 64); err == nil && strconv.FormatInt(v, 10) == text {
+		return text
+	}
+
+	if v, err := strconv.ParseFloat(text, 64); err == nil && strings.ContainsAny(text, ".eE") &&
+		strconv.FormatFloat(v, 'g', -1, 64) == text {
+		return text
+	}
+
+	if v, err := time.Parse(time.RFC3339Nano, text); err == nil && v.Format(time.RFC3339Nano) == text {
+		return text
+	}
+
+	return tomlQuote(text)
+}
+
+// tomlKey returns key as a bare key, if possible.
+func tomlKey(key string) string {
+	if key == "" {
+		return tomlQuote(key)
+	}
+
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return tomlQuote(key)
+		}
+	}
+
+	return key
+}
+
+// tomlQuote returns text as a TOML basic string.
+func tomlQuote(text string) string {
+	var sb strings.Builder
+
+	sb.WriteByte('"')
+
+	for _, r := range text {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+
+	sb.WriteByte('"')
+
+	return sb.String()
+}
@@ -0,0 +1,213 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package convert
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/r3labs/diff/v2"
+)
+
+func TestFromTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    *parser.TreeNode
+		wantErr bool
+	}{
+		{
+			name: "nested tables",
+			text: "title = \"demo\"\n[server]\nport = 8080\n[server.tls]\nenabled = true\n",
+			want: parser.NewNode("root").Block(parser.BlockNormal).AddChildren(
+				parser.NewNode("title").AddChildren(parser.NewStringNode("demo")),
+				parser.NewNode("server").Block(parser.BlockNormal).AddChildren(
+					parser.NewNode("port").AddChildren(parser.NewStringNode("8080")),
+					parser.NewNode("tls").Block(parser.BlockNormal).AddChildren(
+						parser.NewNode("enabled").AddChildren(parser.NewStringNode("true")),
+					),
+				),
+			),
+		},
+		{
+			name: "array of tables",
+			text: "[[srv]]\nname = \"a\"\n\"@id\" = \"1\"\n[[srv]]\nname = \"b\"\n",
+			want: parser.NewNode("root").Block(parser.BlockNormal).AddChildren(
+				parser.NewNode("srv").Block(parser.BlockNormal).
+					AddAttribute("id", "1").
+					AddChildren(parser.NewNode("name").AddChildren(parser.NewStringNode("a"))),
+				parser.NewNode("srv").Block(parser.BlockNormal).
+					AddChildren(parser.NewNode("name").AddChildren(parser.NewStringNode("b"))),
+			),
+		},
+		{
+			name: "arrays",
+			text: "ports = [80, 443]\n",
+			want: parser.NewNode("root").Block(parser.BlockNormal).AddChildren(
+				parser.NewNode("ports").Block(parser.BlockGroup).AddChildren(
+					parser.NewNode(ItemName).AddChildren(parser.NewStringNode("80")),
+					parser.NewNode(ItemName).AddChildren(parser.NewStringNode("443")),
+				),
+			),
+		},
+		{
+			name:    "invalid toml",
+			text:    "a = ",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := FromTOML(strings.NewReader(tt.text))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, but got none")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			differences, err := diff.Diff(tt.want, tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, d := range differences {
+				t.Errorf("property '%s' differs, expected %v but got %v", strings.Join(d.Path, "."), d.From, d.To)
+			}
+		})
+	}
+}
+
+func TestToTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "key values",
+			text: "#name Gopher #age 3 #p one #p two",
+			want: "name = \"Gopher\"\nage = 3\np = [\"one\", \"two\"]\n",
+		},
+		{
+			name: "tables",
+			text: `#!{
+				title "demo",
+				server @id="main" {
+					host "localhost",
+					tls {
+						enabled "true"
+					}
+				}
+			}`,
+			want: "title = \"demo\"\n\n[server]\n\"@id\" = \"main\"\nhost = \"localhost\"\n\n[server.tls]\nenabled = true\n",
+		},
+		{
+			name: "arrays of tables",
+			text: `#!{
+				srv { name "a" },
+				srv { name "b" },
+				ports("80" "443"),
+				list(item { x "1" }),
+			}`,
+			want: "ports = [80, 443]\n\n[[srv]]\nname = \"a\"\n\n[[srv]]\nname = \"b\"\n\n[[list]]\nx = 1\n",
+		},
+		{
+			name:    "sequence root",
+			text:    `#!()`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := parser.NewParser("toml_test.go", strings.NewReader(tt.text)).Parse()
+			if err != nil {
+				if tt.wantErr {
+					return
+				}
+
+				t.Fatal(err)
+			}
+
+			var sb strings.Builder
+
+			err = ToTOML(&sb, tree)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, but got none")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if sb.String() != tt.want {
+				t.Errorf("expected\n%s\nbut got\n%s", tt.want, sb.String())
+			}
+		})
+	}
+}
+
+func TestTOMLRoundTrip(t *testing.T) {
+	text := "title = \"x \\\"quoted\\\"\"\nports = [80, 443]\n\n[db]\nhost = \"localhost\"\n\n[[srv]]\nname = \"a\"\n\n[srv.tls]\non = true\n\n[[srv]]\nname = \"b\"\n"
+
+	tree, err := FromTOML(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sb strings.Builder
+	if err := ToTOML(&sb, tree); err != nil {
+		t.Fatal(err)
+	}
+
+	if sb.String() != text {
+		t.Errorf("expected\n%s\nbut got\n%s", text, sb.String())
+	}
+}
+
+func TestToTOMLRoundTrip(t *testing.T) {
+	values := []string{
+		"01234", "+5", "-0", "1_000", "42", "-7", "1.0", "1e5", "2.5", "1e+21", "inf", "NaN", "0x1F",
+		"true", "True", "2021-01-02T03:04:05Z", "2021-01-02T03:04:05+00:00", "2021-01-02",
+	}
+
+	tree := parser.NewNode("root").Block(parser.BlockNormal)
+	for i, value := range values {
+		tree.AddChildren(parser.NewNode(fmt.Sprintf("v%d", i)).AddChildren(parser.NewStringNode(value)))
+	}
+
+	var sb strings.Builder
+	if err := ToTOML(&sb, tree); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := FromTOML(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("cannot read back\n%s\n%v", sb.String(), err)
+	}
+
+	if len(decoded.Children) != len(values) {
+		t.Fatalf("expected %d values but got %d", len(values), len(decoded.Children))
+	}
+
+	for i, value := range values {
+		if got := decoded.Children[i].Children[0].Text; *got != value {
+			t.Errorf("expected %q but got %q", value, *got)
+		}
+	}
+}
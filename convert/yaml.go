@@ -0,0 +1,337 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/golangee/tadl/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlMergeKey is the key of a YAML merge, like "<<: *defaults".
+const yamlMergeKey = "<<"
+
+// yamlExpansion limits how many tree nodes a document may expand to. Aliases can nest,
+// so a tiny document could otherwise expand to billions of nodes. A document is allowed
+// yamlExpansionBase nodes plus yamlExpansionFactor nodes for each of its own nodes.
+const (
+	yamlExpansionBase   = 10000
+	yamlExpansionFactor = 100
+)
+
+// FromYAML reads a YAML document and returns it as a tree.
+// Tadl has no references, so anchors are expanded: every alias is replaced by a copy of
+// the anchored node and merge keys insert the keys of the merged mappings. Documents which
+// expand excessively by nesting aliases are rejected.
+func FromYAML(r io.Reader) (*parser.TreeNode, error) {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("cannot decode yaml: %w", err)
+	}
+
+	root := parser.NewNode("root")
+	if len(doc.Content) == 0 {
+		return root, nil
+	}
+
+	y := &yamlConverter{
+		active: map[*yaml.Node]bool{},
+		budget: yamlExpansionBase + yamlExpansionFactor*yamlSize(doc.Content[0]),
+	}
+	if err := y.node(root, doc.Content[0]); err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// yamlConverter keeps track of the anchors that are currently expanded and of the
+// number of nodes, which may still be created.
+type yamlConverter struct {
+	active map[*yaml.Node]bool
+	budget int
+}
+
+// yamlSize returns the number of nodes in value without expanding aliases.
+func yamlSize(value *yaml.Node) int {
+	n := 1
+	for _, child := range value.Content {
+		n += yamlSize(child)
+	}
+
+	return n
+}
+
+// spend takes a node from the budget and fails if the document expands excessively.
+func (y *yamlConverter) spend(value *yaml.Node) error {
+	y.budget--
+	if y.budget < 0 {
+		return fmt.Errorf("line %d: document expands to too many nodes, aliases are nested excessively", value.Line)
+	}
+
+	return nil
+}
+
+// resolve follows alias to its anchor. Aliases that refer to one of their own parents
+// cannot be expanded and are rejected.
+func (y *yamlConverter) resolve(alias *yaml.Node) (*yaml.Node, error) {
+	if alias.Kind != yaml.AliasNode {
+		return alias, nil
+	}
+
+	if y.active[alias.Alias] {
+		return nil, fmt.Errorf("line %d: alias '%s' refers to itself", alias.Line, alias.Value)
+	}
+
+	return alias.Alias, nil
+}
+
+// node converts value into the children and attributes of target.
+func (y *yamlConverter) node(target *parser.TreeNode, value *yaml.Node) error {
+	value, err := y.resolve(value)
+	if err != nil {
+		return err
+	}
+
+	if err := y.spend(value); err != nil {
+		return err
+	}
+
+	y.active[value] = true
+	defer delete(y.active, value)
+
+	switch value.Kind {
+	case yaml.MappingNode:
+		target.Block(parser.BlockNormal)
+
+		return y.mapping(target, value)
+	case yaml.SequenceNode:
+		target.Block(parser.BlockGroup)
+
+		for _, item := range value.Content {
+			child := parser.NewNode(ItemName)
+			if err := y.node(child, item); err != nil {
+				return err
+			}
+
+			target.AddChildren(child)
+		}
+	case yaml.ScalarNode:
+		if value.Tag != "!!null" {
+			target.AddChildren(parser.NewStringNode(value.Value))
+		}
+	default:
+		return fmt.Errorf("line %d: unsupported yaml node", value.Line)
+	}
+
+	return nil
+}
+
+// mapping adds the keys of value to target.
+func (y *yamlConverter) mapping(target *parser.TreeNode, value *yaml.Node) error {
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key, val := value.Content[i], value.Content[i+1]
+		if key.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d: only scalar keys are supported", key.Line)
+		}
+
+		resolved, err := y.resolve(val)
+		if err != nil {
+			return err
+		}
+
+		if err := y.spend(key); err != nil {
+			return err
+		}
+
+		switch {
+		case key.Value == yamlMergeKey:
+			if err := y.merge(target, resolved); err != nil {
+				return err
+			}
+		case key.Value == TextKey && resolved.Kind == yaml.ScalarNode:
+			target.AddChildren(parser.NewStringNode(resolved.Value))
+		case strings.HasPrefix(key.Value, AttributePrefix) && resolved.Kind == yaml.ScalarNode:
+			target.AddAttribute(strings.TrimPrefix(key.Value, AttributePrefix), resolved.Value)
+		default:
+			child := parser.NewNode(key.Value)
+			if err := y.node(child, val); err != nil {
+				return err
+			}
+
+			target.AddChildren(child)
+		}
+	}
+
+	return nil
+}
+
+// merge adds the keys of a merged mapping, or of a sequence of mappings, to target.
+func (y *yamlConverter) merge(target *parser.TreeNode, value *yaml.Node) error {
+	y.active[value] = true
+	defer delete(y.active, value)
+
+	switch value.Kind {
+	case yaml.MappingNode:
+		return y.mapping(target, value)
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			resolved, err := y.resolve(item)
+			if err != nil {
+				return err
+			}
+
+			if err := y.merge(target, resolved); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("line %d: only mappings can be merged", value.Line)
+	}
+}
+
+// ToYAML writes tree as a YAML document to w.
+// Elements with a () block are written as sequences and the names of their children are dropped.
+// Other elements with attributes or child elements are written as mappings and child elements
+// sharing a name are collected into a sequence. Text is trimmed and comments are dropped.
+func ToYAML(w io.Writer, tree *parser.TreeNode) error {
+	value, err := toYAML(tree)
+	if err != nil {
+		return err
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("cannot encode yaml: %w", err)
+	}
+
+	return encoder.Close()
+}
+
+// toYAML converts a single element into a YAML node.
+func toYAML(node *parser.TreeNode) (*yaml.Node, error) {
+	if node.BlockType == parser.BlockGroup {
+		if node.Attributes.Len() > 0 {
+			return nil, fmt.Errorf("element '%s' is a sequence and cannot have attributes", node.Name)
+		}
+
+		seq := &yaml.Node{Kind: yaml.SequenceNode}
+
+		for _, child := range node.Children {
+			switch {
+			case child.IsNode():
+				item, err := toYAML(child)
+				if err != nil {
+					return nil, err
+				}
+
+				seq.Content = append(seq.Content, item)
+			case child.IsText():
+				if text := strings.TrimSpace(*child.Text); text != "" {
+					seq.Content = append(seq.Content, yamlScalar(text))
+				}
+			}
+		}
+
+		return seq, nil
+	}
+
+	var (
+		text     strings.Builder
+		hasText  bool
+		elements []*parser.TreeNode
+	)
+
+	for _, child := range node.Children {
+		switch {
+		case child.IsNode():
+			elements = append(elements, child)
+		case child.IsText():
+			text.WriteString(*child.Text)
+			hasText = true
+		}
+	}
+
+	trimmed := strings.TrimSpace(text.String())
+
+	if node.Attributes.Len() == 0 && len(elements) == 0 {
+		if hasText {
+			return yamlScalar(trimmed), nil
+		}
+
+		if node.BlockType == parser.BlockNormal {
+			return &yaml.Node{Kind: yaml.MappingNode}, nil
+		}
+
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, value := node.Attributes.Get(i)
+		mapping.Content = append(mapping.Content, yamlScalar(AttributePrefix+*key), yamlScalar(*value))
+	}
+
+	if trimmed != "" {
+		mapping.Content = append(mapping.Content, yamlScalar(TextKey), yamlScalar(trimmed))
+	}
+
+	// Elements sharing a name are collected into a sequence at the position of the first one.
+	sequences := map[string]*yaml.Node{}
+
+	for _, element := range elements {
+		value, err := toYAML(element)
+		if err != nil {
+			return nil, err
+		}
+
+		if seq, ok := sequences[element.Name]; ok {
+			seq.Content = append(seq.Content, value)
+			continue
+		}
+
+		if count(elements, element.Name) > 1 {
+			value = &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{value}}
+			sequences[element.Name] = value
+		}
+
+		mapping.Content = append(mapping.Content, yamlScalar(element.Name), value)
+	}
+
+	return mapping, nil
+}
+
+// yamlScalar returns a scalar for text, which has no type in Tadl. It is written plain, unless
+// a plain scalar would be read as another type than a string, like "3", "true" or "null",
+// which are quoted then.
+func yamlScalar(value string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if node.ShortTag() != "!!str" {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+
+	return node
+}
+
+// count returns the number of elements with the given name.
+func count(elements []*parser.TreeNode, name string) int {
+	n := 0
+
+	for _, element := range elements {
+		if element.Name == name {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package convert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/r3labs/diff/v2"
+)
+
+func TestFromYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    *parser.TreeNode
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			text: "",
+			want: parser.NewNode("root"),
+		},
+		{
+			name: "nested mapping",
+			text: "server:\n  host: localhost\n  port: 8080\n",
+			want: parser.NewNode("root").Block(parser.BlockNormal).AddChildren(
+				parser.NewNode("server").Block(parser.BlockNormal).AddChildren(
+					parser.NewNode("host").AddChildren(parser.NewStringNode("localhost")),
+					parser.NewNode("port").AddChildren(parser.NewStringNode("8080")),
+				),
+			),
+		},
+		{
+			name: "attributes and text",
+			text: "book:\n  '@id': b1\n  '#text': Once upon a time\n  empty: null\n",
+			want: parser.NewNode("root").Block(parser.BlockNormal).AddChildren(
+				parser.NewNode("book").Block(parser.BlockNormal).
+					AddAttribute("id", "b1").
+					AddChildren(
+						parser.NewStringNode("Once upon a time"),
+						parser.NewNode("empty"),
+					),
+			),
+		},
+		{
+			name: "sequence",
+			text: "tags: [a, b]\n",
+			want: parser.NewNode("root").Block(parser.BlockNormal).AddChildren(
+				parser.NewNode("tags").Block(parser.BlockGroup).AddChildren(
+					parser.NewNode(ItemName).AddChildren(parser.NewStringNode("a")),
+					parser.NewNode(ItemName).AddChildren(parser.NewStringNode("b")),
+				),
+			),
+		},
+		{
+			name: "anchors are expanded",
+			text: "defaults: &d\n  retries: 3\nprod:\n  <<: *d\n  host: example.com\ncopy: *d\n",
+			want: parser.NewNode("root").Block(parser.BlockNormal).AddChildren(
+				parser.NewNode("defaults").Block(parser.BlockNormal).AddChildren(
+					parser.NewNode("retries").AddChildren(parser.NewStringNode("3")),
+				),
+				parser.NewNode("prod").Block(parser.BlockNormal).AddChildren(
+					parser.NewNode("retries").AddChildren(parser.NewStringNode("3")),
+					parser.NewNode("host").AddChildren(parser.NewStringNode("example.com")),
+				),
+				parser.NewNode("copy").Block(parser.BlockNormal).AddChildren(
+					parser.NewNode("retries").AddChildren(parser.NewStringNode("3")),
+				),
+			),
+		},
+		{
+			name:    "recursive alias",
+			text:    "a: &a\n  b: *a\n",
+			wantErr: true,
+		},
+		{
+			name: "nested aliases",
+			text: "a: &a [x, x, x, x, x, x, x, x, x, x]\nb: &b [*a, *a, *a, *a, *a, *a, *a, *a, *a, *a]\n" +
+				"c: &c [*b, *b, *b, *b, *b, *b, *b, *b, *b, *b]\nd: &d [*c, *c, *c, *c, *c, *c, *c, *c, *c, *c]\n" +
+				"e: &e [*d, *d, *d, *d, *d, *d, *d, *d, *d, *d]\nf: &f [*e, *e, *e, *e, *e, *e, *e, *e, *e, *e]\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid yaml",
+			text:    "a: [",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := FromYAML(strings.NewReader(tt.text))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, but got none")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			differences, err := diff.Diff(tt.want, tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, d := range differences {
+				t.Errorf("property '%s' differs, expected %v but got %v", strings.Join(d.Path, "."), d.From, d.To)
+			}
+		})
+	}
+}
+
+func TestToYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "key values",
+			text: "#name Gopher #age 3",
+			want: "name: Gopher\nage: \"3\"\n",
+		},
+		{
+			name: "nesting and attributes",
+			text: `#!{
+				server @id="main" {
+					host "localhost",
+					empty {},
+					nothing,
+				}
+			}`,
+			want: "server:\n  '@id': main\n  host: localhost\n  empty: {}\n  nothing: null\n",
+		},
+		{
+			name: "repeated elements become a sequence",
+			text: "#p one #p two #title three",
+			want: "p:\n  - one\n  - two\ntitle: three\n",
+		},
+		{
+			name: "group block becomes a sequence",
+			text: `#!{ list("a" "b") }`,
+			want: "list:\n  - a\n  - b\n",
+		},
+		{
+			name: "texts which look like other types",
+			text: `#!{ a "null", b "true", c "3", d "~", e "1.5", f "", g "0x1F", h "yes" }`,
+			want: "a: \"null\"\nb: \"true\"\nc: \"3\"\nd: \"~\"\ne: \"1.5\"\nf: \"\"\ng: \"0x1F\"\nh: yes\n",
+		},
+		{
+			name:    "attributes on a sequence",
+			text:    `#!{ list @id="x" ("a") }`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := parser.NewParser("yaml_test.go", strings.NewReader(tt.text)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sb strings.Builder
+
+			err = ToYAML(&sb, tree)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, but got none")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if sb.String() != tt.want {
+				t.Errorf("expected\n%s\nbut got\n%s", tt.want, sb.String())
+			}
+		})
+	}
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "attributes, text and sequences",
+			text: "server:\n  '@id': main\n  '#text': primary\n  ports:\n    - \"80\"\n    - \"443\"\n  host: localhost\n",
+		},
+		{
+			name: "texts which look like other types",
+			text: "'@g': \"false\"\na: \"null\"\nb: \"true\"\nc: \"3\"\nd: \"~\"\ne: \"1.5\"\nf: \"\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := FromYAML(strings.NewReader(tt.text))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sb strings.Builder
+			if err := ToYAML(&sb, tree); err != nil {
+				t.Fatal(err)
+			}
+
+			if sb.String() != tt.text {
+				t.Errorf("expected\n%s\nbut got\n%s", tt.text, sb.String())
+			}
+		})
+	}
+}
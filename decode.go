@@ -0,0 +1,195 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+	"unicode"
+
+	"github.com/golangee/tadl/parser"
+)
+
+// Decode unmarshals the document read from r into a new value of type T, see Unmarshal.
+// Unknown elements are ignored, unless WithStrict is given. If T is a pointer type, the value
+// it points to is allocated.
+//
+//  server, err := tadl.Decode[Server](r)
+//
+func Decode[T any](r io.Reader, opts ...DecodeOption) (T, error) {
+	value := newValue[T]()
+	err := Unmarshal(r, &value, false, opts...)
+
+	return value, err
+}
+
+// DecodeAll unmarshals all documents read from r into values of type T, see Documents.
+// On error, the values of all documents before are returned.
+func DecodeAll[T any](r io.Reader, opts ...DecodeOption) ([]T, error) {
+	var values []T
+
+	for value, err := range Documents[T](r, opts...) {
+		if err != nil {
+			return values, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// Documents returns an iterator, which unmarshals the documents read from r one after another into
+// values of type T, see Unmarshal. The documents of a stream follow each other without separator:
+//
+//  #!{name "web", port 80}
+//  #!{name "api", port 8080}
+//
+// As a document of grammar 1 has no closing bracket, it extends until the end of the stream,
+// so it can only be the last document. Errors name the document, counting from 1, and end the iteration.
+//
+//  for server, err := range tadl.Documents[Server](r) {
+//      ...
+//  }
+//
+func Documents[T any](r io.Reader, opts ...DecodeOption) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		dec := NewDecoder(r, opts...)
+
+		for {
+			value := newValue[T]()
+
+			// Only the plain io.EOF ends the stream, a truncated document wraps io.EOF as cause.
+			err := dec.Decode(&value)
+			if err == io.EOF {
+				return
+			}
+
+			if err != nil {
+				var zero T
+				yield(zero, err)
+
+				return
+			}
+
+			if !yield(value, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Decoder reads the documents of a stream one after another, see NewDecoder.
+type Decoder struct {
+	r    io.Reader
+	opts []DecodeOption
+	// buf contains the text that has been read from r, but not decoded yet.
+	buf []byte
+	// count is the number of the latest document, counting from 1.
+	count int
+	// err is the error, which ended the stream.
+	err error
+}
+
+// NewDecoder returns a Decoder, which reads documents from r and unmarshals them with the given options,
+// see Unmarshal. Unknown elements are ignored, unless WithStrict is given.
+// Only the text of the next document is read from r, as far as the parser needs it.
+//
+//  dec := tadl.NewDecoder(r)
+//  for {
+//      var server Server
+//      if err := dec.Decode(&server); err == io.EOF {
+//          break
+//      } else if err != nil {
+//          return err
+//      }
+//  }
+//
+func NewDecoder(r io.Reader, opts ...DecodeOption) *Decoder {
+	return &Decoder{r: r, opts: opts}
+}
+
+// Decode unmarshals the next document of the stream into v. The documents of a stream follow
+// each other without separator, see Documents. At the end of the stream io.EOF is returned.
+// Errors name the document, counting from 1. After an error, the same error is returned again,
+// as the end of the broken document is unknown.
+func (d *Decoder) Decode(v interface{}) error {
+	if d.err != nil {
+		return d.err
+	}
+
+	if err := d.skipSpace(); err != nil {
+		if !errors.Is(err, io.EOF) {
+			err = fmt.Errorf("document %d: %w", d.count+1, err)
+		}
+
+		d.err = err
+
+		return err
+	}
+
+	d.count++
+
+	// The text the parser reads beyond the end of the document belongs to the next one.
+	var read bytes.Buffer
+
+	tree, err := parser.NewParser("", io.MultiReader(bytes.NewReader(d.buf), io.TeeReader(d.r, &read)), parserOptions(d.opts)...).Parse()
+	if err != nil {
+		d.err = fmt.Errorf("document %d: %w", d.count, limitError(err))
+
+		return d.err
+	}
+
+	src := append(d.buf, read.Bytes()...)
+
+	// A document without position spans the remaining stream.
+	n := int(tree.Range.EndPos.Offset)
+	if n <= 0 || n > len(src) {
+		n = len(src)
+	}
+
+	d.buf = src[n:]
+
+	if err := unmarshalTree(tree, src, v, false, d.opts...); err != nil {
+		d.err = fmt.Errorf("document %d: %w", d.count, err)
+
+		return d.err
+	}
+
+	return nil
+}
+
+// skipSpace drops the whitespace in front of the next document. It returns io.EOF, if there is no next document.
+func (d *Decoder) skipSpace() error {
+	chunk := make([]byte, 512)
+
+	for {
+		d.buf = bytes.TrimLeftFunc(d.buf, unicode.IsSpace)
+		if len(d.buf) > 0 {
+			return nil
+		}
+
+		n, err := d.r.Read(chunk)
+		d.buf = append(d.buf, chunk[:n]...)
+
+		if err != nil && len(bytes.TrimLeftFunc(d.buf, unicode.IsSpace)) == 0 {
+			return err
+		}
+	}
+}
+
+// newValue returns the zero value of T or a pointer to a new zero value, if T is a pointer type.
+func newValue[T any]() T {
+	var value T
+
+	if t := reflect.TypeOf(&value).Elem(); t.Kind() == reflect.Ptr {
+		reflect.ValueOf(&value).Elem().Set(reflect.New(t.Elem()))
+	}
+
+	return value
+}
@@ -0,0 +1,197 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type decodeServer struct {
+	Name string `tadl:"name"`
+	Port int    `tadl:"port"`
+	Raw  Raw    `tadl:"raw"`
+}
+
+func TestDecode(t *testing.T) {
+	server, err := Decode[decodeServer](strings.NewReader(`#!{name "web", port 80}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (decodeServer{Name: "web", Port: 80}); !reflect.DeepEqual(server, want) {
+		t.Errorf("expected %+v but got %+v", want, server)
+	}
+
+	if _, err := Decode[decodeServer](strings.NewReader(`#!{name "web", host "localhost"}`), WithStrict()); err == nil {
+		t.Error("expected error for unknown element in strict mode")
+	}
+
+	pointer, err := Decode[*decodeServer](strings.NewReader(`#!{name "web"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (&decodeServer{Name: "web"}); !reflect.DeepEqual(pointer, want) {
+		t.Errorf("expected %+v but got %+v", want, pointer)
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []decodeServer
+		wantErr string
+	}{
+		{
+			name: "empty",
+			text: " \n",
+		},
+		{
+			name: "single",
+			text: `#!{name "web", port 80}`,
+			want: []decodeServer{{Name: "web", Port: 80}},
+		},
+		{
+			name: "stream",
+			text: "#!{name \"web\", port 80}\n\n#!{name \"api\", port 8080}#!{name \"db\"}\n",
+			want: []decodeServer{{Name: "web", Port: 80}, {Name: "api", Port: 8080}, {Name: "db"}},
+		},
+		{
+			name: "raw of later document",
+			text: "#!{name \"web\"}\n#!{raw {a 1}}",
+			want: []decodeServer{{Name: "web"}, {Raw: Raw("raw {a 1}")}},
+		},
+		{
+			name: "grammar 1 last",
+			text: "#!{name \"web\"}\n#name{api} #port{8080}\n",
+			want: []decodeServer{{Name: "web"}, {Name: "api", Port: 8080}},
+		},
+		{
+			name:    "invalid document",
+			text:    "#!{name \"web\"}\n#!{port x}",
+			want:    []decodeServer{{Name: "web"}},
+			wantErr: "document 2: ",
+		},
+		{
+			name:    "truncated last document",
+			text:    "#!{name \"web\"}\n#!{name \"api\"",
+			want:    []decodeServer{{Name: "web"}},
+			wantErr: "document 2: ",
+		},
+		{
+			name:    "truncated single document",
+			text:    "#!{name \"web\"",
+			wantErr: "document 1: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeAll[decodeServer](strings.NewReader(tt.text))
+
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected error starting with '%s' but got '%v'", tt.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v but got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDocuments(t *testing.T) {
+	text := "#!{name \"web\"}\n#!{name \"api\"}\n#!{port x}"
+
+	var names []string
+
+	for server, err := range Documents[decodeServer](strings.NewReader(text)) {
+		if err != nil {
+			break
+		}
+
+		names = append(names, server.Name)
+		if len(names) == 1 {
+			break
+		}
+	}
+
+	if want := []string{"web"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected %v but got %v", want, names)
+	}
+
+	var errs []error
+
+	for _, err := range Documents[decodeServer](strings.NewReader(text)) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "document 3: ") {
+		t.Errorf("expected error of document 3 but got %v", errs)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	text := "#!{name \"web\", raw {a 1}}\n  #!{name \"api\", port 8080}\n\n"
+	dec := NewDecoder(iotest.OneByteReader(strings.NewReader(text)))
+
+	var got []decodeServer
+
+	for {
+		var server decodeServer
+
+		err := dec.Decode(&server)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, server)
+	}
+
+	want := []decodeServer{{Name: "web", Raw: Raw("raw {a 1}")}, {Name: "api", Port: 8080}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+
+	if err := dec.Decode(&decodeServer{}); err != io.EOF {
+		t.Errorf("expected io.EOF again but got %v", err)
+	}
+
+	dec = NewDecoder(strings.NewReader("#!{name \"web\"}#!{port x}#!{name \"db\"}"), WithStrict())
+
+	var server decodeServer
+	if err := dec.Decode(&server); err == nil || !strings.HasPrefix(err.Error(), "document 1: ") {
+		t.Errorf("expected error of document 1 in strict mode but got %v", err)
+	}
+
+	dec = NewDecoder(strings.NewReader("#!{name \"web\"}#!{port x}#!{name \"db\"}"))
+
+	if err := dec.Decode(&server); err != nil {
+		t.Fatal(err)
+	}
+
+	first := dec.Decode(&server)
+	if first == nil || !strings.HasPrefix(first.Error(), "document 2: ") {
+		t.Errorf("expected error of document 2 but got %v", first)
+	}
+
+	if err := dec.Decode(&server); err != first {
+		t.Errorf("expected error %v again but got %v", first, err)
+	}
+}
@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package describe
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golangee/tadl/parser"
+)
+
+// DefaultExamples is the number of distinct example values, which are kept for each text and attribute.
+const DefaultExamples = 3
+
+// Description is the structural summary of a tree.
+type Description struct {
+	// Root describes the root element and, through its children, all elements below it.
+	Root *Element `json:"root"`
+	// Names are the distinct names of all elements in alphabetical order.
+	Names []string `json:"names"`
+	// Depth is the maximum depth of an element, the root has depth 0.
+	Depth int `json:"depth"`
+	// Elements, Texts and Comments count the nodes of each kind in the tree.
+	Elements int `json:"elements"`
+	Texts    int `json:"texts,omitempty"`
+	Comments int `json:"comments,omitempty"`
+}
+
+// Element describes all elements with the same path.
+type Element struct {
+	Name string `json:"name"`
+	// Depth is the length of the path, the root has depth 0.
+	Depth int `json:"depth"`
+	// Count is the number of elements with this path.
+	Count int `json:"count"`
+	// Labels is the maximum number of labels of a single element.
+	Labels int `json:"labels,omitempty"`
+	// Texts is the number of text children of all elements.
+	Texts int `json:"texts,omitempty"`
+	// Examples are some distinct, trimmed and non-empty text children.
+	Examples   []string     `json:"examples,omitempty"`
+	Attributes []*Attribute `json:"attributes,omitempty"`
+	// Children describe the child elements in the order of their first appearance.
+	Children []*Element `json:"children,omitempty"`
+}
+
+// Attribute describes an attribute key of an Element.
+type Attribute struct {
+	Key string `json:"key"`
+	// Count is the number of elements with this attribute.
+	Count    int      `json:"count"`
+	Examples []string `json:"examples,omitempty"`
+}
+
+// Option configures a Description.
+type Option func(d *describer)
+
+// WithExamples keeps up to n distinct example values for each text and attribute.
+// Use 0 to leave out all examples.
+func WithExamples(n int) Option {
+	return func(d *describer) {
+		d.examples = n
+	}
+}
+
+// describer collects a Description.
+type describer struct {
+	desc     *Description
+	names    map[string]struct{}
+	examples int
+}
+
+// Describe summarizes the structure of tree, see Description.
+func Describe(tree *parser.TreeNode, opts ...Option) *Description {
+	d := &describer{
+		desc:     &Description{Root: &Element{Name: tree.Name}},
+		names:    map[string]struct{}{},
+		examples: DefaultExamples,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	d.element(d.desc.Root, tree)
+
+	for name := range d.names {
+		d.desc.Names = append(d.desc.Names, name)
+	}
+
+	sort.Strings(d.desc.Names)
+
+	return d.desc
+}
+
+// element adds node to e and its children to the children of e.
+func (d *describer) element(e *Element, node *parser.TreeNode) {
+	d.names[node.Name] = struct{}{}
+	d.desc.Elements++
+	d.desc.Depth = max(d.desc.Depth, e.Depth)
+
+	e.Count++
+	e.Labels = max(e.Labels, len(node.Labels))
+
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, value := node.Attributes.Get(i)
+		attr := e.attribute(*key)
+		attr.Count++
+		attr.Examples = d.example(attr.Examples, *value)
+	}
+
+	for _, child := range node.Children {
+		switch {
+		case child.IsText():
+			d.desc.Texts++
+			e.Texts++
+			e.Examples = d.example(e.Examples, *child.Text)
+		case child.IsComment():
+			d.desc.Comments++
+		default:
+			d.element(e.child(child.Name), child)
+		}
+	}
+}
+
+// example adds the trimmed value to examples, if it is not empty, not yet contained and there is room left.
+func (d *describer) example(examples []string, value string) []string {
+	value = strings.TrimSpace(value)
+	if value == "" || len(examples) >= d.examples {
+		return examples
+	}
+
+	for _, example := range examples {
+		if example == value {
+			return examples
+		}
+	}
+
+	return append(examples, value)
+}
+
+// attribute returns the Attribute with the given key and adds it, if required.
+func (e *Element) attribute(key string) *Attribute {
+	for _, attr := range e.Attributes {
+		if attr.Key == key {
+			return attr
+		}
+	}
+
+	attr := &Attribute{Key: key}
+	e.Attributes = append(e.Attributes, attr)
+
+	return attr
+}
+
+// child returns the child Element with the given name and adds it, if required.
+func (e *Element) child(name string) *Element {
+	for _, child := range e.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+
+	child := &Element{Name: name, Depth: e.Depth + 1}
+	e.Children = append(e.Children, child)
+
+	return child
+}
+
+// Tree converts the description into a Tadl tree, so that it can be formatted like any other document.
+// The root contains an "element" node for the root Element. Every Element becomes an "element" node
+// labeled with its name, every Attribute an "attribute" node labeled with its key. Counts are
+// attributes and examples are "example" children:
+//
+//  element @count="2" @labels="1" "server" {
+//      attribute @count="1" "zone" {example "eu"}
+//      element @count="3" @texts="3" "port" {example "80", example "443"}
+//  }
+//
+func (d *Description) Tree() *parser.TreeNode {
+	return parser.NewNode("root").Block(parser.BlockNormal).AddChildren(d.Root.tree())
+}
+
+func (e *Element) tree() *parser.TreeNode {
+	node := parser.NewNode("element").AddLabels(e.Name).AddAttribute("count", strconv.Itoa(e.Count))
+	if e.Labels > 0 {
+		node.AddAttribute("labels", strconv.Itoa(e.Labels))
+	}
+
+	if e.Texts > 0 {
+		node.AddAttribute("texts", strconv.Itoa(e.Texts))
+	}
+
+	node.AddChildren(examples(e.Examples)...)
+
+	for _, attr := range e.Attributes {
+		node.AddChildren(parser.NewNode("attribute").
+			AddLabels(attr.Key).
+			AddAttribute("count", strconv.Itoa(attr.Count)).
+			Block(parser.BlockNormal).
+			AddChildren(examples(attr.Examples)...))
+	}
+
+	for _, child := range e.Children {
+		node.AddChildren(child.tree())
+	}
+
+	return node.Block(parser.BlockNormal)
+}
+
+// examples returns an "example" node for each of values.
+func examples(values []string) []*parser.TreeNode {
+	var nodes []*parser.TreeNode
+	for _, value := range values {
+		nodes = append(nodes, parser.NewNode("example").AddChildren(parser.NewStringNode(value)))
+	}
+
+	return nodes
+}
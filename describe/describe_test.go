@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package describe
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl/format"
+	"github.com/golangee/tadl/parser"
+)
+
+const document = `#!{
+	// the servers
+	server @zone="eu" "web" {port "80", port "443"}
+	server "db" {port "5432", port "80"}
+	owner {name "Alice"}
+}`
+
+func TestDescribe(t *testing.T) {
+	tree, err := parser.NewParser("test.tadl", strings.NewReader(document)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := Describe(tree, WithExamples(2))
+
+	if got, want := strings.Join(desc.Names, ","), "name,owner,port,root,server"; got != want {
+		t.Errorf("expected names %s but got %s", want, got)
+	}
+
+	if desc.Depth != 2 || desc.Elements != 9 || desc.Texts != 5 || desc.Comments != 1 {
+		t.Errorf("unexpected totals %+v", desc)
+	}
+
+	want := `#!{
+	element @count="1" "root" {
+		element @count="2" @labels="1" "server" {
+			attribute @count="1" "zone" {
+				example "eu"
+			}
+			element @count="4" @texts="4" "port" {
+				example "80"
+				example "443"
+			}
+		}
+		element @count="1" "owner" {
+			element @count="1" @texts="1" "name" {
+				example "Alice"
+			}
+		}
+	}
+}
+`
+
+	if got := format.Format(desc.Tree()); got != want {
+		t.Errorf("expected\n%s\nbut got\n%s", want, got)
+	}
+
+	buf, err := json.Marshal(Describe(parser.NewNode("root").AddAttribute("id", "1"), WithExamples(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantJSON := `{"root":{"name":"root","depth":0,"count":1,"attributes":[{"key":"id","count":1}]},"names":["root"],"depth":0,"elements":1}`
+	if string(buf) != wantJSON {
+		t.Errorf("expected %s but got %s", wantJSON, buf)
+	}
+}
@@ -0,0 +1,9 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package describe summarizes the structure of Tadl trees, which is handy to explore unknown documents
+// or to drive generic user interfaces. All elements with the same path, like every "port" inside of a
+// "server", are merged into a single Element, which counts them and keeps their attribute keys, the
+// names of their children and some example values. A Description can be encoded as JSON or be
+// converted into a Tadl tree itself.
+package describe
@@ -0,0 +1,863 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/token"
+)
+
+// textMarshalerType is encoded as text, see primitiveText.
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// marshalerType encodes itself, see tadlMarshaler.
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+// Marshaler is implemented by types that encode themselves as an element, like a duration as text.
+// The name of the returned node is replaced by the name of the field. A nil node is left out.
+// The returned node must not be modified afterwards.
+type Marshaler interface {
+	MarshalTadl() (*parser.TreeNode, error)
+}
+
+// Encoder writes values as documents of grammar 2 to an output stream, see NewEncoder.
+type Encoder struct {
+	// out is the output stream, which w writes to.
+	out      io.Writer
+	w        *bufio.Writer
+	indent   string
+	fallback []string
+	mapper   NameMapper
+}
+
+// NewEncoder returns an Encoder that writes to w.
+//
+//  enc := tadl.NewEncoder(os.Stdout)
+//  for _, server := range servers {
+//      if err := enc.Encode(server); err != nil {
+//          return err
+//      }
+//  }
+//
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{out: w, w: bufio.NewWriter(w), indent: "\t"}
+}
+
+// SetIndent sets the string used for each level of indentation. The default is a tab.
+func (e *Encoder) SetIndent(indent string) {
+	e.indent = indent
+}
+
+// SetTagFallback reads the first of the given struct tags for fields without a tadl tag,
+// like WithTagFallback does for Unmarshal.
+func (e *Encoder) SetTagFallback(tags ...string) {
+	e.fallback = tags
+}
+
+// SetNameMapper maps the names of all fields, which are not renamed with a tag, with m,
+// like WithNameMapper does for Unmarshal.
+func (e *Encoder) SetNameMapper(m NameMapper) {
+	e.mapper = m
+}
+
+// Encode writes v as document followed by a newline. Documents written one after another can
+// be read again with Documents or DecodeAll. v must be a struct or a pointer to a struct, which
+// is written as the root element. The text is written while v is traversed, so that large values
+// are never held in memory as text. If an error occurs, the buffered text of the document is discarded,
+// so that the next document is written cleanly. Parts of large documents may have been written already,
+// so the output may still contain an incomplete document.
+//
+// Encode is the reverse of Unmarshal and follows the same struct tags. Fields are written in their
+// order, nil pointers, maps and slices are left out. Elements of slices without a rename tag are
+// written as texts, if they are primitive, or as elements named "item" otherwise. Keys of maps are
+// sorted and, like all names, must be identifiers. Fields of type Position are not written.
+// Types implementing Marshaler are written as the node they return. Types implementing
+// encoding.TextMarshaler, like net.IP or time.Time, are written as text like primitive types.
+// Fields with the option "omitempty", like `tadl:"port,attr,omitempty"`, are left out, if their value
+// is empty, which is false, 0, "", a zero struct or a nil pointer, or a map or slice of length 0.
+func (e *Encoder) Encode(v interface{}) error {
+	if err := e.encode(v); err != nil {
+		// The incomplete document must not be written in front of the next one.
+		e.w.Reset(e.out)
+
+		return err
+	}
+
+	return nil
+}
+
+// encode writes v, see Encode.
+func (e *Encoder) encode(v interface{}) error {
+	if m, ok := tadlMarshaler(reflect.ValueOf(v)); ok {
+		return e.encodeNode(m)
+	}
+
+	value, ok := indirect(reflect.ValueOf(v))
+	if !ok {
+		return fmt.Errorf("cannot marshal nil")
+	}
+
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot marshal '%s', a struct is required", value.Type())
+	}
+
+	m := marshaler{w: e.w, indent: e.indent, fallback: e.fallback, mapper: e.mapper}
+
+	var h elementHeader
+	if err := m.header(value, &h); err != nil {
+		return err
+	}
+
+	if len(h.attributes) > 0 {
+		return fmt.Errorf("cannot marshal attribute '%s' of the root element, which has no attributes in grammar 2", h.attributes[0])
+	}
+
+	m.w.WriteString("#!")
+
+	for _, label := range h.labels {
+		m.w.WriteString(quote(label) + " ")
+	}
+
+	err := m.block(parser.BlockNormal, 0, func() error {
+		return m.children(value, 1)
+	})
+	if err != nil {
+		return err
+	}
+
+	m.w.WriteString("\n")
+
+	return e.w.Flush()
+}
+
+// encodeNode writes the node of marshaler as root element.
+func (e *Encoder) encodeNode(v Marshaler) error {
+	node, err := v.MarshalTadl()
+	if err != nil {
+		return err
+	}
+
+	if node == nil || !node.IsNode() {
+		return fmt.Errorf("cannot marshal root, MarshalTadl must return an element")
+	}
+
+	if node.Attributes.Len() > 0 {
+		key, _ := node.Attributes.Get(0)
+
+		return fmt.Errorf("cannot marshal attribute '%s' of the root element, which has no attributes in grammar 2", *key)
+	}
+
+	m := marshaler{w: e.w, indent: e.indent, fallback: e.fallback, mapper: e.mapper}
+
+	m.w.WriteString("#!")
+
+	for _, label := range node.Labels {
+		m.w.WriteString(quote(label) + " ")
+	}
+
+	err = m.block(parser.BlockNormal, 0, func() error {
+		for _, child := range node.Children {
+			if err := m.tree(child, 1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	m.w.WriteString("\n")
+
+	return e.w.Flush()
+}
+
+// Marshal returns v as document, see Encoder.Encode.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// marshaler writes the elements of a single document, see Encoder.Encode.
+type marshaler struct {
+	w        *bufio.Writer
+	indent   string
+	fallback []string
+	mapper   NameMapper
+
+	// written counts the children written so far, so that a block without children is written as "{}".
+	written int
+	// open is true, if the latest child is an element without block, which would take the next
+	// child as its own. The next child is separated by a comma then.
+	open bool
+}
+
+// elementHeader contains what is written between the name and the block of an element.
+type elementHeader struct {
+	// attributes contains the key followed by the value of every attribute.
+	attributes []string
+	labels     []string
+}
+
+// add adds an attribute, unless its key has been added before. The attributes of 'attr' fields
+// are read into the map of an 'attrs' field as well, so they are written only once.
+func (h *elementHeader) add(key, value string) {
+	for i := 0; i < len(h.attributes); i += 2 {
+		if h.attributes[i] == key {
+			return
+		}
+	}
+
+	h.attributes = append(h.attributes, key, value)
+}
+
+// indirect dereferences pointers and interfaces. ok is false, if one of them is nil.
+func indirect(value reflect.Value) (v reflect.Value, ok bool) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return value, false
+		}
+
+		value = value.Elem()
+	}
+
+	return value, value.IsValid()
+}
+
+// isEmpty returns true, if value is left out by the option "omitempty".
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	default:
+		return value.IsZero()
+	}
+}
+
+// quote returns text as quoted string of grammar 2.
+func quote(text string) string {
+	return `"` + token.EscapeG2(text) + `"`
+}
+
+// child starts a new child at depth on its own line.
+func (m *marshaler) child(depth int) {
+	if m.open {
+		m.w.WriteString(",")
+		m.open = false
+	}
+
+	m.w.WriteString("\n")
+	m.w.WriteString(strings.Repeat(m.indent, depth))
+	m.written++
+}
+
+// block writes the brackets of blockType, with the children written by children in between.
+func (m *marshaler) block(blockType parser.BlockType, depth int, children func() error) error {
+	if blockType == parser.BlockNone {
+		blockType = parser.BlockNormal
+	}
+
+	m.w.WriteByte(blockType[0])
+
+	written := m.written
+	if err := children(); err != nil {
+		return err
+	}
+
+	m.open = false
+
+	if m.written > written {
+		m.w.WriteString("\n")
+		m.w.WriteString(strings.Repeat(m.indent, depth))
+	}
+
+	m.w.WriteByte(blockType[1])
+
+	return nil
+}
+
+// name returns the name of the element or attribute of a field.
+func (m *marshaler) name(plan fieldPlan) string {
+	if !plan.renamed && m.mapper != nil {
+		return m.mapper(plan.name)
+	}
+
+	return plan.name
+}
+
+// header collects the attributes and labels of the struct value, including the ones of inner structs.
+func (m *marshaler) header(value reflect.Value, h *elementHeader) error {
+	for i, plan := range structPlan(value.Type(), m.fallback...) {
+		if value.Type().Field(i).PkgPath != "" && !plan.embedded {
+			continue
+		}
+
+		if plan.invalid != "" {
+			return fmt.Errorf("field type '%s' invalid", plan.invalid)
+		}
+
+		if plan.omitEmpty && isEmpty(value.Field(i)) {
+			continue
+		}
+
+		field, ok := indirect(value.Field(i))
+		if !ok {
+			continue
+		}
+
+		switch plan.as {
+		case unmarshalAttribute:
+			text, err := primitiveText(field)
+			if err != nil {
+				return fmt.Errorf("while processing attribute '%s': %w", plan.goName, err)
+			}
+
+			h.add(m.name(plan), text)
+		case unmarshalLabel:
+			switch {
+			case field.Kind() == reflect.String:
+				h.labels = append(h.labels, field.String())
+			case field.Type() == reflect.TypeOf([]string(nil)):
+				h.labels = append(h.labels, field.Interface().([]string)...)
+			default:
+				return fmt.Errorf("label '%s' requires string or []string", plan.goName)
+			}
+		case unmarshalInner:
+			if field.Kind() == reflect.Struct {
+				if err := m.header(field, h); err != nil {
+					return err
+				}
+			}
+		case unmarshalAttributes:
+			if err := m.attributes(field, h); err != nil {
+				return fmt.Errorf("while processing attributes '%s': %w", plan.goName, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// attributes adds the entries of the map value, sorted by key, to the attributes of h.
+func (m *marshaler) attributes(value reflect.Value, h *elementHeader) error {
+	if value.Kind() != reflect.Map || !isPrimitive(value.Type().Key()) || !isPrimitive(value.Type().Elem()) {
+		return fmt.Errorf("'attrs' requires a map of primitive types")
+	}
+
+	attributes := make([][2]string, 0, value.Len())
+
+	iter := value.MapRange()
+	for iter.Next() {
+		key, err := primitiveText(iter.Key())
+		if err != nil {
+			return err
+		}
+
+		if key == "" {
+			return fmt.Errorf("attribute key must not be empty")
+		}
+
+		text, err := primitiveText(iter.Value())
+		if err != nil {
+			return err
+		}
+
+		attributes = append(attributes, [2]string{key, text})
+	}
+
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i][0] < attributes[j][0]
+	})
+
+	for _, attr := range attributes {
+		h.add(attr[0], attr[1])
+	}
+
+	return nil
+}
+
+// children writes the fields of the struct value as children at depth.
+func (m *marshaler) children(value reflect.Value, depth int) error {
+	for i, plan := range structPlan(value.Type(), m.fallback...) {
+		if value.Type().Field(i).PkgPath != "" && !plan.embedded {
+			continue
+		}
+
+		field := value.Field(i)
+		if plan.omitEmpty && isEmpty(field) {
+			continue
+		}
+
+		var err error
+
+		switch plan.as {
+		case unmarshalNormal:
+			// Like for Unmarshal, a slice with a rename tag is written as repeated elements.
+			if field.Kind() == reflect.Slice && field.Type() != orderedMapType && field.Type() != rawType &&
+				!isPrimitive(field.Type()) && !reflect.PtrTo(field.Type()).Implements(marshalerType) &&
+				len(plan.tags) > 0 && len(plan.tags[0]) > 0 {
+				for j := 0; j < field.Len() && err == nil; j++ {
+					err = m.element(m.name(plan), field.Index(j), depth)
+				}
+			} else {
+				err = m.element(m.name(plan), field, depth)
+			}
+		case unmarshalInner, unmarshalCharData:
+			err = m.inner(field, depth)
+		case unmarshalTable:
+			err = m.table(m.name(plan), field, depth)
+		case unmarshalAny:
+			nodes, _ := field.Interface().([]*parser.TreeNode)
+			for _, node := range nodes {
+				if err = m.tree(node, depth); err != nil {
+					break
+				}
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("while processing field '%s': %w", plan.goName, err)
+		}
+	}
+
+	return nil
+}
+
+// element writes value as element with the given name at depth.
+func (m *marshaler) element(name string, value reflect.Value, depth int) error {
+	if !token.IsIdentifier(name) {
+		return fmt.Errorf("element '%s' is not an identifier", name)
+	}
+
+	if v, ok := tadlMarshaler(value); ok {
+		return m.node(name, v, depth)
+	}
+
+	value, ok := indirect(value)
+	if !ok {
+		return nil
+	}
+
+	if value.Type() == rawType {
+		if value.Len() > 0 {
+			m.child(depth)
+			m.w.Write(value.Bytes())
+		}
+
+		return nil
+	}
+
+	if isPrimitive(value.Type()) {
+		text, err := primitiveText(value)
+		if err != nil {
+			return err
+		}
+
+		m.child(depth)
+		m.w.WriteString(name + " " + quote(text))
+
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		var h elementHeader
+		if err := m.header(value, &h); err != nil {
+			return err
+		}
+
+		m.child(depth)
+		m.w.WriteString(name)
+
+		for i := 0; i < len(h.attributes); i += 2 {
+			m.w.WriteString(" @" + token.QuoteKey(h.attributes[i]) + "=" + quote(h.attributes[i+1]))
+		}
+
+		for _, label := range h.labels {
+			m.w.WriteString(" " + quote(label))
+		}
+
+		m.w.WriteString(" ")
+
+		return m.block(parser.BlockNormal, depth, func() error {
+			return m.children(value, depth+1)
+		})
+	case reflect.Map, reflect.Slice:
+		if value.IsNil() {
+			return nil
+		}
+
+		m.child(depth)
+		m.w.WriteString(name + " ")
+
+		return m.block(parser.BlockNormal, depth, func() error {
+			return m.inner(value, depth+1)
+		})
+	default:
+		return fmt.Errorf("type '%s' is not supported", value.Type())
+	}
+}
+
+// node writes the node of v as element with the given name at depth.
+func (m *marshaler) node(name string, v Marshaler, depth int) error {
+	node, err := v.MarshalTadl()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case node == nil:
+		return nil
+	case node.IsText():
+		m.child(depth)
+		m.w.WriteString(name + " " + quote(*node.Text))
+
+		return nil
+	case node.IsComment():
+		return fmt.Errorf("MarshalTadl must return an element or text")
+	}
+
+	renamed := *node
+	renamed.Name = name
+
+	return m.tree(&renamed, depth)
+}
+
+// inner writes the contents of value as children at depth, like for the 'inner' tag of Unmarshal.
+func (m *marshaler) inner(value reflect.Value, depth int) error {
+	value, ok := indirect(value)
+	if !ok {
+		return nil
+	}
+
+	if value.Type() == orderedMapType {
+		for _, kv := range value.Interface().(OrderedMap) {
+			if !token.IsIdentifier(kv.Key) {
+				return fmt.Errorf("map key '%s' is not an identifier", kv.Key)
+			}
+
+			m.child(depth)
+			m.w.WriteString(kv.Key + " " + quote(kv.Value))
+		}
+
+		return nil
+	}
+
+	if isPrimitive(value.Type()) {
+		text, err := primitiveText(value)
+		if err != nil {
+			return err
+		}
+
+		m.child(depth)
+		m.w.WriteString(quote(text))
+
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		return m.children(value, depth)
+	case reflect.Map:
+		return m.mapEntries(value, depth)
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			item, ok := indirect(value.Index(i))
+			if !ok {
+				continue
+			}
+
+			if isPrimitive(item.Type()) {
+				if err := m.inner(item, depth); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if err := m.element("item", item, depth); err != nil {
+				return fmt.Errorf("cannot write slice item %d: %w", i, err)
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("type '%s' is not supported", value.Type())
+	}
+}
+
+// mapEntries writes the entries of the map value sorted by key as children at depth.
+func (m *marshaler) mapEntries(value reflect.Value, depth int) error {
+	if !isPrimitive(value.Type().Key()) {
+		return fmt.Errorf("map key type '%s' is not primitive", value.Type().Key())
+	}
+
+	keys := make([]string, 0, value.Len())
+	values := make(map[string]reflect.Value, value.Len())
+
+	iter := value.MapRange()
+	for iter.Next() {
+		key, err := primitiveText(iter.Key())
+		if err != nil {
+			return err
+		}
+
+		if !token.IsIdentifier(key) {
+			return fmt.Errorf("map key '%s' is not an identifier", key)
+		}
+
+		keys = append(keys, key)
+		values[key] = iter.Value()
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		mapValue, ok := indirect(values[key])
+		if !ok {
+			continue
+		}
+
+		switch {
+		case values[key].Type().Implements(marshalerType):
+			if err := m.element(key, values[key], depth); err != nil {
+				return err
+			}
+		case isPrimitive(mapValue.Type()):
+			text, err := primitiveText(mapValue)
+			if err != nil {
+				return err
+			}
+
+			m.child(depth)
+			m.w.WriteString(key + " " + quote(text))
+		case mapValue.Type() == reflect.TypeOf(parser.TreeNode{}):
+			node := mapValue.Interface().(parser.TreeNode)
+
+			m.child(depth)
+			m.w.WriteString(key + " ")
+
+			err := m.block(parser.BlockNormal, depth, func() error {
+				return m.tree(&node, depth+1)
+			})
+			if err != nil {
+				return err
+			}
+		default:
+			if err := m.element(key, mapValue, depth); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// table writes the slice of structs value as element with the given name at depth, see Unmarshal.
+func (m *marshaler) table(name string, value reflect.Value, depth int) error {
+	if value.Kind() != reflect.Slice || value.Type().Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("'table' requires a slice of structs")
+	}
+
+	if value.Len() == 0 {
+		return nil
+	}
+
+	// The header contains the names of all fields, which are written as cells.
+	var (
+		header []string
+		fields []int
+	)
+
+	for i, plan := range structPlan(value.Type().Elem(), m.fallback...) {
+		if value.Type().Elem().Field(i).PkgPath == "" && plan.as == unmarshalNormal {
+			header = append(header, quote(m.name(plan)))
+			fields = append(fields, i)
+		}
+	}
+
+	m.child(depth)
+	m.w.WriteString(name + " ")
+
+	return m.block(parser.BlockNormal, depth, func() error {
+		m.child(depth + 1)
+		m.w.WriteString("row(" + strings.Join(header, " ") + ")")
+
+		for i := 0; i < value.Len(); i++ {
+			cells := make([]string, 0, len(fields))
+
+			for _, field := range fields {
+				text, err := primitiveText(value.Index(i).Field(field))
+				if err != nil {
+					return fmt.Errorf("cannot write table row %d: %w", i, err)
+				}
+
+				cells = append(cells, quote(text))
+			}
+
+			m.child(depth + 1)
+			m.w.WriteString("row(" + strings.Join(cells, " ") + ")")
+		}
+
+		return nil
+	})
+}
+
+// tree writes node and its children at depth.
+func (m *marshaler) tree(node *parser.TreeNode, depth int) error {
+	switch {
+	case node.IsText():
+		m.child(depth)
+		m.w.WriteString(quote(*node.Text))
+
+		return nil
+	case node.IsComment():
+		for _, line := range strings.Split(*node.Comment, "\n") {
+			m.child(depth)
+			m.w.WriteString("// " + line)
+		}
+
+		return nil
+	}
+
+	if !token.IsIdentifier(node.Name) {
+		return fmt.Errorf("element '%s' is not an identifier", node.Name)
+	}
+
+	m.child(depth)
+	m.w.WriteString(node.Name)
+
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, value := node.Attributes.Get(i)
+		if *key == "" {
+			return fmt.Errorf("attribute key must not be empty")
+		}
+
+		m.w.WriteString(" @" + token.QuoteKey(*key) + "=" + quote(*value))
+	}
+
+	for _, label := range node.Labels {
+		m.w.WriteString(" " + quote(label))
+	}
+
+	if len(node.Children) == 0 && len(node.Labels) == 0 && node.BlockType == parser.BlockNone {
+		m.open = true
+
+		return nil
+	}
+
+	m.w.WriteString(" ")
+
+	return m.block(node.BlockType, depth, func() error {
+		for _, child := range node.Children {
+			if err := m.tree(child, depth+1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// tadlMarshaler returns the Marshaler of value, if its type or a pointer to it implements the interface.
+// Nil pointers and interfaces are left out like any other nil value.
+func tadlMarshaler(value reflect.Value) (Marshaler, bool) {
+	if !value.IsValid() || (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && value.IsNil() {
+		return nil, false
+	}
+
+	switch {
+	case value.Type().Implements(marshalerType):
+		return value.Interface().(Marshaler), true
+	case value.Kind() != reflect.Ptr && value.CanAddr() && reflect.PtrTo(value.Type()).Implements(marshalerType):
+		return value.Addr().Interface().(Marshaler), true
+	}
+
+	return nil, false
+}
+
+// isPrimitive returns true, if values of type t are written as text.
+// Types implementing encoding.TextMarshaler are primitive as well.
+func isPrimitive(t reflect.Type) bool {
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Bool, reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	}
+
+	return false
+}
+
+// primitiveText returns the text of a primitive value, as it is read by Unmarshal.
+func primitiveText(value reflect.Value) (string, error) {
+	if marshaler, ok := textMarshaler(value); ok {
+		text, err := marshaler.MarshalText()
+		if err != nil {
+			return "", fmt.Errorf("cannot marshal '%s' as text: %w", value.Type(), err)
+		}
+
+		return string(text), nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), nil
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(value.Float(), 'g', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'g', -1, 64), nil
+	default:
+		return "", fmt.Errorf("type '%s' is not primitive", value.Type())
+	}
+}
+
+// textMarshaler returns the encoding.TextMarshaler of value, if its type or a pointer to it
+// implements the interface. A value, which is not addressable, is copied for the latter.
+func textMarshaler(value reflect.Value) (encoding.TextMarshaler, bool) {
+	switch {
+	case value.Type().Implements(textMarshalerType):
+		if value.Kind() == reflect.Ptr && value.IsNil() {
+			return nil, false
+		}
+
+		return value.Interface().(encoding.TextMarshaler), true
+	case value.Kind() != reflect.Ptr && reflect.PtrTo(value.Type()).Implements(textMarshalerType):
+		if !value.CanAddr() {
+			ptr := reflect.New(value.Type())
+			ptr.Elem().Set(value)
+			value = ptr.Elem()
+		}
+
+		return value.Addr().Interface().(encoding.TextMarshaler), true
+	}
+
+	return nil, false
+}
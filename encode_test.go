@@ -0,0 +1,666 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golangee/tadl/format"
+	"github.com/golangee/tadl/parser"
+)
+
+type encodeConfig struct {
+	Name    string            `tadl:"name"`
+	Debug   bool              `tadl:"debug"`
+	Ratio   float64           `tadl:"ratio"`
+	Servers []encodeServer    `tadl:"server"`
+	Tags    []string          `tadl:"tags"`
+	Env     map[string]string `tadl:"env"`
+	Chain   OrderedMap        `tadl:"chain"`
+	Owner   *encodeUser       `tadl:"owner"`
+	Users   []encodeUser      `tadl:"users,table"`
+	Pos     Position
+}
+
+type encodeServer struct {
+	Zone  string   `tadl:"zone,attr"`
+	Name  string   `tadl:",label"`
+	Ports []uint16 `tadl:"ports"`
+}
+
+type encodeUser struct {
+	Name string `tadl:"name"`
+	Age  int    `tadl:"age"`
+}
+
+func TestEncoder(t *testing.T) {
+	config := encodeConfig{
+		Name:  `say "hi"`,
+		Ratio: 0.5,
+		Servers: []encodeServer{
+			{Zone: "eu", Name: "web", Ports: []uint16{80, 443}},
+			{Name: "db"},
+		},
+		Tags:  []string{},
+		Env:   map[string]string{"PATH": "/bin", "HOME": "/root"},
+		Chain: OrderedMap{{Key: "gzip", Value: "on"}, {Key: "auth", Value: "off"}},
+		Users: []encodeUser{{Name: "Alice", Age: 30}},
+	}
+
+	want := `#!{
+  name "say \"hi\""
+  debug "false"
+  ratio "0.5"
+  server @zone="eu" "web" {
+    ports "80"
+    ports "443"
+  }
+  server @zone="" "db" {}
+  env {
+    HOME "/root"
+    PATH "/bin"
+  }
+  chain {
+    gzip "on"
+    auth "off"
+  }
+  users {
+    row("name" "age")
+    row("Alice" "30")
+  }
+}
+#!{
+  name ""
+  debug "false"
+  ratio "0"
+}
+`
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf)
+	enc.SetIndent("  ")
+
+	if err := enc.Encode(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := enc.Encode(encodeConfig{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s", want, buf.String())
+	}
+
+	if err := enc.Encode(42); err == nil {
+		t.Error("expected error for value, which is not a struct")
+	}
+
+	if err := enc.Encode(struct{ Env map[string]string }{map[string]string{"a b": "c"}}); err == nil {
+		t.Error("expected error for map key, which is not an identifier")
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	type server struct {
+		Zone  string   `tadl:"zone,attr"`
+		Name  string   `tadl:",label"`
+		Ports []uint16 `tadl:"ports"`
+	}
+
+	type document struct {
+		Name    string
+		Servers []server `tadl:"server"`
+		Owner   encodeUser
+		Users   []encodeUser `tadl:"users,table"`
+		Matrix  [][]string
+		Env     map[string]int
+		Text    string `tadl:",inner"`
+	}
+
+	want := document{
+		Name:    "cluster",
+		Servers: []server{{Zone: "eu", Name: "web", Ports: []uint16{80}}},
+		Owner:   encodeUser{Name: "Bob", Age: 25},
+		Users:   []encodeUser{{Name: "Alice", Age: 30}, {Name: "Carol", Age: 41}},
+		Matrix:  [][]string{{"a", "b"}, {"c"}},
+		Env:     map[string]int{"workers": 4},
+		Text:    "some text",
+	}
+
+	text, err := Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got document
+	if err := Unmarshal(bytes.NewReader(text), &got, false); err != nil {
+		t.Fatalf("cannot unmarshal\n%s: %v", text, err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v from\n%s", want, got, text)
+	}
+
+	if strings.Contains(string(text), "Pos") {
+		t.Errorf("expected positions to be left out, but got\n%s", text)
+	}
+}
+
+func (d duration) MarshalTadl() (*parser.TreeNode, error) {
+	return parser.NewStringNode(time.Duration(d).String()), nil
+}
+
+func (e endpoint) MarshalTadl() (*parser.TreeNode, error) {
+	if len(e) == 0 {
+		return nil, nil
+	}
+
+	return parser.NewNode("ignored").AddLabels(e...).Block(parser.BlockNormal), nil
+}
+
+func TestMarshaler(t *testing.T) {
+	type config struct {
+		Timeout  duration            `tadl:"timeout"`
+		Retry    *duration           `tadl:"retry"`
+		Endpoint endpoint            `tadl:"endpoint"`
+		Backup   endpoint            `tadl:"backup"`
+		Limits   map[string]duration `tadl:"limits"`
+	}
+
+	retry := duration(5 * time.Second)
+	want := config{
+		Timeout:  duration(90 * time.Second),
+		Retry:    &retry,
+		Endpoint: endpoint{"localhost", "8080"},
+		Limits:   map[string]duration{"read": duration(time.Second)},
+	}
+
+	text, err := Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantText := `#!{
+	timeout "1m30s"
+	retry "5s"
+	endpoint "localhost" "8080" {}
+	limits {
+		read "1s"
+	}
+}
+`
+	if string(text) != wantText {
+		t.Errorf("expected\n%s\nbut got\n%s", wantText, text)
+	}
+
+	var got config
+	if err := Unmarshal(bytes.NewReader(text), &got, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Timeout != want.Timeout || *got.Retry != retry || !reflect.DeepEqual(got.Endpoint, want.Endpoint) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+
+	text, err = Marshal(endpoint{"a"})
+	if err != nil || string(text) != "#!\"a\" {}\n" {
+		t.Errorf("expected root with label but got %q: %v", text, err)
+	}
+}
+
+func TestEncoderTagFallback(t *testing.T) {
+	type config struct {
+		Name   string `json:"name"`
+		Secret string `json:"-"`
+		Port   int    `tadl:"port" json:"listen"`
+	}
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf)
+	enc.SetTagFallback("json")
+
+	if err := enc.Encode(config{Name: "web", Secret: "hidden", Port: 80}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "#!{\n\tname \"web\"\n\tport \"80\"\n}\n"; buf.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s", want, buf.String())
+	}
+}
+
+func TestEncoderAfterError(t *testing.T) {
+	type config struct {
+		Name string            `tadl:"name"`
+		M    map[string]string `tadl:"m"`
+	}
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf)
+
+	if err := enc.Encode(config{Name: "a", M: map[string]string{"no identifier": "x"}}); err == nil {
+		t.Fatal("expected an error for an invalid key")
+	}
+
+	if err := enc.Encode(config{Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "#!{\n\tname \"b\"\n}\n"; buf.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s", want, buf.String())
+	}
+}
+
+func TestEncoderNameMapper(t *testing.T) {
+	type endpoint struct {
+		HostName string
+		PortNum  int
+	}
+
+	type config struct {
+		ServerID  string     `tadl:",attr"`
+		MaxConns  int        `tadl:",attr"`
+		LogLevel  string     `tadl:"level"`
+		Endpoints []endpoint `tadl:",table"`
+	}
+
+	type document struct {
+		MainConfig config
+	}
+
+	want := document{MainConfig: config{
+		ServerID:  "web",
+		MaxConns:  10,
+		LogLevel:  "info",
+		Endpoints: []endpoint{{HostName: "a", PortNum: 80}, {HostName: "b", PortNum: 443}},
+	}}
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf)
+	enc.SetNameMapper(SnakeCase)
+
+	if err := enc.Encode(want); err != nil {
+		t.Fatal(err)
+	}
+
+	wantText := `#!{
+	main_config @server_id="web" @max_conns="10" {
+		level "info"
+		endpoints {
+			row("host_name" "port_num")
+			row("a" "80")
+			row("b" "443")
+		}
+	}
+}
+`
+	if buf.String() != wantText {
+		t.Errorf("expected\n%s\nbut got\n%s", wantText, buf.String())
+	}
+
+	var got document
+	if err := Unmarshal(&buf, &got, true, WithNameMapper(SnakeCase)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+}
+
+// MarshalText has a pointer receiver, so that values in maps, which are not addressable, are copied.
+func (l *level) MarshalText() ([]byte, error) {
+	names := []string{"debug", "info", "error"}
+	if int(*l) >= len(names) {
+		return nil, fmt.Errorf("unknown level %d", int(*l))
+	}
+
+	return []byte(names[*l]), nil
+}
+
+func TestTextMarshaler(t *testing.T) {
+	type config struct {
+		IP      net.IP           `tadl:"ip"`
+		Started time.Time        `tadl:"started"`
+		Level   level            `tadl:"level"`
+		Min     *level           `tadl:"min"`
+		Loggers map[string]level `tadl:"loggers"`
+	}
+
+	info := level(1)
+	want := config{
+		IP:      net.ParseIP("127.0.0.1"),
+		Started: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+		Level:   2,
+		Min:     &info,
+		Loggers: map[string]level{"http": 0, "db": 2},
+	}
+
+	text, err := Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantText := `#!{
+	ip "127.0.0.1"
+	started "2021-06-01T12:00:00Z"
+	level "error"
+	min "info"
+	loggers {
+		db "error"
+		http "debug"
+	}
+}
+`
+	if string(text) != wantText {
+		t.Errorf("expected\n%s\nbut got\n%s", wantText, text)
+	}
+
+	var got config
+	if err := Unmarshal(bytes.NewReader(text), &got, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+
+	if _, err := Marshal(config{Level: 7}); err == nil || !strings.Contains(err.Error(), "unknown level 7") {
+		t.Errorf("expected error of MarshalText but got %v", err)
+	}
+}
+
+func TestEncoderMapValues(t *testing.T) {
+	type server struct {
+		Zone  string            `tadl:"zone,attr"`
+		Attrs map[string]string `tadl:",attrs"`
+		Ports []int             `tadl:"port"`
+	}
+
+	type config struct {
+		Servers map[string]server   `tadl:"servers"`
+		Groups  map[string][]string `tadl:"groups"`
+	}
+
+	value := config{
+		Servers: map[string]server{
+			"web": {Zone: "eu", Attrs: map[string]string{"zone": "us", "tier": "1"}, Ports: []int{80}},
+		},
+		Groups: map[string][]string{"admins": {"alice"}},
+	}
+
+	text, err := Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `#!{
+	servers {
+		web @zone="eu" @tier="1" {
+			port "80"
+		}
+	}
+	groups {
+		admins {
+			"alice"
+		}
+	}
+}
+`
+	if string(text) != want {
+		t.Errorf("expected\n%s\nbut got\n%s", want, text)
+	}
+}
+
+func TestEncoderEmbeddedStructs(t *testing.T) {
+	type Metadata struct {
+		Zone string `tadl:"zone,attr"`
+		Name string `tadl:"name"`
+	}
+
+	type owner struct {
+		Owner string `tadl:"owner"`
+	}
+
+	type server struct {
+		*Metadata
+		owner
+		Port int `tadl:"port"`
+	}
+
+	type config struct {
+		Server server `tadl:"server"`
+	}
+
+	value := config{Server: server{Metadata: &Metadata{Zone: "eu", Name: "web"}, owner: owner{Owner: "alice"}, Port: 80}}
+
+	text, err := Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `#!{
+	server @zone="eu" {
+		name "web"
+		owner "alice"
+		port "80"
+	}
+}
+`
+	if string(text) != want {
+		t.Errorf("expected\n%s\nbut got\n%s", want, text)
+	}
+}
+
+func TestEncoderCharData(t *testing.T) {
+	type paragraph struct {
+		Lang string `tadl:"lang,attr"`
+		Text string `tadl:",chardata"`
+		Bold string `tadl:"b"`
+	}
+
+	text, err := Marshal(struct {
+		P paragraph `tadl:"p"`
+	}{P: paragraph{Lang: "en", Text: "Read the", Bold: "manual"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `#!{
+	p @lang="en" {
+		"Read the"
+		b "manual"
+	}
+}
+`
+	if string(text) != want {
+		t.Errorf("expected\n%s\nbut got\n%s", want, text)
+	}
+}
+
+func TestQuotedAttributeKeys(t *testing.T) {
+	type request struct {
+		ContentType string            `tadl:"content-type,attr"`
+		Headers     map[string]string `tadl:",attrs"`
+	}
+
+	type config struct {
+		Request request `tadl:"request"`
+	}
+
+	want := config{Request: request{
+		ContentType: "json",
+		Headers:     map[string]string{"content-type": "json", "x-trace id": "1"},
+	}}
+
+	text, err := Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantText := "#!{\n\trequest @\"content-type\"=\"json\" @\"x-trace id\"=\"1\" {}\n}\n"
+	if string(text) != wantText {
+		t.Errorf("expected\n%s\nbut got\n%s", wantText, text)
+	}
+
+	var got config
+	if err := Unmarshal(bytes.NewReader(text), &got, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+}
+
+func TestEncoderAnyChildren(t *testing.T) {
+	type config struct {
+		Name  string             `tadl:"name"`
+		Extra []*parser.TreeNode `tadl:",any"`
+	}
+
+	input := "#!{\n\tname \"web\"\n\tcache @ttl=\"5\" {\n\t\t\"redis\"\n\t}\n}\n"
+
+	var value config
+	if err := Unmarshal(strings.NewReader(input), &value, false); err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(text) != input {
+		t.Errorf("expected\n%s\nbut got\n%s", input, text)
+	}
+}
+
+func TestEncoderOmitEmpty(t *testing.T) {
+	type server struct {
+		ID    int               `tadl:"id,attr,omitempty"`
+		Name  string            `tadl:",label,omitempty"`
+		Host  string            `tadl:"host,omitempty"`
+		Port  int               `tadl:"port,omitempty"`
+		TLS   bool              `tadl:"tls"`
+		Tags  []string          `tadl:"tag,omitempty"`
+		Env   map[string]string `tadl:"env,omitempty"`
+		Debug bool              `json:"debug,omitempty"`
+	}
+
+	text, err := Marshal(struct {
+		A server `tadl:"a"`
+		B server `tadl:"b"`
+	}{
+		A: server{Env: map[string]string{}},
+		B: server{ID: 1, Name: "web", Port: 80, Tags: []string{"x"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the json tag is used as fallback, so Debug is written by its Go name.
+	want := `#!{
+	a {
+		tls "false"
+		Debug "false"
+	}
+	b @id="1" "web" {
+		port "80"
+		tls "false"
+		tag "x"
+		Debug "false"
+	}
+}
+`
+
+	if string(text) != want {
+		t.Errorf("expected\n%s\nbut got\n%s", want, text)
+	}
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf)
+	enc.SetTagFallback("json")
+
+	if err := enc.Encode(struct {
+		S server `tadl:"s"`
+	}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "#!{\n\ts {\n\t\ttls \"false\"\n\t}\n}\n"; buf.String() != want {
+		t.Errorf("expected %q but got %q", want, buf.String())
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	type point struct {
+		X int `tadl:"x,attr"`
+		Y int `tadl:"y,attr"`
+	}
+
+	type shape struct {
+		Center  point   `tadl:"center" format:"inline"`
+		Points  []point `tadl:"point" format:"inline"`
+		Options struct {
+			Fill string
+		} `format:"block"`
+	}
+
+	type drawing struct {
+		Shapes []shape `tadl:"shape"`
+	}
+
+	opts, err := FormatOptions(&drawing{}, WithNameMapper(SnakeCase))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := parser.NewParser("", strings.NewReader(`#!{shape {
+		center @x="0" @y="0" {}, point @x="1" @y="2" {}, point @x="3" @y="4" {}, options {fill "red"}
+	}}`)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := format.Format(tree, append(opts, format.WithSingleLine(100), format.WithMaxWidth(20))...)
+	want := "#!{\n\tshape {\n\t\tcenter @x=\"0\" @y=\"0\" {}\n\t\tpoint @x=\"1\" @y=\"2\" {}\n" +
+		"\t\tpoint @x=\"3\" @y=\"4\" {}\n\t\toptions {\n\t\t\tfill \"red\"\n\t\t}\n\t}\n}\n"
+
+	if got != want {
+		t.Errorf("expected\n%s\nbut got\n%s", want, got)
+	}
+
+	var conflict struct {
+		A point `tadl:"p" format:"inline"`
+		B point `tadl:"p" format:"block"`
+	}
+
+	if _, err := FormatOptions(conflict); err == nil || !strings.Contains(err.Error(), "another layout") {
+		t.Errorf("expected error for conflicting layouts but got %v", err)
+	}
+
+	var unknown struct {
+		A point `format:"compact"`
+	}
+
+	if _, err := FormatOptions(unknown); err == nil || !strings.Contains(err.Error(), "unknown layout 'compact'") {
+		t.Errorf("expected error for unknown layout but got %v", err)
+	}
+
+	if _, err := FormatOptions("text"); err == nil {
+		t.Error("expected error for a schema, which is no struct")
+	}
+}
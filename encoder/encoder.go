@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"errors"
 	"io"
+	"strconv"
 	"strings"
 
 	"github.com/golangee/tadl/parser"
@@ -52,6 +53,8 @@ type Node struct {
 
 	opened    bool
 	blockType parser.BlockType
+	// labels is the number of labels that were written for this node.
+	labels int
 }
 
 // NewNode creates a new named Node
@@ -120,20 +123,40 @@ type Encoder struct {
 	// but are not yet placed in a sensible position.
 	g2Comments Stack
 
+	// rootName is the name of the root element, which is "root" by default.
+	rootName string
+
 	// globalForward indicates the current forward mode
 	// if false, all incoming calls mutate the main stack
 	// if true, they mutate the forward-stack
 	globalForward bool
 }
 
+// Option configures optional behavior of an Encoder.
+type Option func(e *Encoder)
+
+// WithRootName sets the name of the root element, which is "root" by default.
+func WithRootName(name string) Option {
+	return func(e *Encoder) {
+		e.rootName = name
+	}
+}
+
 // NewEncoder creades a new XMLEncoder
 // tadl-input is given as an io.Reader instance
-func NewEncoder(filename string, r io.Reader, w io.Writer, buffsize int) Encoder {
+func NewEncoder(filename string, r io.Reader, w io.Writer, buffsize int, opts ...Option) Encoder {
 	encoder := Encoder{
 		visitor:    *parser.NewVisitor(nil, token.NewLexer(filename, r)),
 		buffWriter: bufio.NewWriterSize(w, buffsize),
+		rootName:   "root",
+	}
+
+	for _, opt := range opts {
+		opt(&encoder)
 	}
+
 	encoder.visitor.SetVisitable(&encoder)
+	encoder.visitor.SetRootName(encoder.rootName)
 	return encoder
 }
 
@@ -190,7 +213,7 @@ func (e *Encoder) Encode() error {
 		return err
 	}
 
-	err = e.writeString(lt, slash, "root", gt)
+	err = e.writeString(lt, slash, escapeDoubleQuotes(e.rootName), gt)
 	if err != nil {
 		return err
 	}
@@ -322,6 +345,24 @@ func (e *Encoder) AddAttribute(key, value string) error {
 	return nil
 }
 
+// AddLabel adds a label to the current parent Node.
+// Labels are encoded as attributes with their index: _label0="[label]", _label1="[label]"...
+func (e *Encoder) AddLabel(label string) error {
+	node := e.stack[len(e.stack)-1]
+	err := e.AddAttribute("_label"+strconv.Itoa(node.labels), label)
+	if err != nil {
+		return err
+	}
+	node.labels++
+	return nil
+}
+
+// AddMetadata encodes an attribute of the G2 preamble as processing instruction in front of the root element.
+// Metadata: @[key]{[value]}		Encoded: <?tadl [key]="[value]"?>
+func (e *Encoder) AddMetadata(key, value string) error {
+	return e.writeString(lt, "?tadl", whitespace, key, equals, dquotes, escapeDoubleQuotes(value), dquotes, "?", gt)
+}
+
 // AddAttributeForward adds a given AttributeMap to the forwaring Attributes
 func (e *Encoder) AddAttributeForward(key, value string) error {
 	v := escapeDoubleQuotes(value)
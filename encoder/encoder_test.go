@@ -15,6 +15,7 @@ func TestEncoderStream(t *testing.T) {
 		want     string
 		wantErr  bool
 		buffsize int
+		opts     []Option
 	}{
 		{
 			name: "hello world",
@@ -186,6 +187,37 @@ func TestEncoderStream(t *testing.T) {
 			buffsize: 10,
 		},
 
+		{
+			name: "G2 labels",
+			text: `#!{
+					server "web" "eu-west" {}
+				}`,
+			want: `<root>
+						<server _label0="web" _label1="eu-west" _groupType="{}"></server>
+					</root>`,
+			wantErr:  false,
+			buffsize: 5,
+		},
+		{
+			name:     "root name",
+			text:     `#book @id{my-book}`,
+			want:     `<library><book id="my-book"></book></library>`,
+			wantErr:  false,
+			buffsize: 5,
+			opts:     []Option{WithRootName("library")},
+		},
+		{
+			name: "G2 preamble attributes",
+			text: `#!@version{2} @schema{books} {
+					book
+				}`,
+			want: `<?tadl version="2"?><?tadl schema="books"?><root>
+						<book></book>
+					</root>`,
+			wantErr:  false,
+			buffsize: 5,
+		},
+
 		// TODO: lack of clarity: "->" encoded to "<ret>" or `<ret _token="->">`?
 		{
 			name: "G2 return arrow, simple",
@@ -285,21 +317,28 @@ func TestEncoderStream(t *testing.T) {
 		},
 		{
 			name:    "Escaped backslash",
-			text:    `#book @id{my-book\} @author{Torben\}`,
+			text:    `#book @id{my-book\\} @author{Torben\\}`,
 			want:    `<root><book id="my-book\" author="Torben\"></book></root>`,
 			wantErr: false,
 		},
+		{
+			name:    "Escaped brackets",
+			text:    `#book @id{my-\{book\}}`,
+			want:    `<root><book id="my-{book}"></book></root>`,
+			wantErr: false,
+		},
 		{
 			name:    "Whitespace after backslash",
-			text:    `#book @id{my-book\ } @author{Torben\}`,
-			wantErr: true,
+			text:    `#book @id{my-book\ } @author{Torben}`,
+			want:    `<root><book id="my-book\ " author="Torben"></book></root>`,
+			wantErr: false,
 		},
 	}
 	for _, test := range tests {
 		t.Run("stream - "+test.name, func(t *testing.T) {
 			writer := new(bytes.Buffer)
 			reader := bytes.NewBuffer([]byte(test.text))
-			encoder = NewEncoder(test.name, reader, writer, test.buffsize)
+			encoder = NewEncoder(test.name, reader, writer, test.buffsize, test.opts...)
 
 			/* first try on testing streaming capability
 			go func() {
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golangee/tadl/token"
+)
+
+// DecodeError is returned when the text of an element or attribute cannot be converted
+// into the type of its field. Use errors.As to get it from the error returned by Unmarshal.
+type DecodeError struct {
+	// FieldPath is the path of the Go field, like "Servers[1].Port".
+	FieldPath string
+	// NodePath is the path of the element in the document, like "/root/Servers/server/port".
+	// Attributes are prefixed with '@'.
+	NodePath string
+	// Pos is the begin of the element.
+	Pos token.Pos
+	// Expected is the Go type of the field.
+	Expected string
+	// Value is the raw text that could not be converted.
+	Value string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: cannot decode '%s' at '%s' into field '%s' of type %s: %v",
+		e.Pos, e.Value, e.NodePath, e.FieldPath, e.Expected, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// path is a stack of the fields and nodes that are currently unmarshalled.
+type path struct {
+	fields []string
+	nodes  []string
+}
+
+// push adds a field and a node segment. Empty segments are left out of the paths and
+// field segments starting with '[' are indices, which are not separated by a '.'.
+func (p *path) push(field, node string) {
+	p.fields = append(p.fields, field)
+	p.nodes = append(p.nodes, node)
+}
+
+// pop removes the latest segments.
+func (p *path) pop() {
+	p.fields = p.fields[:len(p.fields)-1]
+	p.nodes = p.nodes[:len(p.nodes)-1]
+}
+
+// len returns the number of segments.
+func (p *path) len() int {
+	return len(p.fields)
+}
+
+// truncate removes all segments after the first n segments.
+func (p *path) truncate(n int) {
+	p.fields = p.fields[:n]
+	p.nodes = p.nodes[:n]
+}
+
+// field returns the path of the current Go field.
+func (p *path) field() string {
+	var sb strings.Builder
+
+	for _, f := range p.fields {
+		if f == "" {
+			continue
+		}
+
+		if sb.Len() > 0 && !strings.HasPrefix(f, "[") {
+			sb.WriteByte('.')
+		}
+
+		sb.WriteString(f)
+	}
+
+	return sb.String()
+}
+
+// node returns the path of the current node in the document.
+func (p *path) node() string {
+	var sb strings.Builder
+
+	for _, n := range p.nodes {
+		if n == "" {
+			continue
+		}
+
+		sb.WriteByte('/')
+		sb.WriteString(n)
+	}
+
+	return sb.String()
+}
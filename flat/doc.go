@@ -0,0 +1,21 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package flat converts Tadl trees into dotted path and value pairs and back again, which is handy
+// for diffing, exporting to spreadsheets or overriding values from environment variables.
+//
+// The path of an element consists of the names of its parents below the root and its own name,
+// separated by '.'. Elements sharing a name with a sibling are indexed by their position among
+// them, like "server[1]". Attributes are addressed with '@', like "server[1].@zone", and labels
+// with "#label", which is indexed as well if an element has more than one label:
+//
+//  server[0].@zone     eu
+//  server[0].#label    web
+//  server[0].port[0]   80
+//  server[0].port[1]   443
+//  server[1].#label    db
+//  server[1].port      5432
+//
+// The value of an element is its trimmed text. Comments are dropped, so are the positions of text
+// between child elements of mixed content, which is joined into a single value.
+package flat
@@ -0,0 +1,250 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package flat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/token"
+)
+
+const (
+	// AttributePrefix marks the last segment of a path as an attribute key.
+	AttributePrefix = "@"
+	// LabelSegment is the last segment of a path to a label.
+	LabelSegment = "#label"
+)
+
+// PathValue is a single value of a flattened tree.
+type PathValue struct {
+	Path  string
+	Value string
+}
+
+// Flatten returns the values of all elements, attributes and labels below tree in document order.
+// Elements are only included if they have text or nothing at all, so that empty elements are kept.
+func Flatten(tree *parser.TreeNode) []PathValue {
+	var values []PathValue
+
+	flatten(tree, "", &values)
+
+	return values
+}
+
+// flatten appends the values of node, whose path is prefix, to values.
+func flatten(node *parser.TreeNode, prefix string, values *[]PathValue) {
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, value := node.Attributes.Get(i)
+		*values = append(*values, PathValue{Path: join(prefix, AttributePrefix+*key), Value: *value})
+	}
+
+	for i, label := range node.Labels {
+		*values = append(*values, PathValue{Path: join(prefix, segment(LabelSegment, i, len(node.Labels))), Value: label})
+	}
+
+	var (
+		text     strings.Builder
+		elements int
+		count    = map[string]int{}
+		seen     = map[string]int{}
+	)
+
+	for _, child := range node.Children {
+		switch {
+		case child.IsText():
+			text.WriteString(*child.Text)
+		case child.IsNode():
+			count[child.Name]++
+			elements++
+		}
+	}
+
+	if value := strings.TrimSpace(text.String()); value != "" ||
+		(prefix != "" && elements == 0 && node.Attributes.Len() == 0 && len(node.Labels) == 0) {
+		*values = append(*values, PathValue{Path: prefix, Value: value})
+	}
+
+	for _, child := range node.Children {
+		if !child.IsNode() {
+			continue
+		}
+
+		flatten(child, join(prefix, segment(child.Name, seen[child.Name], count[child.Name])), values)
+		seen[child.Name]++
+	}
+}
+
+// join appends seg to the path prefix.
+func join(prefix, seg string) string {
+	if prefix == "" {
+		return seg
+	}
+
+	return prefix + "." + seg
+}
+
+// segment returns name with index i, if there are more than one of them.
+func segment(name string, i, count int) string {
+	if count > 1 {
+		return name + "[" + strconv.Itoa(i) + "]"
+	}
+
+	return name
+}
+
+// Unflatten builds a tree from values, which are applied in order by Set.
+func Unflatten(values []PathValue) (*parser.TreeNode, error) {
+	root := parser.NewNode("root").Block(parser.BlockNormal)
+
+	for _, pv := range values {
+		if err := Set(root, pv.Path, pv.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	return root, nil
+}
+
+// Set sets the value at path below tree, like an override from an environment variable.
+// A segment without index refers to the first element of that name. Missing elements are
+// appended, so that "server[2]" creates up to three server elements. The text of an element
+// is replaced by value, while its child elements are kept.
+//
+//  flat.Set(tree, "server[1].@zone", "us")
+//
+func Set(tree *parser.TreeNode, path, value string) error {
+	segments := strings.Split(path, ".")
+	node := tree
+
+	for i, seg := range segments {
+		last := i == len(segments)-1
+
+		switch {
+		case strings.HasPrefix(seg, AttributePrefix):
+			key := strings.TrimPrefix(seg, AttributePrefix)
+			if !last || key == "" {
+				return fmt.Errorf("'%s': invalid attribute segment '%s'", path, seg)
+			}
+
+			setAttribute(node, key, value)
+
+			return nil
+		case strings.HasPrefix(seg, LabelSegment):
+			index, err := parseIndex(strings.TrimPrefix(seg, LabelSegment))
+			if err != nil || !last {
+				return fmt.Errorf("'%s': invalid label segment '%s'", path, seg)
+			}
+
+			for len(node.Labels) <= index {
+				node.Labels = append(node.Labels, "")
+			}
+
+			node.Labels[index] = value
+			node.Block(parser.BlockNormal)
+
+			return nil
+		}
+
+		name, index, err := splitSegment(seg)
+		if err != nil {
+			return fmt.Errorf("'%s': %w", path, err)
+		}
+
+		node = child(node, name, index)
+	}
+
+	setText(node, value)
+
+	return nil
+}
+
+// splitSegment splits a segment like "server[1]" into its name and index.
+func splitSegment(seg string) (string, int, error) {
+	name := seg
+	if i := strings.IndexByte(seg, '['); i >= 0 {
+		name = seg[:i]
+	}
+
+	index, err := parseIndex(seg[len(name):])
+	if err != nil || !token.IsIdentifier(name) {
+		return "", 0, fmt.Errorf("invalid segment '%s'", seg)
+	}
+
+	return name, index, nil
+}
+
+// parseIndex parses an optional index like "[1]". It returns 0 for an empty string.
+func parseIndex(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return 0, fmt.Errorf("invalid index '%s'", s)
+	}
+
+	index, err := strconv.Atoi(s[1 : len(s)-1])
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid index '%s'", s)
+	}
+
+	return index, nil
+}
+
+// child returns the child element of node with the given name and index among the elements of that
+// name. Missing elements are appended.
+func child(node *parser.TreeNode, name string, index int) *parser.TreeNode {
+	seen := 0
+
+	for _, c := range node.Children {
+		if c.IsNode() && c.Name == name {
+			if seen == index {
+				return c
+			}
+
+			seen++
+		}
+	}
+
+	var c *parser.TreeNode
+	for ; seen <= index; seen++ {
+		c = parser.NewNode(name)
+		node.AddChildren(c)
+	}
+
+	node.Block(parser.BlockNormal)
+
+	return c
+}
+
+// setAttribute replaces the value of the attribute key of node or adds it.
+func setAttribute(node *parser.TreeNode, key, value string) {
+	if node.Attributes.Has(key) {
+		_, v := node.Attributes.Get(node.Attributes.Index(key))
+		*v = value
+
+		return
+	}
+
+	node.AddAttribute(key, value)
+}
+
+// setText replaces the text children of node by value.
+func setText(node *parser.TreeNode, value string) {
+	children := node.Children[:0]
+	for _, c := range node.Children {
+		if !c.IsText() {
+			children = append(children, c)
+		}
+	}
+
+	node.Children = children
+
+	if value != "" {
+		node.Children = append([]*parser.TreeNode{parser.NewStringNode(value)}, node.Children...)
+	}
+}
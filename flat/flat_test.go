@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package flat
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl/format"
+	"github.com/golangee/tadl/parser"
+)
+
+const document = `#!{
+	// the servers
+	server @zone="eu" "web" {port "80", port "443"}
+	server "db" {port "5432"}
+	owner {name "Alice"}
+	debug
+}
+`
+
+func TestFlatten(t *testing.T) {
+	tree, err := parser.NewParser("test.tadl", strings.NewReader(document)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []PathValue{
+		{"server[0].@zone", "eu"},
+		{"server[0].#label", "web"},
+		{"server[0].port[0]", "80"},
+		{"server[0].port[1]", "443"},
+		{"server[1].#label", "db"},
+		{"server[1].port", "5432"},
+		{"owner.name", "Alice"},
+		{"debug", ""},
+	}
+
+	got := Flatten(tree)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v but got %v", want, got)
+	}
+
+	root, err := Unflatten(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := Flatten(root); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v after unflatten but got %v", want, got)
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		value string
+		want  string
+		err   bool
+	}{
+		{name: "text", path: "server[1].port", value: "6543", want: `server "db" {port "6543"}`},
+		{name: "attribute", path: "server[0].@zone", value: "us", want: `server @zone="us" "web"`},
+		{name: "new attribute", path: "server[1].@zone", value: "us", want: `server @zone="us" "db"`},
+		{name: "label", path: "server.#label[1]", value: "prod", want: `server @zone="eu" "web" "prod"`},
+		{name: "new elements", path: "owner.mail[1]", value: "a@b.c", want: `owner {name "Alice", mail, mail "a@b.c"}`},
+		{name: "invalid name", path: "owner.a-b", err: true},
+		{name: "invalid index", path: "server[x]", err: true},
+		{name: "attribute not last", path: "server.@zone.port", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := parser.NewParser("test.tadl", strings.NewReader(document)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = Set(tree, tt.path, tt.value)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v but got %v", tt.err, err)
+			}
+
+			if got := format.Format(tree, format.WithSingleLine(80)); !tt.err && !strings.Contains(got, tt.want) {
+				t.Errorf("expected %s in\n%s", tt.want, got)
+			}
+		})
+	}
+}
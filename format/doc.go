@@ -0,0 +1,21 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package format writes trees back as Tadl text. The output uses the node first grammar G2
+// with one element per line, so that parsing it again results in the same tree:
+//
+//  #!{
+//  	server @id="1" "web" {
+//  		port "80"
+//  	}
+//  }
+//
+// Formatting is canonical: documents which only differ in whitespace or style result in the same text.
+// Options adapt the output to the conventions of a team, like WithSingleLine for short blocks
+// or WithAttributeStyle. WithTransform changes elements while writing, like removing secrets
+// from exported documents. WithSortedChildren makes generated documents reproducible.
+// InsertFragment adds elements to existing text and formats only the changed element.
+//
+// Comments, which have been parsed from the line of an element, stay behind it and are aligned with
+// the trailing comments of the neighboring lines. WithCommentReflow fills comment blocks up to the width limit.
+package format
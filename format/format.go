@@ -0,0 +1,634 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package format
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/token"
+)
+
+// AttributeStyle selects how attributes are written.
+type AttributeStyle int
+
+const (
+	// QuotedAttributes writes attributes like @key="value". This is the default.
+	QuotedAttributes AttributeStyle = iota
+	// BracedAttributes writes attributes like @key{value}. In G2 this style is only allowed in G1 lines,
+	// so it is used for elements without children and brackets, like "# #port @number{80}".
+	// Other elements are written with QuotedAttributes.
+	BracedAttributes
+)
+
+// EmptyStyle selects how elements without children are written.
+type EmptyStyle int
+
+const (
+	// EmptyAsParsed writes empty elements with the brackets of the tree, so "a" stays "a" and "a {}"
+	// stays "a {}". This is the default.
+	EmptyAsParsed EmptyStyle = iota
+	// EmptyBare writes empty elements without brackets, like "a". Elements with labels keep their
+	// block, because labels require one. Group and generic brackets, like "f()" or "list<>", are kept.
+	EmptyBare
+	// EmptyBlock writes empty elements with empty brackets, like "a {}", see also WithBrackets.
+	// G1 lines of BracedAttributes are not changed.
+	EmptyBlock
+)
+
+// Layout is a hint how the block of an element is written, see WithLayout.
+type Layout int
+
+const (
+	// LayoutAuto writes blocks on a single line, if WithSingleLine allows it. This is the default.
+	LayoutAuto Layout = iota
+	// LayoutInline writes the element with its attributes and block on a single line, like
+	// "point @x="1" @y="2"" or "range {from 1, to 5}", no matter how long it is. Blocks containing
+	// comments or line breaks are still written on several lines.
+	LayoutInline
+	// LayoutBlock writes every child on its own line, even if the block would fit on a single line.
+	LayoutBlock
+)
+
+// Serializer writes trees as Tadl text.
+type Serializer struct {
+	w              io.Writer
+	indent         string
+	attributeStyle AttributeStyle
+	brackets       parser.BlockType
+	empty          EmptyStyle
+	layouts        map[string]Layout
+	singleLine     int
+	maxWidth       int
+	tabWidth       int
+	reflow         bool
+	sorted         bool
+	pinned         map[string]bool
+	transforms     []transform
+	buf            bytes.Buffer
+	// inline is true while a block is tried to be written on a single line.
+	inline bool
+	// multiline is set, if something was written while inline is true, that requires its own line.
+	multiline bool
+	// margin is written before the indentation of each line, see InsertFragment.
+	margin string
+}
+
+// Option configures a Serializer.
+type Option func(s *Serializer)
+
+// WithIndent sets the string used for each level of indentation. The default is a tab.
+func WithIndent(indent string) Option {
+	return func(s *Serializer) {
+		s.indent = indent
+	}
+}
+
+// WithAttributeStyle selects how attributes are written, see AttributeStyle.
+func WithAttributeStyle(style AttributeStyle) Option {
+	return func(s *Serializer) {
+		s.attributeStyle = style
+	}
+}
+
+// WithBrackets sets the brackets for elements, which have children but no brackets in the tree,
+// like elements of G1 with several forwarded children. The default is parser.BlockNormal.
+func WithBrackets(blockType parser.BlockType) Option {
+	return func(s *Serializer) {
+		if blockType != parser.BlockNone {
+			s.brackets = blockType
+		}
+	}
+}
+
+// WithEmptyElements selects how elements without children are written, see EmptyStyle.
+// Unmarshal treats all forms alike, so this only changes the text, like for diffs of generated files.
+func WithEmptyElements(style EmptyStyle) Option {
+	return func(s *Serializer) {
+		s.empty = style
+	}
+}
+
+// WithLayout writes the elements with one of the given names with layout. It overrides WithSingleLine
+// and WithMaxWidth for them, so that elements of a domain look the same in all documents. Layouts
+// derived from the struct tags of a schema are returned by tadl.FormatOptions.
+//
+//  format.WithLayout(format.LayoutInline, "point", "range")
+func WithLayout(layout Layout, names ...string) Option {
+	return func(s *Serializer) {
+		if s.layouts == nil {
+			s.layouts = map[string]Layout{}
+		}
+
+		for _, name := range names {
+			s.layouts[name] = layout
+		}
+	}
+}
+
+// WithSingleLine writes blocks on a single line, like "{a, b}", if they are at most maxLength
+// runes long and contain no comments. By default, every child is written on its own line.
+func WithSingleLine(maxLength int) Option {
+	return func(s *Serializer) {
+		s.singleLine = maxLength
+	}
+}
+
+// WithMaxWidth wraps lines, which would be longer than width columns. Attributes and labels, that
+// do not fit into the line of their element, continue on the next line, indented twice as deep
+// as the element. Blocks are only written on a single line, see WithSingleLine, if they fit.
+// Lines are never wrapped inside of a string, so they may still be longer. Tabs advance to the
+// next tab stop, see WithTabWidth.
+func WithMaxWidth(width int) Option {
+	return func(s *Serializer) {
+		s.maxWidth = width
+	}
+}
+
+// WithTabWidth sets the width of tab stops that is used to compute the columns for WithMaxWidth,
+// WithCommentReflow and aligned trailing comments. By default a tab counts as a single column,
+// like for token.WithTabWidth. Use the tab width of your editor, so that wrapped lines fit into it.
+// Widths smaller than one are ignored.
+func WithTabWidth(width int) Option {
+	return func(s *Serializer) {
+		if width > 0 {
+			s.tabWidth = width
+		}
+	}
+}
+
+// PreserveDirective marks a block of comments, which is written unchanged by WithCommentReflow,
+// if it is the text of its first line, like in
+//
+//  // tadl:preserve
+//  // key | value
+//  // ----+------
+//  // a   | 1
+const PreserveDirective = "tadl:preserve"
+
+// WithCommentReflow fills the lines of consecutive comments up to the width of WithMaxWidth, so that
+// lines are joined and split at spaces. Blocks starting with PreserveDirective are not changed.
+// Without WithMaxWidth, this option has no effect.
+func WithCommentReflow() Option {
+	return func(s *Serializer) {
+		s.reflow = true
+	}
+}
+
+// NewSerializer creates a Serializer that writes to w.
+func NewSerializer(w io.Writer, opts ...Option) *Serializer {
+	s := &Serializer{
+		w:        w,
+		indent:   "\t",
+		brackets: parser.BlockNormal,
+		tabWidth: 1,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Format returns the text of tree. It returns an empty string, if a selector of WithTransform is invalid.
+func Format(tree *parser.TreeNode, opts ...Option) string {
+	var sb strings.Builder
+
+	// Writing to a strings.Builder does not fail, only options can be invalid.
+	if err := NewSerializer(&sb, opts...).Serialize(tree); err != nil {
+		return ""
+	}
+
+	return sb.String()
+}
+
+// Serialize writes tree as G2 document. The name and attributes of the root element are not
+// part of the output, because G2 has no syntax for them.
+func (s *Serializer) Serialize(tree *parser.TreeNode) error {
+	return s.serialize(tree, parser.NewAttributeList(), false)
+}
+
+// SerializeDocument writes the tree of doc together with its metadata in the preamble.
+// A G2 root without brackets, see parser.WithRootBlocks, is written without brackets again.
+func (s *Serializer) SerializeDocument(doc *parser.Document) error {
+	return s.serialize(doc.Root, doc.Metadata, doc.Grammar() == token.G2)
+}
+
+func (s *Serializer) serialize(tree *parser.TreeNode, metadata parser.AttributeList, bare bool) error {
+	if len(s.transforms) > 0 {
+		transformed, err := s.transformTree(tree)
+		if err != nil {
+			return err
+		}
+
+		if transformed == nil {
+			transformed = parser.NewNode(tree.Name).Block(parser.BlockNormal)
+		}
+
+		tree = transformed
+	}
+
+	s.buf.Reset()
+	s.buf.WriteString("#!")
+
+	for i := 0; i < metadata.Len(); i++ {
+		key, value := metadata.Get(i)
+		s.buf.WriteString("@" + token.QuoteKey(*key) + "{" + token.EscapeG1(*value) + "} ")
+	}
+
+	for _, label := range tree.Labels {
+		s.buf.WriteString(quote(label) + " ")
+	}
+
+	// Only a single element can follow the preamble without brackets.
+	if bare && tree.BlockType == parser.BlockNone && len(tree.Labels) == 0 &&
+		len(tree.Children) == 1 && tree.Children[0].IsNode() {
+		s.node(tree.Children[0], 0)
+	} else {
+		s.block(tree, 0)
+	}
+
+	s.buf.WriteString("\n")
+
+	_, err := s.w.Write(s.buf.Bytes())
+
+	return err
+}
+
+// block writes the children of node enclosed in its brackets. Short blocks are written on a single
+// line, see WithSingleLine, otherwise each child is written on its own line.
+func (s *Serializer) block(node *parser.TreeNode, depth int) {
+	brackets := string(node.BlockType)
+	if node.BlockType == parser.BlockNone {
+		brackets = string(s.brackets)
+	}
+
+	s.buf.WriteByte(brackets[0])
+
+	children := s.children(node)
+
+	if len(children) == 0 {
+		s.buf.WriteByte(brackets[1])
+
+		return
+	}
+
+	layout := s.layouts[node.Name]
+
+	// A block inside of a single line prevents that line.
+	if s.inline && layout == LayoutBlock {
+		s.multiline = true
+	}
+
+	if (s.singleLine > 0 || layout == LayoutInline) && layout != LayoutBlock && !s.inline {
+		start := s.buf.Len()
+		s.inline, s.multiline = true, false
+
+		s.inlineChildren(children)
+
+		s.inline = false
+		if !s.multiline && (layout == LayoutInline || utf8.RuneCount(s.buf.Bytes()[start:]) <= s.singleLine &&
+			(s.maxWidth <= 0 || s.column()+1 <= s.maxWidth)) {
+			s.buf.WriteByte(brackets[1])
+
+			return
+		}
+
+		s.buf.Truncate(start)
+	}
+
+	if s.inline {
+		s.inlineChildren(children)
+		s.buf.WriteByte(brackets[1])
+
+		return
+	}
+
+	// Trailing comments of consecutive lines are aligned like a column.
+	var column []trailing
+
+	for i := 0; i < len(children); i++ {
+		child := children[i]
+
+		if i > 0 && s.isTrailing(children[i-1], child) {
+			column = append(column, trailing{offset: s.buf.Len(), column: s.column()})
+			s.buf.WriteString(" // " + *child.Comment)
+
+			continue
+		}
+
+		s.buf.WriteString("\n")
+		s.writeIndent(depth + 1)
+
+		if child.IsComment() {
+			s.align(column)
+			column = nil
+
+			end := i + 1
+			for end < len(children) && children[end].IsComment() {
+				end++
+			}
+
+			s.comments(children[i:end], depth+1)
+			i = end - 1
+
+			continue
+		}
+
+		start := s.buf.Len()
+
+		// An element without a block would swallow its next sibling as child, which
+		// is prevented by a comma.
+		if open := s.node(child, depth+1); open && i < len(children)-1 {
+			s.buf.WriteString(",")
+		}
+
+		// A comment after several lines is not aligned with the ones before.
+		if bytes.IndexByte(s.buf.Bytes()[start:], '\n') >= 0 {
+			s.align(column)
+			column = nil
+		}
+
+		if i+1 == len(children) || !s.isTrailing(child, children[i+1]) {
+			s.align(column)
+			column = nil
+		}
+	}
+
+	s.align(column)
+
+	s.buf.WriteString("\n")
+	s.writeIndent(depth)
+	s.buf.WriteByte(brackets[1])
+}
+
+// g1Line returns true, if node is written as G1 line with braced attributes.
+func (s *Serializer) g1Line(node *parser.TreeNode) bool {
+	return s.attributeStyle == BracedAttributes && node.IsNode() && node.Attributes.Len() > 0 &&
+		len(node.Children) == 0 && len(node.Labels) == 0 && node.BlockType == parser.BlockNone &&
+		!multilineAttributes(node)
+}
+
+// trailing is the position of a trailing comment in the buffer and the column before it.
+type trailing struct {
+	offset int
+	column int
+}
+
+// isTrailing returns true, if comment has been parsed from the line on which node ends.
+// A G1 line would take the comment as text, so it is written on its own line.
+func (s *Serializer) isTrailing(node, comment *parser.TreeNode) bool {
+	return comment.IsComment() && !node.IsComment() && !s.g1Line(node) && !strings.Contains(*comment.Comment, "\n") &&
+		comment.Range.BeginPos.Line > 0 && comment.Range.BeginPos.Line == node.Range.EndPos.Line
+}
+
+// align inserts spaces before trailing comments, so that they all start in the same column.
+// The comments must have been written from top to bottom.
+func (s *Serializer) align(comments []trailing) {
+	if len(comments) < 2 {
+		return
+	}
+
+	maxColumn := 0
+	for _, c := range comments {
+		if c.column > maxColumn {
+			maxColumn = c.column
+		}
+	}
+
+	b := s.buf.Bytes()
+	aligned := make([]byte, 0, len(b)+len(comments)*maxColumn)
+	last := 0
+
+	for _, c := range comments {
+		aligned = append(aligned, b[last:c.offset]...)
+		aligned = append(aligned, strings.Repeat(" ", maxColumn-c.column)...)
+		last = c.offset
+	}
+
+	aligned = append(aligned, b[last:]...)
+
+	s.buf.Reset()
+	s.buf.Write(aligned)
+}
+
+// comments writes consecutive comments at depth, reflowed if requested by WithCommentReflow.
+func (s *Serializer) comments(comments []*parser.TreeNode, depth int) {
+	var lines []string
+	for _, comment := range comments {
+		lines = append(lines, strings.Split(*comment.Comment, "\n")...)
+	}
+
+	if s.reflow && s.maxWidth > 0 && strings.TrimSpace(lines[0]) != PreserveDirective {
+		lines = reflow(lines, s.maxWidth-s.column()-len("// "))
+	}
+
+	for i, line := range lines {
+		if i > 0 {
+			s.buf.WriteString("\n")
+			s.writeIndent(depth)
+		}
+
+		s.buf.WriteString("// " + line)
+	}
+
+	s.multiline = true
+}
+
+// reflow fills lines with the words of text, so that they are at most width columns long.
+// Words, which are longer, get a line of their own.
+func reflow(text []string, width int) []string {
+	var lines []string
+	line := ""
+
+	for _, word := range strings.Fields(strings.Join(text, " ")) {
+		switch {
+		case line == "":
+			line = word
+		case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+
+	// Comments consisting of spaces only are kept as they are.
+	if line == "" {
+		return text
+	}
+
+	return append(lines, line)
+}
+
+// inlineChildren writes children separated by commas.
+func (s *Serializer) inlineChildren(children []*parser.TreeNode) {
+	for i, child := range children {
+		switch {
+		case i == 0:
+		case children[i-1].IsText():
+			// A text is not followed by a comma.
+			s.buf.WriteString(" ")
+		default:
+			s.buf.WriteString(", ")
+		}
+
+		s.node(child, 0)
+	}
+}
+
+// node writes a single node and returns true, if a following sibling would become its child.
+func (s *Serializer) node(node *parser.TreeNode, depth int) (open bool) {
+	switch {
+	case node.IsText():
+		s.buf.WriteString(quote(*node.Text))
+		s.multiline = s.multiline || strings.ContainsAny(*node.Text, "\r\n")
+
+		return false
+	case node.IsComment():
+		s.comments([]*parser.TreeNode{node}, depth)
+
+		return false
+	}
+
+	// A G1 line allows braced attributes for elements without children.
+	if s.g1Line(node) {
+		s.buf.WriteString("# #" + node.Name)
+
+		for i := 0; i < node.Attributes.Len(); i++ {
+			key, value := node.Attributes.Get(i)
+			s.buf.WriteString(" @" + token.QuoteKey(*key) + "{" + token.EscapeG1(*value) + "}")
+		}
+
+		s.multiline = true
+
+		return false
+	}
+
+	node = s.emptyElement(node)
+	s.buf.WriteString(node.Name)
+
+	// Attributes and labels of inline elements are never wrapped.
+	inline := s.layouts[node.Name] == LayoutInline
+
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, value := node.Attributes.Get(i)
+		s.wrap("@"+token.QuoteKey(*key)+"="+quote(*value), i == 0 || inline, depth)
+	}
+
+	for i, label := range node.Labels {
+		s.wrap(quote(label), i == 0 && node.Attributes.Len() == 0 || inline, depth)
+	}
+
+	// Without brackets, a single child can follow its parent directly, like in "a b" or "a "text"".
+	if node.BlockType == parser.BlockNone && len(node.Labels) == 0 {
+		switch {
+		case len(node.Children) == 0:
+			return true
+		case len(node.Children) == 1 && !node.Children[0].IsComment():
+			s.buf.WriteString(" ")
+
+			return s.node(node.Children[0], depth)
+		}
+	}
+
+	s.buf.WriteString(" ")
+	s.block(node, depth)
+
+	return false
+}
+
+// emptyElement returns node with the brackets selected by WithEmptyElements, if node has no children.
+// The tree is not changed, a copy is returned instead.
+func (s *Serializer) emptyElement(node *parser.TreeNode) *parser.TreeNode {
+	if len(node.Children) > 0 {
+		return node
+	}
+
+	blockType := node.BlockType
+
+	switch {
+	case s.empty == EmptyBare && blockType == parser.BlockNormal && len(node.Labels) == 0:
+		blockType = parser.BlockNone
+	case s.empty == EmptyBlock && blockType == parser.BlockNone:
+		blockType = s.brackets
+	}
+
+	if blockType == node.BlockType {
+		return node
+	}
+
+	empty := *node
+	empty.BlockType = blockType
+
+	return &empty
+}
+
+// wrap writes an attribute or label of an element at depth. It continues on the next line, if it does not fit
+// into the current one. The first one is never wrapped, so that an element does not end up alone on its line.
+func (s *Serializer) wrap(text string, first bool, depth int) {
+	s.multiline = s.multiline || strings.ContainsAny(text, "\r\n")
+
+	if s.maxWidth <= 0 || s.inline || first || s.advance(s.column()+1, text) <= s.maxWidth {
+		s.buf.WriteString(" " + text)
+
+		return
+	}
+
+	s.buf.WriteString("\n")
+	s.writeIndent(depth + 2)
+	s.buf.WriteString(text)
+}
+
+// column returns the width of the current line.
+func (s *Serializer) column() int {
+	b := s.buf.Bytes()
+
+	return s.advance(0, string(b[bytes.LastIndexByte(b, '\n')+1:]))
+}
+
+// advance returns the column after text, which starts at column col, until its first line break.
+// Tabs advance to the next tab stop.
+func (s *Serializer) advance(col int, text string) int {
+	for _, r := range text {
+		switch r {
+		case '\r', '\n':
+			return col
+		case '\t':
+			col = (col/s.tabWidth + 1) * s.tabWidth
+		default:
+			col++
+		}
+	}
+
+	return col
+}
+
+func (s *Serializer) writeIndent(depth int) {
+	s.buf.WriteString(s.margin)
+
+	for i := 0; i < depth; i++ {
+		s.buf.WriteString(s.indent)
+	}
+}
+
+// multilineAttributes returns true, if an attribute value of node contains a line break.
+func multilineAttributes(node *parser.TreeNode) bool {
+	for i := 0; i < node.Attributes.Len(); i++ {
+		if _, value := node.Attributes.Get(i); strings.ContainsAny(*value, "\r\n") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// quote returns text as quoted string.
+func quote(text string) string {
+	return `"` + token.EscapeG2(text) + `"`
+}
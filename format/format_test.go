@@ -0,0 +1,480 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/store"
+)
+
+func parse(t *testing.T, text string) *parser.TreeNode {
+	t.Helper()
+
+	tree, err := parser.NewParser("format_test.go", strings.NewReader(text)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tree
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "empty",
+			text: `#!{}`,
+			want: "#!{}\n",
+		},
+		{
+			name: "siblings",
+			text: `#!{a, b, c}`,
+			want: "#!{\n\ta,\n\tb,\n\tc\n}\n",
+		},
+		{
+			name: "nested",
+			text: `#!{a b "text" c}`,
+			want: "#!{\n\ta b \"text\"\n\tc\n}\n",
+		},
+		{
+			name: "attributes and labels",
+			text: `#!{server @id="1" "web" {port "80"}}`,
+			want: "#!{\n\tserver @id=\"1\" \"web\" {\n\t\tport \"80\"\n\t}\n}\n",
+		},
+		{
+			name: "brackets",
+			text: `#!{f(a, b) list<T> x {}}`,
+			want: "#!{\n\tf (\n\t\ta,\n\t\tb\n\t)\n\tlist <\n\t\tT\n\t>\n\tx {}\n}\n",
+		},
+		{
+			name: "comments",
+			text: "#!{\n// hello\na}",
+			want: "#!{\n\t// hello\n\ta\n}\n",
+		},
+		{
+			name: "quotes",
+			text: `#!{a @k="say \"hi\"" "\"x\""}`,
+			want: "#!{\n\ta @k=\"say \\\"hi\\\"\" \"\\\"x\\\"\"\n}\n",
+		},
+		{
+			name: "escapes",
+			text: `#a @k{\{C:\\\}} {#b{"\#x}}`,
+			want: "#!{\n\ta @k=\"{C:\\\\}\" {\n\t\tb {\n\t\t\t\"\\\"#x\"\n\t\t}\n\t}\n}\n",
+		},
+		{
+			name: "g1",
+			text: `#a @k{v} {text #b}`,
+			want: "#!{\n\ta @k=\"v\" {\n\t\t\"text \"\n\t\tb\n\t}\n}\n",
+		},
+		{
+			name: "quoted attribute keys",
+			text: `#a @"content-type"{json} @"say \"hi\""{x}`,
+			want: "#!{\n\ta @\"content-type\"=\"json\" @\"say \\\"hi\\\"\"=\"x\"\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := parse(t, tt.text)
+
+			got := Format(tree)
+			if got != tt.want {
+				t.Errorf("expected\n%s\nbut got\n%s", tt.want, got)
+			}
+
+			if store.Hash(parse(t, got)) != store.Hash(tree) {
+				t.Errorf("parsing the output results in another tree")
+			}
+		})
+	}
+}
+
+func TestSerializeDocument(t *testing.T) {
+	doc, err := parser.NewParser("format_test.go", strings.NewReader(`#!@version{2\}} {a}`)).ParseDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sb strings.Builder
+	if err := NewSerializer(&sb, WithIndent("  ")).SerializeDocument(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "#!@version{2\\}} {\n  a\n}\n"; sb.String() != want {
+		t.Errorf("expected %q but got %q", want, sb.String())
+	}
+
+	// The brackets of the root are kept.
+	for _, text := range []string{"#!(a, b)\n", "#!server {a}\n"} {
+		doc, err := parser.NewParser("format_test.go", strings.NewReader(text),
+			parser.WithRootBlocks(parser.BlockGroup, parser.BlockNone)).ParseDocument()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sb.Reset()
+		if err := NewSerializer(&sb, WithIndent("  "), WithSingleLine(20)).SerializeDocument(doc); err != nil {
+			t.Fatal(err)
+		}
+
+		if sb.String() != text {
+			t.Errorf("expected %q but got %q", text, sb.String())
+		}
+	}
+}
+
+func TestWithTransform(t *testing.T) {
+	const text = `#!{db @password="x" {user "admin"}, cache {db @password="y"}, db @password="z"}`
+
+	mask := func(node *parser.TreeNode) *parser.TreeNode {
+		for i := 0; i < node.Attributes.Len(); i++ {
+			if key, value := node.Attributes.Get(i); *key == "password" {
+				*value = "***"
+			}
+		}
+
+		return node
+	}
+
+	drop := func(node *parser.TreeNode) *parser.TreeNode {
+		return nil
+	}
+
+	rename := func(node *parser.TreeNode) *parser.TreeNode {
+		node.Name = "database"
+		return node
+	}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "mask direct children",
+			opts: []Option{WithTransform("/root/db", mask)},
+			want: `#!{db @password="***" {user "admin"}, cache {db @password="y"}, db @password="***"}`,
+		},
+		{
+			name: "mask everywhere",
+			opts: []Option{WithTransform("/**/db", mask)},
+			want: `#!{db @password="***" {user "admin"}, cache {db @password="***"}, db @password="***"}`,
+		},
+		{
+			name: "drop by index",
+			opts: []Option{WithTransform("/root/db[1]", drop), WithTransform("/root/*/db", drop)},
+			want: `#!{db @password="x" {user "admin"}, cache {}}`,
+		},
+		{
+			name: "rename and drop descendants",
+			opts: []Option{WithTransform("/root/db[0]", rename), WithTransform("/**/user", drop)},
+			want: `#!{database @password="x" {}, cache {db @password="y"}, db @password="z"}`,
+		},
+		{
+			name: "drop root",
+			opts: []Option{WithTransform("/root", drop)},
+			want: `#!{}`,
+		},
+		{
+			name:    "invalid selector",
+			opts:    []Option{WithTransform("root", drop)},
+			wantErr: true,
+		},
+		{
+			name:    "invalid index",
+			opts:    []Option{WithTransform("/root/db[x]", drop)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := parse(t, text)
+
+			var sb strings.Builder
+
+			err := NewSerializer(&sb, tt.opts...).Serialize(tree)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, but did not get one")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if store.Hash(parse(t, sb.String())) != store.Hash(parse(t, tt.want)) {
+				t.Errorf("expected %s but got\n%s", tt.want, sb.String())
+			}
+
+			// The tree itself is unchanged.
+			if store.Hash(tree) != store.Hash(parse(t, text)) {
+				t.Errorf("tree has been modified: %s", Format(tree))
+			}
+		})
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		opts []Option
+		want string
+	}{
+		{
+			name: "braced attributes",
+			text: `#!{port @number="80" @note="{x}", server @id="1" {a}}`,
+			opts: []Option{WithAttributeStyle(BracedAttributes)},
+			want: "#!{\n\t# #port @number{80} @note{\\{x\\}}\n\tserver @id=\"1\" {\n\t\ta\n\t}\n}\n",
+		},
+		{
+			name: "brackets",
+			text: `##a ##b #c`,
+			opts: []Option{WithBrackets(parser.BlockGroup)},
+			want: "#!{\n\tc (\n\t\ta,\n\t\tb\n\t)\n}\n",
+		},
+		{
+			name: "single line",
+			text: `#!{server "web" {port "80", host "localhost"}, list<int>}`,
+			opts: []Option{WithSingleLine(40)},
+			want: "#!{\n\tserver \"web\" {port \"80\", host \"localhost\"}\n\tlist <int>\n}\n",
+		},
+		{
+			name: "single line root",
+			text: `#!{a, "text" b {c}}`,
+			opts: []Option{WithSingleLine(40)},
+			want: "#!{a, \"text\" b {c}}\n",
+		},
+		{
+			name: "single line too long",
+			text: `#!{server {port "80", host "localhost"}}`,
+			opts: []Option{WithSingleLine(20)},
+			want: "#!{\n\tserver {\n\t\tport \"80\"\n\t\thost \"localhost\"\n\t}\n}\n",
+		},
+		{
+			name: "single line without comments",
+			text: "#!{server {\n// comment\nport}}",
+			opts: []Option{WithSingleLine(40)},
+			want: "#!{\n\tserver {\n\t\t// comment\n\t\tport\n\t}\n}\n",
+		},
+		{
+			name: "max width",
+			text: `#!{server @id="1" @name="frontend" @host="localhost" "web" {port "80"}}`,
+			opts: []Option{WithMaxWidth(30), WithTabWidth(4)},
+			want: "#!{\n\tserver @id=\"1\"\n\t\t\t@name=\"frontend\"\n\t\t\t@host=\"localhost\"\n\t\t\t\"web\" {\n\t\tport \"80\"\n\t}\n}\n",
+		},
+		{
+			name: "max width with tabs of a single column",
+			text: `#!{server @id="1" @name="frontend" @host="localhost" "web" {port "80"}}`,
+			opts: []Option{WithMaxWidth(30)},
+			want: "#!{\n\tserver @id=\"1\"\n\t\t\t@name=\"frontend\"\n\t\t\t@host=\"localhost\" \"web\" {\n\t\tport \"80\"\n\t}\n}\n",
+		},
+		{
+			name: "max width with tab stops",
+			text: `#!{server @a="1" @b="2"}`,
+			opts: []Option{WithMaxWidth(24), WithTabWidth(4), WithIndent(" \t")},
+			want: "#!{\n \tserver @a=\"1\" @b=\"2\"\n}\n",
+		},
+		{
+			name: "max width with single line",
+			text: `#!{a {b {c, d}, e {f}}}`,
+			opts: []Option{WithMaxWidth(14), WithSingleLine(100), WithIndent("  ")},
+			want: "#!{\n  a {\n    b {c, d}\n    e {f}\n  }\n}\n",
+		},
+		{
+			name: "aligned trailing comments",
+			text: "#!{a, // first\nserver {} // second\n\nport \"80\" // third\nb {\nc\n} // fourth\nd, // fifth\n}",
+			want: "#!{\n\ta,        // first\n\tserver {} // second\n\tport \"80\" // third\n\tb {\n\t\tc\n\t}  // fourth\n\td, // fifth\n}\n",
+		},
+		{
+			name: "trailing comment after a block",
+			text: "#!{a {b} // x\n}",
+			want: "#!{\n\ta {\n\t\tb\n\t} // x\n}\n",
+		},
+		{
+			name: "trailing comment after a formatted block",
+			text: "#!{\n\ta {\n\t\tb\n\t} // x\n}\n",
+			want: "#!{\n\ta {\n\t\tb\n\t} // x\n}\n",
+		},
+		{
+			name: "trailing comment after g1 line",
+			text: "#!{port @number=\"80\", // comment\n}",
+			opts: []Option{WithAttributeStyle(BracedAttributes)},
+			want: "#!{\n\t# #port @number{80}\n\t// comment\n}\n",
+		},
+		{
+			name: "comment reflow",
+			text: "#!{a {\n// This comment is\n// much too long for a single line.\nb\n}}",
+			opts: []Option{WithMaxWidth(26), WithTabWidth(4), WithCommentReflow()},
+			want: "#!{\n\ta {\n\t\t// This comment is\n\t\t// much too long\n\t\t// for a single\n\t\t// line.\n\t\tb\n\t}\n}\n",
+		},
+		{
+			name: "comment reflow joins lines",
+			text: "#!{\n// short\n// lines\n// are joined\na}",
+			opts: []Option{WithMaxWidth(40), WithCommentReflow()},
+			want: "#!{\n\t// short lines are joined\n\ta\n}\n",
+		},
+		{
+			name: "preserved comments",
+			text: "#!{\n// tadl:preserve\n//   a | b\n//   1 | 2\na}",
+			opts: []Option{WithMaxWidth(40), WithCommentReflow()},
+			want: "#!{\n\t// tadl:preserve\n\t// a | b\n\t// 1 | 2\n\ta\n}\n",
+		},
+		{
+			name: "sorted children",
+			text: "#!{c, a {z, y} // a\n// about b\nb, a \"text\"\n// end\n}",
+			opts: []Option{WithSortedChildren()},
+			want: "#!{\n\ta {\n\t\ty,\n\t\tz\n\t} // a\n\ta \"text\"\n\t// about b\n\tb,\n\tc,\n\t// end\n}\n",
+		},
+		{
+			name: "sorted children with pins",
+			text: "#!{steps {build, test, deploy}, env {b, a}}",
+			opts: []Option{WithSortedChildren("steps"), WithSingleLine(30)},
+			want: "#!{\n\tenv {a, b}\n\tsteps {build, test, deploy}\n}\n",
+		},
+		{
+			name: "mixed content is not sorted",
+			text: "#!{p {\"b\" b \"a\" a}}",
+			opts: []Option{WithSortedChildren()},
+			want: "#!{\n\tp {\n\t\t\"b\"\n\t\tb \"a\"\n\t\ta\n\t}\n}\n",
+		},
+		{
+			name: "inline layout",
+			text: `#!{shape {center {x 1, y 2}, point @x="1" @y="2" @z="3", note {// c
+x}}}`,
+			opts: []Option{WithLayout(LayoutInline, "center", "point", "note"), WithMaxWidth(20)},
+			want: "#!{\n\tshape {\n\t\tcenter {x 1, y 2}\n\t\tpoint @x=\"1\" @y=\"2\" @z=\"3\",\n\t\tnote {\n\t\t\t// c\n\t\t\tx\n\t\t}\n\t}\n}\n",
+		},
+		{
+			name: "block layout",
+			text: `#!{a {b {c}, d {e}}}`,
+			opts: []Option{WithLayout(LayoutBlock, "d"), WithSingleLine(40)},
+			want: "#!{\n\ta {\n\t\tb {c}\n\t\td {\n\t\t\te\n\t\t}\n\t}\n}\n",
+		},
+		{
+			name: "empty elements as parsed",
+			text: `#!{a, b {}, c "x" {}, f(), d @k="v" {}, e {g}}`,
+			opts: []Option{WithSingleLine(60)},
+			want: "#!{a, b {}, c \"x\" {}, f (), d @k=\"v\" {}, e {g}}\n",
+		},
+		{
+			name: "empty elements bare",
+			text: `#!{a, b {}, c "x" {}, f(), d @k="v" {}, e {g}}`,
+			opts: []Option{WithSingleLine(60), WithEmptyElements(EmptyBare)},
+			want: "#!{a, b, c \"x\" {}, f (), d @k=\"v\", e {g}}\n",
+		},
+		{
+			name: "empty elements with block",
+			text: `#!{a, b {}, c "x" {}, f(), d @k="v" {}, e {g}}`,
+			opts: []Option{WithSingleLine(60), WithEmptyElements(EmptyBlock)},
+			want: "#!{a {}, b {}, c \"x\" {}, f (), d @k=\"v\" {}, e {g {}}}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := parse(t, tt.text)
+
+			got := Format(tree, tt.opts...)
+			if got != tt.want {
+				t.Errorf("expected\n%s\nbut got\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInsertFragment(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		path     string
+		fragment string
+		opts     []Option
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "only the target is formatted",
+			text:     "#!{\n  x {\n    a @k=\"v\" {b, \"t\"}, // c\n    e   \"text\"\n  }\n}\n",
+			path:     "/root/x/a",
+			fragment: "#!{d {e}}",
+			opts:     []Option{WithIndent("  ")},
+			want:     "#!{\n  x {\n    a @k=\"v\" {\n      b,\n      \"t\"\n      d {\n        e\n      }\n    }, // c\n    e   \"text\"\n  }\n}\n",
+		},
+		{
+			name:     "fragment without preamble",
+			text:     "#!{\n\tservers {\n\t\tserver @id=\"1\" {port \"80\"}\n\t}\n}\n",
+			path:     "/root/servers",
+			fragment: `server @id="3" {port "80"}`,
+			want:     "#!{\n\tservers {\n\t\tserver @id=\"1\" {\n\t\t\tport \"80\"\n\t\t}\n\t\tserver @id=\"3\" {\n\t\t\tport \"80\"\n\t\t}\n\t}\n}\n",
+		},
+		{
+			name:     "element without block",
+			text:     "#!{a, b}",
+			path:     "/root/a",
+			fragment: "#!{c}",
+			want:     "#!{a c, b}",
+		},
+		{
+			name:     "widths include the text before the target",
+			text:     "#!{x {a @k=\"v\" @l=\"w\"}}",
+			path:     "/root/x/a",
+			fragment: "#!{b}",
+			opts:     []Option{WithMaxWidth(20)},
+			want:     "#!{x {a @k=\"v\"\n\t\t@l=\"w\" b}}",
+		},
+		{
+			name:     "root",
+			text:     "#!{a,   b}",
+			path:     "/root",
+			fragment: "#!{c}",
+			want:     "#!{\n\ta,\n\tb,\n\tc\n}\n",
+		},
+		{
+			name:     "g1",
+			text:     "#a",
+			path:     "/root/a",
+			fragment: "#b",
+			wantErr:  true,
+		},
+		{
+			name:     "unknown path",
+			text:     "#!{a}",
+			path:     "/root/b",
+			fragment: "c",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InsertFragment(tt.text, tt.path, tt.fragment, tt.opts...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, but got none")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("expected\n%s\nbut got\n%s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package format
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/token"
+)
+
+// InsertFragment inserts the elements of fragment into the element at path of the G2 document src,
+// see parser.InsertFragment, and returns the changed text. Only the element at path is formatted again,
+// the text before and after it is kept unchanged, so that code-mod tools produce small diffs:
+//
+//  text, err := format.InsertFragment(src, "/root/servers", `server @id="3" {port "80"}`)
+//
+// The element is indented like the line it starts on, nested lines are indented with WithIndent.
+// Transformations of WithTransform are not applied.
+func InsertFragment(src, path, fragment string, opts ...Option) (string, error) {
+	doc, err := parser.NewParser("", strings.NewReader(src)).ParseDocument()
+	if err != nil {
+		return "", err
+	}
+
+	if doc.Grammar() != token.G2 {
+		return "", fmt.Errorf("cannot insert into %s: only G2 documents can be formatted", path)
+	}
+
+	if err := parser.InsertFragment(doc, path, fragment); err != nil {
+		return "", err
+	}
+
+	target, err := doc.Find(path)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+
+	s := NewSerializer(&sb, opts...)
+
+	if target == doc.Root {
+		if err := s.SerializeDocument(doc); err != nil {
+			return "", err
+		}
+
+		return sb.String(), nil
+	}
+
+	// The range of an element may include the comma, which separates it from its next sibling.
+	begin, end := target.Range.BeginPos.Offset, target.Range.EndPos.Offset
+	end = begin + len(strings.TrimRight(strings.TrimSuffix(strings.TrimRight(src[begin:end], " \t\r\n"), ","), " \t\r\n"))
+
+	// The text before the element on its line is written as well, so that widths are computed
+	// for the actual columns, and removed afterwards.
+	lineStart := strings.LastIndexAny(src[:begin], "\r\n") + 1
+	line := src[lineStart:begin]
+	s.margin = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+
+	s.buf.WriteString(line)
+	s.node(target, 0)
+
+	return src[:begin] + s.buf.String()[len(line):] + src[end:], nil
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build go1.18
+// +build go1.18
+
+package format
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/golangee/tadl/parser"
+)
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add("text", "value", "label", "comment")
+	f.Add(`"quoted\"`, `{value}`, `\`, `// #?`)
+	f.Add("multi\nline\r\n", "#@{}\\", "", "")
+	f.Add("\b", "\f\v", "\x1b", "\x00")
+
+	f.Fuzz(func(t *testing.T, text, value, label, comment string) {
+		// Documents are UTF-8 encoded.
+		for _, s := range []string{text, value, label, comment} {
+			if !utf8.ValidString(s) {
+				return
+			}
+		}
+
+		// A comment ends at the end of its line and is trimmed by the parser.
+		if strings.ContainsAny(comment, "\r\n") || strings.TrimSpace(comment) != comment {
+			return
+		}
+
+		tree := parser.NewNode("root").Block(parser.BlockNormal).AddChildren(
+			parser.NewNode("a").AddAttribute("k", value).AddChildren(parser.NewStringNode(text)),
+			parser.NewNode("b").AddLabels(label).Block(parser.BlockGroup),
+			parser.NewStringNode(text),
+		)
+
+		if comment != "" {
+			tree.AddChildren(parser.NewStringCommentNode(comment))
+		}
+
+		roundTrip(t, tree)
+	})
+}
+
+func FuzzFormat(f *testing.F) {
+	f.Add(`#!{server @id="1" "web" {port "80"}}`)
+	f.Add(`#!@version{1\}} {a b "text" c, d(e) -> (f)}`)
+	f.Add("#a @k{\\{v\\}} {text #b}")
+	f.Add("##0##0#0#?0")
+
+	f.Fuzz(func(t *testing.T, text string) {
+		if !utf8.ValidString(text) {
+			return
+		}
+
+		tree, err := parser.NewParser("fuzz.tadl", strings.NewReader(text)).Parse()
+		if err != nil {
+			return
+		}
+
+		// G2 cannot express everything of G1.
+		normalize(tree)
+		roundTrip(t, tree)
+
+		// The output is canonical, formatting it again changes nothing.
+		if formatted := Format(tree); Format(parse(t, formatted)) != formatted {
+			t.Fatalf("formatting is not stable for\n%s", formatted)
+		}
+	})
+}
+
+// normalize applies the changes Format makes to trees parsed from G1: G1 elements may have several
+// children without brackets, which get curly brackets, and G2 comments cannot start or end with whitespace.
+func normalize(node *parser.TreeNode) {
+	if node.IsComment() {
+		comment := strings.TrimSpace(*node.Comment)
+		node.Comment = &comment
+	}
+
+	if node.BlockType == parser.BlockNone && (len(node.Children) > 1 || len(node.Labels) > 0 ||
+		(len(node.Children) == 1 && node.Children[0].IsComment())) {
+		node.BlockType = parser.BlockNormal
+	}
+
+	for _, child := range node.Children {
+		normalize(child)
+	}
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package format
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/store"
+)
+
+// runes are used for random values. They contain all runes with a special meaning in any grammar.
+var runes = []rune("ab \t\n\r\\\"#@{}()<>,=/?!-ä")
+
+// randomString returns a random string made of runes.
+func randomString(rnd *rand.Rand) string {
+	b := make([]rune, rnd.Intn(8))
+	for i := range b {
+		b[i] = runes[rnd.Intn(len(runes))]
+	}
+
+	return string(b)
+}
+
+// randomTree returns a random tree of the given depth, which can be written as Tadl text.
+func randomTree(rnd *rand.Rand, depth int) *parser.TreeNode {
+	root := parser.NewNode("root").Block(parser.BlockNormal)
+	root.Children = randomChildren(rnd, root, depth, rnd.Intn(5))
+
+	return root
+}
+
+func randomChildren(rnd *rand.Rand, parent *parser.TreeNode, depth, n int) []*parser.TreeNode {
+	blockTypes := []parser.BlockType{parser.BlockNormal, parser.BlockGroup, parser.BlockGeneric}
+
+	var children []*parser.TreeNode
+
+	for i := 0; i < n; i++ {
+		var child *parser.TreeNode
+
+		switch rnd.Intn(4) {
+		case 0:
+			child = parser.NewStringNode(randomString(rnd))
+		case 1:
+			// Every line of a comment is a comment node of its own.
+			child = parser.NewStringCommentNode(strings.TrimSpace(strings.NewReplacer("\r", "", "\n", "").Replace(randomString(rnd))))
+		default:
+			child = parser.NewNode(string(rune('a' + rnd.Intn(3))))
+			for j := rnd.Intn(3); j > 0; j-- {
+				child.AddAttribute(string(rune('k'+j)), randomString(rnd))
+			}
+
+			if depth > 0 && rnd.Intn(2) == 0 {
+				child.Block(blockTypes[rnd.Intn(len(blockTypes))])
+
+				for j := rnd.Intn(3); j > 0; j-- {
+					child.AddLabels(randomString(rnd))
+				}
+
+				child.Children = randomChildren(rnd, child, depth-1, rnd.Intn(4))
+			}
+		}
+
+		child.Parent = parent
+		children = append(children, child)
+	}
+
+	return children
+}
+
+// roundTrip checks that writing tree and parsing the result again returns an equal tree.
+func roundTrip(t *testing.T, tree *parser.TreeNode, opts ...Option) {
+	t.Helper()
+
+	text := Format(tree, opts...)
+
+	parsed, err := parser.NewParser("roundtrip.tadl", strings.NewReader(text)).Parse()
+	if err != nil {
+		t.Fatalf("cannot parse\n%s\n%v", text, err)
+	}
+
+	if store.Hash(parsed) != store.Hash(tree) {
+		t.Fatalf("parsed tree differs from written tree:\n%s\nparsed as\n%s", text, Format(parsed))
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	options := [][]Option{
+		nil,
+		{WithAttributeStyle(BracedAttributes)},
+		{WithSingleLine(40), WithIndent("  ")},
+		{WithSingleLine(1000), WithAttributeStyle(BracedAttributes)},
+		{WithSingleLine(30), WithMaxWidth(20)},
+	}
+
+	for i := 0; i < 2000; i++ {
+		tree := randomTree(rnd, 3)
+		for _, opts := range options {
+			roundTrip(t, tree, opts...)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package format
+
+import (
+	"sort"
+
+	"github.com/golangee/tadl/parser"
+)
+
+// WithSortedChildren writes the children of each element sorted by name, so that generated documents
+// are reproducible, even if their elements were created in random order, like from iterating a map.
+// Elements of the same name keep their order. Comments stay with the element they precede, or
+// follow on the same line. Elements containing text are not sorted, because the order of text matters.
+// The children of elements with one of the pinned names keep their order, like the steps of a pipeline:
+//
+//  format.WithSortedChildren("steps", "args")
+func WithSortedChildren(pinned ...string) Option {
+	return func(s *Serializer) {
+		s.sorted = true
+		s.pinned = map[string]bool{}
+
+		for _, name := range pinned {
+			s.pinned[name] = true
+		}
+	}
+}
+
+// children returns the children of node in the order in which they are written.
+func (s *Serializer) children(node *parser.TreeNode) []*parser.TreeNode {
+	if !s.sorted || s.pinned[node.Name] {
+		return node.Children
+	}
+
+	// Each group is an element together with its comments.
+	var groups [][]*parser.TreeNode
+
+	var group []*parser.TreeNode
+
+	for i, child := range node.Children {
+		if child.IsText() {
+			return node.Children
+		}
+
+		group = append(group, child)
+
+		if child.IsNode() && (i+1 == len(node.Children) || !s.isTrailing(child, node.Children[i+1])) ||
+			i > 0 && s.isTrailing(node.Children[i-1], child) {
+			groups = append(groups, group)
+			group = nil
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return name(groups[i]) < name(groups[j])
+	})
+
+	children := make([]*parser.TreeNode, 0, len(node.Children))
+	for _, group := range groups {
+		children = append(children, group...)
+	}
+
+	// Comments at the end of the block stay there.
+	return append(children, group...)
+}
+
+// name returns the name of the element in group.
+func name(group []*parser.TreeNode) string {
+	for _, node := range group {
+		if node.IsNode() {
+			return node.Name
+		}
+	}
+
+	return ""
+}
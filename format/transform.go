@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package format
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golangee/tadl/parser"
+)
+
+// transform replaces the elements matched by selector with the result of fn.
+type transform struct {
+	selector string
+	fn       func(node *parser.TreeNode) *parser.TreeNode
+}
+
+// WithTransform applies fn to all elements matched by selector while writing, so that
+// documents can be exported with changes like dropped or masked secrets. The tree itself
+// is not modified, fn gets a copy of the matched element. The returned node is written
+// instead of the element, nil drops it. Transformations apply in the order of their options.
+//
+// A selector is a path of element names like "/root/db/password". A segment may be
+// "*" to match any name, and may have an index like "db[1]" to match only the second
+// db element of its parent. The segment "**" matches any number of elements, so
+// "/**/password" matches all password elements of the document.
+func WithTransform(selector string, fn func(node *parser.TreeNode) *parser.TreeNode) Option {
+	return func(s *Serializer) {
+		s.transforms = append(s.transforms, transform{selector: selector, fn: fn})
+	}
+}
+
+// pathSegment is an element in the path of a node, with its index among the siblings of the same name.
+type pathSegment struct {
+	name  string
+	index int
+}
+
+// selectorSegment is a segment of a compiled selector. An index of -1 matches any index.
+type selectorSegment struct {
+	name  string
+	index int
+}
+
+// compileSelector splits a selector into its segments.
+func compileSelector(selector string) ([]selectorSegment, error) {
+	if !strings.HasPrefix(selector, "/") {
+		return nil, fmt.Errorf("invalid selector '%s': must start with '/'", selector)
+	}
+
+	var segments []selectorSegment
+
+	for _, segment := range strings.Split(selector[1:], "/") {
+		name, index := segment, -1
+
+		if open := strings.IndexByte(segment, '['); open >= 0 {
+			i, err := strconv.Atoi(strings.TrimSuffix(segment[open+1:], "]"))
+			if err != nil || i < 0 || !strings.HasSuffix(segment, "]") {
+				return nil, fmt.Errorf("invalid selector '%s': invalid index in '%s'", selector, segment)
+			}
+
+			name, index = segment[:open], i
+		}
+
+		if name == "" || (name == "**" && index >= 0) {
+			return nil, fmt.Errorf("invalid selector '%s': invalid segment '%s'", selector, segment)
+		}
+
+		segments = append(segments, selectorSegment{name: name, index: index})
+	}
+
+	return segments, nil
+}
+
+// match returns true, if the selector matches the path.
+func match(selector []selectorSegment, path []pathSegment) bool {
+	if len(selector) == 0 {
+		return len(path) == 0
+	}
+
+	if selector[0].name == "**" {
+		for i := 0; i <= len(path); i++ {
+			if match(selector[1:], path[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+
+	s := selector[0]
+	if (s.name != "*" && s.name != path[0].name) || (s.index >= 0 && s.index != path[0].index) {
+		return false
+	}
+
+	return match(selector[1:], path[1:])
+}
+
+// transformTree returns a copy of tree with all transformations applied, or nil if the root was dropped.
+func (s *Serializer) transformTree(tree *parser.TreeNode) (*parser.TreeNode, error) {
+	selectors := make([][]selectorSegment, 0, len(s.transforms))
+
+	for _, t := range s.transforms {
+		selector, err := compileSelector(t.selector)
+		if err != nil {
+			return nil, err
+		}
+
+		selectors = append(selectors, selector)
+	}
+
+	var apply func(node *parser.TreeNode, path []pathSegment) *parser.TreeNode
+	apply = func(node *parser.TreeNode, path []pathSegment) *parser.TreeNode {
+		if node.IsNode() {
+			for i, t := range s.transforms {
+				if match(selectors[i], path) {
+					if node = t.fn(copyTree(node)); node == nil {
+						return nil
+					}
+				}
+			}
+		}
+
+		clone := *node
+		clone.Children = nil
+		count := map[string]int{}
+
+		for _, child := range node.Children {
+			childPath := path
+			if child.IsNode() {
+				childPath = append(path[:len(path):len(path)], pathSegment{name: child.Name, index: count[child.Name]})
+				count[child.Name]++
+			}
+
+			if transformed := apply(child, childPath); transformed != nil {
+				transformed.Parent = &clone
+				clone.Children = append(clone.Children, transformed)
+			}
+		}
+
+		return &clone
+	}
+
+	return apply(tree, []pathSegment{{name: tree.Name}}), nil
+}
+
+// copyTree returns a deep copy of node.
+func copyTree(node *parser.TreeNode) *parser.TreeNode {
+	clone := *node
+	clone.Attributes = parser.NewAttributeList()
+	clone.Labels = append([]string(nil), node.Labels...)
+	clone.Children = nil
+
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, value := node.Attributes.Get(i)
+		clone.AddAttribute(*key, *value)
+	}
+
+	for _, child := range node.Children {
+		child = copyTree(child)
+		child.Parent = &clone
+		clone.Children = append(clone.Children, child)
+	}
+
+	return &clone
+}
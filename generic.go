@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"github.com/golangee/tadl/parser"
+)
+
+// generic returns the value of node for an empty interface, which is a string, a []interface{}
+// or a map[string]interface{}, see Unmarshal.
+func (u *unmarshaler) generic(node *parser.TreeNode) (interface{}, error) {
+	if node.IsText() {
+		if err := u.checkString(node, len(*node.Text)); err != nil {
+			return nil, err
+		}
+
+		return *node.Text, nil
+	}
+
+	children := make([]*parser.TreeNode, 0, len(node.Children))
+	for _, child := range node.Children {
+		if !child.IsComment() {
+			children = append(children, child)
+		}
+	}
+
+	if err := u.checkElements(node, len(children)); err != nil {
+		return nil, err
+	}
+
+	var (
+		value interface{} = ""
+		err   error
+	)
+
+	switch {
+	case len(children) == 0:
+	case len(children) == 1 && children[0].IsText():
+		value, err = u.generic(children[0])
+	case len(children) == 1 && node.BlockType == parser.BlockNone && isLeaf(children[0]):
+		// An element without brackets followed by an element without children is a key
+		// value pair, like "port 80".
+		value = children[0].Name
+	default:
+		value, err = u.genericChildren(children)
+	}
+
+	if err != nil || node.Attributes.Len() == 0 {
+		return value, err
+	}
+
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{}
+
+		if value != "" {
+			m[""] = value
+		}
+	}
+
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, attrValue := node.Attributes.Get(i)
+		m["@"+*key] = *attrValue
+	}
+
+	return m, nil
+}
+
+// genericChildren returns the values of children as map by their names, if all of them are elements.
+// Otherwise, they are returned as list of strings for texts and maps with a single entry for elements.
+func (u *unmarshaler) genericChildren(children []*parser.TreeNode) (interface{}, error) {
+	elements := true
+	for _, child := range children {
+		elements = elements && child.IsNode()
+	}
+
+	if !elements {
+		list := make([]interface{}, 0, len(children))
+
+		for _, child := range children {
+			value, err := u.generic(child)
+			if err != nil {
+				return nil, err
+			}
+
+			if child.IsNode() {
+				value = map[string]interface{}{child.Name: value}
+			}
+
+			list = append(list, value)
+		}
+
+		return list, nil
+	}
+
+	counts := map[string]int{}
+	for _, child := range children {
+		counts[child.Name]++
+	}
+
+	m := make(map[string]interface{}, len(counts))
+
+	for _, child := range children {
+		value, err := u.generic(child)
+		if err != nil {
+			return nil, err
+		}
+
+		// Repeated elements are collected into a list.
+		if counts[child.Name] > 1 {
+			list, _ := m[child.Name].([]interface{})
+			value = append(list, value)
+		}
+
+		m[child.Name] = value
+	}
+
+	return m, nil
+}
+
+// isLeaf returns true, if node is an element without attributes, labels and children.
+func isLeaf(node *parser.TreeNode) bool {
+	return node.IsNode() && node.Attributes.Len() == 0 && len(node.Labels) == 0 && len(node.Children) == 0
+}
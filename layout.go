@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/golangee/tadl/format"
+)
+
+// layouts maps the values of the format tag to their format.Layout.
+var layouts = map[string]format.Layout{
+	"auto":   format.LayoutAuto,
+	"inline": format.LayoutInline,
+	"block":  format.LayoutBlock,
+}
+
+// FormatOptions returns the options of package format, which write the elements of schema with the
+// layouts of their fields. schema is a struct or a pointer to a struct, like the one of ValidateAll.
+// Fields tagged with `format:"inline"` or `format:"block"` set the layout of their elements, see
+// format.Layout. Names are mapped like by Unmarshal with the given options, like WithNameMapper.
+//
+//  type Shape struct {
+//      Center Point   `tadl:"center" format:"inline"`
+//      Points []Point `tadl:"point" format:"inline"`
+//  }
+//
+//  opts, err := tadl.FormatOptions(Shape{})
+//  text := format.Format(tree, opts...)
+//
+// Layouts apply to all elements of a name, so an error is returned, if fields of the same name have
+// different layouts.
+func FormatOptions(schema interface{}, opts ...DecodeOption) ([]format.Option, error) {
+	var u unmarshaler
+	for _, opt := range opts {
+		opt(&u)
+	}
+
+	t := reflect.TypeOf(schema)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("schema must be a struct, not '%s'", t)
+	}
+
+	found := map[string]format.Layout{}
+	if err := u.layouts(t, found, map[reflect.Type]bool{}); err != nil {
+		return nil, err
+	}
+
+	names := map[format.Layout][]string{}
+	for name, layout := range found {
+		names[layout] = append(names[layout], name)
+	}
+
+	var options []format.Option
+
+	for _, layout := range []format.Layout{format.LayoutInline, format.LayoutBlock} {
+		if len(names[layout]) > 0 {
+			sort.Strings(names[layout])
+			options = append(options, format.WithLayout(layout, names[layout]...))
+		}
+	}
+
+	return options, nil
+}
+
+// layouts adds the layouts of the fields of t, and of the types nested in them, to found.
+// visited contains the types, which have already been checked.
+func (u *unmarshaler) layouts(t reflect.Type, found map[string]format.Layout, visited map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || visited[t] {
+		return nil
+	}
+
+	visited[t] = true
+
+	for i, plan := range structPlan(t, u.tagFallback...) {
+		field := t.Field(i)
+
+		switch plan.as {
+		case unmarshalNormal, unmarshalTable, unmarshalInner:
+		default:
+			continue
+		}
+
+		if tag, ok := field.Tag.Lookup("format"); ok && plan.as != unmarshalInner {
+			layout, ok := layouts[tag]
+			if !ok {
+				return fmt.Errorf("unknown layout '%s' of field '%s', use auto, inline or block", tag, plan.goName)
+			}
+
+			name := plan.name
+			if !plan.renamed && u.nameMapper != nil {
+				name = u.nameMapper(name)
+			}
+
+			if other, ok := found[name]; ok && other != layout {
+				return fmt.Errorf("field '%s' sets the layout '%s' of element '%s', which has another layout", plan.goName, tag, name)
+			}
+
+			found[name] = layout
+		}
+
+		if err := u.layouts(field.Type, found, visited); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golangee/tadl/parser"
+)
+
+// ErrLimitExceeded is wrapped by the errors for documents, which exceed the Limits.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// Limits restrict the documents and values that are unmarshalled, so that services can decode
+// documents of untrusted users without running out of stack or memory. Zero means no limit.
+type Limits struct {
+	// MaxDepth is the maximum nesting of elements below the root. It is checked before unmarshalling.
+	MaxDepth int
+	// MaxElements is the maximum number of elements of a slice, map or table.
+	MaxElements int
+	// MaxStringLen is the maximum length of a string or Raw in bytes.
+	MaxStringLen int
+	// MaxTokens is the maximum number of tokens of a document. It is checked while parsing, so that
+	// large documents are rejected before their tree is built. UnmarshalNode cannot check it.
+	MaxTokens int
+}
+
+// WithLimits rejects documents exceeding limits with an error wrapping ErrLimitExceeded.
+func WithLimits(limits Limits) DecodeOption {
+	return func(u *unmarshaler) {
+		u.limits = limits
+	}
+}
+
+// parserOptions returns the options of the parser for the limits configured by opts.
+func parserOptions(opts []DecodeOption) []parser.Option {
+	var u unmarshaler
+	for _, opt := range opts {
+		opt(&u)
+	}
+
+	if u.limits.MaxTokens > 0 {
+		return []parser.Option{parser.WithMaxTokens(u.limits.MaxTokens)}
+	}
+
+	return nil
+}
+
+// limitError wraps ErrLimitExceeded around a parser error for too many tokens.
+func limitError(err error) error {
+	if errors.Is(err, parser.ErrTooManyTokens) {
+		return fmt.Errorf("%w: %w", ErrLimitExceeded, err)
+	}
+
+	return err
+}
+
+// checkDepth returns an error for the first element nested deeper than MaxDepth. The tree is walked
+// without recursion, as it may be too deep for that.
+func (u *unmarshaler) checkDepth(tree *parser.TreeNode) error {
+	if u.limits.MaxDepth <= 0 {
+		return nil
+	}
+
+	type entry struct {
+		node  *parser.TreeNode
+		depth int
+	}
+
+	stack := []entry{{node: tree}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if e.depth > u.limits.MaxDepth {
+			return NewUnmarshalError(e.node, fmt.Sprintf("nesting exceeds the maximum depth of %d", u.limits.MaxDepth), ErrLimitExceeded)
+		}
+
+		for i := len(e.node.Children) - 1; i >= 0; i-- {
+			if child := e.node.Children[i]; child.IsNode() {
+				stack = append(stack, entry{node: child, depth: e.depth + 1})
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkElements returns an error, if n elements of node exceed MaxElements.
+func (u *unmarshaler) checkElements(node *parser.TreeNode, n int) error {
+	if u.limits.MaxElements > 0 && n > u.limits.MaxElements {
+		return NewUnmarshalError(node, fmt.Sprintf("%d elements exceed the maximum of %d", n, u.limits.MaxElements), ErrLimitExceeded)
+	}
+
+	return nil
+}
+
+// checkString returns an error, if a text of n bytes of node exceeds MaxStringLen.
+func (u *unmarshaler) checkString(node *parser.TreeNode, n int) error {
+	if u.limits.MaxStringLen > 0 && n > u.limits.MaxStringLen {
+		return NewUnmarshalError(node, fmt.Sprintf("text of %d bytes exceeds the maximum of %d", n, u.limits.MaxStringLen), ErrLimitExceeded)
+	}
+
+	return nil
+}
@@ -4,19 +4,27 @@
 package tadl
 
 import (
+	"bytes"
+	"encoding"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/token"
 )
 
 // Unmarshal takes Tadl input and parses it into the given struct.
 // If "into" is not a struct, this method will fail.
 // As this uses go's reflect package, only exported names can be unmarshalled.
 // Strict mode requires that all fields of the struct are set and defined exactly once.
+// Elements that are repeated for a field of a primitive type cause an error, unless configured
+// otherwise with WithDuplicates or WithJoinedDuplicates.
 // You can set struct tags to influence the unmarshalling process.
 // All tags must have the form `tadl:"..."` and are a list of comma separated identifiers.
 //
@@ -30,6 +38,14 @@ import (
 //      SomeName Content `tadl:"item"`
 //  }
 //
+// Fields without a rename tag can be mapped to names of another naming convention with WithNameMapper.
+// Further names separated by '|' are aliases, which are accepted as well. This keeps documents working,
+// after an element or attribute has been renamed. Use WithDeprecationWarnings to find documents using an alias.
+//
+//  type Example struct {
+//      Timeout int `tadl:"timeout|timeout_ms"`
+//  }
+//
 // The second identifier is used to specify what kind of thing is being parsed.
 // This can be used to parse attributes (attr) or text (text).
 //
@@ -73,10 +89,46 @@ import (
 //  }
 //
 //
-// Tadl can unmarshal into maps. The map key must be a primitive type. The map value must be a primitive
-// type, parser.TreeNode or *parser.TreeNode.
-// Parsing maps will read first level elements as map keys and the first child of each as the map value.
-// In strict mode the map key is required to have exactly one child.
+// Embedded structs, which are not renamed by their tag, are flattened like 'inner' structs. Their fields
+// are read from the element of the surrounding struct, so that shared fields can be composed without
+// another element in the document:
+//
+//  type Metadata struct {
+//      Name string `tadl:"name"`
+//  }
+//  // reads the name of #! {name "a", port 80}
+//  type Server struct {
+//      Metadata
+//      Port int `tadl:"port"`
+//  }
+//
+// 'chardata' reads the concatenated text of the element into a string, even in strict mode. Child elements
+// are left to the other fields, so that elements with mixed content can be read together with their
+// attributes:
+//
+//  // This tadl snippet...
+//  #p @lang{en} {Read the #b{manual} first.}
+//  // could be unmarshalled into this go struct.
+//  type Paragraph struct {
+//      Lang string `tadl:"lang,attr"`
+//      Bold string `tadl:"b"`
+//      Text string `tadl:",chardata"` // "Read the first."
+//  }
+//
+// 'any' collects the child elements, which are not used by another field, into a []*parser.TreeNode.
+// This way unknown elements are kept instead of being dropped, like those of a newer version of a
+// configuration format:
+//
+//  type Config struct {
+//      Name  string             `tadl:"name"`
+//      Extra []*parser.TreeNode `tadl:",any"`
+//  }
+//
+// Tadl can unmarshal into maps. The map key must be a primitive type. The map value may be of any type.
+// Parsing maps will read first level elements as map keys. For primitive types, parser.TreeNode and
+// *parser.TreeNode the first child of each is the map value. In strict mode the map key is required to
+// have exactly one child then. Values of all other types, like structs, are unmarshalled from the key
+// element itself, just like a field.
 // By specifying parser.TreeNode (or a pointer to it) as the value type you can access the raw tree that would be
 // parsed as a value. This is useful if you want to have more control over the value for doing more complex
 // manipulations than just parsing a primitive.
@@ -93,35 +145,342 @@ import (
 //      SomeMap map[string]float64
 //  }
 //
+// Types implementing encoding.TextUnmarshaler, like net.IP, time.Time or custom enums, are unmarshalled
+// from text like primitive types. This applies to fields, attributes and the keys and values of maps.
+//
+// Types implementing Unmarshaler decode their element themselves, which takes precedence over all other
+// rules. Map values are passed as the first child of their key and attributes as a text node.
+//
+// The tag `default:"..."` sets a field, whose element or attribute is absent, to the given text in non-strict
+// mode. The text is unmarshalled like the value of an attribute, so it is used with primitive fields, pointers
+// to them and types implementing encoding.TextUnmarshaler. The default of a renamed slice is not used.
+//
+//  type Server struct {
+//      Host string `tadl:"host" default:"localhost"`
+//      Port int    `tadl:"port,attr" default:"80"`
+//  }
+//
+// Pointer fields, like *string or *Server, are allocated and filled when their element or attribute
+// exists and stay nil otherwise. This way an absent element can be told apart from an empty one.
+//
+// Values of type interface{}, like the values of a map[string]interface{}, receive a generic representation
+// of their element for schema-less access. Texts become strings and elements become maps from the names
+// of their children to their values. Repeated children are collected into a []interface{}. An element
+// with a single text, or without brackets and followed by a single element without children like "port 80",
+// becomes a string, an element without children becomes "". Attributes are added to the map with the
+// prefix '@', other content is then found by the key "". Mixed text and elements become a []interface{}
+// of strings and maps with a single entry. Labels and comments are left out, use parser.TreeNode for them.
+//
+//  // #! {name "web", port 80, host "a", host "b", tls @cert="x.pem"} becomes
+//  map[string]interface{}{
+//      "name": "web",
+//      "port": "80",
+//      "host": []interface{}{"a", "b"},
+//      "tls":  map[string]interface{}{"@cert": "x.pem"},
+//  }
+//
+// Fields of type Raw receive the source text of their element, which can be decoded later.
+//
+// Go maps do not keep the order of the document. Use OrderedMap instead of a map[string]string, if the
+// order matters.
+//
 // Tadl also supports unmarshalling slices. When no tag is specified in the struct, elements in Tadl
 // are unmarshalled into the slice directly. Should you specify a tag on the field in your struct,
 // then only elements with that tag will be parsed. See the examples for more details.
+// Slices can be nested, which reads the children of each child as the inner slice. This is
+// useful to read tabular data into a [][]string, where every child is a row of cells.
+//
+// 'table' reads tabular data into a slice of structs. The first child of the element is the header
+// row, its cells name the fields that the cells of the following rows are unmarshalled into.
+// Cells are texts or elements without children.
+//
+//  // This tadl snippet...
+//  #! {
+//      people {
+//          row("name" "age")
+//          row("Alice" "30")
+//          row("Bob" "25")
+//      }
+//  }
+//  // could be unmarshalled into this go struct.
+//  type Person struct {
+//      Name string `tadl:"name"`
+//      Age  int    `tadl:"age"`
+//  }
+//  type Example struct {
+//      People []Person `tadl:"people,table"`
+//  }
+//
+// 'label' reads the labels of an element, which are the strings between its name and its block.
+// Labels are assigned to string fields in the order of the fields, a []string field takes all remaining labels.
+//
+//  // This tadl snippet...
+//  #! {
+//      server "web" "eu-west" {
+//          port 80
+//      }
+//  }
+//  // could be unmarshalled into this go struct.
+//  type Server struct {
+//      Name   string `tadl:",label"`
+//      Region string `tadl:",label"`
+//      Port   int    `tadl:"port"`
+//  }
+//  type Example struct {
+//      Server Server `tadl:"server"`
+//  }
+//
+// 'pos' sets a field of type Position to the source range of the element, see Position.
+//
+// 'attrs' reads all attributes of an element into a map with primitive keys and values,
+// also the ones read by 'attr' fields. Use it for elements with arbitrary attributes.
 //
-func Unmarshal(r io.Reader, into interface{}, strict bool) error {
-	parse := parser.NewParser("", r)
+//  // This tadl snippet...
+//  #! {
+//      link @href="/" @rel="home"
+//  }
+//  // could be unmarshalled into this go struct.
+//  type Link struct {
+//      Attributes map[string]string `tadl:",attrs"`
+//  }
+//
+func Unmarshal(r io.Reader, into interface{}, strict bool, opts ...DecodeOption) error {
+	return unmarshal("", r, into, strict, opts...)
+}
 
-	if into == nil {
-		return fmt.Errorf("cannot unmarshal into nil")
+// UnmarshalNode unmarshals an already parsed node like Unmarshal does with the root of a document.
+// Use it to decode a section of a tree, which has been found by a query, without parsing its text again:
+//
+//  for server := range tree.Descendants("server") {
+//      var s Server
+//      if err := tadl.UnmarshalNode(server, &s, false); err != nil {
+//          return err
+//      }
+//  }
+//
+// The source text is not known, so fields of type Raw cannot be decoded.
+func UnmarshalNode(node *parser.TreeNode, into interface{}, strict bool, opts ...DecodeOption) error {
+	if node == nil {
+		return fmt.Errorf("cannot unmarshal nil node")
 	}
 
-	tree, err := parse.Parse()
+	return unmarshalTree(node, nil, into, strict, opts...)
+}
+
+// unmarshal works like Unmarshal, but positions in errors refer to the given filename.
+func unmarshal(filename string, r io.Reader, into interface{}, strict bool, opts ...DecodeOption) error {
+	// The source is kept for fields of type Raw.
+	src, err := io.ReadAll(r)
 	if err != nil {
 		return err
 	}
 
+	tree, err := parser.NewParser(filename, bytes.NewReader(src), parserOptions(opts)...).Parse()
+	if err != nil {
+		return limitError(err)
+	}
+
+	return unmarshalTree(tree, src, into, strict, opts...)
+}
+
+// unmarshalTree unmarshals the parsed tree into into. src is the text tree has been parsed from.
+func unmarshalTree(tree *parser.TreeNode, src []byte, into interface{}, strict bool, opts ...DecodeOption) error {
+	if into == nil {
+		return fmt.Errorf("cannot unmarshal into nil")
+	}
+
 	value := reflect.ValueOf(into)
-	unmarshal := unmarshaler{strict: strict}
+	unmarshal := unmarshaler{strict: strict, src: src}
+	unmarshal.path.push("", tree.Name)
+	for _, opt := range opts {
+		opt(&unmarshal)
+	}
+
+	if err := unmarshal.checkDepth(tree); err != nil {
+		return err
+	}
 
 	if err := unmarshal.node(tree, value); err != nil {
 		return err
 	}
 
+	if err := unmarshal.reportUnused(tree); err != nil {
+		return err
+	}
+
+	if len(unmarshal.errs) > 0 {
+		return UnmarshalErrors(unmarshal.errs)
+	}
+
 	return nil
 }
 
 // unmarshaler is a helper struct for easier managing the unmarshalling process.
 type unmarshaler struct {
 	strict bool
+	// src is the parsed text, see Raw.
+	src []byte
+
+	duplicates Duplicates
+	// separator joins the texts of repeated elements for DuplicatesJoin.
+	separator string
+	// fuzzyNames matches field names ignoring case, '-' and '_'.
+	fuzzyNames bool
+	// caseInsensitive matches the names of elements and attributes ignoring case, see DecodeOptions.
+	caseInsensitive bool
+	// disallowUnknown returns an error for unused elements and attributes, see DecodeOptions.
+	disallowUnknown bool
+	// nameMapper maps the names of fields without a rename tag, if set.
+	nameMapper NameMapper
+	// tagFallback are the tags read for fields without a tadl tag, see WithTagFallback.
+	tagFallback []string
+	// deprecated is called for elements and attributes using an alias, if set.
+	deprecated func(d Diagnostic)
+	// unused is called for elements and attributes, which are not unmarshalled into a field, if set.
+	// Then structs are the nodes unmarshalled into structs with their types, and used the elements
+	// and attributes of those nodes, which have been matched by a field.
+	unused  func(d Diagnostic)
+	structs map[*parser.TreeNode][]reflect.Type
+	used    map[usage]bool
+
+	limits Limits
+	// uniqueKeys rejects repeated keys of maps, see WithUniqueMapKeys.
+	uniqueKeys bool
+
+	// allErrors continues with the next field after an error, errs collects those errors.
+	allErrors bool
+	errs      []error
+
+	// path is the path to the field and node that is currently unmarshalled.
+	path path
+}
+
+// DecodeOption configures optional behavior of Unmarshal.
+type DecodeOption func(u *unmarshaler)
+
+// Duplicates decides what happens, when an element is repeated but the field it is unmarshalled
+// into holds a single primitive value.
+type Duplicates int
+
+const (
+	// DuplicatesError returns an error for repeated elements. This is the default.
+	DuplicatesError Duplicates = iota
+	// DuplicatesFirst uses the first of the repeated elements.
+	DuplicatesFirst
+	// DuplicatesLast uses the last of the repeated elements.
+	DuplicatesLast
+	// DuplicatesJoin joins the texts of the repeated elements, see WithJoinedDuplicates.
+	DuplicatesJoin
+)
+
+// WithDuplicates sets how repeated elements are unmarshalled into primitive fields.
+// This applies in strict mode as well.
+func WithDuplicates(d Duplicates) DecodeOption {
+	return func(u *unmarshaler) {
+		u.duplicates = d
+	}
+}
+
+// WithFuzzyNames matches elements to struct fields ignoring case, '-' and '_', so that
+// an element "max_conns" or "max-conns" is unmarshalled into a field "MaxConns".
+// Fields which are renamed with a tag are still matched exactly.
+func WithFuzzyNames() DecodeOption {
+	return func(u *unmarshaler) {
+		u.fuzzyNames = true
+	}
+}
+
+// WithNameMapper maps the names of all fields, which are not renamed with a tag, with m.
+// Use it to follow naming conventions without tagging every field, e.g. with SnakeCase.
+func WithNameMapper(m NameMapper) DecodeOption {
+	return func(u *unmarshaler) {
+		u.nameMapper = m
+	}
+}
+
+// WithTagFallback reads the first of the given struct tags, like "json" or "xml", for fields without
+// a tadl tag, so that structs tagged for other packages can be reused. The name of such a tag renames
+// the field and "-" skips it. Of the xml options, "attr" reads an attribute and "chardata" the text of
+// the element, like the tadl kinds "attr" and "chardata". Fields with other xml options, or with nested
+// names like "a>b", are skipped. All other options, like "omitempty", are ignored.
+//
+//  tadl.Unmarshal(r, &config, false, tadl.WithTagFallback("json", "xml"))
+//
+func WithTagFallback(tags ...string) DecodeOption {
+	return func(u *unmarshaler) {
+		u.tagFallback = tags
+	}
+}
+
+// WithDeprecationWarnings calls warn for every element or attribute, which is named by an alias
+// of its field instead of the name, see Unmarshal. The Diagnostic is positioned at the element or attribute.
+func WithDeprecationWarnings(warn func(d Diagnostic)) DecodeOption {
+	return func(u *unmarshaler) {
+		u.deprecated = warn
+	}
+}
+
+// WithUnusedWarnings calls warn for every element or attribute, which has not been unmarshalled
+// because no field matches it, even in non-strict mode. Use it to log ignored configuration keys,
+// like typos, without failing. The Diagnostics are reported in document order after unmarshalling
+// succeeded. Only the elements and attributes of elements unmarshalled into structs are checked,
+// as all children of an element are read into slices, maps and other types.
+func WithUnusedWarnings(warn func(d Diagnostic)) DecodeOption {
+	return func(u *unmarshaler) {
+		u.unused = warn
+		u.structs = map[*parser.TreeNode][]reflect.Type{}
+		u.used = map[usage]bool{}
+	}
+}
+
+// WithDisallowUnknownFields returns an error for the first element or attribute, which has not been
+// unmarshalled because no field matches it, like DecodeOptions.DisallowUnknownFields. The error is
+// positioned at the element or attribute and names a field with a similar name, if there is one, so
+// that typos in configuration files are caught:
+//
+//  cannot unmarshal into 'server', unknown element 'prot', did you mean 'port'?
+//
+// With WithAllErrors, all unknown elements and attributes are returned.
+func WithDisallowUnknownFields() DecodeOption {
+	return func(u *unmarshaler) {
+		u.disallowUnknown = true
+		u.structs = map[*parser.TreeNode][]reflect.Type{}
+		u.used = map[usage]bool{}
+	}
+}
+
+// WithUniqueMapKeys returns an error for an element, which repeats the key of a map or OrderedMap,
+// naming the positions of both elements. By default, the last element of a key wins for maps and
+// OrderedMap keeps all of them. Keys of maps are compared after unmarshalling, so "01" and "1" are
+// the same key of a map[int]string.
+func WithUniqueMapKeys() DecodeOption {
+	return func(u *unmarshaler) {
+		u.uniqueKeys = true
+	}
+}
+
+// WithAllErrors continues unmarshalling after a field could not be unmarshalled.
+// All errors are returned together as UnmarshalErrors, so that a document can be fixed at once.
+func WithAllErrors() DecodeOption {
+	return func(u *unmarshaler) {
+		u.allErrors = true
+	}
+}
+
+// WithStrict unmarshals like Unmarshal in strict mode. Use it with Decode and DecodeAll.
+func WithStrict() DecodeOption {
+	return func(u *unmarshaler) {
+		u.strict = true
+	}
+}
+
+// WithJoinedDuplicates joins the texts of repeated elements with separator and unmarshals the
+// result into the field. This is only valid for string fields.
+func WithJoinedDuplicates(separator string) DecodeOption {
+	return func(u *unmarshaler) {
+		u.duplicates = DuplicatesJoin
+		u.separator = separator
+	}
 }
 
 // While unmarshalling we might need to process a node as an attribute.
@@ -132,8 +491,31 @@ const (
 	unmarshalNormal unmarshalType = iota
 	unmarshalAttribute
 	unmarshalInner
+	unmarshalTable
+	unmarshalLabel
+	unmarshalPosition
+	unmarshalAttributes
+	unmarshalCharData
+	unmarshalAny
+	// unmarshalSkip leaves out a field, like one with a "-" fallback tag, see WithTagFallback.
+	unmarshalSkip
 )
 
+// orderedMapType is decoded like a map, even though it is a slice.
+var orderedMapType = reflect.TypeOf(OrderedMap{})
+
+// textUnmarshalerType is decoded from text, see textUnmarshaler.
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// unmarshalerType decodes itself, see tadlUnmarshaler.
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+// Unmarshaler is implemented by types that decode their element themselves, like a duration
+// from its text or an ID in a custom format. The node must not be modified.
+type Unmarshaler interface {
+	UnmarshalTadl(node *parser.TreeNode) error
+}
+
 // unmarshalMapValue is a helper to decide what kind of map value should be unmarshalled.
 type unmarshalMapValue int
 
@@ -141,6 +523,8 @@ const (
 	mapValueIsPrimitive unmarshalMapValue = iota
 	mapValueIsNode
 	mapValueIsNodePointer
+	// mapValueIsElement unmarshals the value from the element of the key, like a field.
+	mapValueIsElement
 )
 
 // UnmarshalError is an error that occurred during unmarshalling.
@@ -149,13 +533,15 @@ type UnmarshalError struct {
 	Node     *parser.TreeNode
 	Detail   string
 	wrapping error
+	// pos is the position of the problem within Node, like the value of an attribute.
+	pos token.Pos
 }
 
 func NewUnmarshalError(node *parser.TreeNode, detail string, wrapping error) UnmarshalError {
 	return UnmarshalError{
-		node,
-		detail,
-		wrapping,
+		Node:     node,
+		Detail:   detail,
+		wrapping: wrapping,
 	}
 }
 
@@ -167,15 +553,118 @@ func (u UnmarshalError) Error() string {
 	return fmt.Sprintf("cannot unmarshal into '%s', %s", u.Node.Name, u.Detail)
 }
 
-func (u *UnmarshalError) Unwrap() error {
+func (u UnmarshalError) Unwrap() error {
 	return u.wrapping
 }
 
+// UnmarshalErrors are all errors that occurred during unmarshalling with WithAllErrors.
+// errors.Is and errors.As look into each of them, like for errors.Join.
+//
+//  var decodeErr *tadl.DecodeError
+//  if errors.As(err, &decodeErr) {
+//      ...
+//  }
+//
+type UnmarshalErrors []error
+
+func (e UnmarshalErrors) Error() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%d errors occurred while unmarshalling:", len(e))
+
+	for _, err := range e {
+		sb.WriteString("\n")
+
+		if pos, ok := errorPosition(err); ok {
+			sb.WriteString(pos.String())
+			sb.WriteString(": ")
+		}
+
+		sb.WriteString(err.Error())
+	}
+
+	return sb.String()
+}
+
+// Unwrap returns the errors, so that errors.Is and errors.As can find them.
+func (e UnmarshalErrors) Unwrap() []error {
+	return e
+}
+
+// errorPosition returns the position of the innermost node of an UnmarshalError chain,
+// which has positional information.
+func errorPosition(err error) (token.Pos, bool) {
+	var (
+		pos   token.Pos
+		found bool
+	)
+
+	for err != nil {
+		if u, ok := err.(UnmarshalError); ok {
+			if u.pos.Line > 0 {
+				pos = u.pos
+				found = true
+			} else if u.Node != nil && u.Node.Range.BeginPos.Line > 0 {
+				pos = u.Node.Range.BeginPos
+				found = true
+			}
+
+			err = u.wrapping
+
+			continue
+		}
+
+		err = errors.Unwrap(err)
+	}
+
+	return pos, found
+}
+
 // node will place contents of the tadl node inside the given value.
 // tags are any field tags that may be relevant to process the current node.
 func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...string) error {
 	valueType := value.Type()
 
+	if unmarshaler, ok := tadlUnmarshaler(value); ok {
+		if err := unmarshaler.UnmarshalTadl(node); err != nil {
+			return NewUnmarshalError(node, fmt.Sprintf("cannot unmarshal '%s'", valueType), err)
+		}
+
+		return nil
+	}
+
+	if valueType == orderedMapType {
+		return u.orderedMap(node, value)
+	}
+
+	if valueType == rawType {
+		raw, err := u.raw(node)
+		if err != nil {
+			return err
+		}
+
+		if err := u.checkString(node, len(raw)); err != nil {
+			return err
+		}
+
+		value.SetBytes(raw)
+
+		return nil
+	}
+
+	if unmarshaler, ok := textUnmarshaler(value); ok {
+		text, err := getAsText(node)
+		if err != nil {
+			return NewUnmarshalError(node, fmt.Sprintf("text required for '%s'", valueType), err)
+		}
+
+		if err := unmarshaler.UnmarshalText([]byte(text)); err != nil {
+			return u.decodeError(node, valueType, text, NewUnmarshalError(node, fmt.Sprintf("'%s' is not a valid %s", text, valueType), err))
+		}
+
+		return nil
+	}
+
 	switch value.Kind() {
 	case reflect.String:
 		text, err := u.findText(node)
@@ -183,6 +672,10 @@ func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...s
 			return NewUnmarshalError(node, "expected string", err)
 		}
 
+		if err := u.checkString(node, len(text)); err != nil {
+			return err
+		}
+
 		value.SetString(text)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		text, err := getAsText(node)
@@ -192,11 +685,11 @@ func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...s
 
 		i, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
 		if err != nil {
-			return NewUnmarshalError(node, fmt.Sprintf("'%s' is not a valid integer", text), err)
+			return u.decodeError(node, valueType, text, NewUnmarshalError(node, fmt.Sprintf("'%s' is not a valid integer", text), err))
 		}
 
 		if value.OverflowInt(i) {
-			return NewUnmarshalError(node, fmt.Sprintf("value for '%s' out of bounds", valueType.Name()), err)
+			return u.decodeError(node, valueType, text, NewUnmarshalError(node, fmt.Sprintf("value for '%s' out of bounds", valueType.Name()), err))
 		}
 
 		value.SetInt(i)
@@ -208,11 +701,11 @@ func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...s
 
 		i, err := strconv.ParseUint(strings.TrimSpace(text), 10, 64)
 		if err != nil {
-			return NewUnmarshalError(node, fmt.Sprintf("'%s' is not a valid unsigned integer", text), err)
+			return u.decodeError(node, valueType, text, NewUnmarshalError(node, fmt.Sprintf("'%s' is not a valid unsigned integer", text), err))
 		}
 
 		if value.OverflowUint(i) {
-			return NewUnmarshalError(node, fmt.Sprintf("value for '%s' out of bounds", valueType.Name()), err)
+			return u.decodeError(node, valueType, text, NewUnmarshalError(node, fmt.Sprintf("value for '%s' out of bounds", valueType.Name()), err))
 		}
 
 		value.SetUint(i)
@@ -224,7 +717,7 @@ func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...s
 
 		b, err := strconv.ParseBool(strings.TrimSpace(text))
 		if err != nil {
-			return NewUnmarshalError(node, fmt.Sprintf("'%s' is not a valid boolean", text), err)
+			return u.decodeError(node, valueType, text, NewUnmarshalError(node, fmt.Sprintf("'%s' is not a valid boolean", text), err))
 		}
 
 		value.SetBool(b)
@@ -245,12 +738,16 @@ func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...s
 
 		f, err := strconv.ParseFloat(strings.TrimSpace(text), bitSize)
 		if err != nil {
-			return NewUnmarshalError(node, fmt.Sprintf("'%s' is not a valid float", text), err)
+			return u.decodeError(node, valueType, text, NewUnmarshalError(node, fmt.Sprintf("'%s' is not a valid float", text), err))
 		}
 
 		value.SetFloat(f)
 	case reflect.Ptr:
-		// Dereference pointer
+		// A nil pointer is allocated, so that fields of absent elements stay nil.
+		if value.IsNil() {
+			value.Set(reflect.New(valueType.Elem()))
+		}
+
 		return u.node(node, value.Elem())
 	case reflect.Map:
 		mapKeyType := valueType.Key()
@@ -261,7 +758,6 @@ func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...s
 			return NewUnmarshalError(node, fmt.Sprintf("map key type '%s' is not primitive", mapKeyType.String()), nil)
 		}
 
-		// Map value must be primitive or a (pointer to) parser.TreeNode
 		var valueMode unmarshalMapValue
 		if u.isPrimitive(mapValueType) {
 			valueMode = mapValueIsPrimitive
@@ -270,10 +766,21 @@ func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...s
 		} else if mapValueType == reflect.TypeOf(&parser.TreeNode{}) {
 			valueMode = mapValueIsNodePointer
 		} else {
-			return NewUnmarshalError(node, "map value must be primitive type or (*)parser.TreeNode", nil)
+			valueMode = mapValueIsElement
+		}
+
+		if err := u.checkElements(node, len(node.Children)); err != nil {
+			return err
 		}
 
 		value.Set(reflect.MakeMap(valueType))
+
+		// keyPositions are the positions of the elements of the keys, see WithUniqueMapKeys.
+		keyPositions := map[interface{}]token.Pos{}
+
+		depth := u.path.len()
+		defer u.path.truncate(depth)
+
 		// A map will parse first level children as the key and the first child of those as the value.
 		for _, keyNode := range node.Children {
 			if !keyNode.IsNode() {
@@ -286,10 +793,32 @@ func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...s
 			// In order to recursively use u.node() to parse values, we will forge a fake text node here
 			// and use that to recurse. We use this trick to parse both the key and the value.
 			fakeNode := parser.NewStringNode(keyNode.Name)
+			fakeNode.Range = keyNode.Range
+
+			u.path.truncate(depth)
+			u.path.push("["+keyNode.Name+"]", keyNode.Name)
+
 			if err := u.node(fakeNode, mapKey); err != nil {
 				return NewUnmarshalError(node, "invalid map key", err)
 			}
 
+			if u.uniqueKeys {
+				if err := uniqueKey(node, keyNode, mapKey.Interface(), keyPositions); err != nil {
+					return err
+				}
+			}
+
+			if valueMode == mapValueIsElement {
+				mapValue := reflect.New(mapValueType).Elem()
+				if err := u.node(keyNode, mapValue); err != nil {
+					return NewUnmarshalError(node, fmt.Sprintf("invalid value for key '%v'", mapKey), err)
+				}
+
+				value.SetMapIndex(mapKey, mapValue)
+
+				continue
+			}
+
 			// Now that we parsed the key we continue with parsing the value
 			if len(keyNode.Children) == 0 {
 				return NewUnmarshalError(node, fmt.Sprintf("no value in map for key '%v'", mapKey), nil)
@@ -323,6 +852,8 @@ func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...s
 				}
 
 				fakeNode := parser.NewStringNode(primitiveValueToParse)
+				fakeNode.Range = valueNode.Range
+
 				if err := u.node(fakeNode, mapValue); err != nil {
 					return NewUnmarshalError(node, "value is incompatible with map type", err)
 				}
@@ -334,23 +865,29 @@ func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...s
 			value.SetMapIndex(mapKey, mapValue)
 		}
 	case reflect.Slice:
-		// Figure out type for elements. Should this be a slice we want to know what type is stored in it.
 		elementType := valueType.Elem()
-		if elementType.Kind() == reflect.Slice {
-			elementType = elementType.Elem()
-		}
 
 		// Create, process and append children
 		for _, child := range node.Children {
 			if len(tags) > 0 {
 				// Use rename tag to filter for slice elements with the given name.
-				if child.Name != tags[0] {
+				names := strings.Split(tags[0], "|")
+				if !u.fieldMatches(child, names[0], true, names[1:]) {
 					continue
 				}
 			}
 
+			if err := u.checkElements(node, value.Len()+1); err != nil {
+				return err
+			}
+
 			element := reflect.New(elementType).Elem()
-			if err := u.node(child, element); err != nil {
+
+			u.path.push(fmt.Sprintf("[%d]", value.Len()), child.Name)
+			err := u.node(child, element)
+			u.path.pop()
+
+			if err != nil {
 				return NewUnmarshalError(node, fmt.Sprintf("cannot read slice children for '%s'", node.Name), err)
 			}
 
@@ -358,91 +895,61 @@ func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...s
 		}
 	case reflect.Array:
 		return NewUnmarshalError(node, "arrays not supported, use a slice instead", nil)
+	case reflect.Interface:
+		if valueType.NumMethod() > 0 {
+			return NewUnmarshalError(node, fmt.Sprintf("with unsupported type '%s'", valueType), nil)
+		}
+
+		generic, err := u.generic(node)
+		if err != nil {
+			return err
+		}
+
+		value.Set(reflect.ValueOf(generic))
 	case reflect.Struct:
-		// Iterate over all struct fields.
-		for i := 0; i < value.NumField(); i++ {
-			fieldType := value.Type().Field(i)
-			field := value.Field(i)
+		// Embedded and inner structs are unmarshalled from the same node.
+		if u.structs != nil && !slices.Contains(u.structs[node], valueType) {
+			u.structs[node] = append(u.structs[node], valueType)
+		}
 
-			fieldName := fieldType.Name
-			unmarshalAs := unmarshalNormal
+		// labelIndex is the index of the next label to unmarshal.
+		labelIndex := 0
 
-			var tags []string
+		// Fields with the 'any' tag take the children, which are left by all other fields.
+		var anyFields []int
 
-			// Some tags will change the behavior of how this field will be processed.
-			if structTag, ok := fieldType.Tag.Lookup("tadl"); ok {
-				tags = strings.Split(structTag, ",")
+		for i, plan := range structPlan(valueType, u.tagFallback...) {
+			if plan.as == unmarshalAny {
+				anyFields = append(anyFields, i)
+			}
+		}
 
-				// The first tag will rename the field
-				if len(tags) > 0 {
-					rename := tags[0]
-					if len(rename) > 0 {
-						fieldName = rename
-					}
-				}
+		if len(anyFields) > 0 && u.used == nil {
+			u.used = map[usage]bool{}
+		}
 
-				// The second tag indicates the type we are parsing
-				if len(tags) > 1 {
-					as := tags[1]
-					switch as {
-					case "attr":
-						unmarshalAs = unmarshalAttribute
-					case "inner":
-						unmarshalAs = unmarshalInner
-					case "":
-						unmarshalAs = unmarshalNormal
-					default:
-						return NewUnmarshalError(node, fmt.Sprintf("field type '%s' invalid", as), nil)
-					}
-				}
+		// Iterate over all struct fields.
+		for i := 0; i < value.NumField(); i++ {
+			if slices.Contains(anyFields, i) {
+				continue
 			}
 
-			switch unmarshalAs {
-			case unmarshalNormal:
-				// Should the field be a slice and a rename param is set, then we need to pass the whole node in,
-				// not just a subnode, to allow for filtering of elements.
-				if field.Kind() == reflect.Slice && len(tags) > 0 && len(tags[0]) > 0 {
-					if err := u.node(node, field, tags...); err != nil {
-						return err
-					}
-				} else {
-					nodeForField, err := u.findSingleChild(node, fieldName)
-					if err != nil {
-						return err
-					}
-
-					if nodeForField == nil {
-						continue
-					}
-
-					err = u.node(nodeForField, field, tags...)
-					if err != nil {
-						return NewUnmarshalError(node, fmt.Sprintf("while processing field '%s'", fieldType.Name), err)
-					}
-				}
-			case unmarshalAttribute:
-				if node.Attributes.Has(fieldName) {
-					// We have everything ready to set the attribute.
-					// We want to handle integers and strings easily so we recurse here by creating a fake node.
-					// As this node is a string, it can *only* be parsed as a primitive type, everything else
-					// will return an error, just like we want.
-					fakeNode := parser.NewStringNode(fieldName)
-
-					err := u.node(fakeNode, field)
-					if err != nil {
-						// We throw away the error, as it was created with a fake node containing useless information.
-						return NewUnmarshalError(node, fmt.Sprintf("attribute '%s' requires primitve type", fieldName), nil)
-					}
-				} else if u.strict {
-					return NewUnmarshalError(node, fmt.Sprintf("attribute '%s' required", fieldName), nil)
+			if err := u.field(node, value, i, &labelIndex); err != nil {
+				if !u.allErrors {
+					return err
 				}
-			case unmarshalInner:
-				if err := u.node(node, field); err != nil {
-					return NewUnmarshalError(node, "'inner' struct tag caused an error", err)
+
+				u.errs = append(u.errs, err)
+			}
+		}
+
+		for _, i := range anyFields {
+			if err := u.field(node, value, i, &labelIndex); err != nil {
+				if !u.allErrors {
+					return err
 				}
-			default:
-				// Should never happen. We provide a helpful message just in case.
-				return fmt.Errorf("unmarshal in invalid state: unmarshalType=%v. this is a bug", unmarshalAs)
+
+				u.errs = append(u.errs, err)
 			}
 		}
 	default:
@@ -452,8 +959,403 @@ func (u *unmarshaler) node(node *parser.TreeNode, value reflect.Value, tags ...s
 	return nil
 }
 
+// field unmarshals the i-th field of the struct value from node.
+// labelIndex is the index of the next label of node, that has not been unmarshalled into a field.
+func (u *unmarshaler) field(node *parser.TreeNode, value reflect.Value, i int, labelIndex *int) error {
+	plan := structPlan(value.Type(), u.tagFallback...)[i]
+	field := value.Field(i)
+
+	fieldName := plan.name
+	renamed := plan.renamed
+	unmarshalAs := plan.as
+	aliases := plan.aliases
+	tags := plan.tags
+
+	if !renamed && u.nameMapper != nil {
+		fieldName = u.nameMapper(fieldName)
+	}
+
+	if plan.invalid != "" {
+		return NewUnmarshalError(node, fmt.Sprintf("field type '%s' invalid", plan.invalid), nil)
+	}
+
+	// Errors may return early from nested nodes, so the path is restored to its current depth.
+	defer u.path.truncate(u.path.len())
+	u.path.push(plan.goName, "")
+
+	switch unmarshalAs {
+	case unmarshalNormal:
+		// Should the field be a slice and a rename param is set, then we need to pass the whole node in,
+		// not just a subnode, to allow for filtering of elements.
+		if field.Kind() == reflect.Slice && field.Type() != orderedMapType && field.Type() != rawType &&
+			!u.isPrimitive(field.Type()) && !reflect.PtrTo(field.Type()).Implements(unmarshalerType) &&
+			len(tags) > 0 && len(tags[0]) > 0 {
+			if err := u.node(node, field, tags...); err != nil {
+				return err
+			}
+		} else {
+			var (
+				nodeForField *parser.TreeNode
+				err          error
+			)
+
+			if u.isPrimitive(field.Type()) {
+				nodeForField, err = u.findPrimitiveChild(node, fieldName, renamed, field.Type(), aliases...)
+			} else {
+				nodeForField, err = u.findSingleChild(node, fieldName, renamed, aliases...)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if nodeForField == nil {
+				return u.defaultValue(node, field, plan)
+			}
+
+			u.path.push("", nodeForField.Name)
+			err = u.node(nodeForField, field, tags...)
+			u.path.pop()
+
+			if err != nil {
+				return NewUnmarshalError(node, fmt.Sprintf("while processing field '%s'", plan.goName), err)
+			}
+		}
+	case unmarshalAttribute:
+		if u.caseInsensitive && !node.Attributes.Has(fieldName) {
+			for i := 0; i < node.Attributes.Len(); i++ {
+				if key, _ := node.Attributes.Get(i); strings.EqualFold(*key, fieldName) {
+					fieldName = *key
+					break
+				}
+			}
+		}
+
+		for _, alias := range aliases {
+			if !node.Attributes.Has(fieldName) && node.Attributes.Has(alias) {
+				key, _ := node.Attributes.Range(node.Attributes.Index(alias))
+				u.deprecate(key.BeginPos, alias, fieldName)
+				fieldName = alias
+			}
+		}
+
+		if node.Attributes.Has(fieldName) {
+			u.use(node, fieldName)
+
+			// We have everything ready to set the attribute.
+			// We want to handle integers and strings easily so we recurse here by creating a fake node.
+			// As this node is a string, it can *only* be parsed as a primitive type, everything else
+			// will return an error, just like we want.
+			// The fake node has the range of the value, so that a DecodeError points to it.
+			_, attrValue := node.Attributes.Get(node.Attributes.Index(fieldName))
+			_, value := node.Attributes.Range(node.Attributes.Index(fieldName))
+			fakeNode := parser.NewStringNode(*attrValue)
+			fakeNode.Range = value
+
+			u.path.push("", "@"+fieldName)
+			err := u.node(fakeNode, field)
+			u.path.pop()
+
+			if err != nil {
+				err := NewUnmarshalError(node, fmt.Sprintf("while processing attribute '%s'", fieldName), err)
+				err.pos = value.BeginPos
+
+				return err
+			}
+		} else if u.strict {
+			return NewUnmarshalError(node, fmt.Sprintf("attribute '%s' required", fieldName), nil)
+		} else {
+			return u.defaultValue(node, field, plan)
+		}
+	case unmarshalInner:
+		if err := u.node(node, field); err != nil {
+			if plan.embedded {
+				return NewUnmarshalError(node, fmt.Sprintf("while processing embedded '%s'", plan.goName), err)
+			}
+
+			return NewUnmarshalError(node, "'inner' struct tag caused an error", err)
+		}
+	case unmarshalCharData:
+		return u.charData(node, field, plan.goName)
+	case unmarshalAny:
+		return u.anyChildren(node, field, plan.goName)
+	case unmarshalTable:
+		nodeForField, err := u.findSingleChild(node, fieldName, renamed, aliases...)
+		if err != nil {
+			return err
+		}
+
+		if nodeForField == nil {
+			return nil
+		}
+
+		if err := u.table(nodeForField, field); err != nil {
+			return NewUnmarshalError(node, fmt.Sprintf("while processing table '%s'", plan.goName), err)
+		}
+	case unmarshalLabel:
+		if field.Kind() == reflect.Slice {
+			if *labelIndex < len(node.Labels) {
+				field.Set(reflect.ValueOf(append([]string(nil), node.Labels[*labelIndex:]...)))
+				*labelIndex = len(node.Labels)
+			}
+
+			return nil
+		}
+
+		if field.Kind() != reflect.String {
+			return NewUnmarshalError(node, fmt.Sprintf("label '%s' requires string or []string", plan.goName), nil)
+		}
+
+		if *labelIndex < len(node.Labels) {
+			field.SetString(node.Labels[*labelIndex])
+			*labelIndex++
+		} else if u.strict {
+			return NewUnmarshalError(node, fmt.Sprintf("label '%s' required", plan.goName), nil)
+		}
+	case unmarshalPosition:
+		if field.Type() != positionType {
+			return NewUnmarshalError(node, fmt.Sprintf("pos '%s' requires tadl.Position", plan.goName), nil)
+		}
+
+		field.Set(reflect.ValueOf(node.Range))
+	case unmarshalAttributes:
+		return u.attributes(node, field, plan.goName)
+	case unmarshalSkip:
+		return nil
+	default:
+		// Should never happen. We provide a helpful message just in case.
+		return fmt.Errorf("unmarshal in invalid state: unmarshalType=%v. this is a bug", unmarshalAs)
+	}
+
+	return nil
+}
+
+// defaultValue unmarshals the default tag of plan into field, if the field has one. It is used for
+// fields, whose element or attribute is absent in node.
+func (u *unmarshaler) defaultValue(node *parser.TreeNode, field reflect.Value, plan fieldPlan) error {
+	if !plan.hasDefault {
+		return nil
+	}
+
+	// Like for attributes, the text is unmarshalled from a fake node.
+	fakeNode := parser.NewStringNode(plan.def)
+	fakeNode.Range = node.Range
+
+	if err := u.node(fakeNode, field); err != nil {
+		return NewUnmarshalError(node, fmt.Sprintf("invalid default of field '%s'", plan.goName), err)
+	}
+
+	return nil
+}
+
+// attributes unmarshals all attributes of node into the map field with the given name, see Unmarshal.
+func (u *unmarshaler) attributes(node *parser.TreeNode, value reflect.Value, name string) error {
+	if value.Kind() != reflect.Map || !u.isPrimitive(value.Type().Key()) || !u.isPrimitive(value.Type().Elem()) {
+		return NewUnmarshalError(node, fmt.Sprintf("attrs '%s' requires a map of primitive types", name), nil)
+	}
+
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, val := node.Attributes.Get(i)
+		keyRange, valueRange := node.Attributes.Range(i)
+		u.use(node, *key)
+
+		mapKey := reflect.New(value.Type().Key()).Elem()
+		fakeNode := parser.NewStringNode(*key)
+		fakeNode.Range = keyRange
+
+		if err := u.node(fakeNode, mapKey); err != nil {
+			return NewUnmarshalError(node, fmt.Sprintf("invalid key of attribute '%s'", *key), err)
+		}
+
+		mapValue := reflect.New(value.Type().Elem()).Elem()
+		fakeNode = parser.NewStringNode(*val)
+		fakeNode.Range = valueRange
+
+		if err := u.node(fakeNode, mapValue); err != nil {
+			return NewUnmarshalError(node, fmt.Sprintf("invalid value of attribute '%s'", *key), err)
+		}
+
+		if value.IsNil() {
+			value.Set(reflect.MakeMap(value.Type()))
+		}
+
+		value.SetMapIndex(mapKey, mapValue)
+	}
+
+	return nil
+}
+
+// decodeError returns a DecodeError for text of node, which cannot be converted into t.
+func (u *unmarshaler) decodeError(node *parser.TreeNode, t reflect.Type, text string, err error) error {
+	return &DecodeError{
+		FieldPath: u.path.field(),
+		NodePath:  u.path.node(),
+		Pos:       node.Range.BeginPos,
+		Expected:  t.String(),
+		Value:     text,
+		Err:       err,
+	}
+}
+
+// orderedMap unmarshals the children of node into an OrderedMap.
+// It follows the same rules as unmarshalling into a map[string]string.
+func (u *unmarshaler) orderedMap(node *parser.TreeNode, value reflect.Value) error {
+	if err := u.checkElements(node, len(node.Children)); err != nil {
+		return err
+	}
+
+	m := OrderedMap{}
+	keyPositions := map[interface{}]token.Pos{}
+
+	for _, keyNode := range node.Children {
+		if !keyNode.IsNode() {
+			return NewUnmarshalError(node, "map key must be a node", nil)
+		}
+
+		if u.uniqueKeys {
+			if err := uniqueKey(node, keyNode, keyNode.Name, keyPositions); err != nil {
+				return err
+			}
+		}
+
+		if len(keyNode.Children) == 0 {
+			return NewUnmarshalError(node, fmt.Sprintf("no value in map for key '%s'", keyNode.Name), nil)
+		} else if u.strict && len(keyNode.Children) != 1 {
+			return NewUnmarshalError(node, fmt.Sprintf("key '%s' needs exactly one value", keyNode.Name), nil)
+		}
+
+		valueNode := keyNode.Children[0]
+		if u.strict && len(valueNode.Children) > 0 {
+			return NewUnmarshalError(node, fmt.Sprintf("value for key '%s' must have no children", keyNode.Name), nil)
+		}
+
+		kv := KeyValue{Key: keyNode.Name, Node: keyNode}
+
+		if valueNode.IsNode() {
+			kv.Value = valueNode.Name
+		} else if valueNode.IsText() {
+			kv.Value = *valueNode.Text
+		} else {
+			return NewUnmarshalError(node, fmt.Sprintf("value for key '%s' must be node or text", keyNode.Name), nil)
+		}
+
+		m = append(m, kv)
+	}
+
+	value.Set(reflect.ValueOf(m))
+
+	return nil
+}
+
+// uniqueKey returns an error, if key of the element keyNode of the map node is already in positions.
+// Otherwise it adds the position of keyNode.
+func uniqueKey(node, keyNode *parser.TreeNode, key interface{}, positions map[interface{}]token.Pos) error {
+	if first, ok := positions[key]; ok {
+		err := NewUnmarshalError(node, fmt.Sprintf("map key '%v' at %s already defined at %s", key, keyNode.Range.BeginPos, first), nil)
+		err.pos = keyNode.Range.BeginPos
+
+		return err
+	}
+
+	positions[key] = keyNode.Range.BeginPos
+
+	return nil
+}
+
+// table unmarshals the rows of a table into a slice of structs.
+// The first child of node is the header row, which names the struct fields of the cells in the following rows.
+func (u *unmarshaler) table(node *parser.TreeNode, value reflect.Value) error {
+	if value.Kind() != reflect.Slice || value.Type().Elem().Kind() != reflect.Struct {
+		return NewUnmarshalError(node, "'table' requires a slice of structs", nil)
+	}
+
+	var rows []*parser.TreeNode
+
+	for _, child := range node.Children {
+		if child.IsNode() {
+			rows = append(rows, child)
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var header []string
+
+	for _, cell := range rows[0].Children {
+		name, err := cellText(cell)
+		if err != nil {
+			return NewUnmarshalError(rows[0], "invalid header", err)
+		}
+
+		header = append(header, name)
+	}
+
+	if err := u.checkElements(node, len(rows)-1); err != nil {
+		return err
+	}
+
+	for _, row := range rows[1:] {
+		if len(row.Children) > len(header) {
+			return NewUnmarshalError(row, fmt.Sprintf("row has %d cells, but header only %d", len(row.Children), len(header)), nil)
+		}
+
+		// Forge a node with a child per cell, so that it can be unmarshalled like a regular struct.
+		fakeRow := parser.NewNode(row.Name)
+		fakeRow.Range = row.Range
+
+		for i, cell := range row.Children {
+			text, err := cellText(cell)
+			if err != nil {
+				return NewUnmarshalError(row, fmt.Sprintf("invalid cell for '%s'", header[i]), err)
+			}
+
+			fakeCell := parser.NewNode(header[i]).AddChildren(parser.NewStringNode(text))
+			fakeCell.Range = cell.Range
+			fakeRow.AddChildren(fakeCell)
+		}
+
+		element := reflect.New(value.Type().Elem()).Elem()
+		u.path.push(fmt.Sprintf("[%d]", value.Len()), row.Name)
+		err := u.node(fakeRow, element)
+		u.path.pop()
+
+		if err != nil {
+			return NewUnmarshalError(row, "cannot read table row", err)
+		}
+
+		value.Set(reflect.Append(value, element))
+	}
+
+	return nil
+}
+
+// cellText returns the text of a table cell, which is either a text or a node without children.
+func cellText(cell *parser.TreeNode) (string, error) {
+	if cell.IsText() {
+		return *cell.Text, nil
+	}
+
+	if cell.IsNode() && len(cell.Children) == 0 {
+		return cell.Name, nil
+	}
+
+	return "", NewUnmarshalError(cell, "cell must be text or an element without children", nil)
+}
+
 // isPrimitive returns true if the given type is a primitive one.
+// Types implementing encoding.TextUnmarshaler are primitive as well.
 func (u *unmarshaler) isPrimitive(t reflect.Type) bool {
+	// Pointers are unmarshalled like the value they point to.
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Implements(textUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+
 	switch t.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
@@ -464,15 +1366,49 @@ func (u *unmarshaler) isPrimitive(t reflect.Type) bool {
 	return false
 }
 
+// textUnmarshaler returns the encoding.TextUnmarshaler of value, if its type or a pointer to it
+// implements the interface. A nil pointer is set to a new value first.
+func textUnmarshaler(value reflect.Value) (encoding.TextUnmarshaler, bool) {
+	switch {
+	case value.Kind() == reflect.Ptr && value.Type().Implements(textUnmarshalerType):
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+
+		return value.Interface().(encoding.TextUnmarshaler), true
+	case value.Kind() != reflect.Ptr && value.CanAddr() && reflect.PtrTo(value.Type()).Implements(textUnmarshalerType):
+		return value.Addr().Interface().(encoding.TextUnmarshaler), true
+	}
+
+	return nil, false
+}
+
+// tadlUnmarshaler returns the Unmarshaler of value, if its type or a pointer to it implements the
+// interface. A nil pointer is set to a new value first.
+func tadlUnmarshaler(value reflect.Value) (Unmarshaler, bool) {
+	switch {
+	case value.Kind() == reflect.Ptr && value.Type().Implements(unmarshalerType):
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+
+		return value.Interface().(Unmarshaler), true
+	case value.Kind() != reflect.Ptr && value.CanAddr() && reflect.PtrTo(value.Type()).Implements(unmarshalerType):
+		return value.Addr().Interface().(Unmarshaler), true
+	}
+
+	return nil, false
+}
+
 // findSingleChild returns the child with the given name or an error in strict mode when there is no
 // such child or there are multiple children.
 // In non-strict mode this method might return (nil, nil) which means that no such child exists, or it will
-// return the first item with that name.
-func (u *unmarshaler) findSingleChild(node *parser.TreeNode, name string) (*parser.TreeNode, error) {
+// return the first item with that name. See fieldMatches for exact and aliases.
+func (u *unmarshaler) findSingleChild(node *parser.TreeNode, name string, exact bool, aliases ...string) (*parser.TreeNode, error) {
 	var child *parser.TreeNode
 
 	for _, c := range node.Children {
-		if c.Name == name {
+		if u.fieldMatches(c, name, exact, aliases) {
 			if child == nil {
 				child = c
 
@@ -493,6 +1429,127 @@ func (u *unmarshaler) findSingleChild(node *parser.TreeNode, name string) (*pars
 	return child, nil
 }
 
+// fieldMatches returns true if child is an element for the field name or one of its aliases,
+// which are compared exactly. Elements using an alias are reported, see WithDeprecationWarnings.
+func (u *unmarshaler) fieldMatches(child *parser.TreeNode, name string, exact bool, aliases []string) bool {
+	if u.nameMatches(child, name, exact) {
+		u.use(child, "")
+
+		return true
+	}
+
+	for _, alias := range aliases {
+		if child.IsNode() && child.Name == alias {
+			u.deprecate(child.Range.BeginPos, alias, name)
+			u.use(child, "")
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// deprecate reports the use of alias instead of name at pos, see WithDeprecationWarnings.
+func (u *unmarshaler) deprecate(pos token.Pos, alias, name string) {
+	if u.deprecated != nil {
+		u.deprecated(Diagnostic{Pos: pos, Message: fmt.Sprintf("'%s' is deprecated, use '%s' instead", alias, name)})
+	}
+}
+
+// nameMatches returns true if child is an element for the field name.
+// Unless exact is set, names are compared fuzzy, if configured with WithFuzzyNames.
+// Names are compared ignoring case, if configured with DecodeOptions.CaseInsensitiveNames.
+func (u *unmarshaler) nameMatches(child *parser.TreeNode, name string, exact bool) bool {
+	if child.Name == name {
+		return true
+	}
+
+	if u.caseInsensitive && child.IsNode() && strings.EqualFold(child.Name, name) {
+		return true
+	}
+
+	if exact || !u.fuzzyNames || !child.IsNode() {
+		return false
+	}
+
+	return normalizeName(child.Name) == normalizeName(name)
+}
+
+// normalizeName lowercases name and removes '-' and '_'.
+func normalizeName(name string) string {
+	var sb strings.Builder
+
+	for _, r := range name {
+		if r == '-' || r == '_' {
+			continue
+		}
+
+		sb.WriteRune(unicode.ToLower(r))
+	}
+
+	return sb.String()
+}
+
+// findPrimitiveChild returns the child with the given name, that is unmarshalled into a field of type t.
+// Repeated children are handled as configured with WithDuplicates.
+// This might return (nil, nil) in non-strict mode, if no such child exists.
+func (u *unmarshaler) findPrimitiveChild(node *parser.TreeNode, name string, exact bool, t reflect.Type,
+	aliases ...string) (*parser.TreeNode, error) {
+	var children []*parser.TreeNode
+
+	for _, c := range node.Children {
+		if u.fieldMatches(c, name, exact, aliases) {
+			children = append(children, c)
+		}
+	}
+
+	switch {
+	case len(children) == 0:
+		if u.strict {
+			return nil, NewUnmarshalError(node, fmt.Sprintf("child '%s' required", name), nil)
+		}
+
+		return nil, nil
+	case len(children) == 1:
+		return children[0], nil
+	}
+
+	switch u.duplicates {
+	case DuplicatesFirst:
+		return children[0], nil
+	case DuplicatesLast:
+		return children[len(children)-1], nil
+	case DuplicatesJoin:
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		if t.Kind() != reflect.String {
+			return nil, NewUnmarshalError(node, fmt.Sprintf("'%s' defined multiple times, but only strings can be joined", name), nil)
+		}
+
+		texts := make([]string, 0, len(children))
+
+		for _, c := range children {
+			text, err := u.findText(c)
+			if err != nil {
+				return nil, NewUnmarshalError(node, fmt.Sprintf("cannot join '%s'", name), err)
+			}
+
+			texts = append(texts, text)
+		}
+
+		// Forge a node holding the joined text, which is unmarshalled like a regular element.
+		joined := parser.NewNode(name).AddChildren(parser.NewStringNode(strings.Join(texts, u.separator)))
+		joined.Range = children[0].Range
+
+		return joined, nil
+	default:
+		return nil, NewUnmarshalError(node, fmt.Sprintf("'%s' defined multiple times", name), nil)
+	}
+}
+
 // findText will find text inside the children of the given node or will return the text of a text node directly.
 // In strict mode exactly one text child is required.
 // In non-strict mode all text children will be concatenated. This might then return an empty string
@@ -525,6 +1582,50 @@ func (u *unmarshaler) findText(node *parser.TreeNode) (string, error) {
 	return text.String(), nil
 }
 
+// charData sets the string field to the concatenated text children of node, see the 'chardata' tag.
+func (u *unmarshaler) charData(node *parser.TreeNode, field reflect.Value, goName string) error {
+	if field.Kind() != reflect.String {
+		return NewUnmarshalError(node, fmt.Sprintf("chardata '%s' requires string", goName), nil)
+	}
+
+	var text strings.Builder
+
+	for _, c := range node.Children {
+		if c.IsText() {
+			text.WriteString(*c.Text)
+		}
+	}
+
+	if err := u.checkString(node, text.Len()); err != nil {
+		return err
+	}
+
+	field.SetString(text.String())
+
+	return nil
+}
+
+// anyChildren sets the field to the child elements of node, which have not been used by another field,
+// see the 'any' tag.
+func (u *unmarshaler) anyChildren(node *parser.TreeNode, field reflect.Value, goName string) error {
+	if field.Type() != reflect.TypeOf([]*parser.TreeNode(nil)) {
+		return NewUnmarshalError(node, fmt.Sprintf("any '%s' requires []*parser.TreeNode", goName), nil)
+	}
+
+	var children []*parser.TreeNode
+
+	for _, child := range node.Children {
+		if child.IsNode() && !u.used[usage{node: child}] {
+			u.use(child, "")
+			children = append(children, child)
+		}
+	}
+
+	field.Set(reflect.ValueOf(children))
+
+	return nil
+}
+
 // getAsText will return a string from the given node.
 // This can either be from the node itself should it either:
 //  - Be text, in which case that is returned
@@ -4,11 +4,20 @@
 package tadl
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/token"
 	"github.com/r3labs/diff/v2"
 	"log"
+	"net"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func ExampleUnmarshal() {
@@ -87,6 +96,7 @@ func TestUnmarshal(t *testing.T) {
 		name   string
 		text   string
 		strict bool
+		opts   []DecodeOption
 		// into is an empty instance we will unmarshal into.
 		into interface{}
 		// want is a filled instance with all values we want.
@@ -288,6 +298,41 @@ func TestUnmarshal(t *testing.T) {
 		},
 	})
 
+	type G2AttributeInner struct {
+		Host    string   `tadl:"host,attr"`
+		Port    *uint16  `tadl:"port,attr"`
+		Missing *string  `tadl:"missing,attr"`
+		IP      net.IP   `tadl:"ip,attr"`
+		Tags    []string `tadl:"tag"`
+	}
+
+	type G2Attribute struct {
+		Server G2AttributeInner `tadl:"server"`
+	}
+
+	port := uint16(8080)
+
+	testCases = append(testCases, TestCase{
+		name: "attributes in grammar 2",
+		text: `#!{server @host="example.org" @port="8080" @ip="10.0.0.1" {tag "a"}}`,
+		into: &G2Attribute{},
+		want: &G2Attribute{
+			Server: G2AttributeInner{
+				Host: "example.org",
+				Port: &port,
+				IP:   net.ParseIP("10.0.0.1"),
+				Tags: []string{"a"},
+			},
+		},
+	})
+
+	testCases = append(testCases, TestCase{
+		name:    "attribute value of wrong type",
+		text:    `#!{server @port="http"}`,
+		into:    &G2Attribute{},
+		wantErr: true,
+	})
+
 	type RequiredAttributeStrictInner struct {
 		Attribute string `tadl:",attr"`
 	}
@@ -427,10 +472,286 @@ func TestUnmarshal(t *testing.T) {
 		wantErr: true,
 	})
 
+	type Repeated struct {
+		Name string `tadl:"name"`
+		Age  int    `tadl:"age"`
+	}
+
+	testCases = append(testCases, TestCase{
+		name:    "repeated element is an error by default",
+		text:    `#!{ name "a", name "b" }`,
+		into:    &Repeated{},
+		wantErr: true,
+	})
+
+	testCases = append(testCases, TestCase{
+		name: "repeated element first wins",
+		text: `#!{ name "a", name "b", age 1, age 2 }`,
+		opts: []DecodeOption{WithDuplicates(DuplicatesFirst)},
+		into: &Repeated{},
+		want: &Repeated{Name: "a", Age: 1},
+	})
+
+	testCases = append(testCases, TestCase{
+		name:   "repeated element last wins",
+		text:   `#!{ name "a", name "b", age 1, age 2 }`,
+		strict: true,
+		opts:   []DecodeOption{WithDuplicates(DuplicatesLast)},
+		into:   &Repeated{},
+		want:   &Repeated{Name: "b", Age: 2},
+	})
+
+	testCases = append(testCases, TestCase{
+		name: "repeated element joined",
+		text: `#!{ name "a", name "b", name "c" }`,
+		opts: []DecodeOption{WithJoinedDuplicates(", ")},
+		into: &Repeated{},
+		want: &Repeated{Name: "a, b, c"},
+	})
+
+	testCases = append(testCases, TestCase{
+		name:    "repeated element cannot be joined into int",
+		text:    `#!{ age 1, age 2 }`,
+		opts:    []DecodeOption{WithJoinedDuplicates(",")},
+		into:    &Repeated{},
+		wantErr: true,
+	})
+
+	type FuzzyInner struct {
+		Enabled bool
+	}
+
+	type Fuzzy struct {
+		MaxConns  int
+		LogLevel  string
+		TLSConfig FuzzyInner
+		Explicit  string `tadl:"ExactName"`
+	}
+
+	testCases = append(testCases, TestCase{
+		name: "fuzzy names",
+		text: `#!{
+					log_level "debug"
+					max_conns 10,
+					exact_name "ignored"
+					tlsconfig { enabled "true" }
+				}`,
+		opts: []DecodeOption{WithFuzzyNames()},
+		into: &Fuzzy{},
+		want: &Fuzzy{
+			MaxConns:  10,
+			LogLevel:  "debug",
+			TLSConfig: FuzzyInner{Enabled: true},
+		},
+	})
+
+	testCases = append(testCases, TestCase{
+		name: "names are exact by default",
+		text: `#!{ max_conns 10, MaxConns 5 }`,
+		into: &Fuzzy{},
+		want: &Fuzzy{MaxConns: 5},
+	})
+
+	type AliasInner struct {
+		Enabled bool `tadl:"enabled"`
+	}
+
+	type Alias struct {
+		Timeout int          `tadl:"timeout|timeout_ms"`
+		TLS     AliasInner   `tadl:"tls|ssl"`
+		Hosts   []string     `tadl:"host|server"`
+		Inner   []AliasInner `tadl:"inner"`
+	}
+
+	testCases = append(testCases, TestCase{
+		name: "aliases",
+		text: `#!{
+					timeout_ms 30,
+					ssl { enabled "true" }
+					host "a", server "b", host "c"
+				}`,
+		into: &Alias{},
+		want: &Alias{
+			Timeout: 30,
+			TLS:     AliasInner{Enabled: true},
+			Hosts:   []string{"a", "b", "c"},
+		},
+	})
+
+	testCases = append(testCases, TestCase{
+		name:    "name and alias in strict mode",
+		text:    `#!{ timeout 1, timeout_ms 2, tls { enabled "true" } }`,
+		strict:  true,
+		into:    &Alias{},
+		wantErr: true,
+	})
+
+	type MappedInner struct {
+		DisplayName string
+	}
+
+	type Mapped struct {
+		MaxConns int
+		Inner    MappedInner `tadl:"Server"`
+	}
+
+	testCases = append(testCases, TestCase{
+		name: "name mapper",
+		text: `#!{
+					max_conns 10,
+					Server {
+						display_name "web"
+					}
+				}`,
+		opts: []DecodeOption{WithNameMapper(SnakeCase)},
+		into: &Mapped{},
+		want: &Mapped{
+			MaxConns: 10,
+			Inner:    MappedInner{DisplayName: "web"},
+		},
+	})
+
+	type Ordered struct {
+		Chain OrderedMap
+	}
+
+	testCases = append(testCases, TestCase{
+		name: "ordered map",
+		text: `#!{
+					Chain {
+						zlib "fast",
+						auth basic,
+						cors "*"
+					}
+				}`,
+		into: &Ordered{},
+		want: &Ordered{
+			Chain: OrderedMap{
+				{Key: "zlib", Value: "fast", Node: parser.NewNode("zlib").AddChildren(parser.NewStringNode("fast"))},
+				{Key: "auth", Value: "basic", Node: parser.NewNode("auth").AddChildren(parser.NewNode("basic"))},
+				{Key: "cors", Value: "*", Node: parser.NewNode("cors").AddChildren(parser.NewStringNode("*"))},
+			},
+		},
+	})
+
+	testCases = append(testCases, TestCase{
+		name:    "ordered map without value",
+		text:    `#!{ Chain { zlib, auth } }`,
+		into:    &Ordered{},
+		wantErr: true,
+	})
+
+	type NestedSlice struct {
+		Rows [][]string
+	}
+
+	testCases = append(testCases, TestCase{
+		name: "nested slice",
+		text: `#!{
+					Rows {
+						row("a" "b"),
+						row("c"),
+					}
+				}`,
+		into: &NestedSlice{},
+		want: &NestedSlice{
+			Rows: [][]string{{"a", "b"}, {"c"}},
+		},
+	})
+
+	type TableRow struct {
+		Name string `tadl:"name"`
+		Age  int    `tadl:"age"`
+	}
+
+	type Table struct {
+		People []TableRow `tadl:"people,table"`
+	}
+
+	testCases = append(testCases, TestCase{
+		name: "table",
+		text: `#!{
+					people {
+						row(name, age)
+						row("Alice" "30")
+						row(Bob, "25")
+						row("Carol")
+					}
+				}`,
+		into: &Table{},
+		want: &Table{
+			People: []TableRow{
+				{Name: "Alice", Age: 30},
+				{Name: "Bob", Age: 25},
+				{Name: "Carol"},
+			},
+		},
+	})
+
+	testCases = append(testCases, TestCase{
+		name: "table row with too many cells",
+		text: `#!{
+					people {
+						row(name)
+						row("Alice" "30")
+					}
+				}`,
+		into:    &Table{},
+		wantErr: true,
+	})
+
+	type LabeledServer struct {
+		Name   string   `tadl:",label"`
+		Region string   `tadl:",label"`
+		Rest   []string `tadl:",label"`
+		Port   int      `tadl:"port"`
+	}
+
+	type Labels struct {
+		Server LabeledServer `tadl:"server"`
+	}
+
+	testCases = append(testCases, TestCase{
+		name: "labels",
+		text: `#!{
+					server "web" "eu-west" "a" "b" {
+						port 80
+					}
+				}`,
+		into: &Labels{},
+		want: &Labels{
+			Server: LabeledServer{
+				Name:   "web",
+				Region: "eu-west",
+				Rest:   []string{"a", "b"},
+				Port:   80,
+			},
+		},
+	})
+
+	testCases = append(testCases, TestCase{
+		name: "missing label",
+		text: `#!{
+					server "web" {}
+				}`,
+		into: &Labels{},
+		want: &Labels{
+			Server: LabeledServer{Name: "web"},
+		},
+	})
+
+	testCases = append(testCases, TestCase{
+		name:    "label required in strict mode",
+		text:    `#!{ server "web" { port 80 } }`,
+		strict:  true,
+		into:    &Labels{},
+		wantErr: true,
+	})
+
 	// Run all test cases
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := Unmarshal(strings.NewReader(tc.text), tc.into, tc.strict)
+			err := Unmarshal(strings.NewReader(tc.text), tc.into, tc.strict, tc.opts...)
 
 			if err != nil {
 				if tc.wantErr {
@@ -479,3 +800,1383 @@ func TestUnmarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestDeprecationWarnings(t *testing.T) {
+	type Config struct {
+		Timeout int    `tadl:"timeout|timeout_ms"`
+		Name    string `tadl:"name|id,attr"`
+		Port    int    `tadl:"port"`
+	}
+
+	input := "#!{\n\ttimeout_ms 30,\n\tport 80\n}"
+
+	var warnings []string
+
+	err := Unmarshal(strings.NewReader(input), &Config{}, false, WithDeprecationWarnings(func(d Diagnostic) {
+		warnings = append(warnings, d.String())
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{":2:2: 'timeout_ms' is deprecated, use 'timeout' instead"}
+	if len(warnings) != len(want) || warnings[0] != want[0] {
+		t.Errorf("expected warnings %v but got %v", want, warnings)
+	}
+
+	warnings = nil
+
+	var item struct {
+		Item Config `tadl:"item"`
+	}
+
+	input = "#!{\n\titem @id=\"x\" {timeout 1}\n}"
+
+	if err := Unmarshal(strings.NewReader(input), &item, false, WithDeprecationWarnings(func(d Diagnostic) {
+		warnings = append(warnings, d.String())
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	want = []string{":2:8: 'id' is deprecated, use 'name' instead"}
+	if len(warnings) != len(want) || warnings[0] != want[0] {
+		t.Errorf("expected warnings %v but got %v", want, warnings)
+	}
+}
+
+func TestUnusedWarnings(t *testing.T) {
+	type Server struct {
+		Name  string   `tadl:",label"`
+		Port  int      `tadl:"port|listen"`
+		Zone  string   `tadl:"zone,attr"`
+		Hosts []string `tadl:"host"`
+		Env   map[string]string
+	}
+
+	type Config struct {
+		Debug   bool     `tadl:"debug"`
+		Servers []Server `tadl:"server"`
+		Raw     Raw      `tadl:"plugin"`
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "all used",
+			text: "#!{\n\tdebug true,\n\tserver @zone=\"eu\" \"web\" {listen 80, host a, host b, Env {a 1}},\n\tplugin {x 1}\n}",
+		},
+		{
+			name: "unused elements and attributes",
+			text: "#!{\n\tdebg true,\n\tserver @zone=\"eu\" @weight=\"1\" {port 80, hosts a},\n\tserver {timeout 1}\n}",
+			want: []string{
+				":2:2: 'debg' is not used",
+				":3:21: attribute 'weight' is not used",
+				":3:42: 'hosts' is not used",
+				":4:10: 'timeout' is not used",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings []string
+
+			err := Unmarshal(strings.NewReader(tt.text), &Config{}, false, WithUnusedWarnings(func(d Diagnostic) {
+				warnings = append(warnings, d.String())
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fmt.Sprint(warnings) != fmt.Sprint(tt.want) {
+				t.Errorf("expected warnings %q but got %q", tt.want, warnings)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	type Server struct {
+		Name  string   `tadl:"name"`
+		Hosts []string `tadl:"host"`
+		Raw   Raw      `tadl:"plugin"`
+		Env   map[string]string
+	}
+
+	type Config struct {
+		Servers []Server `tadl:"server"`
+	}
+
+	limits := Limits{MaxDepth: 4, MaxElements: 2, MaxStringLen: 12, MaxTokens: 100}
+
+	tests := []struct {
+		name    string
+		text    string
+		wantErr bool
+	}{
+		{
+			name: "within limits",
+			text: `#!{server {name "web", host a, host b, plugin {x}, Env {a 1, b 2}}, server {name "api"}}`,
+		},
+		{
+			name:    "too deep",
+			text:    `#!{server {plugin {a {b {c}}}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "too many slice elements",
+			text:    `#!{server, server, server}`,
+			wantErr: true,
+		},
+		{
+			name:    "too many map entries",
+			text:    `#!{server {Env {a 1, b 2, c 3}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "string too long",
+			text:    `#!{server {name "localhost.example"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "raw too long",
+			text:    `#!{server {plugin {size 10}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "too many tokens",
+			text:    "#!{server {name \"web\"}\n" + strings.Repeat("// comment\n", 100) + "}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal(strings.NewReader(tt.text), &Config{}, false, WithLimits(limits))
+
+			if !tt.wantErr && err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantErr && !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("expected ErrLimitExceeded but got %v", err)
+			}
+
+			// Without limits, all documents are valid.
+			if err := Unmarshal(strings.NewReader(tt.text), &Config{}, false); err != nil {
+				t.Errorf("unexpected error without limits: %v", err)
+			}
+		})
+	}
+}
+
+func TestUniqueMapKeys(t *testing.T) {
+	type Config struct {
+		Ports map[int]string `tadl:"ports"`
+		Env   OrderedMap     `tadl:"env"`
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{
+			name: "unique",
+			text: "#!{\n\tports {80 http, 443 https},\n\tenv {a 1, b 2}\n}",
+		},
+		{
+			name:    "repeated map key",
+			text:    "#!{\n\tports {80 http, 443 https, 080 proxy}\n}",
+			wantErr: "cannot unmarshal into 'root', while processing field 'Ports': cannot unmarshal into 'ports', map key '80' at :2:29 already defined at :2:9",
+		},
+		{
+			name:    "repeated ordered map key",
+			text:    "#!{\n\tenv {a 1,\n\t\ta 2}\n}",
+			wantErr: "cannot unmarshal into 'root', while processing field 'Env': cannot unmarshal into 'env', map key 'a' at :3:3 already defined at :2:7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal(strings.NewReader(tt.text), &Config{}, false, WithUniqueMapKeys())
+
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("expected error '%s' but got '%v'", tt.wantErr, err)
+			}
+
+			// Without the option, repeated keys are accepted.
+			if err := Unmarshal(strings.NewReader(tt.text), &Config{}, false); err != nil {
+				t.Errorf("unexpected error without option: %v", err)
+			}
+		})
+	}
+}
+
+// level is an enum, which is unmarshalled from its name.
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	for i, name := range []string{"debug", "info", "error"} {
+		if string(text) == name {
+			*l = level(i)
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown level '%s'", text)
+}
+
+func TestTextUnmarshaler(t *testing.T) {
+	type Config struct {
+		IP      net.IP           `tadl:"ip"`
+		Started time.Time        `tadl:"started"`
+		Level   level            `tadl:"level"`
+		Min     *level           `tadl:"min"`
+		Loggers map[string]level `tadl:"loggers"`
+	}
+
+	input := `#!{
+		ip "127.0.0.1",
+		started "2021-06-01T12:00:00Z",
+		level error,
+		min info,
+		loggers {
+			http debug,
+			db error
+		}
+	}`
+
+	var config Config
+
+	if err := Unmarshal(strings.NewReader(input), &config, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if !config.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("expected ip 127.0.0.1 but got %v", config.IP)
+	}
+
+	if want := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC); !config.Started.Equal(want) {
+		t.Errorf("expected time %v but got %v", want, config.Started)
+	}
+
+	if config.Level != 2 || config.Min == nil || *config.Min != 1 {
+		t.Errorf("expected levels 2 and 1 but got %v and %v", config.Level, config.Min)
+	}
+
+	if len(config.Loggers) != 2 || config.Loggers["http"] != 0 || config.Loggers["db"] != 2 {
+		t.Errorf("expected levels of loggers but got %v", config.Loggers)
+	}
+
+	err := Unmarshal(strings.NewReader(`#!{level fatal}`), &Config{}, false)
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected DecodeError but got %v", err)
+	}
+
+	if decodeErr.Value != "fatal" || decodeErr.Expected != "tadl.level" {
+		t.Errorf("expected error for value 'fatal' of tadl.level but got %v", decodeErr)
+	}
+}
+
+// duration decodes a time.Duration from the text of its element or from a text node.
+type duration time.Duration
+
+func (d *duration) UnmarshalTadl(node *parser.TreeNode) error {
+	if !node.IsText() {
+		if len(node.Children) != 1 || !node.Children[0].IsText() {
+			return fmt.Errorf("duration requires a single text")
+		}
+
+		node = node.Children[0]
+	}
+
+	v, err := time.ParseDuration(*node.Text)
+	if err != nil {
+		return err
+	}
+
+	*d = duration(v)
+
+	return nil
+}
+
+// endpoint decodes all labels of its element.
+type endpoint []string
+
+func (e *endpoint) UnmarshalTadl(node *parser.TreeNode) error {
+	*e = append(endpoint(nil), node.Labels...)
+
+	return nil
+}
+
+func TestUnmarshaler(t *testing.T) {
+	type Config struct {
+		Timeout  duration  `tadl:"timeout"`
+		Retry    *duration `tadl:"retry"`
+		Endpoint endpoint  `tadl:"endpoint"`
+	}
+
+	input := `#!{
+		timeout "1m30s",
+		retry "5s",
+		endpoint "localhost" "8080" {}
+	}`
+
+	var config Config
+
+	if err := Unmarshal(strings.NewReader(input), &config, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Timeout != duration(90*time.Second) || config.Retry == nil || *config.Retry != duration(5*time.Second) {
+		t.Errorf("expected durations 1m30s and 5s but got %v and %v", config.Timeout, config.Retry)
+	}
+
+	if !reflect.DeepEqual(config.Endpoint, endpoint{"localhost", "8080"}) {
+		t.Errorf("expected endpoint labels but got %v", config.Endpoint)
+	}
+
+	err := Unmarshal(strings.NewReader(`#!{timeout "soon"}`), &Config{}, false)
+	if err == nil || !strings.Contains(err.Error(), "cannot unmarshal 'tadl.duration'") {
+		t.Errorf("expected error of UnmarshalTadl but got %v", err)
+	}
+}
+
+func TestRaw(t *testing.T) {
+	type Config struct {
+		Name    string `tadl:"name"`
+		Plugin  Raw    `tadl:"plugin"`
+		Filters []Raw  `tadl:"filter"`
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		plugin  string
+		filters []string
+	}{
+		{
+			name:    "G2",
+			text:    "#!{\n\tname \"app\",\n\tplugin @name=\"cache\" {\n\t\tsize 10\n\t},\n\tfilter a, filter \"ü\"\n}",
+			plugin:  "plugin @name=\"cache\" {\n\t\tsize 10\n\t}",
+			filters: []string{"filter a", "filter \"ü\""},
+		},
+		{
+			name:    "G1",
+			text:    "#name{app} #plugin @name{cache} {#size{10}} #filter{a}",
+			plugin:  "#plugin @name{cache} {#size{10}}",
+			filters: []string{"#filter{a}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+
+			if err := Unmarshal(strings.NewReader(tt.text), &config, false); err != nil {
+				t.Fatal(err)
+			}
+
+			if config.Name != "app" {
+				t.Errorf("expected name 'app' but got '%s'", config.Name)
+			}
+
+			if string(config.Plugin) != tt.plugin {
+				t.Errorf("expected plugin %q but got %q", tt.plugin, config.Plugin)
+			}
+
+			if len(config.Filters) != len(tt.filters) {
+				t.Fatalf("expected filters %q but got %q", tt.filters, config.Filters)
+			}
+
+			for i, filter := range tt.filters {
+				if string(config.Filters[i]) != filter {
+					t.Errorf("expected filter %q but got %q", filter, config.Filters[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPosition(t *testing.T) {
+	type Server struct {
+		Pos  Position
+		Name string `tadl:",label"`
+		Port int    `tadl:"port"`
+	}
+
+	type Config struct {
+		Pos     Position `tadl:",pos"`
+		Servers []Server `tadl:"server"`
+	}
+
+	text := "#!{\n\tserver \"web\" {port 80},\n\tserver \"api\" {port 80}\n}"
+
+	var config Config
+	if err := Unmarshal(strings.NewReader(text), &config, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Servers) != 2 {
+		t.Fatalf("expected 2 servers but got %d", len(config.Servers))
+	}
+
+	if got := config.Pos.BeginPos.String(); got != ":1:1" {
+		t.Errorf("expected root at ':1:1' but got '%s'", got)
+	}
+
+	for i, want := range []string{":2:2", ":3:2"} {
+		if got := config.Servers[i].Pos.BeginPos.String(); got != want {
+			t.Errorf("expected server %d at '%s' but got '%s'", i, want, got)
+		}
+	}
+
+	type Invalid struct {
+		Pos string `tadl:",pos"`
+	}
+
+	if err := Unmarshal(strings.NewReader("#!{}"), &Invalid{}, false); err == nil {
+		t.Error("expected error for pos tag on string")
+	}
+}
+
+func TestStructPlan(t *testing.T) {
+	type Config struct {
+		Name    string `tadl:"name|id,attr"`
+		Port    int
+		Invalid string `tadl:",unknown"`
+		Empty   string `tadl:"empty,omitempty"`
+		Attr    string `tadl:"attr,attr,omitempty" default:"x"`
+	}
+
+	plan := structPlan(reflect.TypeOf(Config{}))
+
+	if len(plan) != 5 || plan[0].name != "name" || plan[0].as != unmarshalAttribute || len(plan[0].aliases) != 1 ||
+		plan[1].renamed || plan[2].invalid != "unknown" || !plan[3].omitEmpty || plan[3].as != unmarshalNormal ||
+		!plan[4].omitEmpty || plan[4].as != unmarshalAttribute || !plan[4].hasDefault || plan[4].def != "x" {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+
+	// The plan is computed once and shared by concurrent calls.
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if &structPlan(reflect.TypeOf(Config{}))[0] != &plan[0] {
+				t.Error("expected cached plan")
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestTagFallback(t *testing.T) {
+	type Server struct {
+		Zone string `xml:"zone,attr"`
+		Host string `xml:"urn:net host"`
+		Note string `xml:",chardata"`
+		Raw  string `xml:",innerxml"`
+	}
+
+	type Config struct {
+		Name    string   `json:"name,omitempty"`
+		Port    int      `tadl:"port" json:"listen"`
+		Secret  string   `json:"-"`
+		Servers []Server `json:"server" xml:"ignored"`
+		Debug   bool
+	}
+
+	input := `#!{
+		name "web",
+		port 8080,
+		Secret "hidden",
+		server {host "a"},
+		server {host "b", "fallback"},
+		Debug "true"
+	}`
+
+	var got Config
+	if err := Unmarshal(strings.NewReader(input), &got, false, WithTagFallback("json", "xml")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Config{
+		Name:    "web",
+		Port:    8080,
+		Servers: []Server{{Host: "a"}, {Host: "b", Note: "fallback"}},
+		Debug:   true,
+	}
+
+	if plan := structPlan(reflect.TypeOf(Server{}), "json", "xml"); plan[0].as != unmarshalAttribute || plan[3].as != unmarshalSkip {
+		t.Errorf("expected attribute and skipped field but got %+v", plan)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+
+	var plain Config
+	if err := Unmarshal(strings.NewReader(input), &plain, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if plain.Name != "" || plain.Secret != "hidden" {
+		t.Errorf("expected json tags to be ignored without fallback but got %+v", plain)
+	}
+}
+
+func TestMapValues(t *testing.T) {
+	type Server struct {
+		Host  string            `tadl:"host"`
+		Ports []int             `tadl:"port"`
+		Attrs map[string]string `tadl:",attrs"`
+	}
+
+	type Config struct {
+		Servers map[string]Server   `tadl:"servers"`
+		Groups  map[string][]string `tadl:"groups"`
+		Limits  map[string]int      `tadl:"limits"`
+	}
+
+	input := `#!{
+		servers {
+			web @zone="eu" @tier="1" {host "a", port 80, port 443}
+			db {}
+		}
+		groups {
+			admins {"alice" "bob"}
+		}
+		limits {
+			conns 10
+		}
+	}`
+
+	var got Config
+	if err := Unmarshal(strings.NewReader(input), &got, false); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Config{
+		Servers: map[string]Server{
+			"web": {Host: "a", Ports: []int{80, 443}, Attrs: map[string]string{"zone": "eu", "tier": "1"}},
+			"db":  {},
+		},
+		Groups: map[string][]string{"admins": {"alice", "bob"}},
+		Limits: map[string]int{"conns": 10},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+
+	var invalid struct {
+		Attrs map[string][]string `tadl:",attrs"`
+	}
+
+	err := Unmarshal(strings.NewReader(`#!{a}`), &invalid, false)
+	if err == nil || !strings.Contains(err.Error(), "attrs 'Attrs' requires a map of primitive types") {
+		t.Errorf("expected error for attrs of wrong type but got %v", err)
+	}
+}
+
+func TestPointerFields(t *testing.T) {
+	type Server struct {
+		Host string `tadl:"host"`
+		Port *int   `tadl:"port"`
+	}
+
+	type Config struct {
+		Name    *string            `tadl:"name"`
+		Zone    *string            `tadl:"zone,attr"`
+		Primary *Server            `tadl:"primary"`
+		Backup  *Server            `tadl:"backup"`
+		Timeout *int               `tadl:"timeout"`
+		Mirrors map[string]*Server `tadl:"mirrors"`
+	}
+
+	input := `#!{
+		name "demo"
+		primary {host "a", port 80}
+		mirrors {
+			eu {host "b"}
+		}
+	}`
+
+	var got Config
+	if err := Unmarshal(strings.NewReader(input), &got, false); err != nil {
+		t.Fatal(err)
+	}
+
+	name, port := "demo", 80
+	want := Config{
+		Name:    &name,
+		Primary: &Server{Host: "a", Port: &port},
+		Mirrors: map[string]*Server{"eu": {Host: "b"}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+}
+
+func TestEmbeddedStructs(t *testing.T) {
+	type Metadata struct {
+		Name   string            `tadl:"name"`
+		Labels map[string]string `tadl:",attrs"`
+	}
+
+	type owner struct {
+		Owner string `tadl:"owner"`
+	}
+
+	type Limits struct {
+		Conns int `tadl:"conns"`
+	}
+
+	type Server struct {
+		Metadata
+		owner
+		*Limits
+		Named Metadata `tadl:"meta"`
+		Port  int      `tadl:"port"`
+	}
+
+	input := `#!{
+		name "web"
+		owner "alice"
+		conns 10,
+		meta @zone="eu" {name "inner"}
+		port 80
+	}`
+
+	var got Server
+	if err := Unmarshal(strings.NewReader(input), &got, false); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Server{
+		Metadata: Metadata{Name: "web"},
+		owner:    owner{Owner: "alice"},
+		Limits:   &Limits{Conns: 10},
+		Named:    Metadata{Name: "inner", Labels: map[string]string{"zone": "eu"}},
+		Port:     80,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+}
+
+func TestCharData(t *testing.T) {
+	type Paragraph struct {
+		Lang string `tadl:"lang,attr"`
+		Bold string `tadl:"b"`
+		Text string `tadl:",chardata"`
+	}
+
+	type Document struct {
+		Paragraphs []Paragraph `tadl:"p"`
+	}
+
+	// Strict mode neither complains about several texts, nor about none.
+	input := `#p @lang{en} {Read the #b{manual} first.} #p @lang{de} {#b{Handbuch}}`
+
+	var got Document
+	if err := Unmarshal(strings.NewReader(input), &got, true); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Document{Paragraphs: []Paragraph{
+		{Lang: "en", Bold: "manual", Text: "Read the first."},
+		{Lang: "de", Bold: "Handbuch"},
+	}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+
+	var invalid struct {
+		Text int `tadl:",chardata"`
+	}
+
+	err := Unmarshal(strings.NewReader(`#a`), &invalid, false)
+	if err == nil || !strings.Contains(err.Error(), "chardata 'Text' requires string") {
+		t.Errorf("expected error for chardata of wrong type but got %v", err)
+	}
+}
+
+func TestAnyChildren(t *testing.T) {
+	type Server struct {
+		Host  string             `tadl:"host"`
+		Ports []int              `tadl:"port"`
+		Extra []*parser.TreeNode `tadl:",any"`
+	}
+
+	type Config struct {
+		Extra  []*parser.TreeNode `tadl:",any"`
+		Server Server             `tadl:"server"`
+	}
+
+	input := `#!{
+		server {host "a", port 80, tls {cert "x"}, port 443, ciphers {"a" "b"}},
+		cache "redis",
+		"text"
+	}`
+
+	var got Config
+	if err := Unmarshal(strings.NewReader(input), &got, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The field order does not matter, but texts are left out.
+	if len(got.Extra) != 1 || got.Extra[0].Name != "cache" {
+		t.Errorf("expected cache in extra elements but got %v", got.Extra)
+	}
+
+	var names []string
+	for _, node := range got.Server.Extra {
+		names = append(names, node.Name)
+	}
+
+	if want := []string{"tls", "ciphers"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected %v but got %v", want, names)
+	}
+
+	// Extra elements are not reported as unused.
+	var unused []string
+
+	err := Unmarshal(strings.NewReader(input), &got, false, WithUnusedWarnings(func(d Diagnostic) {
+		unused = append(unused, d.Message)
+	}))
+	if err != nil || len(unused) > 0 {
+		t.Errorf("expected no unused elements but got %v: %v", unused, err)
+	}
+
+	var invalid struct {
+		Extra []string `tadl:",any"`
+	}
+
+	err = Unmarshal(strings.NewReader(`#a`), &invalid, false)
+	if err == nil || !strings.Contains(err.Error(), "any 'Extra' requires []*parser.TreeNode") {
+		t.Errorf("expected error for any of wrong type but got %v", err)
+	}
+}
+
+func TestEmptyElements(t *testing.T) {
+	type Server struct {
+		Port  int      `tadl:"port,attr"`
+		Hosts []string `tadl:"host"`
+	}
+
+	type Config struct {
+		Name    string            `tadl:"name"`
+		Server  Server            `tadl:"server"`
+		Backups []Server          `tadl:"backup"`
+		Env     map[string]string `tadl:"env"`
+		Tags    []string          `tadl:"tag"`
+	}
+
+	// All forms of empty elements, like the ones of format.WithEmptyElements, are read alike.
+	inputs := []string{
+		`#!{name, server @port="80", backup, env, tag}`,
+		`#!{name {}, server @port="80" {}, backup {}, env {}, tag {}}`,
+		`#!{name(), server @port="80" (), backup(), env(), tag()}`,
+		`#name #server @port{80} #backup #env #tag`,
+		`#name{} #server @port{80} {} #backup{} #env{} #tag{}`,
+	}
+
+	want := Config{
+		Server:  Server{Port: 80},
+		Backups: []Server{{}},
+		Env:     map[string]string{},
+		Tags:    []string{""},
+	}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			var got Config
+			if err := Unmarshal(strings.NewReader(input), &got, false); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %+v but got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	type Server struct {
+		Host    string        `tadl:"host" default:"localhost"`
+		Port    int           `tadl:"port,attr" default:"80"`
+		TLS     *bool         `tadl:"tls" default:"true"`
+		Timeout time.Duration `tadl:"timeout" default:"1500"`
+		Tags    []string      `tadl:"tag" default:"a"`
+	}
+
+	type Config struct {
+		Server Server `tadl:"server"`
+	}
+
+	var got Config
+	if err := Unmarshal(strings.NewReader(`#!{server @port="8080" {timeout 30}}`), &got, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Defaults are only used for absent values, renamed slices keep no elements.
+	if s := got.Server; s.Host != "localhost" || s.Port != 8080 || s.TLS == nil || !*s.TLS || s.Timeout != 30 ||
+		s.Tags != nil {
+		t.Errorf("unexpected server %+v", s)
+	}
+
+	got = Config{}
+	if err := Unmarshal(strings.NewReader(`#!{server}`), &got, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Server.Port != 80 || got.Server.Timeout != 1500 {
+		t.Errorf("expected defaults but got %+v", got.Server)
+	}
+
+	// Strict mode still requires all values.
+	err := Unmarshal(strings.NewReader(`#!{server {host "a", tls "false", timeout 1}}`), &got, true)
+	if err == nil || !strings.Contains(err.Error(), "attribute 'port' required") {
+		t.Errorf("expected missing attribute in strict mode but got %v", err)
+	}
+
+	var invalid struct {
+		Port int `tadl:"port" default:"http"`
+	}
+
+	err = Unmarshal(strings.NewReader(`#a`), &invalid, false)
+	if err == nil || !strings.Contains(err.Error(), "invalid default of field 'Port'") {
+		t.Errorf("expected error for invalid default but got %v", err)
+	}
+}
+
+func TestGeneric(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  interface{}
+	}{
+		{
+			name:  "elements",
+			input: `#!{name "web", port 80, host "a", host "b", tls @cert="x.pem", flags {debug, trace}, empty {}}`,
+			want: map[string]interface{}{
+				"name":  "web",
+				"port":  "80",
+				"host":  []interface{}{"a", "b"},
+				"tls":   map[string]interface{}{"@cert": "x.pem"},
+				"flags": map[string]interface{}{"debug": "", "trace": ""},
+				"empty": "",
+			},
+		},
+		{
+			name:  "attributes with text",
+			input: `#link @href{/} {home}`,
+			want:  map[string]interface{}{"link": map[string]interface{}{"@href": "/", "": "home"}},
+		},
+		{
+			name:  "mixed content",
+			input: `#p {Read the #b{manual} first.}`,
+			want: map[string]interface{}{"p": []interface{}{
+				"Read the ", map[string]interface{}{"b": "manual"}, "first.",
+			}},
+		},
+		{
+			name:  "texts and comments",
+			input: "#!{list {\"a\"\n// comment\n\"b\"}}",
+			want:  map[string]interface{}{"list": []interface{}{"a", "b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got interface{}
+			if err := Unmarshal(strings.NewReader(tt.input), &got, false); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %#v but got %#v", tt.want, got)
+			}
+		})
+	}
+
+	var config struct {
+		Name  string                 `tadl:"name"`
+		Extra map[string]interface{} `tadl:"extra"`
+		Any   interface{}            `tadl:"any"`
+	}
+
+	err := Unmarshal(strings.NewReader(`#!{name "a", extra {x 1, y {z 2}}, any "text"}`), &config, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{"x": "1", "y": map[string]interface{}{"z": "2"}}
+	if config.Name != "a" || !reflect.DeepEqual(config.Extra, want) || config.Any != "text" {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	var stringer struct {
+		Value fmt.Stringer `tadl:"value"`
+	}
+
+	err = Unmarshal(strings.NewReader(`#!{value "a"}`), &stringer, false)
+	if err == nil || !strings.Contains(err.Error(), "unsupported type 'fmt.Stringer'") {
+		t.Errorf("expected error for interface with methods but got %v", err)
+	}
+}
+
+func TestUnmarshalNode(t *testing.T) {
+	type Server struct {
+		Name string   `tadl:",label"`
+		Port int      `tadl:"port"`
+		Raw  Raw      `tadl:"raw"`
+		Pos  Position `tadl:",pos"`
+	}
+
+	tree, err := parser.NewParser("node.tadl", strings.NewReader(`#!{
+		cluster {
+			server "a" {port 80},
+			server "b" {port 81}
+		},
+		server "c" {port 82, raw {}}
+	}`)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+
+	for node := range tree.Children[0].Descendants("server") {
+		var server Server
+		if err := UnmarshalNode(node, &server, false, WithFuzzyNames()); err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, fmt.Sprintf("%s:%d@%d", server.Name, server.Port, server.Pos.BeginPos.Line))
+	}
+
+	if want := []string{"a:80@3", "b:81@4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+
+	// Without the source text, Raw cannot be decoded.
+	var server Server
+
+	err = UnmarshalNode(tree.Children[1], &server, false)
+	if err == nil || !strings.Contains(err.Error(), "source text is not available") {
+		t.Errorf("expected error for Raw but got %v", err)
+	}
+
+	if err := UnmarshalNode(nil, &server, false); err == nil {
+		t.Error("expected error for nil node")
+	}
+}
+
+func TestDecodeOptions(t *testing.T) {
+	type Server struct {
+		Name string `tadl:"Name"`
+		Port int    `tadl:"port,attr"`
+		TLS  bool
+	}
+
+	type Config struct {
+		Server Server `tadl:"server"`
+	}
+
+	var got Config
+
+	err := Unmarshal(strings.NewReader(`#!{SERVER @PORT="80" {name "web", tls "true"}}`), &got, false,
+		WithDecodeOptions(DecodeOptions{Strict: true, CaseInsensitiveNames: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (Server{Name: "web", Port: 80, TLS: true}); got.Server != want {
+		t.Errorf("expected %+v but got %+v", want, got.Server)
+	}
+
+	// Strict mode is enabled by any of the strict argument, WithStrict or Strict and cannot be disabled.
+	for _, strict := range []struct {
+		arg  bool
+		opts []DecodeOption
+		want bool
+	}{
+		{arg: false, opts: []DecodeOption{WithDecodeOptions(DecodeOptions{})}, want: false},
+		{arg: false, opts: []DecodeOption{WithDecodeOptions(DecodeOptions{Strict: true})}, want: true},
+		{arg: true, opts: []DecodeOption{WithDecodeOptions(DecodeOptions{Strict: false})}, want: true},
+		{arg: false, opts: []DecodeOption{WithStrict(), WithDecodeOptions(DecodeOptions{})}, want: true},
+		{arg: false, opts: []DecodeOption{WithDecodeOptions(DecodeOptions{}), WithStrict()}, want: true},
+	} {
+		err = Unmarshal(strings.NewReader(`#!{server @port="80" {Name "web"}}`), &got, strict.arg, strict.opts...)
+		if gotStrict := err != nil && strings.Contains(err.Error(), "'TLS' required"); gotStrict != strict.want {
+			t.Errorf("strict argument %v with %d options: expected strict %v but got error %v",
+				strict.arg, len(strict.opts), strict.want, err)
+		}
+	}
+
+	// Options, which are not set, keep the ones set before.
+	err = Unmarshal(strings.NewReader(`#!{SERVER @PORT="80" {name "web"}}`), &got, false,
+		WithDecodeOptions(DecodeOptions{CaseInsensitiveNames: true}), WithDecodeOptions(DecodeOptions{}))
+	if err != nil || got.Server.Name != "web" {
+		t.Errorf("expected case insensitive names to be kept but got %v", err)
+	}
+
+	// Unknown elements and attributes are reported with their position.
+	input := "#!{server @port=\"80\" @prot=\"tcp\" {\n\tName \"web\"\n\tTSL \"true\"\n}}"
+
+	err = Unmarshal(strings.NewReader(input), &got, false, WithDecodeOptions(DecodeOptions{DisallowUnknownFields: true}))
+
+	var decodeErr UnmarshalError
+	if !errors.As(err, &decodeErr) || !strings.Contains(err.Error(), "unknown attribute 'prot'") {
+		t.Fatalf("expected unknown attribute but got %v", err)
+	}
+
+	if pos, _ := errorPosition(err); pos.Line != 1 || pos.Col != 23 {
+		t.Errorf("expected error at the attribute but got %v", pos)
+	}
+
+	err = Unmarshal(strings.NewReader(input), &got, false, WithAllErrors(),
+		WithDecodeOptions(DecodeOptions{DisallowUnknownFields: true}))
+
+	var errs UnmarshalErrors
+	if !errors.As(err, &errs) || len(errs) != 2 || !strings.Contains(errs[1].Error(), "unknown element 'TSL'") {
+		t.Errorf("expected all unknown fields but got %v", err)
+	}
+
+	err = Unmarshal(strings.NewReader(`#!{server {Name "web"}}`), &got, false,
+		WithDecodeOptions(DecodeOptions{DisallowUnknownFields: true}))
+	if err != nil {
+		t.Errorf("expected no error for known fields but got %v", err)
+	}
+
+	// Limits are checked while parsing and unmarshalling.
+	for _, o := range []DecodeOptions{{MaxDepth: 1}, {MaxTokens: 5}} {
+		err := Unmarshal(strings.NewReader(input), &got, false, WithDecodeOptions(o))
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%+v: expected ErrLimitExceeded but got %v", o, err)
+		}
+	}
+
+	_, err = Decode[Config](strings.NewReader(input), WithDecodeOptions(DecodeOptions{MaxTokens: 5}))
+	if !errors.Is(err, ErrLimitExceeded) || !errors.Is(err, parser.ErrTooManyTokens) {
+		t.Errorf("expected ErrLimitExceeded of Decode but got %v", err)
+	}
+}
+
+func TestDisallowUnknownFields(t *testing.T) {
+	type Metadata struct {
+		Owner string `tadl:"owner"`
+	}
+
+	type Server struct {
+		Metadata
+		Zone       string `tadl:"zone,attr"`
+		Port       int    `tadl:"port|listen"`
+		MaxConns   int
+		TLS        bool
+		Hosts      []string          `tadl:"host"`
+		Attributes map[string]string `tadl:"labels"`
+	}
+
+	type Config struct {
+		Servers []Server `tadl:"server"`
+	}
+
+	tests := []struct {
+		name string
+		text string
+		opts []DecodeOption
+		want string
+	}{
+		{
+			name: "known fields",
+			text: `#!{server @zone="eu" {owner "a", listen 80, MaxConns 1, TLS true, host a, labels {x y}}}`,
+		},
+		{
+			name: "typo of element",
+			text: "#!{server {\n\tprot 80\n}}",
+			want: ":2:2: cannot unmarshal into 'server', unknown element 'prot', did you mean 'port'?",
+		},
+		{
+			name: "typo of attribute",
+			text: `#!{server @zon="eu"}`,
+			want: ":1:12: cannot unmarshal into 'server', unknown attribute 'zon', did you mean 'zone'?",
+		},
+		{
+			name: "typo of embedded field",
+			text: `#!{server {onwer "a"}}`,
+			want: ":1:12: cannot unmarshal into 'server', unknown element 'onwer', did you mean 'owner'?",
+		},
+		{
+			name: "typo of mapped name",
+			text: `#!{server {max_con 1}}`,
+			opts: []DecodeOption{WithNameMapper(SnakeCase)},
+			want: ":1:12: cannot unmarshal into 'server', unknown element 'max_con', did you mean 'max_conns'?",
+		},
+		{
+			name: "no similar field",
+			text: `#!{server, cluster {server}}`,
+			want: ":1:12: cannot unmarshal into 'root', unknown element 'cluster'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal(strings.NewReader(tt.text), &Config{}, false, append(tt.opts, WithDisallowUnknownFields())...)
+
+			var got string
+			if err != nil {
+				pos, _ := errorPosition(err)
+				got = pos.String() + ": " + err.Error()
+			}
+
+			if got != tt.want {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+
+	if d := distance("tsl", "tls"); d != 1 {
+		t.Errorf("expected swapped runes to have distance 1 but got %d", d)
+	}
+}
+
+func TestOrderedMap(t *testing.T) {
+	var result struct {
+		Steps OrderedMap `tadl:"steps"`
+	}
+
+	input := strings.NewReader(`#!{
+		steps {
+			v3 "add index",
+			v1 "create table",
+			v2 "add column",
+		}
+	}`)
+
+	if err := Unmarshal(input, &result, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(result.Steps.Keys(), " "), "v3 v1 v2"; got != want {
+		t.Errorf("expected keys '%s' but got '%s'", want, got)
+	}
+
+	if v, ok := result.Steps.Get("v1"); !ok || v != "create table" {
+		t.Errorf("expected value 'create table' for 'v1' but got '%s'", v)
+	}
+
+	if _, ok := result.Steps.Get("v4"); ok {
+		t.Error("expected no value for 'v4'")
+	}
+}
+
+func TestUnmarshalAllErrors(t *testing.T) {
+	type Inner struct {
+		Port int `tadl:"port"`
+	}
+
+	type Config struct {
+		Name    string `tadl:"name"`
+		Retries uint   `tadl:"retries"`
+		Ratio   float64
+		Inner   Inner `tadl:"inner"`
+	}
+
+	input := `#!{
+		retries "-1",
+		Ratio "half",
+		inner {
+			port "http"
+		}
+		name "ok"
+	}`
+
+	var config Config
+
+	err := Unmarshal(strings.NewReader(input), &config, false, WithAllErrors())
+	if err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+
+	errs, ok := err.(UnmarshalErrors)
+	if !ok {
+		t.Fatalf("expected UnmarshalErrors, but got %T", err)
+	}
+
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 errors, but got %d: %v", len(errs), err)
+	}
+
+	for i, line := range []string{":2:", ":3:", ":5:"} {
+		if !strings.Contains(strings.Split(err.Error(), "\n")[i+1], line) {
+			t.Errorf("expected error %d to be at line %s, but got: %s", i, line, errs[i])
+		}
+	}
+
+	if config.Name != "ok" {
+		t.Errorf("expected fields after an error to be unmarshalled, but got name '%s'", config.Name)
+	}
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Value != "-1" {
+		t.Errorf("expected the DecodeError of the first error, but got %v", decodeErr)
+	}
+
+	if !errors.Is(fmt.Errorf("document 1: %w", err), errs[2]) {
+		t.Error("expected a wrapped UnmarshalErrors to contain its errors")
+	}
+
+	if err := Unmarshal(strings.NewReader(input), &Config{}, false); err == nil {
+		t.Fatal("expected an error, but got none")
+	} else if _, ok := err.(UnmarshalErrors); ok {
+		t.Error("expected only the first error without WithAllErrors")
+	}
+}
+
+func TestUnmarshalAttributeErrorPosition(t *testing.T) {
+	type Config struct {
+		Server struct {
+			Port int `tadl:"port,attr"`
+		} `tadl:"server"`
+	}
+
+	input := "#!{\n\tserver @name=\"web\" @port=\"http\"\n}"
+
+	err := Unmarshal(strings.NewReader(input), &Config{}, false, WithAllErrors())
+	if err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+
+	// The error points to the value of the attribute, not to its element.
+	if !strings.Contains(err.Error(), ":2:27: ") {
+		t.Errorf("expected error at the attribute value, but got: %s", err)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	type Server struct {
+		Ports  map[string]int `tadl:"ports"`
+		Weight int            `tadl:"weight,attr"`
+	}
+
+	type Config struct {
+		Servers []Server `tadl:"server"`
+		Retries uint     `tadl:"retries"`
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want DecodeError
+	}{
+		{
+			name: "primitive field",
+			text: "#!{\n\tretries \"-1\"\n}",
+			want: DecodeError{
+				FieldPath: "Retries",
+				NodePath:  "/root/retries",
+				Pos:       token.Pos{File: "", Line: 2, Col: 2},
+				Expected:  "uint",
+				Value:     "-1",
+			},
+		},
+		{
+			name: "map value in slice",
+			text: "#!{\n\tserver {},\n\tserver {\n\t\tports {\n\t\t\thttp \"eighty\"\n\t\t}\n\t}\n}",
+			want: DecodeError{
+				FieldPath: "Servers[1].Ports[http]",
+				NodePath:  "/root/server/ports/http",
+				Pos:       token.Pos{File: "", Line: 5, Col: 9},
+				Expected:  "int",
+				Value:     "eighty",
+			},
+		},
+		{
+			name: "attribute",
+			text: "#!{\n\tserver @weight=\"heavy\" {}\n}",
+			want: DecodeError{
+				FieldPath: "Servers[0].Weight",
+				NodePath:  "/root/server/@weight",
+				Pos:       token.Pos{File: "", Line: 2, Col: 17},
+				Expected:  "int",
+				Value:     "heavy",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal(strings.NewReader(tt.text), &Config{}, false)
+
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("expected a DecodeError, but got %v", err)
+			}
+
+			if !errors.Is(err, strconv.ErrSyntax) {
+				t.Errorf("expected the cause to be reachable, but got %v", err)
+			}
+
+			got := *decodeErr
+			got.Err = nil
+			got.Pos.Offset = 0
+
+			if got != tt.want {
+				t.Errorf("expected %+v but got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	type Server struct {
+		Name    string   `tadl:",label"`
+		Port    int      `tadl:"port"`
+		Host    string   `tadl:"host"`
+		Aliases []string `tadl:"alias"`
+	}
+
+	type Config struct {
+		Debug   bool     `tadl:"debug"`
+		Servers []Server `tadl:"server"`
+	}
+
+	input := []byte(`#!{
+		debug "true",
+		server "web" {port 80, host "localhost", alias "www", alias "home"}
+		server "api" {port 8080, host "localhost"}
+	}`)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var config Config
+
+		if err := Unmarshal(bytes.NewReader(input), &config, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package merge combines concurrent edits of a Tadl document structurally.
+// Instead of lines, elements are matched by their name and labels, so reformatting a
+// document does not cause conflicts, and changes to different attributes or children
+// of the same element merge cleanly.
+package merge
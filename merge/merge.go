@@ -0,0 +1,355 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package merge
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/store"
+)
+
+// Conflict is a change that was made differently in ours and theirs.
+// The merged tree contains our side of a conflict.
+type Conflict struct {
+	// Path is the path of the conflicting element in the merged tree, like "/root/server[1]".
+	// See parser.Document.Find for the syntax.
+	Path   string
+	Reason string
+	// Base, Ours and Theirs are the conflicting nodes. They are nil, if a node is missing on that side.
+	Base, Ours, Theirs *parser.TreeNode
+}
+
+func (c Conflict) String() string {
+	return c.Path + ": " + c.Reason
+}
+
+// Merge3 merges the changes from base to ours and from base to theirs into a new tree.
+// Children are matched by their name and labels, repeated elements by the order of their
+// occurrence. Attributes are merged one by one. When both sides changed the same thing
+// differently, our change is kept and a Conflict is reported.
+// base may be nil, if both sides were created independently.
+func Merge3(base, ours, theirs *parser.TreeNode) (*parser.TreeNode, []Conflict) {
+	m := &merger{}
+	merged := m.node("/"+ours.Name, base, ours, theirs)
+
+	return merged, m.conflicts
+}
+
+// merger collects the conflicts of a merge.
+type merger struct {
+	conflicts []Conflict
+}
+
+func (m *merger) conflict(path, reason string, base, ours, theirs *parser.TreeNode) {
+	m.conflicts = append(m.conflicts, Conflict{
+		Path:   path,
+		Reason: reason,
+		Base:   base,
+		Ours:   ours,
+		Theirs: theirs,
+	})
+}
+
+// equal returns true if both trees are structurally equal, see store.Hash.
+func equal(a, b *parser.TreeNode) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return store.Hash(a) == store.Hash(b)
+}
+
+// value merges a single value: a side that did not change from base takes the other one.
+func value(base, ours, theirs string) (merged string, ok bool) {
+	switch {
+	case ours == theirs || theirs == base:
+		return ours, true
+	case ours == base:
+		return theirs, true
+	default:
+		return ours, false
+	}
+}
+
+// node merges the matching nodes of all sides. ours and theirs must not be nil.
+func (m *merger) node(path string, base, ours, theirs *parser.TreeNode) *parser.TreeNode {
+	if equal(ours, theirs) || equal(base, theirs) {
+		return copyTree(ours)
+	}
+
+	if equal(base, ours) {
+		return copyTree(theirs)
+	}
+
+	if base == nil {
+		base = &parser.TreeNode{Name: ours.Name, Labels: ours.Labels, Attributes: parser.NewAttributeList()}
+	}
+
+	merged := &parser.TreeNode{
+		Name:       ours.Name,
+		Labels:     ours.Labels,
+		Attributes: parser.NewAttributeList(),
+		Range:      ours.Range,
+	}
+
+	switch {
+	case ours.IsText():
+		text, ok := value(stringOf(base.Text), *ours.Text, *theirs.Text)
+		if !ok {
+			m.conflict(path, "text changed on both sides", base, ours, theirs)
+		}
+
+		merged.Text = &text
+
+		return merged
+	case ours.IsComment():
+		comment, ok := value(stringOf(base.Comment), *ours.Comment, *theirs.Comment)
+		if !ok {
+			m.conflict(path, "comment changed on both sides", base, ours, theirs)
+		}
+
+		merged.Comment = &comment
+
+		return merged
+	}
+
+	blockType, ok := value(string(base.BlockType), string(ours.BlockType), string(theirs.BlockType))
+	if !ok {
+		m.conflict(path, "brackets changed on both sides", base, ours, theirs)
+	}
+
+	merged.BlockType = parser.BlockType(blockType)
+
+	m.attributes(path, merged, base, ours, theirs)
+	for _, child := range m.children(path, base, ours, theirs) {
+		child.Parent = merged
+		merged.AddChildren(child)
+	}
+
+	return merged
+}
+
+// attributes merges the attributes of all sides into merged, key by key.
+func (m *merger) attributes(path string, merged, base, ours, theirs *parser.TreeNode) {
+	baseAttrs, ourAttrs, theirAttrs := attributes(base), attributes(ours), attributes(theirs)
+
+	// Our order is kept, attributes that were added by them are appended.
+	keys := append([]string{}, ourAttrs.keys...)
+	for _, key := range theirAttrs.keys {
+		if _, ok := ourAttrs.values[key]; !ok {
+			if _, inBase := baseAttrs.values[key]; !inBase {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		b, inBase := baseAttrs.values[key]
+		o, inOurs := ourAttrs.values[key]
+		t, inTheirs := theirAttrs.values[key]
+
+		switch {
+		case inOurs && inTheirs:
+			v, ok := value(b, o, t)
+			if !ok {
+				m.conflict(path, fmt.Sprintf("attribute '%s' changed on both sides", key), base, ours, theirs)
+			}
+
+			merged.AddAttribute(key, v)
+		case inOurs && !inTheirs && inBase:
+			// They removed it, which wins unless we changed it.
+			if o != b {
+				m.conflict(path, fmt.Sprintf("attribute '%s' changed by us, but removed by them", key), base, ours, theirs)
+				merged.AddAttribute(key, o)
+			}
+		case inOurs:
+			merged.AddAttribute(key, o)
+		case inTheirs && !inBase:
+			merged.AddAttribute(key, t)
+		}
+	}
+
+	// Attributes we removed, but they changed.
+	for _, key := range theirAttrs.keys {
+		b, inBase := baseAttrs.values[key]
+		if _, inOurs := ourAttrs.values[key]; !inOurs && inBase && theirAttrs.values[key] != b {
+			m.conflict(path, fmt.Sprintf("attribute '%s' removed by us, but changed by them", key), base, ours, theirs)
+		}
+	}
+}
+
+// attributeMap gives fast access to attributes while keeping their order.
+type attributeMap struct {
+	keys   []string
+	values map[string]string
+}
+
+func attributes(node *parser.TreeNode) attributeMap {
+	attrs := attributeMap{values: map[string]string{}}
+
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, value := node.Attributes.Get(i)
+		attrs.keys = append(attrs.keys, *key)
+		attrs.values[*key] = *value
+	}
+
+	return attrs
+}
+
+// keyedNode is a child together with the key that matches it to the children of other sides.
+type keyedNode struct {
+	key  string
+	node *parser.TreeNode
+}
+
+// keyed returns the children of node with their keys. Children are matched by their kind,
+// name and labels. Repeated children with the same key are numbered in order.
+func keyed(node *parser.TreeNode) []keyedNode {
+	if node == nil {
+		return nil
+	}
+
+	count := map[string]int{}
+	children := make([]keyedNode, 0, len(node.Children))
+
+	for _, child := range node.Children {
+		var key string
+
+		switch {
+		case child.IsText():
+			key = "#text"
+		case child.IsComment():
+			key = "#comment"
+		default:
+			key = child.Name + "\x00" + strings.Join(child.Labels, "\x00")
+		}
+
+		children = append(children, keyedNode{key: key + "\x00" + strconv.Itoa(count[key]), node: child})
+		count[key]++
+	}
+
+	return children
+}
+
+// children merges the children of all sides.
+func (m *merger) children(path string, base, ours, theirs *parser.TreeNode) []*parser.TreeNode {
+	baseChildren, ourChildren, theirChildren := keyed(base), keyed(ours), keyed(theirs)
+
+	index := func(children []keyedNode) map[string]*parser.TreeNode {
+		nodes := make(map[string]*parser.TreeNode, len(children))
+		for _, child := range children {
+			nodes[child.key] = child.node
+		}
+
+		return nodes
+	}
+
+	baseNodes, ourNodes, theirNodes := index(baseChildren), index(ourChildren), index(theirChildren)
+
+	// Children that only they added are placed after their nearest predecessor in their order,
+	// which is kept by us, or at the front. Predecessors we removed are skipped, as they are
+	// not part of the result and the additions would be lost otherwise.
+	added := map[string][]*parser.TreeNode{}
+	predecessor := ""
+
+	for _, child := range theirChildren {
+		_, inBase := baseNodes[child.key]
+		_, inOurs := ourNodes[child.key]
+
+		switch {
+		case !inBase && !inOurs:
+			added[predecessor] = append(added[predecessor], child.node)
+		case inOurs:
+			predecessor = child.key
+		}
+	}
+
+	var merged []*parser.TreeNode
+
+	names := map[string]int{}
+	appendNode := func(node *parser.TreeNode) {
+		merged = append(merged, node)
+		if node.IsNode() {
+			names[node.Name]++
+		}
+	}
+
+	childPath := func(node *parser.TreeNode) string {
+		switch {
+		case node.IsText():
+			return path + "/#text"
+		case node.IsComment():
+			return path + "/#comment"
+		}
+
+		return path + "/" + node.Name + "[" + strconv.Itoa(names[node.Name]) + "]"
+	}
+
+	for _, node := range added[""] {
+		appendNode(copyTree(node))
+	}
+
+	for _, child := range ourChildren {
+		b, inBase := baseNodes[child.key]
+		t, inTheirs := theirNodes[child.key]
+
+		switch {
+		case inTheirs:
+			appendNode(m.node(childPath(child.node), b, child.node, t))
+		case !inBase:
+			// We added it.
+			appendNode(copyTree(child.node))
+		case !equal(b, child.node):
+			m.conflict(childPath(child.node), "changed by us, but removed by them", b, child.node, nil)
+			appendNode(copyTree(child.node))
+		}
+
+		for _, node := range added[child.key] {
+			appendNode(copyTree(node))
+		}
+	}
+
+	// Children we removed, but they changed.
+	for _, child := range theirChildren {
+		b, inBase := baseNodes[child.key]
+		if _, inOurs := ourNodes[child.key]; !inOurs && inBase && !equal(b, child.node) {
+			m.conflict(path, "removed by us, but changed by them", b, nil, child.node)
+		}
+	}
+
+	return merged
+}
+
+// copyTree returns a deep copy of node, so that the merged tree shares nothing with its inputs.
+func copyTree(node *parser.TreeNode) *parser.TreeNode {
+	clone := *node
+	clone.Parent = nil
+	clone.Attributes = parser.NewAttributeList()
+	clone.Labels = append([]string(nil), node.Labels...)
+	clone.Children = nil
+
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, value := node.Attributes.Get(i)
+		clone.AddAttribute(*key, *value)
+	}
+
+	for _, child := range node.Children {
+		child = copyTree(child)
+		child.Parent = &clone
+		clone.AddChildren(child)
+	}
+
+	return &clone
+}
+
+func stringOf(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package merge
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/store"
+)
+
+func parse(t *testing.T, text string) *parser.TreeNode {
+	t.Helper()
+
+	tree, err := parser.NewParser("merge_test.go", strings.NewReader(text)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tree
+}
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		conflicts          []string
+	}{
+		{
+			name:   "unchanged",
+			base:   `#!{a @k="v"}`,
+			ours:   `#!{a @k="v"}`,
+			theirs: `#!{a @k="v"}`,
+			want:   `#!{a @k="v"}`,
+		},
+		{
+			name:   "only theirs changed",
+			base:   `#!{a @k="v"}`,
+			ours:   "#!{\n\ta @k=\"v\"\n}",
+			theirs: `#!{a @k="w"}`,
+			want:   `#!{a @k="w"}`,
+		},
+		{
+			name:   "different attributes",
+			base:   `#!{a @k="v" @l="v"}`,
+			ours:   `#!{a @k="w" @l="v"}`,
+			theirs: `#!{a @k="v" @l="w" @m="x"}`,
+			want:   `#!{a @k="w" @l="w" @m="x"}`,
+		},
+		{
+			name:      "same attribute",
+			base:      `#!{a @k="v"}`,
+			ours:      `#!{a @k="w"}`,
+			theirs:    `#!{a @k="x"}`,
+			want:      `#!{a @k="w"}`,
+			conflicts: []string{"/root/a[0]: attribute 'k' changed on both sides"},
+		},
+		{
+			name:   "attribute removed",
+			base:   `#!{a @k="v" @l="v"}`,
+			ours:   `#!{a @l="v"}`,
+			theirs: `#!{a @k="v" @l="w"}`,
+			want:   `#!{a @l="w"}`,
+		},
+		{
+			name:   "children added on both sides",
+			base:   `#!{a {x}}`,
+			ours:   `#!{a {y, x}}`,
+			theirs: `#!{a {x, z}}`,
+			want:   `#!{a {y, x, z}}`,
+		},
+		{
+			name:   "children matched by labels",
+			base:   `#!{server "a" {port "80"}, server "b" {port "80"}}`,
+			ours:   `#!{server "b" {port "80"}, server "a" {port "80"}}`,
+			theirs: `#!{server "a" {port "80"}, server "b" {port "81"}}`,
+			want:   `#!{server "b" {port "81"}, server "a" {port "80"}}`,
+		},
+		{
+			name:   "child removed",
+			base:   `#!{a, b, c}`,
+			ours:   `#!{a, c}`,
+			theirs: `#!{a, b, c, d}`,
+			want:   `#!{a, c, d}`,
+		},
+		{
+			name:   "added after a child we removed",
+			base:   `#!{a, b}`,
+			ours:   `#!{b}`,
+			theirs: `#!{a, c, b}`,
+			want:   `#!{c, b}`,
+		},
+		{
+			name:   "added after several children we removed",
+			base:   `#!{x, a, b, y}`,
+			ours:   `#!{x, y}`,
+			theirs: `#!{x, a, b, c, y}`,
+			want:   `#!{x, c, y}`,
+		},
+		{
+			name:      "text changed on both sides",
+			base:      `#!{a {b "x"}}`,
+			ours:      `#!{a {b "y"}}`,
+			theirs:    `#!{a {b "z"}}`,
+			want:      `#!{a {b "y"}}`,
+			conflicts: []string{"/root/a[0]/b[0]/#text: text changed on both sides"},
+		},
+		{
+			name:      "removed but changed",
+			base:      `#!{a {b "x"}, c}`,
+			ours:      `#!{a {b "y"}, c}`,
+			theirs:    `#!{c}`,
+			want:      `#!{a {b "y"}, c}`,
+			conflicts: []string{"/root/a[0]: changed by us, but removed by them"},
+		},
+		{
+			name:      "changed but removed",
+			base:      `#!{a {b "x"}, c}`,
+			ours:      `#!{c}`,
+			theirs:    `#!{a {b "y"}, c}`,
+			want:      `#!{c}`,
+			conflicts: []string{"/root: removed by us, but changed by them"},
+		},
+		{
+			name:   "same change",
+			base:   `#!{a {b "x"}}`,
+			ours:   `#!{a {b "y"}, c}`,
+			theirs: `#!{a {b "y"}, c}`,
+			want:   `#!{a {b "y"}, c}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts := Merge3(parse(t, tt.base), parse(t, tt.ours), parse(t, tt.theirs))
+
+			if store.Hash(merged) != store.Hash(parse(t, tt.want)) {
+				t.Errorf("unexpected merge result %+v", merged.Children)
+			}
+
+			var got []string
+			for _, c := range conflicts {
+				got = append(got, c.String())
+			}
+
+			if strings.Join(got, "\n") != strings.Join(tt.conflicts, "\n") {
+				t.Errorf("expected conflicts %q but got %q", tt.conflicts, got)
+			}
+
+			for _, child := range merged.Children {
+				if child.Parent != merged {
+					t.Errorf("child %s has wrong parent", child.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestMerge3WithoutBase(t *testing.T) {
+	merged, conflicts := Merge3(nil, parse(t, `#!{a @k="v", b}`), parse(t, `#!{a @k="w", c}`))
+
+	if len(conflicts) != 1 || conflicts[0].Path != "/root/a[0]" {
+		t.Errorf("unexpected conflicts %v", conflicts)
+	}
+
+	if store.Hash(merged) != store.Hash(parse(t, `#!{a @k="v", c, b}`)) {
+		t.Errorf("unexpected merge result %+v", merged.Children)
+	}
+}
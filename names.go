@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NameMapper maps the name of a struct field to the name of its element or attribute.
+// It is only applied to fields, which are not renamed with a tag.
+type NameMapper func(field string) string
+
+// SnakeCase maps CamelCase field names to snake_case, e.g. "MaxConns" to "max_conns".
+// Acronyms are kept together, so "TLSConfig" becomes "tls_config".
+func SnakeCase(field string) string {
+	return splitWords(field, '_')
+}
+
+// KebabCase maps CamelCase field names to kebab-case, e.g. "MaxConns" to "max-conns".
+// Acronyms are kept together, so "TLSConfig" becomes "tls-config".
+func KebabCase(field string) string {
+	return splitWords(field, '-')
+}
+
+// splitWords lowercases a CamelCase name and inserts sep between its words.
+func splitWords(name string, sep rune) string {
+	runes := []rune(name)
+
+	var sb strings.Builder
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			// The last letter of an acronym starts the next word, like the "C" in "TLSConfig".
+			endOfAcronym := unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+			if prevLower || endOfAcronym {
+				sb.WriteRune(sep)
+			}
+		}
+
+		sb.WriteRune(unicode.ToLower(r))
+	}
+
+	return sb.String()
+}
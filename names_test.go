@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import "testing"
+
+func TestNameMappers(t *testing.T) {
+	tests := []struct {
+		field string
+		snake string
+		kebab string
+	}{
+		{field: "Name", snake: "name", kebab: "name"},
+		{field: "MaxConns", snake: "max_conns", kebab: "max-conns"},
+		{field: "TLSConfig", snake: "tls_config", kebab: "tls-config"},
+		{field: "ID", snake: "id", kebab: "id"},
+		{field: "UserID", snake: "user_id", kebab: "user-id"},
+		{field: "Port8080Open", snake: "port8080_open", kebab: "port8080-open"},
+		{field: "already_snake", snake: "already_snake", kebab: "already_snake"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if got := SnakeCase(tt.field); got != tt.snake {
+				t.Errorf("SnakeCase(%q) = %q, want %q", tt.field, got, tt.snake)
+			}
+
+			if got := KebabCase(tt.field); got != tt.kebab {
+				t.Errorf("KebabCase(%q) = %q, want %q", tt.field, got, tt.kebab)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+// DecodeOptions configure the common settings of decoding at once, see WithDecodeOptions.
+// It is a shorthand for the functional options named at its fields and combines with them
+// like they do: a field only enables its setting, it never disables what was enabled otherwise.
+// So the result is strict, if either the strict argument of Unmarshal, WithStrict or Strict is set,
+// no matter in which order the options are given. The zero value keeps the default behavior,
+// so that fields can be added without breaking callers.
+//
+//  err := tadl.Unmarshal(r, &config, false, tadl.WithDecodeOptions(tadl.DecodeOptions{
+//      Strict:                true,
+//      DisallowUnknownFields: true,
+//      MaxTokens:             1 << 20,
+//  }))
+type DecodeOptions struct {
+	// Strict unmarshals in strict mode, like WithStrict. It cannot disable the strict mode of Unmarshal.
+	Strict bool
+	// CaseInsensitiveNames matches elements and attributes to fields ignoring the case of their names,
+	// also for fields renamed by a tag. Unlike WithFuzzyNames, '-' and '_' are not ignored.
+	CaseInsensitiveNames bool
+	// DisallowUnknownFields returns an error for elements and attributes, which no field matches,
+	// see WithDisallowUnknownFields.
+	DisallowUnknownFields bool
+	// MaxDepth and MaxTokens set the limits of the same name, like WithLimits. Limits of zero are kept.
+	MaxDepth  int
+	MaxTokens int
+}
+
+// WithDecodeOptions applies the fields of o, which are set, see DecodeOptions.
+func WithDecodeOptions(o DecodeOptions) DecodeOption {
+	return func(u *unmarshaler) {
+		if o.Strict {
+			WithStrict()(u)
+		}
+
+		if o.CaseInsensitiveNames {
+			u.caseInsensitive = true
+		}
+
+		if o.DisallowUnknownFields {
+			WithDisallowUnknownFields()(u)
+		}
+
+		if o.MaxDepth > 0 {
+			u.limits.MaxDepth = o.MaxDepth
+		}
+
+		if o.MaxTokens > 0 {
+			u.limits.MaxTokens = o.MaxTokens
+		}
+	}
+}
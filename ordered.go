@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import "github.com/golangee/tadl/parser"
+
+// KeyValue is a single entry of an OrderedMap.
+type KeyValue struct {
+	// Key is the name of the element.
+	Key string
+	// Value is the text of the first child of the element, or its name if it is an element.
+	Value string
+	// Node is the element itself, which gives access to further children and attributes.
+	Node *parser.TreeNode
+}
+
+// OrderedMap is decoded like a map[string]string, but keeps the order of the document.
+// Use it, when the order of the entries matters, like for a chain of middlewares.
+type OrderedMap []KeyValue
+
+// Get returns the value of the first entry with the given key.
+func (m OrderedMap) Get(key string) (string, bool) {
+	for _, kv := range m {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// Keys returns all keys in the order of the document.
+func (m OrderedMap) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for _, kv := range m {
+		keys = append(keys, kv.Key)
+	}
+
+	return keys
+}
@@ -1,10 +1,15 @@
 package parser
 
+import "github.com/golangee/tadl/token"
+
 // Attribute represents single attribute and holds a pointer to the next attribute
 type Attribute struct {
 	Key   string
 	Value string
-	Next  *Attribute
+	// KeyRange and ValueRange are the positions of key and value in the parsed text.
+	// They are zero for attributes that were not parsed.
+	KeyRange, ValueRange token.Position
+	Next                 *Attribute
 }
 
 // AttributeList is a FiFo linked list to hold Attributes
@@ -25,10 +30,14 @@ func (l *AttributeList) Len() int { return l.length }
 
 // Push adds an attribute to the list
 func (l *AttributeList) Push(key, value *string) {
-	attribute := &Attribute{
+	l.push(&Attribute{
 		Key:   *key,
 		Value: *value,
-	}
+	})
+}
+
+// push appends attribute to the list.
+func (l *AttributeList) push(attribute *Attribute) {
 
 	if l.first == nil {
 		l.first = attribute
@@ -105,3 +114,34 @@ func (l *AttributeList) Get(index int) (*string, *string) {
 	}
 	return &runner.Key, &runner.Value
 }
+
+// Range returns the positions of the key and value of the attribute on the given position in the
+// AttributeList, so that errors can point to a single attribute instead of its element.
+// Both are zero if the attribute was not parsed or the index is out of bounds.
+func (l *AttributeList) Range(index int) (key, value token.Position) {
+	if index < 0 || index >= l.Len() {
+		return token.Position{}, token.Position{}
+	}
+
+	runner := l.first
+	for i := 0; i < index; i++ {
+		runner = runner.Next
+	}
+
+	return runner.KeyRange, runner.ValueRange
+}
+
+// Index returns the position of the first attribute with the given key in the AttributeList,
+// or -1 if there is none.
+func (l *AttributeList) Index(key string) int {
+	i := 0
+	for a := l.first; a != nil; a = a.Next {
+		if a.Key == key {
+			return i
+		}
+
+		i++
+	}
+
+	return -1
+}
@@ -0,0 +1,210 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/golangee/tadl/token"
+)
+
+// Document is a parsed tree together with information about the input it was parsed from.
+type Document struct {
+	// Root is the root element of the document, as returned by Parser.Parse.
+	Root *TreeNode
+	// Metadata contains the attributes of the G2 preamble, like "version" in "#!@version{2} {...}".
+	// They describe the document and are not part of the attributes of Root.
+	Metadata AttributeList
+
+	grammar  token.GrammarMode
+	preamble token.Position
+}
+
+// Grammar returns the grammar the document was written in.
+// This is G2 if the input started with the '#!' preamble and G1 otherwise.
+func (d *Document) Grammar() token.GrammarMode {
+	return d.grammar
+}
+
+// Preamble returns the position of the '#!' preamble.
+// ok is false, if the document is written in G1 and has no preamble.
+func (d *Document) Preamble() (pos token.Position, ok bool) {
+	return d.preamble, d.grammar == token.G2
+}
+
+// ParseDocument works like Parse, but returns the tree together with the grammar of the input.
+func (p *Parser) ParseDocument() (*Document, error) {
+	root, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Document{
+		Root:     root,
+		Metadata: p.metadata,
+		grammar:  p.visitor.grammar,
+		preamble: p.visitor.preamble,
+	}, nil
+}
+
+// ParseFragment parses a sequence of elements, that is not wrapped into a document.
+// In G1 the input is parsed as usual, in G2 the elements may be enclosed in any kind of
+// brackets after the preamble, like "#!(a, b)". The returned elements have no parent.
+func (p *Parser) ParseFragment() ([]*TreeNode, error) {
+	p.visitor.SetFragment(true)
+
+	root, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, child := range root.Children {
+		child.Parent = nil
+	}
+
+	return root.Children, nil
+}
+
+// ParseFragment parses a sequence of elements from r, see Parser.ParseFragment.
+func ParseFragment(r io.Reader, opts ...Option) ([]*TreeNode, error) {
+	return NewParser("", r, opts...).ParseFragment()
+}
+
+// ParseLine parses a single G1 line, like the lines starting with '#' in G2 documents, without
+// wrapping it into a document. This is useful for one-liners embedded in other text, like chat messages:
+//
+//  nodes, err := parser.ParseLine("deploy #service{api} to #env prod")
+//
+// A single trailing line ending is ignored, any other line ending is an error, as is a G2 preamble.
+// The returned elements have no parent.
+func ParseLine(s string, opts ...Option) ([]*TreeNode, error) {
+	line := strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+
+	if i := strings.IndexAny(line, "\r\n"); i >= 0 {
+		return nil, token.NewPosError(linePosition(line, i), "a G1 line must not contain a line ending")
+	}
+
+	if strings.HasPrefix(line, "#!") {
+		return nil, token.NewPosError(linePosition(line, 0), "a G1 line must not start with the G2 preamble")
+	}
+
+	return ParseFragment(strings.NewReader(line), opts...)
+}
+
+// linePosition returns the position of the byte at offset in line.
+func linePosition(line string, offset int) token.Position {
+	pos := token.Pos{Line: 1, Col: utf8.RuneCountInString(line[:offset]) + 1, Offset: offset}
+
+	return token.Position{BeginPos: pos, EndPos: pos}
+}
+
+// InsertFragment parses src with ParseFragment and appends the parsed elements to the
+// children of the element at path. The path lists the names of the elements from the root
+// on, separated by '/', like "/root/servers/server[1]". An index selects the n-th
+// element of that name, by default the first one is used.
+// The fragment is written in the grammar of doc: in G2 the preamble may be left out, like in
+// `server @id="3" {port "80"}`, and in G1 a fragment with the G2 preamble is rejected.
+// Use format.InsertFragment to change the text of a document instead, which formats only the changed element.
+func InsertFragment(doc *Document, path, src string) error {
+	target, err := doc.Find(path)
+	if err != nil {
+		return err
+	}
+
+	preamble := strings.HasPrefix(strings.TrimLeftFunc(src, unicode.IsSpace), "#!")
+
+	switch {
+	case doc.Grammar() == token.G2 && !preamble:
+		// The closing bracket goes on its own line, so that a trailing comment cannot hide it.
+		src = "#!{" + src + "\n}"
+	case doc.Grammar() == token.G1 && preamble:
+		return fmt.Errorf("cannot insert a G2 fragment into the G1 document at %s", path)
+	}
+
+	nodes, err := ParseFragment(strings.NewReader(src))
+	if err != nil {
+		return fmt.Errorf("cannot parse fragment for %s: %w", path, err)
+	}
+
+	for _, node := range nodes {
+		node.Parent = target
+	}
+
+	target.Children = append(target.Children, nodes...)
+
+	if len(nodes) > 0 && target.BlockType == BlockNone && len(target.Children) > 1 {
+		// A node without brackets has at most one child.
+		target.BlockType = BlockNormal
+	}
+
+	return nil
+}
+
+// Find returns the element at path, see InsertFragment for the syntax of paths.
+func (d *Document) Find(path string) (*TreeNode, error) {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if d.Root == nil || segments[0] == "" {
+		return nil, fmt.Errorf("no element at path '%s'", path)
+	}
+
+	name, index, err := pathSegment(segments[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if name != d.Root.Name || index != 0 {
+		return nil, fmt.Errorf("no element at path '%s': root is '%s'", path, d.Root.Name)
+	}
+
+	node := d.Root
+	for i, segment := range segments[1:] {
+		name, index, err := pathSegment(segment)
+		if err != nil {
+			return nil, err
+		}
+
+		var next *TreeNode
+		for _, child := range node.Children {
+			if child.IsNode() && child.Name == name {
+				if index == 0 {
+					next = child
+					break
+				}
+				index--
+			}
+		}
+
+		if next == nil {
+			return nil, fmt.Errorf("no element at path '%s'", "/"+strings.Join(segments[:i+2], "/"))
+		}
+
+		node = next
+	}
+
+	return node, nil
+}
+
+// pathSegment splits a segment of a path like "server[1]" into name and index.
+func pathSegment(segment string) (name string, index int, err error) {
+	open := strings.IndexByte(segment, '[')
+	if open < 0 {
+		return segment, 0, nil
+	}
+
+	if !strings.HasSuffix(segment, "]") {
+		return "", 0, fmt.Errorf("invalid path segment '%s': missing ']'", segment)
+	}
+
+	index, err = strconv.Atoi(segment[open+1 : len(segment)-1])
+	if err != nil || index < 0 {
+		return "", 0, fmt.Errorf("invalid path segment '%s': index must not be negative", segment)
+	}
+
+	return segment[:open], index, nil
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package parser
+
+import "iter"
+
+// All returns an iterator over t and all nodes below it in document order, including text and comments.
+//
+//  for node := range tree.All() {
+//      ...
+//  }
+//
+func (t *TreeNode) All() iter.Seq[*TreeNode] {
+	return func(yield func(*TreeNode) bool) {
+		t.walk(yield)
+	}
+}
+
+// Descendants returns an iterator over the elements below t with the given name in document order.
+// Nested matches are returned after the element containing them. t itself is never returned.
+func (t *TreeNode) Descendants(name string) iter.Seq[*TreeNode] {
+	return func(yield func(*TreeNode) bool) {
+		for _, child := range t.Children {
+			more := child.walk(func(node *TreeNode) bool {
+				if node.IsNode() && node.Name == name {
+					return yield(node)
+				}
+
+				return true
+			})
+
+			if !more {
+				return
+			}
+		}
+	}
+}
+
+// walk calls visit for t and all nodes below it in document order, until visit returns false.
+// It returns false, if it has been stopped.
+func (t *TreeNode) walk(visit func(node *TreeNode) bool) bool {
+	if !visit(t) {
+		return false
+	}
+
+	for _, child := range t.Children {
+		if !child.walk(visit) {
+			return false
+		}
+	}
+
+	return true
+}
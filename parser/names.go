@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golangee/tadl/token"
+)
+
+// WithStrictNames rejects documents with element names that cannot be exported to case-insensitive
+// targets, like file trees on Windows or some XML consumers. An element must not have children whose
+// names differ only in case, like "server" and "Server", and must not be named like the root element
+// or one of reserved, like the directive names of a tool. Names are compared case-insensitively.
+// All offending elements are reported as details of a single error.
+//
+//  parser.WithStrictNames("include", "import")
+func WithStrictNames(reserved ...string) Option {
+	return func(p *Parser) {
+		p.strictNames = true
+		p.reservedNames = append(p.reservedNames, reserved...)
+	}
+}
+
+// checkNames verifies the names of all elements below root, see WithStrictNames.
+func checkNames(root *TreeNode, rootName string, reserved []string) error {
+	reservedNames := map[string]string{strings.ToLower(rootName): rootName}
+	for _, name := range reserved {
+		reservedNames[strings.ToLower(name)] = name
+	}
+
+	var details []token.ErrDetail
+
+	for node := range root.All() {
+		// first contains the first child of each name, by its lower case name.
+		first := map[string]*TreeNode{}
+
+		for _, child := range node.Children {
+			if !child.IsNode() {
+				continue
+			}
+
+			key := strings.ToLower(child.Name)
+
+			if name, ok := reservedNames[key]; ok {
+				details = append(details, token.NewErrDetail(child.Range,
+					fmt.Sprintf("'%s' shadows the reserved name '%s'", child.Name, name)))
+
+				continue
+			}
+
+			if other, ok := first[key]; !ok {
+				first[key] = child
+			} else if other.Name != child.Name {
+				details = append(details, token.NewErrDetail(child.Range,
+					fmt.Sprintf("'%s' collides with '%s' at %s", child.Name, other.Name, other.Range.BeginPos)))
+			}
+		}
+	}
+
+	if len(details) == 0 {
+		return nil
+	}
+
+	return token.NewPosError(details[0].Node, details[0].Message, details[1:]...)
+}
@@ -5,7 +5,9 @@ package parser
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"strings"
 
 	"github.com/golangee/tadl/token"
 )
@@ -19,13 +21,19 @@ type TreeNode struct {
 	Text       *string
 	Comment    *string
 	Attributes AttributeList
-	Parent     *TreeNode
-	Children   []*TreeNode
+	// Labels are the strings between the name and the block of a G2 element,
+	// like "web" and "eu-west" in 'server "web" "eu-west" {...}'.
+	Labels   []string
+	Parent   *TreeNode
+	Children []*TreeNode
 	// BlockType describes the type of brackets the children were surrounded with.
 	// This may be BlockNone in which case this node either has no or one children.
 	BlockType BlockType
 	// Range will span all tokens that were processed to build this node.
 	Range token.Position
+	// Annotations hold information that tools attach to the node, like resolved types or
+	// computed values. They are not part of the document and nil until the first Annotate.
+	Annotations map[string]interface{}
 }
 
 // NewNode creates a new node for the parse tree.
@@ -95,6 +103,13 @@ func (t *TreeNode) AddAttribute(key, value string) *TreeNode {
 	return t
 }
 
+// AddLabels adds labels to a node and can be used builder-style.
+func (t *TreeNode) AddLabels(labels ...string) *TreeNode {
+	t.Labels = append(t.Labels, labels...)
+
+	return t
+}
+
 // Block is used to set the BlockType of this node.
 func (t *TreeNode) Block(blockType BlockType) *TreeNode {
 	t.BlockType = blockType
@@ -102,6 +117,24 @@ func (t *TreeNode) Block(blockType BlockType) *TreeNode {
 	return t
 }
 
+// Annotate sets the annotation key of the node to value and returns the node itself.
+func (t *TreeNode) Annotate(key string, value interface{}) *TreeNode {
+	if t.Annotations == nil {
+		t.Annotations = map[string]interface{}{}
+	}
+
+	t.Annotations[key] = value
+
+	return t
+}
+
+// Annotation returns the annotation key of the node. ok is false, if it has not been set.
+func (t *TreeNode) Annotation(key string) (value interface{}, ok bool) {
+	value, ok = t.Annotations[key]
+
+	return value, ok
+}
+
 // IsClosedBy returns true if tok is a BlockEnd/GroupEnd/GenericEnd that is the correct
 // match for closing this TreeNode.
 func (t *TreeNode) IsClosedBy(tok token.Token) bool {
@@ -117,6 +150,12 @@ func (t *TreeNode) IsClosedBy(tok token.Token) bool {
 	}
 }
 
+// IsSynthetic returns true if this node does not appear in the input, like the root element.
+// Its Range then spans the construct that generated it, like the G2 preamble.
+func (t *TreeNode) IsSynthetic() bool {
+	return t.Range.Synthetic
+}
+
 // IsText returns true if this node is a text only node.
 // Only one of IsText, IsComment, IsNode should be true.
 func (t *TreeNode) IsText() bool {
@@ -135,11 +174,37 @@ func (t *TreeNode) IsNode() bool {
 	return !t.IsText() && !t.IsComment()
 }
 
-// unbindParents recursively sets all parent Pointers of a tree to nil
+// IsKeyValue returns true if this node is a key/value pair.
+// A key/value pair is a regular node without brackets that has exactly one text child,
+// like "#key value" in G1 or G1 lines and "key "value"" in G2.
+func (t *TreeNode) IsKeyValue() bool {
+	return t.IsNode() && t.BlockType == BlockNone && len(t.Children) == 1 && t.Children[0].IsText()
+}
+
+// KeyValue returns the name and the text of a key/value pair node, see IsKeyValue.
+// Surrounding whitespace is removed from the value, as in G1 the text runs until the next element.
+// ok is false, if this node is not a key/value pair.
+func (t *TreeNode) KeyValue() (key, value string, ok bool) {
+	if !t.IsKeyValue() {
+		return "", "", false
+	}
+
+	return t.Name, strings.TrimSpace(*t.Children[0].Text), true
+}
+
+// unbindParents sets all parent Pointers of a tree to nil.
+// Children that were preallocated but never used are released as well.
 func unbindParents(t *TreeNode) {
-	t.Parent = nil
-	for _, child := range t.Children {
-		unbindParents(child)
+	stack := []*TreeNode{t}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		node.Parent = nil
+		if len(node.Children) == 0 {
+			node.Children = nil
+		}
+		stack = append(stack, node.Children...)
 	}
 }
 
@@ -180,49 +245,455 @@ type Parser struct {
 	rootForward   *TreeNode
 	parentForward *TreeNode
 
+	// metadata contains the attributes of the G2 preamble, see Document.Metadata.
+	metadata AttributeList
+
 	// g2Comments contains all comments in G2 that were eaten from the input,
 	// but are not yet placed in a sensible position.
 	g2Comments []*TreeNode
 
-	visitor Visitor
+	// childrenHint remembers the number of children the last closed node of a name had.
+	// Nodes with the same name tend to have a similar shape, so this is used to
+	// preallocate the children of new nodes.
+	childrenHint map[string]int
+
+	visitor      Visitor
+	lexerOptions []token.Option
+
+	// rootName is the name of the synthetic root element, see WithRootName.
+	rootName string
+	// explicitRoot replaces the synthetic root of G1 documents with their single element.
+	explicitRoot bool
+	// validators check attribute values by key, see WithAttributeValidator.
+	validators map[string][]func(value string) error
+	// rootBlocks are the brackets the root of G2 may have besides curly brackets, see WithRootBlocks.
+	rootBlocks []BlockType
+	// trailingForward is the name of the element for forwarded elements at the end, see WithTrailingForward.
+	trailingForward string
+	// autoCloseWarn receives the warning about blocks closed at the end of the input, see WithAutoClose.
+	autoClose     bool
+	autoCloseWarn func(err error)
+	// maxTokens is the maximum number of tokens of the input, see WithMaxTokens.
+	maxTokens int
+	// progress receives the state of the parse, see WithProgress. nodes counts the created nodes.
+	progress      func(p Progress)
+	progressEvery int64
+	nodes         int
+	// inCallback is true while a function of the user is called, see callback.
+	inCallback bool
+	// strictNames enables the check of element names against each other and reservedNames, see WithStrictNames.
+	strictNames   bool
+	reservedNames []string
 
 	firstNode     bool
 	globalForward bool
+
+	// debug enables the verification of the tree invariants after each structural change.
+	debug bool
+}
+
+// Option configures optional behavior of a Parser.
+type Option func(p *Parser)
+
+// WithLexerOptions passes the given options to the lexer of the parser.
+func WithLexerOptions(opts ...token.Option) Option {
+	return func(p *Parser) {
+		p.lexerOptions = append(p.lexerOptions, opts...)
+	}
+}
+
+// WithRootName sets the name of the synthetic root element, which is "root" by default.
+func WithRootName(name string) Option {
+	return func(p *Parser) {
+		p.rootName = name
+	}
+}
+
+// WithExplicitRoot requires G1 documents to consist of a single element, which is
+// returned as root instead of the synthetic root element. Whitespace and comments
+// around that element are dropped. G2 documents are not affected, as their root is
+// always the block after the preamble.
+func WithExplicitRoot() Option {
+	return func(p *Parser) {
+		p.explicitRoot = true
+	}
+}
+
+// WithAttributeValidator registers fn to check the value of every attribute with the given key,
+// as soon as it is parsed. Parsing stops with the error of fn, positioned at the value, so that
+// large inputs can be rejected before their tree is built. Several validators of a key are called
+// in the order of their registration. Metadata of the G2 preamble is validated as well.
+//
+//  parser.WithAttributeValidator("port", func(value string) error {
+//  	_, err := strconv.ParseUint(value, 10, 16)
+//  	return err
+//  })
+func WithAttributeValidator(key string, fn func(value string) error) Option {
+	return func(p *Parser) {
+		if p.validators == nil {
+			p.validators = map[string][]func(value string) error{}
+		}
+
+		p.validators[key] = append(p.validators[key], fn)
+	}
+}
+
+// WithRootBlocks allows the root element of G2 documents to be enclosed in the given brackets,
+// like "#!(a, b)" for BlockGroup, instead of only curly brackets. BlockNone allows a root without
+// brackets, which consists of a single element with a block, like "#!server {...}". The brackets
+// are kept as BlockType of the root, so that serializers can reproduce the original form.
+func WithRootBlocks(blockTypes ...BlockType) Option {
+	return func(p *Parser) {
+		p.rootBlocks = append(p.rootBlocks, blockTypes...)
+	}
+}
+
+// WithTrailingForward attaches forwarded elements that are left at the end of the input
+// to a synthetic element with the given name, which is appended to the root. Without this
+// option, such elements are reported as error, which lists all of them.
+//
+//  // "#a ##b ##c" is parsed like "#a #trailing{#b #c}"
+//  parser.WithTrailingForward("trailing")
+func WithTrailingForward(name string) Option {
+	return func(p *Parser) {
+		p.trailingForward = name
+	}
+}
+
+// WithAutoClose closes all open blocks at an unexpected end of the input, instead of reporting
+// an error, so that partially written or truncated files can be read as far as they go.
+// If blocks have been closed, warn is called with an error at the end of the input, which
+// points to their opening brackets, before the tree is returned. warn may be nil.
+// Input that ends inside of a token, like in the middle of an attribute, loses that token.
+// Some states, like an open G1 line in G2, are still reported as error.
+//
+//  // "#!{server {port 80" is parsed like "#!{server {port 80}}"
+//  parser.WithAutoClose(func(err error) {
+//      log.Println(err)
+//  })
+func WithAutoClose(warn func(err error)) Option {
+	return func(p *Parser) {
+		p.autoClose = true
+		p.autoCloseWarn = warn
+	}
+}
+
+// Progress is the state of a running parse, see WithProgress.
+type Progress struct {
+	// Bytes is the number of bytes, which have been read from the input.
+	Bytes int64
+	// Tokens is the number of tokens, which have been read from the input.
+	Tokens int
+	// Nodes is the number of elements, texts and comments, which have been created.
+	Nodes int
+}
+
+// WithProgress calls fn whenever at least every more bytes of the input have been read, and once
+// more when the input has been parsed successfully. As the size of the input is known to the caller,
+// this is enough to render a progress bar or to estimate the remaining time of large inputs.
+// fn is called synchronously and slows down parsing, if it takes long.
+//
+//  parser.WithProgress(1<<20, func(p parser.Progress) {
+//      fmt.Printf("\r%d%%", p.Bytes*100/size)
+//  })
+func WithProgress(every int64, fn func(p Progress)) Option {
+	return func(p *Parser) {
+		p.progress = fn
+		p.progressEvery = every
+	}
+}
+
+// ErrTooManyTokens is the cause of the error for inputs exceeding WithMaxTokens.
+var ErrTooManyTokens = errors.New("too many tokens")
+
+// WithMaxTokens stops parsing with an error caused by ErrTooManyTokens, when the input has more than
+// max tokens. Use it to reject large inputs of untrusted users before their tree is built.
+func WithMaxTokens(max int) Option {
+	return func(p *Parser) {
+		p.maxTokens = max
+	}
+}
+
+// WithDebug enables consistency checks of the tree that is built while parsing.
+// A violated invariant is reported as error instead of silently producing a broken tree.
+// This is only useful for debugging the parser itself, as the checks are expensive.
+func WithDebug() Option {
+	return func(p *Parser) {
+		p.debug = true
+	}
 }
 
 // NewParser creates and returns a new Parser with corresponding Visitor
-func NewParser(filename string, r io.Reader) *Parser {
+func NewParser(filename string, r io.Reader, opts ...Option) *Parser {
+	return newParser(nil, filename, r, opts...)
+}
+
+// newParser works like NewParser, but resets lexer to read r instead of creating a new one, if it is not nil.
+func newParser(lexer *token.Lexer, filename string, r io.Reader, opts ...Option) *Parser {
 	parser := &Parser{
-		visitor:       *NewVisitor(nil, token.NewLexer(filename, r)),
 		globalForward: false,
 		rootForward:   NewNode("root").Block(BlockNormal),
+		childrenHint:  map[string]int{},
+		metadata:      NewAttributeList(),
+	}
+
+	for _, opt := range opts {
+		opt(parser)
+	}
+
+	if lexer == nil {
+		lexer = token.NewLexer(filename, r, parser.lexerOptions...)
+	} else {
+		lexer.Reset(filename, r)
 	}
+
+	parser.visitor = *NewVisitor(nil, lexer)
 	parser.parentForward = parser.rootForward
 	parser.visitor.SetVisitable(parser)
+	if parser.rootName != "" {
+		parser.visitor.SetRootName(parser.rootName)
+	}
+	parser.visitor.SetRootBlocks(parser.rootBlocks...)
+	parser.visitor.SetTrailingForward(parser.trailingForward)
+	parser.visitor.SetAutoClose(parser.autoClose)
+	parser.visitor.SetMaxTokens(parser.maxTokens)
+	if parser.progress != nil {
+		parser.visitor.SetProgress(parser.progressEvery, func(bytes int64, tokens int) {
+			parser.callback(func() {
+				parser.progress(Progress{Bytes: bytes, Tokens: tokens, Nodes: parser.nodes})
+			})
+		})
+	}
 	parser.firstNode = true
 	return parser
 }
 
 // Parse returns a parsed tree.
-func (p *Parser) Parse() (*TreeNode, error) {
-	err := p.visitor.Run()
+// Parse never panics, an inconsistent parser state is reported as error. Panics of functions
+// given as options, like the one of WithProgress, are not recovered and keep their stack.
+func (p *Parser) Parse() (tree *TreeNode, err error) {
+	p.inCallback = false
+
+	defer func() {
+		if p.inCallback {
+			return
+		}
+
+		if r := recover(); r != nil {
+			tree = nil
+			err = p.stateError(fmt.Sprintf("internal parser error: %v", r))
+		}
+	}()
+
+	err = p.visitor.Run()
 	if err != nil {
 		return nil, err
 	}
+
+	if p.root == nil {
+		return nil, p.stateError("no root element")
+	}
+
+	// The root of G2 is not closed explicitly, it spans until the last token.
+	if p.root.Range.EndPos.Line == 0 {
+		p.root.Range.EndPos = p.visitor.lastEnd
+	}
+
+	if p.debug {
+		if err := p.checkFinished(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.explicitRoot && !p.visitor.fragment && p.visitor.grammar == token.G1 {
+		root, err := p.explicitRootElement()
+		if err != nil {
+			return nil, err
+		}
+
+		p.root = root
+	}
+
+	if p.strictNames {
+		if err := checkNames(p.root, p.visitor.rootName, p.reservedNames); err != nil {
+			return nil, err
+		}
+	}
+
+	if closed := p.visitor.AutoClosed(); len(closed) > 0 && p.autoCloseWarn != nil {
+		p.callback(func() {
+			p.autoCloseWarn(autoClosedError(closed, p.visitor.lastEnd))
+		})
+	}
+
+	if p.progress != nil {
+		bytes, tokens := p.visitor.Progress()
+		p.callback(func() {
+			p.progress(Progress{Bytes: bytes, Tokens: tokens, Nodes: p.nodes})
+		})
+	}
+
 	unbindParents(p.root)
 
 	return p.root, nil
 }
 
+// autoClosedError returns the warning of WithAutoClose about the blocks, which have been closed at end.
+func autoClosedError(closed []token.Token, end token.Pos) error {
+	details := make([]token.ErrDetail, 0, len(closed))
+	for _, tok := range closed {
+		details = append(details, token.NewErrDetail(tok.Pos(), "this block is not closed"))
+	}
+
+	msg := "unexpected end of input, closed 1 block"
+	if len(closed) > 1 {
+		msg = fmt.Sprintf("unexpected end of input, closed %d blocks", len(closed))
+	}
+
+	return token.NewPosError(token.Position{BeginPos: end, EndPos: end}, msg, details...)
+}
+
+// explicitRootElement returns the single element of a G1 document, see WithExplicitRoot.
+func (p *Parser) explicitRootElement() (*TreeNode, error) {
+	var root *TreeNode
+
+	for _, child := range p.root.Children {
+		switch {
+		case child.IsComment():
+		case child.IsText() && strings.TrimSpace(*child.Text) == "":
+		case child.IsNode() && root == nil:
+			root = child
+		default:
+			return nil, token.NewPosError(child.Range, "only a single root element is allowed")
+		}
+	}
+
+	if root == nil {
+		return nil, p.stateError("a root element is required")
+	}
+
+	root.Parent = nil
+
+	return root, nil
+}
+
+// stateError creates an error at the position of the latest token for a callback
+// that was invoked in a state it cannot handle.
+// callback calls fn, which runs a function of the user. If it panics, inCallback stays set,
+// so that Parse does not take the panic for an internal error.
+func (p *Parser) callback(fn func()) {
+	p.inCallback = true
+	fn()
+	p.inCallback = false
+}
+
+func (p *Parser) stateError(msg string) error {
+	pos := p.visitor.lastEnd
+	return token.NewPosError(token.Position{BeginPos: pos, EndPos: pos}, msg)
+}
+
+// attribute returns the latest attribute of the visitor, after it has been checked by the validators of its key.
+func (p *Parser) attribute(key, value string) (*Attribute, error) {
+	attribute := p.visitor.attribute(key, value)
+
+	for _, validate := range p.validators[key] {
+		var err error
+
+		p.callback(func() {
+			err = validate(value)
+		})
+
+		if err != nil {
+			return nil, token.NewPosError(attribute.ValueRange, fmt.Sprintf("invalid value of attribute '%s'", key)).
+				SetCause(err)
+		}
+	}
+
+	return attribute, nil
+}
+
+// current returns the node that is currently modified.
+// It is an error to call this before the root node has been created.
+func (p *Parser) current(op string) (*TreeNode, error) {
+	if p.parent == nil {
+		return nil, p.stateError("cannot " + op + ": no open element")
+	}
+
+	return p.parent, nil
+}
+
+// checkTree verifies that the current node is attached to the active tree.
+func (p *Parser) checkTree() error {
+	if p.root == nil {
+		if p.parent != nil {
+			return p.stateError("invariant violated: open element without root")
+		}
+		return nil
+	}
+
+	for node := p.parent; node != p.root; node = node.Parent {
+		if node == nil {
+			return p.stateError("invariant violated: open element is not part of the tree")
+		}
+	}
+
+	return nil
+}
+
+// checkFinished verifies that nothing is left over after the input has been consumed.
+func (p *Parser) checkFinished() error {
+	if err := p.checkTree(); err != nil {
+		return err
+	}
+
+	if p.globalForward {
+		return p.stateError("invariant violated: forwarding tree still active")
+	}
+
+	if n, _ := p.GetForwardingLength(); n > 0 {
+		return p.stateError(fmt.Sprintf("invariant violated: %d forwarded elements not merged", n))
+	}
+
+	if n, _ := p.GetForwardingAttributesLength(); n > 0 {
+		return p.stateError(fmt.Sprintf("invariant violated: %d forwarded attributes not merged", n))
+	}
+
+	if len(p.g2Comments) > 0 {
+		return p.stateError(fmt.Sprintf("invariant violated: %d comments not placed", len(p.g2Comments)))
+	}
+
+	return nil
+}
+
 // open sets the parent pointer to the latest Child of it's current Node
-func (p *Parser) open() {
+func (p *Parser) open() error {
+	if p.parent == nil || len(p.parent.Children) == 0 {
+		return p.stateError("cannot open element: no element to open")
+	}
+
 	p.parent = p.parent.Children[len(p.parent.Children)-1]
+	return nil
 }
 
+// maxChildrenHint limits the capacity that is preallocated for the children of a node.
+const maxChildrenHint = 4096
+
 // Close moves the parent pointer to its current parent Node
 func (p *Parser) Close() error {
-	if p.parent.Parent != nil {
-		p.parent = p.parent.Parent
+	parent, err := p.current("close element")
+	if err != nil {
+		return err
+	}
+
+	p.rememberChildren(parent)
+	parent.Range.EndPos = p.visitor.lastEnd
+
+	if parent.Parent != nil {
+		p.parent = parent.Parent
+	}
+
+	if p.debug {
+		return p.checkTree()
 	}
 	return nil
 }
@@ -230,8 +701,12 @@ func (p *Parser) Close() error {
 // NewNode creates a named Node and adds it as a child to the current parent Node
 // Opens the new Node
 func (p *Parser) NewNode(name string) error {
+	p.nodes++
+
 	if p.root == nil || p.firstNode {
 		p.root = NewNode(name)
+		p.root.Range.BeginPos = p.visitor.nodeBegin
+		p.root.Range.Synthetic = p.visitor.nodeSynthetic
 		p.parent = p.root
 
 		if p.firstNode {
@@ -240,42 +715,106 @@ func (p *Parser) NewNode(name string) error {
 		return nil
 	}
 
-	p.parent.AddChildren(NewNode(name))
-	p.parent.Children[len(p.parent.Children)-1].Parent = p.parent
-	p.open()
+	parent, err := p.current("create element " + name)
+	if err != nil {
+		return err
+	}
+
+	node := p.newNode(name)
+	node.Range.BeginPos = p.visitor.nodeBegin
+	node.Range.Synthetic = p.visitor.nodeSynthetic
+	node.Parent = parent
+	parent.AddChildren(node)
+	if err := p.open(); err != nil {
+		return err
+	}
+
+	if p.debug {
+		return p.checkTree()
+	}
 	return nil
 }
 
+// newNode creates a node whose children are preallocated according to the children
+// of the last closed node with the same name.
+func (p *Parser) newNode(name string) *TreeNode {
+	node := NewNode(name)
+	if hint := p.childrenHint[name]; hint > 0 {
+		node.Children = make([]*TreeNode, 0, hint)
+	}
+
+	return node
+}
+
+// rememberChildren records the number of children of a finished node as hint for
+// upcoming nodes with the same name.
+func (p *Parser) rememberChildren(node *TreeNode) {
+	hint := len(node.Children)
+	if hint > maxChildrenHint {
+		hint = maxChildrenHint
+	}
+
+	p.childrenHint[node.Name] = hint
+}
+
 // NewTextNode creates a new Node with Text based on CharData and adds it as a child to the current parent Node
 // Opens the new Node
 func (p *Parser) NewTextNode(cd *token.CharData) error {
-	p.parent.AddChildren(NewTextNode(cd))
-	p.parent.Children[len(p.parent.Children)-1].Parent = p.parent
+	parent, err := p.current("add text")
+	if err != nil {
+		return err
+	}
+
+	p.nodes++
+	node := NewTextNode(cd)
+	node.Parent = parent
+	parent.AddChildren(node)
 	return nil
 }
 
 // NewCommentNode creates a new Node with Text as Comment, based on CharData and adds it as a child to the current parent Node
 // Opens the new Node
 func (p *Parser) NewCommentNode(cd *token.CharData) error {
-	p.parent.AddChildren(NewCommentNode(cd))
-	p.parent.Children[len(p.parent.Children)-1].Parent = p.parent
+	parent, err := p.current("add comment")
+	if err != nil {
+		return err
+	}
+
+	p.nodes++
+	node := NewCommentNode(cd)
+	node.Parent = parent
+	parent.AddChildren(node)
 	return nil
 }
 
 // SetBlockType sets the current parent Nodes BlockType
 func (p *Parser) SetBlockType(b BlockType) error {
-	p.parent.Block(b)
+	parent, err := p.current("set block type")
+	if err != nil {
+		return err
+	}
+
+	parent.Block(b)
 	return nil
 }
 
 // GetRootBlockType returns the root Nodes BlockType
 func (p *Parser) GetRootBlockType() (BlockType, error) {
+	if p.root == nil {
+		return BlockNone, p.stateError("cannot get block type: no root element")
+	}
+
 	return p.root.BlockType, nil
 }
 
 // GetBlockType returns the block type of the current parent node
 func (p *Parser) GetBlockType() (BlockType, error) {
-	return p.parent.BlockType, nil
+	parent, err := p.current("get block type")
+	if err != nil {
+		return BlockNone, err
+	}
+
+	return parent.BlockType, nil
 }
 
 // GetForwardingLength returns the length of the List of forwaring Nodes
@@ -297,12 +836,58 @@ func (p *Parser) GetForwardingAttributesLength() (int, error) {
 // GetForwardingPosition retrieves a forwarded Node based on given Index and
 // returns the Rangespan the Token corresponding to said Node had in the input tadl text
 func (p *Parser) GetForwardingPosition(i int) (token.Node, error) {
+	if p.rootForward == nil || i < 0 || i >= len(p.rootForward.Children) {
+		return nil, p.stateError(fmt.Sprintf("no forwarded element at index %d", i))
+	}
+
 	return p.rootForward.Children[i].Range, nil
 }
 
+// GetForwardingName retrieves a forwarded Node based on given Index and
+// returns its name, which is empty if the Node is text
+func (p *Parser) GetForwardingName(i int) (string, error) {
+	if p.rootForward == nil || i < 0 || i >= len(p.rootForward.Children) {
+		return "", p.stateError(fmt.Sprintf("no forwarded element at index %d", i))
+	}
+
+	return p.rootForward.Children[i].Name, nil
+}
+
 // AddAttribute adds a given Attribute to the current parent Node
 func (p *Parser) AddAttribute(key, value string) error {
-	p.parent.Attributes.Set(&key, &value)
+	parent, err := p.current("add attribute " + key)
+	if err != nil {
+		return err
+	}
+
+	attribute, err := p.attribute(key, value)
+	if err != nil {
+		return err
+	}
+
+	parent.Attributes.push(attribute)
+	return nil
+}
+
+// AddLabel adds a label to the current parent Node
+func (p *Parser) AddLabel(label string) error {
+	parent, err := p.current("add label")
+	if err != nil {
+		return err
+	}
+
+	parent.Labels = append(parent.Labels, label)
+	return nil
+}
+
+// AddMetadata adds an attribute of the G2 preamble to the metadata of the document
+func (p *Parser) AddMetadata(key, value string) error {
+	attribute, err := p.attribute(key, value)
+	if err != nil {
+		return err
+	}
+
+	p.metadata.push(attribute)
 	return nil
 }
 
@@ -311,7 +896,12 @@ func (p *Parser) AddAttributeForward(key, value string) error {
 	if p.forwardingAttributes == nil {
 		p.forwardingAttributes = &AttributeList{}
 	}
-	p.forwardingAttributes.Push(&key, &value)
+	attribute, err := p.attribute(key, value)
+	if err != nil {
+		return err
+	}
+
+	p.forwardingAttributes.push(attribute)
 	return nil
 }
 
@@ -322,6 +912,10 @@ func (p *Parser) AddNodeForward(name string) error {
 		return err
 	}
 
+	if p.root == nil {
+		return p.stateError("cannot forward element " + name + ": no forwarding tree")
+	}
+
 	p.parent = p.root
 	err = p.NewNode(name)
 	if err != nil {
@@ -338,7 +932,12 @@ func (p *Parser) AddNodeForward(name string) error {
 // MergeAttributes merges the list of forwarded Attributes to the current parent Nodes Attributes
 func (p *Parser) MergeAttributes() error {
 	if p.forwardingAttributes != nil && p.forwardingAttributes.Len() > 0 {
-		p.parent.Attributes = p.parent.Attributes.Merge(*p.forwardingAttributes)
+		parent, err := p.current("merge attributes")
+		if err != nil {
+			return err
+		}
+
+		parent.Attributes = parent.Attributes.Merge(*p.forwardingAttributes)
 		p.forwardingAttributes = nil
 	}
 	return nil
@@ -351,6 +950,10 @@ func (p *Parser) MergeAttributesForwarded() error {
 		if err != nil {
 			return err
 		}
+		if p.parent == nil {
+			_ = p.SwitchActiveTree()
+			return p.stateError("cannot merge attributes: no forwarded element")
+		}
 		p.parent.Attributes = p.parent.Attributes.Merge(*p.forwardingAttributes)
 		p.forwardingAttributes = nil
 		err = p.SwitchActiveTree()
@@ -366,7 +969,15 @@ func (p *Parser) MergeAttributesForwarded() error {
 // as Children to the current parent Node
 func (p *Parser) MergeNodesForwarded() error {
 	if p.rootForward != nil && p.rootForward.Children != nil && len(p.rootForward.Children) != 0 {
-		p.parent.Children = append(p.parent.Children, p.rootForward.Children...)
+		parent, err := p.current("merge forwarded elements")
+		if err != nil {
+			return err
+		}
+
+		for _, child := range p.rootForward.Children {
+			child.Parent = parent
+		}
+		parent.Children = append(parent.Children, p.rootForward.Children...)
 		p.rootForward.Children = nil
 		p.parentForward = p.rootForward
 	}
@@ -388,6 +999,7 @@ func (p *Parser) G2AppendComments() error {
 // G2AddComments adds a new Comment Node based on given CharData to the g2Comments List,
 // to be added to the tree later
 func (p *Parser) G2AddComments(cd *token.CharData) error {
+	p.nodes++
 	p.g2Comments = append(p.g2Comments, NewCommentNode(cd))
 	return nil
 }
@@ -410,18 +1022,32 @@ func (p *Parser) SwitchActiveTree() error {
 
 // NewStringNode creates a Node with Text and adds it as a child to the current parent Node
 // Opens the new Node, used for testing purposes only
-func (p *Parser) NewStringNode(name string) {
-	p.parent.AddChildren(NewStringNode(name))
-	p.parent.Children[len(p.parent.Children)-1].Parent = p.parent
-	p.open()
+func (p *Parser) NewStringNode(name string) error {
+	parent, err := p.current("add text")
+	if err != nil {
+		return err
+	}
+
+	node := NewStringNode(name)
+	node.Parent = parent
+	parent.AddChildren(node)
+
+	return p.open()
 }
 
 // NewStringCommentNode creates a new Node with Text as Comment, based on string and adds it as a child to the current parent Node
 // Opens the new Node, used for testing purposes only
-func (p *Parser) NewStringCommentNode(text string) {
-	p.parent.AddChildren(NewStringCommentNode(text))
-	p.parent.Children[len(p.parent.Children)-1].Parent = p.parent
-	p.open()
+func (p *Parser) NewStringCommentNode(text string) error {
+	parent, err := p.current("add comment")
+	if err != nil {
+		return err
+	}
+
+	node := NewStringCommentNode(text)
+	node.Parent = parent
+	parent.AddChildren(node)
+
+	return p.open()
 }
 
 // GetGlobalForward returns the global forward flag
@@ -4,10 +4,17 @@
 package parser
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/golangee/tadl/token"
 	"github.com/r3labs/diff/v2"
 )
 
@@ -15,6 +22,7 @@ func TestParser(t *testing.T) {
 	tests := []struct {
 		name    string
 		text    string
+		opts    []Option
 		want    *TreeNode
 		wantErr bool
 	}{
@@ -64,6 +72,37 @@ func TestParser(t *testing.T) {
 				NewNode("F"),
 			),
 		},
+		{
+			name: "G2 island",
+			text: "Some text #!{a, b @k=\"v\" {c \"1\"}} more #p{x}",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewStringNode("Some text "),
+				NewNode("a"),
+				NewNode("b").AddAttribute("k", "v").Block(BlockNormal).AddChildren(
+					NewNode("c").AddChildren(NewStringNode("1")),
+				),
+				NewStringNode("more "),
+				NewNode("p").Block(BlockNormal).AddChildren(NewStringNode("x")),
+			),
+		},
+		{
+			name: "G2 island in element with comments and G1 line",
+			text: "#table{#!{\n\trow(\"a\" \"b\"), // header\n\trow(\"c\" \"d\")\n\t# #note text\n}}\nafter",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("table").Block(BlockNormal).AddChildren(
+					NewNode("row").Block(BlockGroup).AddChildren(NewStringNode("a"), NewStringNode("b")),
+					NewStringCommentNode("header"),
+					NewNode("row").Block(BlockGroup).AddChildren(NewStringNode("c"), NewStringNode("d")),
+					NewNode("note").AddChildren(NewStringNode("text")),
+				),
+				NewStringNode("after"),
+			),
+		},
+		{
+			name:    "G2 island without block",
+			text:    "text #!a",
+			wantErr: true,
+		},
 		{
 			name: "elements with text",
 			text: `#title Hello #subtitle World`,
@@ -247,6 +286,39 @@ func TestParser(t *testing.T) {
 				NewNode("B"),
 			),
 		},
+		{
+			name: "G2 labels",
+			text: `#!{
+						server "web" "eu-west" {
+							port 80
+						},
+						group "a" (x),
+						A "hello" "world"
+					}`,
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("server").AddLabels("web", "eu-west").Block(BlockNormal).AddChildren(
+					NewNode("port").AddChildren(
+						NewNode("80"),
+					),
+				),
+				NewNode("group").AddLabels("a").Block(BlockGroup).AddChildren(
+					NewNode("x"),
+				),
+				NewNode("A").AddChildren(
+					NewStringNode("hello"),
+				),
+				NewStringNode("world"),
+			),
+		},
+		{
+			name: "G2 labels with attributes",
+			text: `#!{
+						server @id="1" "web" {}
+					}`,
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("server").AddAttribute("id", "1").AddLabels("web").Block(BlockNormal),
+			),
+		},
 		{
 			name: "simple attribute G2",
 			text: `#!{
@@ -277,6 +349,95 @@ func TestParser(t *testing.T) {
 				NewNode("E"),
 			),
 		},
+		{
+			name: "nested attributes and blocks G2",
+			text: `#!{
+						outer @level="1" {
+							middle @level="2" (
+								inner @level="3" <
+									leaf @level="4"
+								>,
+								sibling @level="2b"
+							)
+						},
+						after @level="0"
+					}`,
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("outer").AddAttribute("level", "1").Block(BlockNormal).AddChildren(
+					NewNode("middle").AddAttribute("level", "2").Block(BlockGroup).AddChildren(
+						NewNode("inner").AddAttribute("level", "3").Block(BlockGeneric).AddChildren(
+							NewNode("leaf").AddAttribute("level", "4"),
+						),
+						NewNode("sibling").AddAttribute("level", "2b"),
+					),
+				),
+				NewNode("after").AddAttribute("level", "0"),
+			),
+		},
+		{
+			name: "root name",
+			text: "#item",
+			opts: []Option{WithRootName("book")},
+			want: NewNode("book").Block(BlockNormal).AddChildren(
+				NewNode("item"),
+			),
+		},
+		{
+			name: "root name G2",
+			text: "#!{item}",
+			opts: []Option{WithRootName("book")},
+			want: NewNode("book").Block(BlockNormal).AddChildren(
+				NewNode("item"),
+			),
+		},
+		{
+			name: "explicit root",
+			text: "#? the book\n#book @id{1} {\n\t#title{Hello}\n}\n",
+			opts: []Option{WithExplicitRoot()},
+			want: NewNode("book").AddAttribute("id", "1").Block(BlockNormal).AddChildren(
+				NewNode("title").Block(BlockNormal).AddChildren(
+					NewStringNode("Hello"),
+				),
+			),
+		},
+		{
+			name:    "invalid explicit root with siblings",
+			text:    "#book #magazine",
+			opts:    []Option{WithExplicitRoot()},
+			wantErr: true,
+		},
+		{
+			name:    "invalid explicit root with text",
+			text:    "#book{} trailing text",
+			opts:    []Option{WithExplicitRoot()},
+			wantErr: true,
+		},
+		{
+			name:    "invalid explicit root missing",
+			text:    "just text",
+			opts:    []Option{WithExplicitRoot()},
+			wantErr: true,
+		},
+		{
+			name: "preamble attributes are not root attributes G2",
+			text: `#!@version{2} @schema{http://example.com/books}
+					{
+						item @key="value"
+					}`,
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("item").AddAttribute("key", "value"),
+			),
+		},
+		{
+			name:    "invalid forwarded preamble attribute G2",
+			text:    `#!@@version{2} {}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid preamble attribute defined twice G2",
+			text:    `#!@version{2} @version{3} {}`,
+			wantErr: true,
+		},
 		{
 			name:    "invalid lonely attribute G2",
 			text:    `#!{@key="value"}`,
@@ -491,6 +652,33 @@ func TestParser(t *testing.T) {
 			),
 		},
 
+		{
+			name: "g2 comment before end of block",
+			text: "#!{a,\n// comment\n}",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("a"),
+				NewStringCommentNode("comment"),
+			),
+		},
+		{
+			name: "g2 comment before g1 line",
+			text: "#!{\n// comment\n# #a @k{v}\n}",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewStringCommentNode("comment"),
+				NewNode("a").AddAttribute("k", "v"),
+			),
+		},
+		{
+			name: "g2 comma after blocks",
+			text: `#!{a, b {c, d}, e {}, f}`,
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("a"),
+				NewNode("b").Block(BlockNormal).AddChildren(NewNode("c"), NewNode("d")),
+				NewNode("e").Block(BlockNormal),
+				NewNode("f"),
+			),
+		},
+
 		{
 			name: "g2 return arrow",
 			text: `#!{
@@ -617,7 +805,7 @@ func TestParser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			parser := NewParser("parser_test.go", strings.NewReader(tt.text))
+			parser := NewParser("parser_test.go", strings.NewReader(tt.text), tt.opts...)
 			tree, err := parser.Parse()
 
 			if !tt.wantErr && err != nil {
@@ -690,3 +878,1370 @@ func PrettyValue(v interface{}) string {
 
 	return fmt.Sprintf("%#v", v)
 }
+
+func TestParserDeepNesting(t *testing.T) {
+	const depth = 100000
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "G1",
+			text: strings.Repeat("#item{", depth) + strings.Repeat("}", depth),
+		},
+		{
+			name: "G2",
+			text: "#!{" + strings.Repeat("item{", depth) + strings.Repeat("}", depth) + "}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := NewParser("parser_test.go", strings.NewReader(tt.text)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			level := 0
+			for node := tree; len(node.Children) > 0; node = node.Children[0] {
+				level++
+			}
+
+			if level != depth {
+				t.Errorf("expected depth %d, got %d", depth, level)
+			}
+		})
+	}
+}
+
+func BenchmarkParserWideNodes(b *testing.B) {
+	var sb strings.Builder
+
+	sb.WriteString("#!{")
+	for i := 0; i < 1000; i++ {
+		sb.WriteString("row{")
+		for j := 0; j < 50; j++ {
+			sb.WriteString("cell,")
+		}
+		sb.WriteString("}")
+	}
+	sb.WriteString("}")
+
+	text := sb.String()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := NewParser("parser_test.go", strings.NewReader(text)).Parse()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTreeNode_KeyValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		wantKey   string
+		wantValue string
+		wantOk    bool
+	}{
+		{
+			name:      "G1",
+			text:      `#key value #other`,
+			wantKey:   "key",
+			wantValue: "value",
+			wantOk:    true,
+		},
+		{
+			name:      "G1 line",
+			text:      "#!{\n# #key value\n}",
+			wantKey:   "key",
+			wantValue: "value",
+			wantOk:    true,
+		},
+		{
+			name:      "G2",
+			text:      `#!{key "value"}`,
+			wantKey:   "key",
+			wantValue: "value",
+			wantOk:    true,
+		},
+		{
+			name:   "block is not a key/value pair",
+			text:   `#key{value}`,
+			wantOk: false,
+		},
+		{
+			name:   "nested element is not a key/value pair",
+			text:   `#!{key value}`,
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := NewParser("parser_test.go", strings.NewReader(tt.text)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			key, value, ok := tree.Children[0].KeyValue()
+			if ok != tt.wantOk || key != tt.wantKey || value != tt.wantValue {
+				t.Errorf("expected (%q, %q, %v), got (%q, %q, %v)", tt.wantKey, tt.wantValue, tt.wantOk, key, value, ok)
+			}
+		})
+	}
+}
+
+func TestParserRanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		begin, end string
+	}{
+		{
+			name:  "G1",
+			text:  "text\n  #item{hello}",
+			begin: "parser_test.go:2:3",
+			end:   "parser_test.go:2:15",
+		},
+		{
+			name:  "G2",
+			text:  "#!{\n\titem @key=\"value\" {\n\t\tchild\n\t}\n}",
+			begin: "parser_test.go:2:2",
+			end:   "parser_test.go:4:3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := NewParser("parser_test.go", strings.NewReader(tt.text)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var item *TreeNode
+
+			for _, child := range tree.Children {
+				if child.Name == "item" {
+					item = child
+				}
+			}
+
+			if item == nil {
+				t.Fatal("item not found")
+			}
+
+			if got := item.Range.BeginPos.String(); got != tt.begin {
+				t.Errorf("expected begin %s but got %s", tt.begin, got)
+			}
+
+			if got := item.Range.EndPos.String(); got != tt.end {
+				t.Errorf("expected end %s but got %s", tt.end, got)
+			}
+		})
+	}
+}
+
+func TestAttributeRanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		key, value string
+	}{
+		{
+			name:  "G1",
+			text:  "#item @id{1} @key{value}",
+			key:   "parser_test.go:1:15:parser_test.go:1:18",
+			value: "parser_test.go:1:19:parser_test.go:1:24",
+		},
+		{
+			name:  "G1 forwarded",
+			text:  "@@key{value}\n#item",
+			key:   "parser_test.go:1:3:parser_test.go:1:6",
+			value: "parser_test.go:1:7:parser_test.go:1:12",
+		},
+		{
+			name:  "G2",
+			text:  "#!{\n\titem @id=\"1\" @key=\"value\"\n}",
+			key:   "parser_test.go:2:16:parser_test.go:2:19",
+			value: "parser_test.go:2:20:parser_test.go:2:27",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := NewParser("parser_test.go", strings.NewReader(tt.text)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			item := tree.Children[0]
+
+			i := item.Attributes.Index("key")
+			if i < 0 {
+				t.Fatal("attribute not found")
+			}
+
+			key, value := item.Attributes.Range(i)
+			if got := key.BeginPos.String() + ":" + key.EndPos.String(); got != tt.key {
+				t.Errorf("expected key at %s but got %s", tt.key, got)
+			}
+
+			if got := value.BeginPos.String() + ":" + value.EndPos.String(); got != tt.value {
+				t.Errorf("expected value at %s but got %s", tt.value, got)
+			}
+		})
+	}
+}
+
+func TestParserStateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(p *Parser) error
+	}{
+		{"Close", func(p *Parser) error { return p.Close() }},
+		{"NewTextNode", func(p *Parser) error { return p.NewTextNode(&token.CharData{Value: "text"}) }},
+		{"NewCommentNode", func(p *Parser) error { return p.NewCommentNode(&token.CharData{Value: "comment"}) }},
+		{"NewStringNode", func(p *Parser) error { return p.NewStringNode("text") }},
+		{"NewStringCommentNode", func(p *Parser) error { return p.NewStringCommentNode("comment") }},
+		{"SetBlockType", func(p *Parser) error { return p.SetBlockType(BlockNormal) }},
+		{"GetBlockType", func(p *Parser) error { _, err := p.GetBlockType(); return err }},
+		{"GetRootBlockType", func(p *Parser) error { _, err := p.GetRootBlockType(); return err }},
+		{"GetForwardingPosition", func(p *Parser) error { _, err := p.GetForwardingPosition(3); return err }},
+		{"AddAttribute", func(p *Parser) error { return p.AddAttribute("key", "value") }},
+		{"AddLabel", func(p *Parser) error { return p.AddLabel("label") }},
+		{"MergeAttributes", func(p *Parser) error {
+			if err := p.AddAttributeForward("key", "value"); err != nil {
+				return err
+			}
+			return p.MergeAttributes()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewParser("parser_test.go", strings.NewReader(""))
+
+			err := tt.call(p)
+			if err == nil {
+				t.Fatal("expected an error but got none")
+			}
+
+			var posErr *token.PosError
+			if !errors.As(err, &posErr) {
+				t.Errorf("expected a positioned error but got %v", err)
+			}
+		})
+	}
+}
+
+func TestCallbackPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"progress", WithProgress(1, func(Progress) { panic("progress") })},
+		{"attribute validator", WithAttributeValidator("k", func(string) error { panic("attribute validator") })},
+		{"auto close", WithAutoClose(func(error) { panic("auto close") })},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != tt.name {
+					t.Errorf("expected the panic of the callback but got %v", r)
+				}
+			}()
+
+			_, err := NewParser("parser_test.go", strings.NewReader("#!{a @k=\"v\" {"), tt.opt).Parse()
+			t.Errorf("expected a panic but got error %v", err)
+		})
+	}
+}
+
+func TestAttributeValidator(t *testing.T) {
+	errPort := errors.New("not a port")
+
+	validPort := func(value string) error {
+		if _, err := strconv.ParseUint(value, 10, 16); err != nil {
+			return errPort
+		}
+
+		return nil
+	}
+
+	tests := []struct {
+		name string
+		text string
+		// pos is the position of the error, or empty if the text is valid.
+		pos string
+	}{
+		{
+			name: "valid",
+			text: "#!@port{80} {server @port=\"8080\", client @host=\"x\"}",
+		},
+		{
+			name: "G1",
+			text: "#server @port{http}",
+			pos:  "parser_test.go:1:15",
+		},
+		{
+			name: "G1 forwarded",
+			text: "@@port{-1}\n#server",
+			pos:  "parser_test.go:1:8",
+		},
+		{
+			name: "G2",
+			text: "#!{\n\tserver @port=\"99999\"\n}",
+			pos:  "parser_test.go:2:15",
+		},
+		{
+			name: "metadata",
+			text: "#!@port{x} {}",
+			pos:  "parser_test.go:1:9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser("parser_test.go", strings.NewReader(tt.text),
+				WithAttributeValidator("port", validPort)).Parse()
+
+			if tt.pos == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, errPort) {
+				t.Fatalf("expected error of validator but got %v", err)
+			}
+
+			var posErr *token.PosError
+			if !errors.As(err, &posErr) {
+				t.Fatalf("expected PosError but got %T", err)
+			}
+
+			if got := posErr.Details[0].Node.Begin().String(); got != tt.pos {
+				t.Errorf("expected error at %s but got %s", tt.pos, got)
+			}
+		})
+	}
+}
+
+func TestForwardingAtEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want *TreeNode
+		// wantErr are the positions of all forwarded nodes that are reported.
+		wantErr []string
+	}{
+		{
+			name: "G1",
+			text: "#a{}\n##b ##c\n  ##d",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("a").Block(BlockNormal),
+				NewNode("trailing").AddChildren(
+					NewNode("b"),
+					NewNode("c"),
+					NewNode("d"),
+				),
+			),
+			wantErr: []string{"parser_test.go:2:1", "parser_test.go:2:5", "parser_test.go:3:3"},
+		},
+		{
+			name: "G1 single",
+			text: "##x",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("trailing").AddChildren(
+					NewNode("x"),
+				),
+			),
+			wantErr: []string{"parser_test.go:1:1"},
+		},
+		{
+			name: "G2",
+			text: "#!{\n\ta,\n\t## text #b\n}",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("a"),
+				NewNode("trailing").AddChildren(
+					NewStringNode("text "),
+					NewNode("b"),
+				),
+			),
+			wantErr: []string{"parser_test.go:3:5", "parser_test.go:3:10"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser("parser_test.go", strings.NewReader(tt.text)).Parse()
+
+			var posErr *token.PosError
+			if !errors.As(err, &posErr) {
+				t.Fatalf("expected PosError but got %v", err)
+			}
+
+			var got []string
+			for _, detail := range posErr.Details {
+				got = append(got, detail.Node.Begin().String())
+			}
+
+			if !slices.Equal(got, tt.wantErr) {
+				t.Errorf("expected errors at %v but got %v", tt.wantErr, got)
+			}
+
+			tree, err := NewParser("parser_test.go", strings.NewReader(tt.text),
+				WithTrailingForward("trailing")).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if trailing := tree.Children[len(tree.Children)-1]; !trailing.IsSynthetic() {
+				t.Errorf("expected %s to be synthetic", trailing.Name)
+			}
+
+			differences, err := diff.Diff(tt.want, tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, d := range differences {
+				nicePath := strings.Join(d.Path, ".")
+				if strings.Contains(nicePath, "Range.") {
+					continue
+				}
+
+				t.Errorf("property '%s' differs, expected %s but got %s", nicePath, PrettyValue(d.From), PrettyValue(d.To))
+			}
+		})
+	}
+}
+
+func TestStrictNames(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// wantErr are the messages of all reported elements.
+		wantErr []string
+	}{
+		{
+			name: "valid",
+			text: "#!{server, server, client {server}}",
+		},
+		{
+			name: "case collision",
+			text: "#!{server,\nServer,\nSERVER}",
+			wantErr: []string{
+				"'Server' collides with 'server' at parser_test.go:1:4",
+				"'SERVER' collides with 'server' at parser_test.go:1:4",
+			},
+		},
+		{
+			name:    "nested collision",
+			text:    "#!{a {b, B}, c {b, B}}",
+			wantErr: []string{"'B' collides with 'b' at parser_test.go:1:7", "'B' collides with 'b' at parser_test.go:1:17"},
+		},
+		{
+			name:    "root",
+			text:    "#a {#Root}",
+			wantErr: []string{"'Root' shadows the reserved name 'root'"},
+		},
+		{
+			name:    "reserved",
+			text:    "#!{server {include \"other.tadl\"}}",
+			wantErr: []string{"'include' shadows the reserved name 'include'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser("parser_test.go", strings.NewReader(tt.text),
+				WithStrictNames("include")).Parse()
+
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			var posErr *token.PosError
+			if !errors.As(err, &posErr) {
+				t.Fatalf("expected PosError but got %v", err)
+			}
+
+			var got []string
+			for _, detail := range posErr.Details {
+				got = append(got, detail.Message)
+			}
+
+			if !slices.Equal(got, tt.wantErr) {
+				t.Errorf("expected %q but got %q", tt.wantErr, got)
+			}
+		})
+	}
+}
+
+func TestRootBlocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    BlockType
+		wantErr string
+	}{
+		{
+			name: "curly brackets",
+			text: "#!{a, b}",
+			want: BlockNormal,
+		},
+		{
+			name: "group",
+			text: "#!(a, b)",
+			want: BlockGroup,
+		},
+		{
+			name:    "generic",
+			text:    "#!<a, b>",
+			wantErr: "root element must have curly brackets",
+		},
+		{
+			name: "no brackets",
+			text: "#!server {a, b}\n",
+			want: BlockNone,
+		},
+		{
+			name:    "no brackets with siblings",
+			text:    "#!server {a}, client {b}",
+			wantErr: "a root element without brackets must consist of a single element",
+		},
+		{
+			name: "G1",
+			text: "#server",
+			want: BlockNormal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := NewParser("parser_test.go", strings.NewReader(tt.text),
+				WithRootBlocks(BlockGroup, BlockNone)).Parse()
+
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q but got %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tree.BlockType != tt.want {
+				t.Errorf("expected root with %q but got %q", tt.want, tree.BlockType)
+			}
+		})
+	}
+
+	if _, err := NewParser("parser_test.go", strings.NewReader("#!(a, b)")).Parse(); err == nil {
+		t.Error("expected root with group brackets to be invalid by default")
+	}
+}
+
+func TestParserDebug(t *testing.T) {
+	tests := []string{
+		"text #item{hello} more",
+		"##subA @@key{value} ##subB @@another_key{more_value} #item",
+		"#!{\n\t// comment\n\tserver \"web\" {\n\t\tport 80\n\t},\n\tgroup (x, y)\n}",
+	}
+
+	for _, text := range tests {
+		t.Run(text, func(t *testing.T) {
+			_, err := NewParser("parser_test.go", strings.NewReader(text), WithDebug()).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		want     token.GrammarMode
+		preamble string
+	}{
+		{
+			name: "G1",
+			text: "#item{hello}",
+			want: token.G1,
+		},
+		{
+			name:     "G2",
+			text:     "#!{item}",
+			want:     token.G2,
+			preamble: "parser_test.go:1:1",
+		},
+		{
+			name:     "G2 with G1 line",
+			text:     "#!{\n# #key value\n}",
+			want:     token.G2,
+			preamble: "parser_test.go:1:1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := NewParser("parser_test.go", strings.NewReader(tt.text)).ParseDocument()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if doc.Root == nil || doc.Root.Name != "root" {
+				t.Fatalf("expected root element but got %v", doc.Root)
+			}
+
+			if got := doc.Grammar(); got != tt.want {
+				t.Errorf("expected grammar %v but got %v", tt.want, got)
+			}
+
+			pos, ok := doc.Preamble()
+			if ok != (tt.preamble != "") {
+				t.Fatalf("expected preamble %v but got %v", tt.preamble != "", ok)
+			}
+
+			if ok && pos.BeginPos.String() != tt.preamble {
+				t.Errorf("expected preamble at %s but got %s", tt.preamble, pos.BeginPos)
+			}
+		})
+	}
+}
+
+func TestParseDocumentMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "G1",
+			text: "#item @key{value}",
+		},
+		{
+			name: "G2 without metadata",
+			text: "#!{item}",
+		},
+		{
+			name: "G2 with metadata",
+			text: "#!@version{2} @schema{http://example.com/books} {item @key=\"value\"}",
+			want: []string{"version", "2", "schema", "http://example.com/books"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := NewParser("parser_test.go", strings.NewReader(tt.text)).ParseDocument()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for i := 0; i < doc.Metadata.Len(); i++ {
+				key, value := doc.Metadata.Get(i)
+				got = append(got, *key, *value)
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("expected metadata %v but got %v", tt.want, got)
+			}
+
+			if doc.Root.Attributes.Len() != 0 {
+				t.Errorf("expected no root attributes but got %d", doc.Root.Attributes.Len())
+			}
+		})
+	}
+}
+
+func TestParseFragment(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []*TreeNode
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			text: "",
+		},
+		{
+			name: "G1",
+			text: "#title Hello #p{World}",
+			want: []*TreeNode{
+				NewNode("title").AddChildren(
+					NewStringNode("Hello "),
+				),
+				NewNode("p").Block(BlockNormal).AddChildren(
+					NewStringNode("World"),
+				),
+			},
+		},
+		{
+			name: "G2",
+			text: "#!{a, b @key=\"value\"}",
+			want: []*TreeNode{
+				NewNode("a"),
+				NewNode("b").AddAttribute("key", "value"),
+			},
+		},
+		{
+			name: "G2 group brackets",
+			text: "#!(a {c}, b)",
+			want: []*TreeNode{
+				NewNode("a").Block(BlockNormal).AddChildren(
+					NewNode("c"),
+				),
+				NewNode("b"),
+			},
+		},
+		{
+			name:    "invalid unclosed",
+			text:    "#!(a {c}, b",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFragment(strings.NewReader(tt.text))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, but did not get one")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			differences, err := diff.Diff(tt.want, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, d := range differences {
+				nicePath := strings.Join(d.Path, ".")
+				if strings.Contains(nicePath, "Range.") {
+					continue
+				}
+
+				t.Errorf("property '%s' differs, expected %s but got %s", nicePath, PrettyValue(d.From), PrettyValue(d.To))
+			}
+
+			for _, node := range got {
+				if node.Parent != nil {
+					t.Errorf("expected %s to have no parent", node.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []*TreeNode
+		wantErr string
+	}{
+		{
+			name: "text",
+			text: "hello world",
+			want: []*TreeNode{NewStringNode("hello world")},
+		},
+		{
+			name: "elements",
+			text: "deploy #service{api} to #env prod\r\n",
+			want: []*TreeNode{
+				NewStringNode("deploy "),
+				NewNode("service").Block(BlockNormal).AddChildren(NewStringNode("api")),
+				NewStringNode("to "),
+				NewNode("env").AddChildren(NewStringNode("prod")),
+			},
+		},
+		{
+			name:    "line ending",
+			text:    "first\nsecond",
+			wantErr: "a G1 line must not contain a line ending at 1:6",
+		},
+		{
+			name:    "preamble",
+			text:    "#!{a}",
+			wantErr: "a G1 line must not start with the G2 preamble at 1:1",
+		},
+		{
+			name:    "unclosed block",
+			text:    "#service{api",
+			wantErr: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.text)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatal("expected error, but did not get one")
+				}
+
+				var posErr *token.PosError
+				if tt.wantErr != "" && errors.As(err, &posErr) {
+					begin := posErr.Details[0].Node.Begin()
+					err = fmt.Errorf("%w at %d:%d", err, begin.Line, begin.Col)
+				}
+
+				if tt.wantErr != "" && err.Error() != tt.wantErr {
+					t.Errorf("expected error '%s' but got '%v'", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			differences, err := diff.Diff(tt.want, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, d := range differences {
+				nicePath := strings.Join(d.Path, ".")
+				if strings.Contains(nicePath, "Range.") {
+					continue
+				}
+
+				t.Errorf("property '%s' differs, expected %s but got %s", nicePath, PrettyValue(d.From), PrettyValue(d.To))
+			}
+		})
+	}
+}
+
+func TestInsertFragment(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		fragment string
+		want     *TreeNode
+		wantErr  bool
+	}{
+		{
+			name:     "into root",
+			path:     "/root",
+			fragment: "#!{c}",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("a").Block(BlockNormal).AddChildren(
+					NewNode("b"),
+				),
+				NewNode("a").Block(BlockNormal),
+				NewNode("c"),
+			),
+		},
+		{
+			name:     "into indexed element",
+			path:     "root/a[1]",
+			fragment: "#!{x, y @key=\"value\"}",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("a").Block(BlockNormal).AddChildren(
+					NewNode("b"),
+				),
+				NewNode("a").Block(BlockNormal).AddChildren(
+					NewNode("x"),
+					NewNode("y").AddAttribute("key", "value"),
+				),
+			),
+		},
+		{
+			name:     "into element without brackets",
+			path:     "/root/a/b",
+			fragment: "x, y",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("a").Block(BlockNormal).AddChildren(
+					NewNode("b").Block(BlockNormal).AddChildren(
+						NewNode("x"),
+						NewNode("y"),
+					),
+				),
+				NewNode("a").Block(BlockNormal),
+			),
+		},
+		{
+			name:     "invalid path",
+			path:     "/root/a[2]",
+			fragment: "#x",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid root",
+			path:     "/document",
+			fragment: "#x",
+			wantErr:  true,
+		},
+		{
+			name:     "without preamble in grammar of document",
+			path:     "/root",
+			fragment: `c @id="3" {d "80"} // comment`,
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("a").Block(BlockNormal).AddChildren(
+					NewNode("b"),
+				),
+				NewNode("a").Block(BlockNormal),
+				NewNode("c").AddAttribute("id", "3").Block(BlockNormal).AddChildren(
+					NewNode("d").AddChildren(NewStringNode("80")),
+				),
+				NewStringCommentNode("comment"),
+			),
+		},
+		{
+			name:     "invalid fragment",
+			path:     "/root",
+			fragment: "#!{x",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := NewParser("parser_test.go", strings.NewReader("#!{a {b}, a {}}")).ParseDocument()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = InsertFragment(doc, tt.path, tt.fragment)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, but did not get one")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			unbindParents(doc.Root)
+
+			differences, err := diff.Diff(tt.want, doc.Root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, d := range differences {
+				nicePath := strings.Join(d.Path, ".")
+				if strings.Contains(nicePath, "Range.") {
+					continue
+				}
+
+				t.Errorf("property '%s' differs, expected %s but got %s", nicePath, PrettyValue(d.From), PrettyValue(d.To))
+			}
+		})
+	}
+
+	// Fragments of G1 documents are G1 as well.
+	doc, err := NewParser("parser_test.go", strings.NewReader("#a")).ParseDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InsertFragment(doc, "/root/a", "#!{b}"); err == nil {
+		t.Error("expected error for a G2 fragment in a G1 document")
+	}
+
+	if err := InsertFragment(doc, "/root/a", "#b"); err != nil || len(doc.Root.Children[0].Children) != 1 {
+		t.Errorf("expected G1 fragment to be inserted but got %v", err)
+	}
+}
+
+func TestParserSynthetic(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		begin string
+	}{
+		{
+			name:  "G1 root is generated by the document",
+			text:  "\n#item",
+			begin: "parser_test.go:1:1",
+		},
+		{
+			name:  "G2 root is generated by the preamble",
+			text:  "#!{\n\titem\n}",
+			begin: "parser_test.go:1:1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := NewParser("parser_test.go", strings.NewReader(tt.text)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tree.IsSynthetic() {
+				t.Error("expected root to be synthetic")
+			}
+
+			if got := tree.Range.BeginPos.String(); got != tt.begin {
+				t.Errorf("expected root to begin at %s but got %s", tt.begin, got)
+			}
+
+			for _, child := range tree.Children {
+				if child.IsSynthetic() {
+					t.Errorf("expected %s not to be synthetic", child.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestTreeIterators(t *testing.T) {
+	tree := NewNode("root").AddChildren(
+		NewNode("server").AddChildren(
+			NewStringNode("web"),
+			NewNode("server").AddChildren(NewStringNode("nested")),
+		),
+		NewStringCommentNode("note"),
+		NewNode("db"),
+		NewNode("server"),
+	)
+
+	var all []string
+
+	for node := range tree.All() {
+		switch {
+		case node.IsText():
+			all = append(all, "text:"+*node.Text)
+		case node.IsComment():
+			all = append(all, "comment:"+*node.Comment)
+		default:
+			all = append(all, node.Name)
+		}
+	}
+
+	want := []string{"root", "server", "text:web", "server", "text:nested", "comment:note", "db", "server"}
+	if fmt.Sprint(all) != fmt.Sprint(want) {
+		t.Errorf("expected %v but got %v", want, all)
+	}
+
+	var servers []*TreeNode
+	for node := range tree.Descendants("server") {
+		servers = append(servers, node)
+	}
+
+	if len(servers) != 3 || servers[0] != tree.Children[0] || servers[1] != tree.Children[0].Children[1] ||
+		servers[2] != tree.Children[3] {
+		t.Errorf("unexpected servers %v", servers)
+	}
+
+	if count := len(slices.Collect(tree.Children[0].Descendants("server"))); count != 1 {
+		t.Errorf("expected 1 nested server but got %d", count)
+	}
+
+	// Stopping early must not visit further nodes.
+	for node := range tree.Descendants("server") {
+		if node != tree.Children[0] {
+			t.Errorf("iteration continued after break")
+		}
+
+		break
+	}
+}
+
+func TestAutoClose(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want *TreeNode
+		// wantWarn are the positions of the opening brackets, which are reported.
+		wantWarn []string
+	}{
+		{
+			name: "G2",
+			text: "#!{\n\tserver {\n\t\tports (80, 443",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("server").Block(BlockNormal).AddChildren(
+					NewNode("ports").Block(BlockGroup).AddChildren(
+						NewNode("80"),
+						NewNode("443"),
+					),
+				),
+			),
+			wantWarn: []string{"parser_test.go:3:9", "parser_test.go:2:9", "parser_test.go:1:3"},
+		},
+		{
+			name: "G1",
+			text: "#a{ text #b{x",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("a").Block(BlockNormal).AddChildren(
+					NewStringNode("text "),
+					NewNode("b").Block(BlockNormal).AddChildren(
+						NewStringNode("x"),
+					),
+				),
+			),
+			wantWarn: []string{"parser_test.go:1:12", "parser_test.go:1:3"},
+		},
+		{
+			name: "G2 island",
+			text: "#a{ #!{b {c",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("a").Block(BlockNormal).AddChildren(
+					NewNode("b").Block(BlockNormal).AddChildren(
+						NewNode("c"),
+					),
+				),
+			),
+			wantWarn: []string{"parser_test.go:1:10", "parser_test.go:1:7", "parser_test.go:1:3"},
+		},
+		{
+			name: "complete",
+			text: "#!{a {b}}",
+			want: NewNode("root").Block(BlockNormal).AddChildren(
+				NewNode("a").Block(BlockNormal).AddChildren(
+					NewNode("b"),
+				),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantWarn != nil {
+				if _, err := NewParser("parser_test.go", strings.NewReader(tt.text)).Parse(); err == nil {
+					t.Fatal("expected error without WithAutoClose")
+				}
+			}
+
+			var got []string
+
+			tree, err := NewParser("parser_test.go", strings.NewReader(tt.text), WithAutoClose(func(err error) {
+				var posErr *token.PosError
+				if !errors.As(err, &posErr) {
+					t.Fatalf("expected PosError but got %v", err)
+				}
+
+				for _, detail := range posErr.Details[1:] {
+					got = append(got, detail.Node.Begin().String())
+				}
+			})).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(got, tt.wantWarn) {
+				t.Errorf("expected warning about %v but got %v", tt.wantWarn, got)
+			}
+
+			differences, err := diff.Diff(tt.want, tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, d := range differences {
+				nicePath := strings.Join(d.Path, ".")
+				if strings.Contains(nicePath, "Range.") {
+					continue
+				}
+
+				t.Errorf("property '%s' differs, expected %s but got %s", nicePath, PrettyValue(d.From), PrettyValue(d.To))
+			}
+		})
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var text strings.Builder
+
+	text.WriteString("#!{\n")
+
+	for i := 0; i < 100; i++ {
+		text.WriteString("\tserver @id=\"" + strconv.Itoa(i) + "\" {port 80} // comment\n")
+	}
+
+	text.WriteString("}")
+
+	var calls []Progress
+
+	parser := NewParser("parser_test.go", strings.NewReader(text.String()), WithProgress(1000, func(p Progress) {
+		calls = append(calls, p)
+	}))
+
+	if _, err := parser.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Roughly one call per 1000 bytes and the final one.
+	if want := text.Len()/1000 + 1; len(calls) != want {
+		t.Fatalf("expected %d calls but got %d: %+v", want, len(calls), calls)
+	}
+
+	for i, p := range calls[:len(calls)-1] {
+		if p.Bytes < int64((i+1)*1000) || p.Bytes >= int64((i+2)*1000) {
+			t.Errorf("expected call %d after %d bytes but got %+v", i, (i+1)*1000, p)
+		}
+
+		if p.Tokens == 0 || p.Nodes == 0 {
+			t.Errorf("expected tokens and nodes to be counted but got %+v", p)
+		}
+	}
+
+	// The root, 100 servers with a port element, which contains the element "80", and 100 comments.
+	last := calls[len(calls)-1]
+	if last.Bytes != int64(text.Len()) || last.Nodes != 401 {
+		t.Errorf("expected %d bytes and 401 nodes at the end but got %+v", text.Len(), last)
+	}
+}
+
+func TestParsePool(t *testing.T) {
+	pool := NewParsePool(2, WithRootName("doc"))
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, 20)
+	)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			// Alternate grammars and invalid input, so that reused lexers start from a clean state.
+			text := "#!{server @id=\"" + strconv.Itoa(i) + "\" {port 80}}"
+			if i%2 == 0 {
+				text = "#server @id{" + strconv.Itoa(i) + "} #port{80}"
+			}
+
+			if i%5 == 0 {
+				text = "#!{a\x00}"
+			}
+
+			tree, err := pool.Parse(context.Background(), "pool.tadl", strings.NewReader(text))
+
+			switch {
+			case i%5 == 0:
+				if err == nil {
+					errs <- fmt.Errorf("%d: expected an error", i)
+				}
+			case err != nil:
+				errs <- fmt.Errorf("%d: %w", i, err)
+			case tree.Name != "doc":
+				errs <- fmt.Errorf("%d: expected root 'doc' but got '%s'", i, tree.Name)
+			default:
+				server := tree.Children[0]
+				if id, _ := server.Attributes.Get(server.Attributes.Index("id")); id == nil {
+					errs <- fmt.Errorf("%d: expected attribute 'id' in '%s'", i, server.Name)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := pool.Parse(ctx, "pool.tadl", strings.NewReader("#a")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled but got %v", err)
+	}
+
+	// The context is canceled, while the input is read.
+	ctx, cancel = context.WithCancel(context.Background())
+	r := io.MultiReader(strings.NewReader("#a{b #c{"), cancelReader(cancel), strings.NewReader("d}}"))
+
+	if _, err := pool.Parse(ctx, "pool.tadl", r); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled but got %v", err)
+	}
+}
+
+// cancelReader calls itself on its first read and then reports EOF.
+type cancelReader func()
+
+func (c cancelReader) Read([]byte) (int, error) {
+	c()
+
+	return 0, io.EOF
+}
+
+func TestAnnotations(t *testing.T) {
+	tree, err := NewParser("annotations.tadl", strings.NewReader(`#!{port "80"}`)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := tree.Children[0]
+	if port.Annotations != nil {
+		t.Errorf("expected no annotations but got %v", port.Annotations)
+	}
+
+	if _, ok := port.Annotation("type"); ok {
+		t.Error("expected missing annotation")
+	}
+
+	port.Annotate("type", "uint16").Annotate("value", 80)
+
+	if value, ok := port.Annotation("type"); !ok || value != "uint16" {
+		t.Errorf("expected type annotation but got %v", value)
+	}
+
+	if len(port.Annotations) != 2 || port.Annotations["value"] != 80 {
+		t.Errorf("unexpected annotations %v", port.Annotations)
+	}
+}
+
+func TestMaxTokens(t *testing.T) {
+	inputs := []string{
+		`#!@version{1} {server @port="80" "web" {name "a", hosts {"x" "y"}} // comment
+		list<int>, f(a b)}`,
+		`#book @id{1} {#title Hello #? comment
+		#p{World @x{y}} ##forward #a{b} }`,
+		"#!{a\n# #port @number{80}\nb}",
+	}
+
+	for _, input := range inputs {
+		_, err := NewParser("max.tadl", strings.NewReader(input)).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Every limit below the number of tokens fails at the token, which exceeds it.
+		for max := 1; ; max++ {
+			_, err := NewParser("max.tadl", strings.NewReader(input), WithMaxTokens(max)).Parse()
+			if err == nil {
+				break
+			}
+
+			if !errors.Is(err, ErrTooManyTokens) {
+				t.Fatalf("expected ErrTooManyTokens for %d tokens of %q but got %v", max, input, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package parser
+
+import (
+	"context"
+	"io"
+
+	"github.com/golangee/tadl/token"
+)
+
+// ParsePool parses documents with a bounded number of parsers at the same time, like the requests of
+// an HTTP server. The lexers of finished parses, and with them their buffers, are reused for the next
+// ones. A ParsePool is safe for concurrent use by multiple goroutines.
+//
+//  pool := parser.NewParsePool(runtime.NumCPU())
+//
+//  http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+//      tree, err := pool.Parse(r.Context(), "request", r.Body)
+//      ...
+//  })
+type ParsePool struct {
+	opts []Option
+	// lexers holds a slot for each parser, which may run at the same time. A slot
+	// is nil, until a lexer has been created for it.
+	lexers chan *token.Lexer
+}
+
+// NewParsePool creates a pool, which runs up to size parsers at the same time. The options are
+// applied to each parser, so that callbacks, like the one of WithProgress, must be safe for
+// concurrent use.
+func NewParsePool(size int, opts ...Option) *ParsePool {
+	if size < 1 {
+		size = 1
+	}
+
+	pool := &ParsePool{
+		opts:   opts,
+		lexers: make(chan *token.Lexer, size),
+	}
+
+	for i := 0; i < size; i++ {
+		pool.lexers <- nil
+	}
+
+	return pool
+}
+
+// Parse parses r like Parser.Parse. It waits for a free parser, if all of them are busy.
+// If ctx is done before, or while r is read, its error is returned.
+func (p *ParsePool) Parse(ctx context.Context, filename string, r io.Reader) (*TreeNode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var lexer *token.Lexer
+
+	select {
+	case lexer = <-p.lexers:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	parser := newParser(lexer, filename, contextReader{ctx: ctx, r: r}, p.opts...)
+
+	defer func() {
+		// Do not keep the input alive, until the lexer is used again.
+		parser.visitor.lexer.Reset("", nil)
+		p.lexers <- parser.visitor.lexer
+	}()
+
+	return parser.Parse()
+}
+
+// contextReader reads from r, until ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.r.Read(p)
+}
@@ -2,7 +2,10 @@ package parser
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"slices"
+	"strings"
 
 	"github.com/golangee/tadl/token"
 )
@@ -22,7 +25,8 @@ type Visitable interface {
 	NewCommentNode(cd *token.CharData) error
 
 	// SetBlockType is called when a certain type of brackets is encountered,
-	// represented by the BlockType field.
+	// represented by the BlockType field. It applies to the currently watched Node,
+	// which is the innermost Node that was created by NewNode and not yet closed.
 	SetBlockType(t BlockType) error
 
 	// GetRootBlockType returns the root nodes BlockType
@@ -35,11 +39,18 @@ type Visitable interface {
 	GetForwardingAttributesLength() (int, error)
 
 	// Called when encountering a non-forwarded Attribute.
-	// Adds the attribute to the currently watched Node.
+	// Adds the attribute to the currently watched Node, never to the root,
+	// unless the root is the Node under construction.
 	AddAttribute(key, value string) error
 	// Called when encountering a forwarded Attribute.
 	// Adds the attribute to the List of forwarded Attributes.
 	AddAttributeForward(key, value string) error
+	// Called when encountering an attribute of the G2 preamble, like "@version{2}" in "#!@version{2} {...}".
+	// These describe the document and do not belong to any Node.
+	AddMetadata(key, value string) error
+	// Called when encountering a label of a G2 element, which are the strings
+	// between the name and the block. Adds the label to the currently watched Node.
+	AddLabel(label string) error
 	// Adds all forward attributes to the currently watched Node.
 	MergeAttributes() error
 	// Adds all forward attributes to the latest forwarded Node.
@@ -67,6 +78,15 @@ type Visitable interface {
 	GetGlobalForward() (bool, error)
 }
 
+// forwardingLister is implemented by Visitables that keep their forwarding Nodes, like the Parser.
+// It allows to report every forwarding Node that is left at the end of the input.
+type forwardingLister interface {
+	// returns the Rangespan of the forwarding Node at the given index
+	GetForwardingPosition(i int) (token.Node, error)
+	// returns the name of the forwarding Node at the given index, or "" if it is no element
+	GetForwardingName(i int) (string, error)
+}
+
 // Visitor defines a visitor traversing a Syntaxtree based on Lexer output.
 // Visitor calls the Methods defined in the Visitable interface to allow the
 // overlying class to work with the tree.
@@ -75,6 +95,33 @@ type Visitor struct {
 
 	lexer *token.Lexer
 	mode  token.GrammarMode
+	// rootName is the name of the synthetic root element.
+	rootName string
+	// fragment allows the root element to have any kind of brackets, see SetFragment.
+	fragment bool
+	// rootBlocks are the brackets the root of G2 may have besides curly brackets, see SetRootBlocks.
+	rootBlocks []BlockType
+	// trailingForward is the name of the element that takes the forwarding nodes
+	// left at the end of the input, see SetTrailingForward.
+	trailingForward string
+	// autoClose inserts the closing brackets of open blocks at the end of the input, see SetAutoClose.
+	// openBlocks are the opening brackets consumed so far, which are not yet closed, and autoClosed
+	// are the ones closed at the end of the input, once atEnd is true.
+	autoClose, atEnd bool
+	openBlocks       []token.Token
+	autoClosed       []token.Token
+	// progress is called whenever progressEvery more bytes have been lexed, see SetProgress.
+	// tokens counts the tokens read from the lexer and progressNext is the offset of the next call.
+	progress      func(bytes int64, tokens int)
+	progressEvery int64
+	progressNext  int64
+	tokens        int
+	// maxTokens is the maximum number of tokens read from the lexer, see SetMaxTokens.
+	maxTokens int
+	// grammar is the grammar of the document as a whole, which is G2 if the
+	// input started with a preamble. preamble is the position of that preamble.
+	grammar  token.GrammarMode
+	preamble token.Position
 	// tokenBuffer contains all tokens that need to be processed next.
 	// These could be peeked tokens or tokens that were added in the parser.
 	// When it is empty, we can call lexer.Token() to get the next token.
@@ -88,6 +135,17 @@ type Visitor struct {
 	// tokens that were added from parser code.
 	tokenTailBuffer []tokenWithError
 
+	// steps is the stack of pending parsing work, see Run.
+	steps []step
+
+	// nodeBegin is the begin of the token that started the latest node.
+	// lastEnd is the end of the latest token from the input that was consumed with next.
+	nodeBegin, lastEnd token.Pos
+	// nodeSynthetic is true if the token that started the latest node was generated.
+	nodeSynthetic bool
+	// keyRange and valueRange are the positions of the latest attribute passed to the Visitable.
+	keyRange, valueRange token.Position
+
 	newNode        bool
 	nestedG1       bool
 	closed         bool
@@ -95,11 +153,15 @@ type Visitor struct {
 	nodeNoChildren bool
 }
 
+// step is a single unit of parsing work that is scheduled on the stack of a Visitor.
+type step func() error
+
 // NewVisitor creates a new Visitor, links lexer and Visitable-implementation to given values.
 func NewVisitor(visit Visitable, lexer *token.Lexer) *Visitor {
 	return &Visitor{
 		visitMe:        visit,
 		lexer:          lexer,
+		rootName:       "root",
 		newNode:        true,
 		nestedG1:       false,
 		closed:         false,
@@ -112,9 +174,102 @@ func (v *Visitor) SetVisitable(vis Visitable) {
 	v.visitMe = vis
 }
 
+// SetRootName sets the name of the synthetic root element, which is "root" by default.
+func (v *Visitor) SetRootName(name string) {
+	v.rootName = name
+}
+
+// SetFragment sets whether the input is a fragment of a document.
+// The root block of a G2 fragment may use any kind of brackets, like "#!(a, b)".
+func (v *Visitor) SetFragment(fragment bool) {
+	v.fragment = fragment
+}
+
+// SetRootBlocks sets the brackets the root element of G2 may be enclosed in, besides curly brackets.
+// BlockNone allows a root without brackets, which consists of a single element with a block,
+// like "#!server {...}".
+func (v *Visitor) SetRootBlocks(blockTypes ...BlockType) {
+	v.rootBlocks = blockTypes
+}
+
+// SetTrailingForward sets the name of a synthetic element, which is appended to the root
+// and takes all forwarding nodes that are left at the end of the input.
+// By default, or if name is empty, these nodes are reported as error.
+func (v *Visitor) SetTrailingForward(name string) {
+	v.trailingForward = name
+}
+
+// SetAutoClose sets whether open blocks are closed at an unexpected end of the input,
+// instead of reporting an error. The opening brackets of those blocks are available
+// with AutoClosed afterwards.
+func (v *Visitor) SetAutoClose(autoClose bool) {
+	v.autoClose = autoClose
+}
+
+// SetProgress sets fn to be called whenever at least every more bytes of the input have been
+// lexed, with the number of bytes and tokens read so far. A nil fn disables the calls.
+func (v *Visitor) SetProgress(every int64, fn func(bytes int64, tokens int)) {
+	if every < 1 {
+		every = 1
+	}
+
+	v.progress = fn
+	v.progressEvery = every
+	v.progressNext = every
+}
+
+// SetMaxTokens returns an error caused by ErrTooManyTokens for the token after the first max ones.
+// A max of 0 or less disables the limit.
+func (v *Visitor) SetMaxTokens(max int) {
+	v.maxTokens = max
+}
+
+// Progress returns the number of bytes and tokens, which have been read from the lexer so far.
+func (v *Visitor) Progress() (bytes int64, tokens int) {
+	return int64(v.lexer.Pos().Offset), v.tokens
+}
+
+// AutoClosed returns the opening brackets of all blocks that have been closed at the end
+// of the input, innermost first, see SetAutoClose.
+func (v *Visitor) AutoClosed() []token.Token {
+	return v.autoClosed
+}
+
 // Run runs the visitor, starting the traversion of the syntax tree.
+// The tree is traversed without recursion: every unit of work is a step on the
+// visitor's stack, so deeply nested input does not grow the call stack.
 func (v *Visitor) Run() error {
 	v.newNode = true
+	v.steps = nil
+	v.push(v.start, v.finish)
+
+	for len(v.steps) > 0 {
+		if err := v.pop()(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// push schedules the given steps, so that they are executed in the given order
+// before any step that is already on the stack.
+func (v *Visitor) push(steps ...step) {
+	for i := len(steps) - 1; i >= 0; i-- {
+		v.steps = append(v.steps, steps[i])
+	}
+}
+
+// pop removes the next step from the stack and returns it.
+func (v *Visitor) pop() step {
+	s := v.steps[len(v.steps)-1]
+	v.steps = v.steps[:len(v.steps)-1]
+
+	return s
+}
+
+// start detects the grammar of the input and schedules parsing of the root element.
+func (v *Visitor) start() error {
 	// Peek the first token to check if we should set G2 mode.
 	tok, err := v.peek()
 
@@ -126,27 +281,37 @@ func (v *Visitor) Run() error {
 	if tok != nil && tok.TokenType() == token.TokenG2Preamble {
 		// Prepare G2 by switching out the preamble for a root identifier.
 		v.mode = token.G2
+		v.grammar = token.G2
+		v.preamble = *tok.Pos()
 		_, err = v.next()
 		if err != nil {
 			return err
 		}
 
-		v.tokenBuffer = append(v.tokenBuffer,
-			tokenWithError{tok: &token.Identifier{Value: "root"}},
-		)
-
-		err = v.g2Node()
-		if err != nil {
+		if err := v.g2PreambleAttributes(); err != nil {
 			return err
 		}
+
+		// The root identifier goes in front of the block start, which may have been peeked already.
+		// It is generated by the preamble.
+		v.tokenBuffer = append([]tokenWithError{
+			{tok: &token.Identifier{Position: token.Synthesize(v.preamble), Value: v.rootName}},
+		},
+			v.tokenBuffer...,
+		)
+
+		v.push(v.g2Node)
 	} else {
 		// Prepare G1.
 		// Prepend and append tokens for the root element.
 		// This makes the root just another element, which simplifies parsing a lot.
+		// These tokens are generated by the beginning of the document.
+		begin := token.Pos{File: v.lexer.Pos().File, Line: 1, Col: 1}
+		origin := token.Synthesize(token.NewNode(begin, begin))
 		v.tokenBuffer = append([]tokenWithError{
-			{tok: &token.DefineElement{}},
-			{tok: &token.Identifier{Value: "root"}},
-			{tok: &token.BlockStart{}},
+			{tok: &token.DefineElement{Position: origin}},
+			{tok: &token.Identifier{Position: origin, Value: v.rootName}},
+			{tok: &token.BlockStart{Position: origin}},
 		},
 			v.tokenBuffer...,
 		)
@@ -155,38 +320,275 @@ func (v *Visitor) Run() error {
 			tokenWithError{tok: &token.BlockEnd{}},
 		)
 
-		err = v.g1Node()
+		v.push(v.g1Node)
+	}
+
+	return nil
+}
+
+// g2PreambleAttributes parses the attributes that follow the G2 preamble and passes them
+// to the Visitable as metadata of the document.
+func (v *Visitor) g2PreambleAttributes() error {
+	seen := NewAttributeList()
+
+	for {
+		tok, err := v.peek()
+		if err != nil {
+			// The root element reports the missing input.
+			return nil
+		}
+
+		attr, ok := tok.(*token.DefineAttribute)
+		if !ok {
+			return nil
+		}
+
+		if attr.Forward {
+			return token.NewPosError(tok.Pos(), "attributes of the preamble cannot be forwarded")
+		}
+
+		_, _ = v.next() // pop DefineAttribute
+
+		tok, err = v.next()
 		if err != nil {
 			return err
 		}
+
+		ident, ok := tok.(*token.Identifier)
+		if !ok {
+			return token.NewPosError(
+				tok.Pos(),
+				"an identifier is required as an attribute key",
+			).SetCause(NewUnexpectedTokenError(tok, token.TokenIdentifier))
+		}
+
+		if seen.Has(ident.Value) {
+			return token.NewPosError(tok.Pos(), "cannot define same attribute twice")
+		}
+
+		tok, err = v.next()
+		if err != nil {
+			return err
+		}
+
+		if tok.TokenType() != token.TokenBlockStart {
+			return token.NewPosError(
+				tok.Pos(),
+				"attribute value must be enclosed in '{}'",
+			).SetCause(NewUnexpectedTokenError(tok, token.TokenBlockStart))
+		}
+
+		tok, err = v.next()
+		if err != nil {
+			return err
+		}
+
+		cd, ok := tok.(*token.CharData)
+		if !ok {
+			return token.NewPosError(
+				tok.Pos(),
+				"attribute value is required",
+			).SetCause(NewUnexpectedTokenError(tok, token.TokenCharData))
+		}
+
+		tok, err = v.next()
+		if err != nil {
+			return err
+		}
+
+		if tok.TokenType() != token.TokenBlockEnd {
+			return token.NewPosError(
+				tok.Pos(),
+				"attribute value needs to be closed with '}'",
+			).SetCause(NewUnexpectedTokenError(tok, token.TokenBlockEnd))
+		}
+
+		key, value := ident.Value, cd.Value
+		seen.Set(&key, &value)
+
+		v.keyRange, v.valueRange = *ident.Pos(), *cd.Pos()
+		if err := v.visitMe.AddMetadata(key, value); err != nil {
+			return err
+		}
 	}
+}
 
+// finish validates the state of the visitor after the root element has been parsed.
+func (v *Visitor) finish() error {
 	// All forwarding nodes should have been processed earlier.
 	if l, err := v.visitMe.GetForwardingLength(); err != nil || l > 0 {
 		if err != nil {
 			return err
 		}
+
+		if v.trailingForward != "" {
+			if err := v.forwardTrailing(); err != nil {
+				return err
+			}
+		} else {
+			return v.forwardingError(l)
+		}
+	}
+
+	if v.fragment {
+		return nil
+	}
+
+	// The root element should always have curly brackets, unless others are allowed.
+	blocktype, err := v.visitMe.GetRootBlockType()
+	if err != nil {
+		return err
+	}
+
+	if blocktype == BlockNormal {
+		return nil
+	}
+
+	if v.grammar == token.G2 && slices.Contains(v.rootBlocks, blocktype) {
+		if blocktype == BlockNone {
+			return v.finishBareRoot()
+		}
+
+		return nil
+	}
+
+	r, err := v.getRange()
+	if err != nil {
+		return err
+	}
+	return token.NewPosError(r, "root element must have curly brackets")
+}
+
+// finishBareRoot verifies that the input ends after a root element without brackets.
+// Otherwise, the elements after the first one would be lost.
+func (v *Visitor) finishBareRoot() error {
+	tok, err := v.peek()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		return err
+	}
+
+	return token.NewPosError(tok.Pos(), "a root element without brackets must consist of a single element")
+}
+
+// forwardTrailing appends the synthetic element of SetTrailingForward to the root
+// and places all forwarding nodes inside it.
+func (v *Visitor) forwardTrailing() error {
+	v.nodeBegin, v.nodeSynthetic = v.lastEnd, true
+
+	if err := v.visitMe.NewNode(v.trailingForward); err != nil {
+		return err
+	}
+
+	if err := v.visitMe.MergeNodesForwarded(); err != nil {
+		return err
+	}
+
+	return v.visitMe.Close()
+}
+
+// forwardingError reports all l forwarding nodes that are left at the end of the input.
+// The error is positioned at the first of them, the others are added as details.
+func (v *Visitor) forwardingError(l int) error {
+	lister, ok := v.visitMe.(forwardingLister)
+	if !ok {
 		return token.NewPosError(v.getForwardingPosition(), "there is no node to forward this node into")
 	}
 
-	// The root element should always have curly brackets.
-	if blocktype, err := v.visitMe.GetRootBlockType(); err != nil || blocktype != BlockNormal {
+	names := make([]string, 0, l)
+	details := make([]token.ErrDetail, 0, l)
+
+	for i := 0; i < l; i++ {
+		pos, err := lister.GetForwardingPosition(i)
 		if err != nil {
 			return err
 		}
-		r, err := v.getRange()
+
+		name, err := lister.GetForwardingName(i)
 		if err != nil {
 			return err
 		}
-		return token.NewPosError(r, "root element must have curly brackets")
+
+		if name == "" {
+			name = "text"
+		} else {
+			name = "'" + name + "'"
+		}
+
+		names = append(names, name)
+		details = append(details, token.NewErrDetail(pos, name+" is forwarded here"))
 	}
 
-	return nil
+	return token.NewPosError(
+		details[0].Node,
+		"there is no node to forward "+strings.Join(names, ", ")+" into",
+		details[1:]...,
+	)
 }
 
 // next returns the next token or (nil, io.EOF) if there are no more tokens.
 // Repeatedly calling this can be used to get all tokens by advancing the lexer.
 func (v *Visitor) next() (token.Token, error) {
+	tok, err := v.nextToken()
+
+	// Generated tokens are not taken into account.
+	if tok != nil && !tok.Pos().Synthetic && tok.Pos().End().Line > 0 {
+		v.lastEnd = tok.Pos().End()
+	}
+
+	if v.autoClose && tok != nil {
+		v.trackBlocks(tok)
+	}
+
+	return tok, err
+}
+
+// trackBlocks keeps openBlocks up to date with the consumed token tok, see SetAutoClose.
+func (v *Visitor) trackBlocks(tok token.Token) {
+	switch tok.TokenType() {
+	case token.TokenBlockStart, token.TokenGroupStart, token.TokenGenericStart:
+		v.openBlocks = append(v.openBlocks, tok)
+	case token.TokenBlockEnd, token.TokenGroupEnd, token.TokenGenericEnd:
+		if len(v.openBlocks) > 0 {
+			v.openBlocks = v.openBlocks[:len(v.openBlocks)-1]
+		}
+	}
+}
+
+// closeOpenBlocks inserts the closing brackets of all open blocks in front of the tail tokens,
+// see SetAutoClose. The synthetic root of G1 is closed by a tail token already.
+func (v *Visitor) closeOpenBlocks() {
+	open := v.openBlocks
+	if v.grammar == token.G1 && len(open) > 0 {
+		open = open[1:]
+	}
+
+	closing := make([]tokenWithError, 0, len(open))
+
+	for i := len(open) - 1; i >= 0; i-- {
+		var tok token.Token
+
+		switch open[i].TokenType() {
+		case token.TokenGroupStart:
+			tok = &token.GroupEnd{}
+		case token.TokenGenericStart:
+			tok = &token.GenericEnd{}
+		default:
+			tok = &token.BlockEnd{}
+		}
+
+		closing = append(closing, tokenWithError{tok: tok})
+		v.autoClosed = append(v.autoClosed, open[i])
+	}
+
+	v.tokenTailBuffer = append(closing, v.tokenTailBuffer...)
+}
+
+// nextToken returns the next token from the buffers or the lexer, see next.
+func (v *Visitor) nextToken() (token.Token, error) {
 	// Check the buffer for tokens
 	if len(v.tokenBuffer) > 0 {
 		twe := v.tokenBuffer[0]
@@ -196,6 +598,26 @@ func (v *Visitor) next() (token.Token, error) {
 	}
 
 	tok, err := v.lexer.Token()
+	if err == nil {
+		v.tokens++
+
+		if v.maxTokens > 0 && v.tokens > v.maxTokens {
+			return nil, token.NewPosError(tok.Pos(), fmt.Sprintf("input exceeds the maximum of %d tokens", v.maxTokens)).
+				SetCause(ErrTooManyTokens)
+		}
+
+		if v.progress != nil {
+			if bytes := int64(v.lexer.Pos().Offset); bytes >= v.progressNext {
+				v.progressNext = bytes - bytes%v.progressEvery + v.progressEvery
+				v.progress(bytes, v.tokens)
+			}
+		}
+	}
+
+	if errors.Is(err, io.EOF) && v.autoClose && !v.atEnd {
+		v.atEnd = true
+		v.closeOpenBlocks()
+	}
 
 	if errors.Is(err, io.EOF) {
 		// Check tail buffer for tokens that need to be appended
@@ -204,11 +626,10 @@ func (v *Visitor) next() (token.Token, error) {
 			v.tokenTailBuffer = v.tokenTailBuffer[1:] // pop token
 
 			// Tail tokens are generated and have no positional information associated.
-			// We fix that here, so that potential errors point to the right place.
+			// We fix that here, so that potential errors point to the end of the input, which caused them.
 			if twe.tok != nil {
 				lexPos := v.lexer.Pos()
-				twe.tok.Pos().SetBegin(lexPos.File, lexPos.Line, lexPos.Col)
-				twe.tok.Pos().SetEnd(lexPos.File, lexPos.Line, lexPos.Col)
+				*twe.tok.Pos() = token.Synthesize(token.NewNode(lexPos, lexPos))
 			}
 
 			return twe.tok, twe.err
@@ -228,7 +649,7 @@ func (v *Visitor) peek() (token.Token, error) {
 		return twe.tok, twe.err
 	}
 
-	tok, err := v.next()
+	tok, err := v.nextToken()
 
 	// Store token+error for use in next()
 	v.tokenBuffer = append(v.tokenBuffer, tokenWithError{
@@ -239,7 +660,7 @@ func (v *Visitor) peek() (token.Token, error) {
 	return tok, err
 }
 
-// g1Node recursively parses a G1 node and all its children from tokens.
+// g1Node parses a G1 node from tokens. Its children are parsed by the steps it schedules.
 func (v *Visitor) g1Node() error {
 	forwardingNode := false
 
@@ -258,6 +679,7 @@ func (v *Visitor) g1Node() error {
 	switch t := tok.(type) {
 	case *token.DefineElement:
 		forwardingNode = t.Forward
+		v.nodeBegin, v.nodeSynthetic = t.Pos().Begin(), t.Pos().Synthetic
 	case *token.CharData:
 		err = v.visitMe.NewTextNode(t)
 		if err != nil {
@@ -271,6 +693,11 @@ func (v *Visitor) g1Node() error {
 
 		v.nodeNoChildren = true
 		return nil
+	case *token.G2Preamble:
+		// The elements of a G2 island become children of the current node, there is no node to close.
+		v.nodeNoChildren = true
+
+		return v.g2Island(t)
 	case *token.G1Comment:
 		// Expect CharData as comment
 		tok, err = v.next()
@@ -382,75 +809,144 @@ func (v *Visitor) g1Node() error {
 		}
 
 		// Append children until we encounter a TokenBlockEnd
-		for {
+		v.push(v.g1Children(forwardingNode))
 
-			tok, _ = v.peek()
-			if tok == nil {
-				return errors.New("token not identified, is nil")
-			}
-			if tok.TokenType() == token.TokenBlockEnd {
-				break
+		return nil
+	} else if tok.TokenType() == token.TokenCharData {
+		_, err = v.next()
+		if err != nil {
+			return err
+		}
+
+		err = v.visitMe.NewTextNode(tok.(*token.CharData))
+		if err != nil {
+			return err
+		}
+	}
+
+	return v.g1NodeEnd(forwardingNode)
+}
+
+// g1Children returns a step that parses the next child of the current G1 node.
+// The step reschedules itself until the closing BlockEnd is reached.
+func (v *Visitor) g1Children(forwardingNode bool) step {
+	var child step
+
+	child = func() error {
+		tok, err := v.peek()
+		if tok == nil {
+			// Errors of the input, like a failing reader, are more helpful than the missing token.
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
 			}
 
-			err := v.g1Node()
+			return errors.New("token not identified, is nil")
+		}
+
+		if tok.TokenType() == token.TokenBlockEnd {
+			_, err := v.next() // Pop the token, we know it's a BlockEnd
 			if err != nil {
 				return err
 			}
-			if !v.nodeNoChildren {
-				err = v.close()
-				if err != nil {
-					return err
-				}
-			}
-			v.nodeNoChildren = false
 
+			return v.g1NodeEnd(forwardingNode)
 		}
 
-		// Expect a BlockEnd
-		tok, err = v.next()
-		if err != nil {
-			return err
-		}
+		v.push(v.g1Node, v.g1CloseChild, child)
 
-		if tok.TokenType() != token.TokenBlockEnd {
-			return token.NewPosError(
-				tok.Pos(),
-				"use a '}' here to close the element",
-			).SetCause(NewUnexpectedTokenError(tok, token.TokenBlockEnd))
-		}
-	} else if tok.TokenType() == token.TokenCharData {
-		_, err = v.next()
-		if err != nil {
-			return err
-		}
+		return nil
+	}
 
-		err = v.visitMe.NewTextNode(tok.(*token.CharData))
+	return child
+}
+
+// g1CloseChild closes the child that was parsed last, unless it cannot have children.
+func (v *Visitor) g1CloseChild() error {
+	if !v.nodeNoChildren {
+		err := v.close()
 		if err != nil {
 			return err
 		}
 	}
+	v.nodeNoChildren = false
 
+	return nil
+}
+
+// g1NodeEnd finishes a G1 node after its children have been parsed.
+func (v *Visitor) g1NodeEnd(forwardingNode bool) error {
 	if forwardingNode {
 		// We just parsed a forwarding node. We need to save it, but cannot return it,
 		// as it needs to be placed inside the next non-forwarding node.
 		// We will parse another node to make it opaque to our caller that this happened.
+		// At the end of the input there is no such node, finish takes care of the forwarded nodes.
+		if tok, _ := v.peek(); tok != nil && tok.TokenType() == token.TokenBlockEnd && tok.Pos().Synthetic {
+			v.nodeNoChildren = true
 
-		err = v.g1Node()
-		if err != nil {
-			return err
+			return nil
 		}
 
+		v.push(v.g1Node)
+
 		return nil
 	}
 
-	err = v.setEndPos(v.lexer.Pos())
+	return v.setEndPos(v.lexer.Pos())
+}
+
+// g2Island parses a G2 island inside G1, like "#!{a, b}", whose '#!' has been read already.
+// The elements of the island are added to the current node.
+func (v *Visitor) g2Island(preamble *token.G2Preamble) error {
+	tok, err := v.next()
 	if err != nil {
 		return err
 	}
+
+	if _, ok := tok.(*token.BlockStart); !ok {
+		return token.NewPosError(
+			preamble.Pos(),
+			"a G2 island must be enclosed in '{...}'",
+		).SetCause(NewUnexpectedTokenError(tok, token.TokenBlockStart))
+	}
+
+	v.mode = token.G2
+
+	var child step
+
+	child = func() error {
+		if err := v.g2EatComments(); err != nil {
+			return err
+		}
+
+		tok, err := v.peek()
+		if err != nil {
+			return err
+		}
+
+		switch tok.TokenType() {
+		case token.TokenBlockEnd:
+			// The lexer has switched back to G1 after this token.
+			if _, err := v.next(); err != nil {
+				return err
+			}
+
+			v.mode = token.G1
+			v.closedByComma = false
+		case token.TokenDefineElement:
+			v.push(v.g1LineNodes, child)
+		default:
+			v.push(v.g2Node, child)
+		}
+
+		return nil
+	}
+
+	v.push(child)
+
 	return nil
 }
 
-// g1LineNodes returns all nodes that were encountered in a G1 line.
+// g1LineNodes parses all nodes that are encountered in a G1 line.
 // This function will eat the beginning DefineElement and the ending G1LineEnd token.
 func (v *Visitor) g1LineNodes() error {
 	// Expect beginning '#'
@@ -478,24 +974,34 @@ func (v *Visitor) g1LineNodes() error {
 	}
 
 	v.nestedG1 = true
-	for {
+
+	var line step
+
+	line = func() error {
 		tok, _ := v.peek()
 		if tok != nil && tok.TokenType() == token.TokenG1LineEnd {
-			_, err = v.next()
+			_, err := v.next()
 			if err != nil {
 				return err
 			}
 
-			break
+			return v.g1LineEnd(forward)
 		}
 
 		// Read g1Nodes until we encounter G1LineEnd
-		err := v.g1Node()
-		if err != nil {
-			return err
-		}
+		v.push(v.g1Node, line)
+
+		return nil
 	}
-	err = v.visitMe.SwitchActiveTree()
+
+	v.push(line)
+
+	return nil
+}
+
+// g1LineEnd switches back to G2 after all nodes of a G1 line have been parsed.
+func (v *Visitor) g1LineEnd(forward bool) error {
+	err := v.visitMe.SwitchActiveTree()
 	if err != nil {
 		return err
 	}
@@ -504,18 +1010,18 @@ func (v *Visitor) g1LineNodes() error {
 
 	v.mode = token.G2
 
-	// Should this be a forwarding G1 line, we will store the children for later
-	// and return an empty array here.
+	// Should this be a forwarding G1 line, we will store the children for later.
 	if !forward {
 		err = v.visitMe.MergeNodesForwarded()
 		if err != nil {
 			return err
 		}
 	}
+
 	return nil
 }
 
-// g2Node recursively parses a G2 node and all its children from tokens.
+// g2Node parses a G2 node from tokens. Its children are parsed by the steps it schedules.
 func (v *Visitor) g2Node() error {
 	err := v.setStartPos(v.lexer.Pos())
 	if err != nil {
@@ -532,8 +1038,26 @@ func (v *Visitor) g2Node() error {
 		return err
 	}
 
+	// Comments after a comma may be followed by the end of the block, like in "{a, // comment\n}".
+	tok, err := v.peek()
+	if err != nil {
+		return err
+	}
+
+	switch tok.(type) {
+	case *token.BlockEnd, *token.GroupEnd, *token.GenericEnd:
+		if closed, err := v.nodeIsClosedBy(tok); err != nil || closed {
+			return err
+		}
+	case *token.DefineElement:
+		// Comments may also be followed by a G1 line.
+		v.push(v.g1LineNodes)
+
+		return nil
+	}
+
 	// Expect identifier or text
-	tok, err := v.next()
+	tok, err = v.next()
 	if err != nil {
 		return err
 	}
@@ -542,6 +1066,9 @@ func (v *Visitor) g2Node() error {
 	case *token.Comma:
 		return errors.New("unexpected Comma token")
 	case *token.Identifier:
+		v.nodeBegin, v.nodeSynthetic = t.Pos().Begin(), t.Pos().Synthetic
+		v.closedByComma = false
+
 		err = v.visitMe.NewNode(t.Value)
 		if err != nil {
 			return err
@@ -594,29 +1121,41 @@ func (v *Visitor) g2Node() error {
 		return err
 	}
 
+	return v.g2NodeBlock()
+}
+
+// g2NodeBlock parses what follows the name, attributes and labels of a G2 node.
+func (v *Visitor) g2NodeBlock() error {
 	// Process children
-	tok, err = v.peek()
+	tok, err := v.peek()
 	if err != nil {
 		return err
 	}
 
 	switch t := tok.(type) {
 	case *token.CharData:
-		_, err = v.next()
+		isLabel, err := v.g2Labels()
 		if err != nil {
 			return err
 		}
 
-		err = v.visitMe.NewTextNode(t)
+		if isLabel {
+			return v.g2NodeBlock()
+		}
+
+		_, err = v.next()
 		if err != nil {
 			return err
 		}
-	case *token.DefineElement:
-		err := v.g1LineNodes()
+
+		err = v.visitMe.NewTextNode(t)
 		if err != nil {
 			return err
 		}
+	case *token.DefineElement:
+		v.push(v.g1LineNodes, v.g2NodeEnd)
 
+		return nil
 	case *token.BlockStart, *token.GenericStart, *token.GroupStart:
 		_, err = v.next()
 		if err != nil {
@@ -643,34 +1182,9 @@ func (v *Visitor) g2Node() error {
 		}
 
 		// Parse children
-		for {
-			tok, err = v.peek()
-			if err != nil {
-				return err
-			}
-
-			if closed, err := v.nodeIsClosedBy(tok); err != nil || closed {
-				if err != nil {
-					return err
-				}
-				_, err = v.next() // pop closing token
-				if err != nil {
-					return err
-				}
+		v.push(v.g2Children(false, v.g2NodeEnd))
 
-				break
-			} else if tok.TokenType() == token.TokenDefineElement {
-				err := v.g1LineNodes()
-				if err != nil {
-					return err
-				}
-			} else {
-				err := v.g2Node()
-				if err != nil {
-					return err
-				}
-			}
-		}
+		return nil
 	case *token.BlockEnd, *token.GroupEnd, *token.GenericEnd:
 		// Any closing token ends this node and will be handled by the parent.
 	case *token.Comma:
@@ -689,22 +1203,104 @@ func (v *Visitor) g2Node() error {
 		}
 
 	case *token.G2Arrow:
-		if err := v.g2ParseArrow(); err != nil {
-			return err
+		v.push(v.g2ParseArrow, v.g2NodeEnd)
+
+		return nil
+	default:
+		v.push(v.g2Node, v.visitMe.MergeNodesForwarded, v.g2NodeEnd)
+
+		return nil
+	}
+
+	return v.g2NodeEnd()
+}
+
+// g2Labels reads the strings following the name of a G2 node. If they are followed by a block,
+// they are added as labels to the node and true is returned. Otherwise, the strings are left
+// untouched to be parsed as text.
+func (v *Visitor) g2Labels() (bool, error) {
+	var labels []tokenWithError
+
+	for {
+		tok, err := v.peek()
+		if _, ok := tok.(*token.CharData); err != nil || !ok {
+			break
 		}
+
+		// Take the string out of the buffer, so that we can peek the token after it.
+		labels = append(labels, v.tokenBuffer[0])
+		v.tokenBuffer = v.tokenBuffer[1:]
+	}
+
+	tok, _ := v.peek()
+	switch tok.(type) {
+	case *token.BlockStart, *token.GenericStart, *token.GroupStart:
+		for _, label := range labels {
+			if err := v.visitMe.AddLabel(label.tok.(*token.CharData).Value); err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
 	default:
-		err := v.g2Node()
-		if err != nil {
-			return err
+		// Not labels, put the strings back in front of the peeked token.
+		v.tokenBuffer = append(labels, v.tokenBuffer...)
+
+		return false, nil
+	}
+}
+
+// g2Children returns a step that parses the next child of the current G2 node.
+// The step reschedules itself until the closing token of the node is reached,
+// afterwards done is called.
+func (v *Visitor) g2Children(eatComments bool, done step) step {
+	var child step
+
+	child = func() error {
+		if eatComments {
+			if err := v.g2EatComments(); err != nil {
+				return err
+			}
+
+			err := v.visitMe.G2AppendComments()
+			if err != nil {
+				return err
+			}
 		}
 
-		err = v.visitMe.MergeNodesForwarded()
+		tok, err := v.peek()
 		if err != nil {
 			return err
 		}
+
+		if closed, err := v.nodeIsClosedBy(tok); err != nil || closed {
+			if err != nil {
+				return err
+			}
+			_, err = v.next() // pop closing token
+			if err != nil {
+				return err
+			}
+
+			// A comma after the block belongs to the node of the block, not to its last child.
+			v.closedByComma = false
+
+			return done()
+		} else if tok.TokenType() == token.TokenDefineElement {
+			v.push(v.g1LineNodes, child)
+		} else {
+			v.push(v.g2Node, child)
+		}
+
+		return nil
 	}
 
-	tok, err = v.peek()
+	return child
+}
+
+// g2NodeEnd parses an optional return arrow after the children of a G2 node.
+func (v *Visitor) g2NodeEnd() error {
+	tok, err := v.peek()
 	if err != nil {
 		if errors.Is(err, io.EOF) {
 			return nil
@@ -713,12 +1309,17 @@ func (v *Visitor) g2Node() error {
 	}
 
 	if tok.TokenType() == token.TokenG2Arrow {
-		if err := v.g2ParseArrow(); err != nil {
-			return err
-		}
+		v.push(v.g2ParseArrow, v.g2NodeClose)
+
+		return nil
 	}
 
-	err = v.setEndPos(v.lexer.Pos())
+	return v.g2NodeClose()
+}
+
+// g2NodeClose closes the current G2 node and eats a separating comma.
+func (v *Visitor) g2NodeClose() error {
+	err := v.setEndPos(v.lexer.Pos())
 	if err != nil {
 		return err
 	}
@@ -794,9 +1395,10 @@ func (v *Visitor) g2EatComments() error {
 	return nil
 }
 
-// g2ParseBlock parses a block and its children into the given node.
+// g2ParseBlock parses a block and its children into the current node.
 // The blockType of the node will be set to the type of the block.
-func (v *Visitor) g2ParseBlock() error {
+// done is called once the block has been closed.
+func (v *Visitor) g2ParseBlock(done step) error {
 	tok, err := v.next()
 	if err != nil {
 		return err
@@ -827,43 +1429,7 @@ func (v *Visitor) g2ParseBlock() error {
 	}
 
 	// Parse children
-	for {
-		if err := v.g2EatComments(); err != nil {
-			return err
-		}
-
-		err = v.visitMe.G2AppendComments()
-		if err != nil {
-			return err
-		}
-
-		tok, err = v.peek()
-		if err != nil {
-			return err
-		}
-
-		if closed, err := v.nodeIsClosedBy(tok); err != nil || closed {
-			if err != nil {
-				return err
-			}
-			_, err = v.next() // pop closing token
-			if err != nil {
-				return err
-			}
-
-			break
-		} else if tok.TokenType() == token.TokenDefineElement {
-			err := v.g1LineNodes()
-			if err != nil {
-				return err
-			}
-		} else {
-			err := v.g2Node()
-			if err != nil {
-				return err
-			}
-		}
-	}
+	v.push(v.g2Children(true, done))
 
 	return nil
 }
@@ -893,16 +1459,7 @@ func (v *Visitor) g2ParseArrow() error {
 		return err
 	}
 
-	if err := v.g2ParseBlock(); err != nil {
-		return err
-	}
-
-	err = v.close()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return v.g2ParseBlock(v.close)
 }
 
 // parseAttributes eats consecutive attributes from the lexer and returns them in an AttributeMap.
@@ -950,7 +1507,10 @@ func (v *Visitor) parseAttributes(wantForward bool) error {
 			break
 		}
 
-		var attrKey, attrValue string
+		var (
+			attrKey, attrValue   string
+			keyRange, valueRange token.Position
+		)
 
 		// Read attribute key
 		tok, err = v.next()
@@ -959,7 +1519,7 @@ func (v *Visitor) parseAttributes(wantForward bool) error {
 		}
 
 		if ident, ok := tok.(*token.Identifier); ok {
-			attrKey = ident.Value
+			attrKey, keyRange = ident.Value, *ident.Pos()
 		} else {
 			return token.NewPosError(
 				tok.Pos(),
@@ -977,7 +1537,11 @@ func (v *Visitor) parseAttributes(wantForward bool) error {
 		// Read CharData enclosed in brackets as attribute value in G1.
 		// Read CharData after Assign in G2.
 
-		tok, _ = v.next()
+		tok, err = v.next()
+		if err != nil {
+			return err
+		}
+
 		if isG1 {
 			if tok.TokenType() != token.TokenBlockStart {
 				return token.NewPosError(
@@ -1000,7 +1564,7 @@ func (v *Visitor) parseAttributes(wantForward bool) error {
 		}
 
 		if cd, ok := tok.(*token.CharData); ok {
-			attrValue = cd.Value
+			attrValue, valueRange = cd.Value, *cd.Pos()
 		} else {
 			return token.NewPosError(
 				tok.Pos(),
@@ -1008,10 +1572,14 @@ func (v *Visitor) parseAttributes(wantForward bool) error {
 			).SetCause(NewUnexpectedTokenError(tok, token.TokenCharData))
 		}
 
-		result.Set(&attrKey, &attrValue)
+		result.push(&Attribute{Key: attrKey, Value: attrValue, KeyRange: keyRange, ValueRange: valueRange})
 
 		if isG1 {
-			tok, _ = v.next()
+			tok, err = v.next()
+			if err != nil {
+				return err
+			}
+
 			if tok.TokenType() != token.TokenBlockEnd {
 				return token.NewPosError(
 					tok.Pos(),
@@ -1021,18 +1589,16 @@ func (v *Visitor) parseAttributes(wantForward bool) error {
 		}
 	}
 
-	if wantForward {
-		for result.Len() > 0 {
-			key, val := result.Pop()
-			err := v.visitMe.AddAttributeForward(*key, *val)
+	for a := result.first; a != nil; a = a.Next {
+		v.keyRange, v.valueRange = a.KeyRange, a.ValueRange
+
+		if wantForward {
+			err := v.visitMe.AddAttributeForward(a.Key, a.Value)
 			if err != nil {
 				return err
 			}
-		}
-	} else {
-		for result.Len() > 0 {
-			key, val := result.Pop()
-			err := v.visitMe.AddAttribute(*key, *val)
+		} else {
+			err := v.visitMe.AddAttribute(a.Key, a.Value)
 			if err != nil {
 				return err
 			}
@@ -1060,6 +1626,11 @@ func (v *Visitor) nodeIsClosedBy(tok token.Token) (bool, error) {
 	}
 }
 
+// attribute returns a new attribute with the positions of the latest attribute passed to the Visitable.
+func (v *Visitor) attribute(key, value string) *Attribute {
+	return &Attribute{Key: key, Value: value, KeyRange: v.keyRange, ValueRange: v.valueRange}
+}
+
 func (v *Visitor) setStartPos(pos token.Pos) error {
 	if forward, err := v.visitMe.GetGlobalForward(); err != nil || forward {
 		if err != nil {
@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package pipeline processes Tadl documents as a stream of events.
+// A Source emits the events of a document, which pass a chain of Transformers
+// before they reach a Sink. Each stage sees one event at a time, so stages can be
+// chained without building a tree in between:
+//
+//  src, _ := pipeline.Parse("doc.tadl", r)
+//  err := pipeline.Run(src, pipeline.NewJSONSink(w), pipeline.DropElements(isInternal))
+//
+// Every element is framed by a StartElement and an EndElement event,
+// its text and comment children are emitted in between.
+package pipeline
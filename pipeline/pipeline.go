@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package pipeline
+
+import (
+	"errors"
+	"io"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/token"
+)
+
+// EventKind is the type of an Event.
+type EventKind int
+
+const (
+	// StartElement begins an element, its children follow until the matching EndElement.
+	StartElement EventKind = iota
+	// EndElement ends the latest element that was started.
+	EndElement
+	// Text is a text node of the current element.
+	Text
+	// Comment is a comment node of the current element.
+	Comment
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case StartElement:
+		return "StartElement"
+	case EndElement:
+		return "EndElement"
+	case Text:
+		return "Text"
+	case Comment:
+		return "Comment"
+	default:
+		return "EventKind(?)"
+	}
+}
+
+// Event is a single step in the stream of a document.
+type Event struct {
+	Kind EventKind
+	// Name is the name of the element for StartElement and EndElement.
+	Name string
+	// Attributes, Labels and BlockType describe the element of a StartElement.
+	Attributes parser.AttributeList
+	Labels     []string
+	BlockType  parser.BlockType
+	// Text is the content of a Text or Comment.
+	Text string
+	// Range is the position of the node in the input, if known.
+	Range token.Position
+	// Annotations are the annotations of the node of a StartElement, Text or Comment,
+	// see parser.TreeNode. Transformers may add their own ones.
+	Annotations map[string]interface{}
+}
+
+// Source emits the events of a document.
+type Source interface {
+	// Next returns the next event or io.EOF after the last one.
+	Next() (Event, error)
+}
+
+// Transformer processes a single event and passes any number of events to the next stage
+// by calling emit. A Transformer may keep state between events, but should not wait for
+// the end of the stream, as events are expected to flow through.
+type Transformer interface {
+	Transform(ev Event, emit func(Event) error) error
+}
+
+// TransformerFunc is a Transformer implemented as function.
+type TransformerFunc func(ev Event, emit func(Event) error) error
+
+// Transform calls f.
+func (f TransformerFunc) Transform(ev Event, emit func(Event) error) error {
+	return f(ev, emit)
+}
+
+// Sink is the last stage, which receives all events that passed the transformers.
+type Sink interface {
+	Consume(ev Event) error
+	// Close is called after the last event, if no error occurred.
+	Close() error
+}
+
+// Run passes all events of src through the transformers into sink.
+// The transformers are applied in the given order.
+func Run(src Source, sink Sink, transformers ...Transformer) error {
+	emit := sink.Consume
+
+	for i := len(transformers) - 1; i >= 0; i-- {
+		next, t := emit, transformers[i]
+		emit = func(ev Event) error {
+			return t.Transform(ev, next)
+		}
+	}
+
+	for {
+		ev, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := emit(ev); err != nil {
+			return err
+		}
+	}
+
+	return sink.Close()
+}
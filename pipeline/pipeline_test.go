@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package pipeline
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+)
+
+// sliceSource emits a fixed list of events.
+type sliceSource []Event
+
+func (s *sliceSource) Next() (Event, error) {
+	if len(*s) == 0 {
+		return Event{}, io.EOF
+	}
+
+	ev := (*s)[0]
+	*s = (*s)[1:]
+
+	return ev, nil
+}
+
+func TestRunJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		transformers []Transformer
+		want         string
+	}{
+		{
+			name: "G2",
+			text: `#!{
+				// note
+				server @id="1" "web" {port "80"}
+			}`,
+			want: `{"name":"root","blockType":"{}","children":[{"comment":"note"},` +
+				`{"name":"server","attributes":[{"key":"id","value":"1"}],"labels":["web"],"blockType":"{}","children":[` +
+				`{"name":"port","children":[{"text":"80"}]}]}]}` + "\n",
+		},
+		{
+			name: "drop elements",
+			text: `#!{a {x, y} b, c {z}}`,
+			transformers: []Transformer{
+				DropElements(func(ev Event) bool {
+					return ev.Name == "a" || ev.Name == "z"
+				}),
+			},
+			want: `{"name":"root","blockType":"{}","children":[{"name":"b","children":[]},{"name":"c","blockType":"{}","children":[]}]}` + "\n",
+		},
+		{
+			name: "chained transformers",
+			text: `#!{a {b}}`,
+			transformers: []Transformer{
+				Map(func(ev Event) Event {
+					ev.Name = strings.ToUpper(ev.Name)
+					return ev
+				}),
+				DropElements(func(ev Event) bool {
+					return ev.Name == "B"
+				}),
+			},
+			want: `{"name":"ROOT","blockType":"{}","children":[{"name":"A","blockType":"{}","children":[]}]}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := Parse("pipeline_test.go", strings.NewReader(tt.text))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := Run(src, NewJSONSink(&buf), tt.transformers...); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := buf.String(); got != tt.want {
+				t.Errorf("expected\n%s\nbut got\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTreeSink(t *testing.T) {
+	text := `#book @id{1} {#title Hello #? comment
+	#p{World}}`
+
+	src, err := Parse("pipeline_test.go", strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := NewTreeSink()
+	if err := Run(src, sink); err != nil {
+		t.Fatal(err)
+	}
+
+	// Converting the rebuilt tree again must yield the same events.
+	var want, got bytes.Buffer
+
+	src, _ = Parse("pipeline_test.go", strings.NewReader(text))
+	if err := Run(src, NewJSONSink(&want)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Run(FromTree(sink.Tree()), NewJSONSink(&got)); err != nil {
+		t.Fatal(err)
+	}
+
+	if want.String() != got.String() {
+		t.Errorf("expected\n%s\nbut got\n%s", want.String(), got.String())
+	}
+
+	if sink.Tree().Children[0].Parent != nil {
+		t.Error("expected parents to be released")
+	}
+}
+
+func TestSinkErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []Event
+	}{
+		{
+			name:   "unclosed",
+			events: []Event{{Kind: StartElement, Name: "a"}},
+		},
+		{
+			name:   "unopened",
+			events: []Event{{Kind: EndElement, Name: "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, sink := range []Sink{NewTreeSink(), NewJSONSink(io.Discard)} {
+				src := sliceSource(append([]Event{}, tt.events...))
+				if err := Run(&src, sink); err == nil {
+					t.Errorf("expected error from %T", sink)
+				}
+			}
+		})
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	tree, err := parser.NewParser("pipeline_test.go", strings.NewReader(`#!{a {b "x"}}`)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree.Children[0].Annotate("checked", true)
+
+	// A stage annotates the elements named b.
+	resolve := TransformerFunc(func(ev Event, emit func(Event) error) error {
+		if ev.Kind == StartElement && ev.Name == "b" {
+			ev.Annotations = map[string]interface{}{"type": "string"}
+		}
+
+		return emit(ev)
+	})
+
+	sink := NewTreeSink()
+	if err := Run(FromTree(tree), sink, resolve); err != nil {
+		t.Fatal(err)
+	}
+
+	a := sink.Tree().Children[0]
+	if checked, _ := a.Annotation("checked"); checked != true {
+		t.Errorf("expected annotation of the source tree but got %v", a.Annotations)
+	}
+
+	if typ, _ := a.Children[0].Annotation("type"); typ != "string" {
+		t.Errorf("expected annotation of the transformer but got %v", a.Children[0].Annotations)
+	}
+}
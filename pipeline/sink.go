@@ -0,0 +1,215 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/golangee/tadl/parser"
+)
+
+// TreeSink builds a tree from the events it receives.
+type TreeSink struct {
+	root, current *parser.TreeNode
+}
+
+// NewTreeSink creates an empty TreeSink.
+func NewTreeSink() *TreeSink {
+	return &TreeSink{}
+}
+
+// Tree returns the tree that was built, which is nil if no element was received.
+func (s *TreeSink) Tree() *parser.TreeNode {
+	return s.root
+}
+
+func (s *TreeSink) Consume(ev Event) error {
+	switch ev.Kind {
+	case StartElement:
+		node := parser.NewNode(ev.Name)
+		node.Attributes = ev.Attributes
+		node.Labels = ev.Labels
+		node.BlockType = ev.BlockType
+		node.Range = ev.Range
+		node.Annotations = ev.Annotations
+
+		if s.current == nil {
+			if s.root != nil {
+				return fmt.Errorf("cannot start element '%s': the root element is already closed", ev.Name)
+			}
+
+			s.root = node
+		} else {
+			node.Parent = s.current
+			s.current.Children = append(s.current.Children, node)
+		}
+
+		s.current = node
+	case EndElement:
+		if s.current == nil {
+			return fmt.Errorf("cannot end element '%s': no element is open", ev.Name)
+		}
+
+		s.current = s.current.Parent
+	case Text, Comment:
+		if s.current == nil {
+			return fmt.Errorf("cannot add %s outside of an element", ev.Kind)
+		}
+
+		text := ev.Text
+		node := &parser.TreeNode{Parent: s.current, Range: ev.Range, Annotations: ev.Annotations}
+
+		if ev.Kind == Text {
+			node.Text = &text
+		} else {
+			node.Comment = &text
+		}
+
+		s.current.Children = append(s.current.Children, node)
+	}
+
+	return nil
+}
+
+// Close checks that all elements were closed and releases the parent pointers of the tree.
+func (s *TreeSink) Close() error {
+	if s.current != nil {
+		return fmt.Errorf("element '%s' was not closed", s.current.Name)
+	}
+
+	// Like trees returned by the parser, the result has no parent pointers.
+	stack := []*parser.TreeNode{s.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if node == nil {
+			continue
+		}
+
+		node.Parent = nil
+		stack = append(stack, node.Children...)
+	}
+
+	return nil
+}
+
+// JSONSink writes the events as JSON, while they arrive.
+// An element is an object with its name, attributes, labels, block type and children.
+// Text and comment nodes are objects with a single "text" or "comment" field.
+type JSONSink struct {
+	w *bufio.Writer
+	// hasChildren tells for every open element, if a child was written already.
+	hasChildren []bool
+}
+
+// NewJSONSink creates a JSONSink that writes to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{w: bufio.NewWriter(w)}
+}
+
+func (s *JSONSink) Consume(ev Event) error {
+	if ev.Kind != EndElement {
+		s.separate()
+	}
+
+	switch ev.Kind {
+	case StartElement:
+		s.w.WriteString(`{"name":`)
+		s.writeString(ev.Name)
+
+		if ev.Attributes.Len() > 0 {
+			s.w.WriteString(`,"attributes":[`)
+
+			for i := 0; i < ev.Attributes.Len(); i++ {
+				key, value := ev.Attributes.Get(i)
+				if i > 0 {
+					s.w.WriteByte(',')
+				}
+
+				s.w.WriteString(`{"key":`)
+				s.writeString(*key)
+				s.w.WriteString(`,"value":`)
+				s.writeString(*value)
+				s.w.WriteByte('}')
+			}
+
+			s.w.WriteByte(']')
+		}
+
+		if len(ev.Labels) > 0 {
+			s.w.WriteString(`,"labels":[`)
+
+			for i, label := range ev.Labels {
+				if i > 0 {
+					s.w.WriteByte(',')
+				}
+
+				s.writeString(label)
+			}
+
+			s.w.WriteByte(']')
+		}
+
+		if ev.BlockType != parser.BlockNone {
+			s.w.WriteString(`,"blockType":`)
+			s.writeString(string(ev.BlockType))
+		}
+
+		s.w.WriteString(`,"children":[`)
+		s.hasChildren = append(s.hasChildren, false)
+	case EndElement:
+		if len(s.hasChildren) == 0 {
+			return fmt.Errorf("cannot end element '%s': no element is open", ev.Name)
+		}
+
+		s.hasChildren = s.hasChildren[:len(s.hasChildren)-1]
+		s.w.WriteString("]}")
+
+		if len(s.hasChildren) == 0 {
+			s.w.WriteByte('\n')
+		}
+	case Text:
+		s.w.WriteString(`{"text":`)
+		s.writeString(ev.Text)
+		s.w.WriteByte('}')
+	case Comment:
+		s.w.WriteString(`{"comment":`)
+		s.writeString(ev.Text)
+		s.w.WriteByte('}')
+	}
+
+	return nil
+}
+
+// separate writes the comma in front of all but the first child of an element.
+func (s *JSONSink) separate() {
+	if len(s.hasChildren) == 0 {
+		return
+	}
+
+	if s.hasChildren[len(s.hasChildren)-1] {
+		s.w.WriteByte(',')
+	}
+
+	s.hasChildren[len(s.hasChildren)-1] = true
+}
+
+// writeString writes str as quoted JSON string.
+func (s *JSONSink) writeString(str string) {
+	buf, _ := json.Marshal(str)
+	s.w.Write(buf)
+}
+
+// Close flushes all buffered output.
+func (s *JSONSink) Close() error {
+	if len(s.hasChildren) > 0 {
+		return fmt.Errorf("%d elements were not closed", len(s.hasChildren))
+	}
+
+	return s.w.Flush()
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package pipeline
+
+import (
+	"io"
+
+	"github.com/golangee/tadl/parser"
+)
+
+// treeSource emits the events of a tree, see FromTree.
+type treeSource struct {
+	// stack contains the nodes that are still to be visited. A nil node marks
+	// the end of the element in ends with the same index.
+	stack []*parser.TreeNode
+	ends  []*parser.TreeNode
+}
+
+// FromTree returns a Source that emits the events of an existing tree.
+func FromTree(tree *parser.TreeNode) Source {
+	return &treeSource{
+		stack: []*parser.TreeNode{tree},
+		ends:  []*parser.TreeNode{nil},
+	}
+}
+
+// Parse parses the document from r and returns a Source for its events.
+// The parser has to resolve forwarded elements, which may appear anywhere in a document,
+// so the document is parsed once completely before the first event is emitted.
+func Parse(filename string, r io.Reader, opts ...parser.Option) (Source, error) {
+	tree, err := parser.NewParser(filename, r, opts...).Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return FromTree(tree), nil
+}
+
+func (s *treeSource) Next() (Event, error) {
+	if len(s.stack) == 0 {
+		return Event{}, io.EOF
+	}
+
+	node, end := s.stack[len(s.stack)-1], s.ends[len(s.ends)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	s.ends = s.ends[:len(s.ends)-1]
+
+	if node == nil {
+		return Event{Kind: EndElement, Name: end.Name, Range: end.Range}, nil
+	}
+
+	switch {
+	case node.IsText():
+		return Event{Kind: Text, Text: *node.Text, Range: node.Range, Annotations: node.Annotations}, nil
+	case node.IsComment():
+		return Event{Kind: Comment, Text: *node.Comment, Range: node.Range, Annotations: node.Annotations}, nil
+	}
+
+	// The end of the element is visited after all of its children.
+	s.stack = append(s.stack, nil)
+	s.ends = append(s.ends, node)
+
+	for i := len(node.Children) - 1; i >= 0; i-- {
+		s.stack = append(s.stack, node.Children[i])
+		s.ends = append(s.ends, nil)
+	}
+
+	return Event{
+		Kind:        StartElement,
+		Name:        node.Name,
+		Attributes:  node.Attributes,
+		Labels:      node.Labels,
+		BlockType:   node.BlockType,
+		Range:       node.Range,
+		Annotations: node.Annotations,
+	}, nil
+}
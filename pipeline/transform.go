@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package pipeline
+
+// Map returns a Transformer that replaces every event with the result of f.
+func Map(f func(ev Event) Event) Transformer {
+	return TransformerFunc(func(ev Event, emit func(Event) error) error {
+		return emit(f(ev))
+	})
+}
+
+// DropElements returns a Transformer that removes every element, for whose StartElement
+// drop returns true, together with all of its children.
+func DropElements(drop func(ev Event) bool) Transformer {
+	// depth is the nesting inside the element that is currently dropped, or 0.
+	depth := 0
+
+	return TransformerFunc(func(ev Event, emit func(Event) error) error {
+		if depth > 0 {
+			switch ev.Kind {
+			case StartElement:
+				depth++
+			case EndElement:
+				depth--
+			}
+
+			return nil
+		}
+
+		if ev.Kind == StartElement && drop(ev) {
+			depth = 1
+			return nil
+		}
+
+		return emit(ev)
+	})
+}
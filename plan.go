@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// fieldPlan describes how a struct field is unmarshalled. It only depends on the type
+// and the tag of the field, so it is computed once per struct type, see structPlan.
+type fieldPlan struct {
+	// goName is the name of the field in Go.
+	goName string
+	// name is the name of the element or attribute, unless the field is not renamed and
+	// a NameMapper is configured.
+	name    string
+	renamed bool
+	aliases []string
+	tags    []string
+	as      unmarshalType
+	// invalid is the kind of the tag, like "attr", if it is unknown.
+	invalid string
+	// embedded is true for an embedded struct without a name in its tag. Its fields are read
+	// from the element of the surrounding struct, like those of an 'inner' struct.
+	embedded bool
+	// omitEmpty is set by the option "omitempty", which leaves out empty values when marshalling.
+	omitEmpty bool
+	// def is the text of the default tag, which is read when the element or attribute is absent.
+	def        string
+	hasDefault bool
+}
+
+// plans caches the []fieldPlan of struct types by planKey.
+var plans sync.Map
+
+// planKey identifies the plans of a struct type read with a list of fallback tags.
+type planKey struct {
+	t        reflect.Type
+	fallback string
+}
+
+// structPlan returns the plans of all fields of the struct type t.
+// Fields without a tadl tag use the first of the fallback tags they have, see WithTagFallback.
+func structPlan(t reflect.Type, fallback ...string) []fieldPlan {
+	key := planKey{t: t, fallback: strings.Join(fallback, ",")}
+	if cached, ok := plans.Load(key); ok {
+		return cached.([]fieldPlan)
+	}
+
+	fields := make([]fieldPlan, t.NumField())
+
+	for i := range fields {
+		fieldType := t.Field(i)
+		field := fieldPlan{goName: fieldType.Name, name: fieldType.Name, as: unmarshalNormal}
+
+		// Some tags will change the behavior of how this field will be processed.
+		if structTag, ok := fieldType.Tag.Lookup("tadl"); ok {
+			field.tags = strings.Split(structTag, ",")
+
+			// The first tag will rename the field
+			if rename := field.tags[0]; len(rename) > 0 {
+				names := strings.Split(rename, "|")
+				field.name, field.aliases = names[0], names[1:]
+				field.renamed = true
+			}
+
+			// The option "omitempty" may follow the rename or the type.
+			options := field.tags[1:]
+			if i := slices.Index(options, "omitempty"); i >= 0 {
+				field.omitEmpty = true
+				options = slices.Delete(slices.Clone(options), i, i+1)
+			}
+
+			// The second tag indicates the type we are parsing
+			if len(options) > 0 {
+				switch as := options[0]; as {
+				case "attr":
+					field.as = unmarshalAttribute
+				case "inner":
+					field.as = unmarshalInner
+				case "table":
+					field.as = unmarshalTable
+				case "label":
+					field.as = unmarshalLabel
+				case "pos":
+					field.as = unmarshalPosition
+				case "attrs":
+					field.as = unmarshalAttributes
+				case "chardata":
+					field.as = unmarshalCharData
+				case "any":
+					field.as = unmarshalAny
+				case "":
+					field.as = unmarshalNormal
+				default:
+					field.invalid = as
+				}
+			}
+		} else {
+			for _, name := range fallback {
+				if structTag, ok := fieldType.Tag.Lookup(name); ok {
+					fallbackPlan(&field, name, structTag)
+					break
+				}
+			}
+		}
+
+		field.def, field.hasDefault = fieldType.Tag.Lookup("default")
+
+		// A Position is never decoded from an element.
+		if fieldType.Type == positionType && field.as == unmarshalNormal {
+			field.as = unmarshalPosition
+		}
+
+		// Embedded structs are flattened into the surrounding struct, like in encoding/json.
+		if fieldType.Anonymous && !field.renamed && field.as == unmarshalNormal {
+			embedded := fieldType.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+
+			switch {
+			case embedded.Kind() != reflect.Struct:
+			case fieldType.Type.Kind() == reflect.Ptr && !fieldType.IsExported():
+				// A pointer to an unexported struct type cannot be allocated.
+				field.as = unmarshalSkip
+			default:
+				field.as = unmarshalInner
+				field.embedded = true
+			}
+		}
+
+		fields[i] = field
+	}
+
+	cached, _ := plans.LoadOrStore(key, fields)
+
+	return cached.([]fieldPlan)
+}
+
+// fallbackPlan configures field from the tag of another package, like `json:"name,omitempty"` or
+// `xml:"name,attr"`. The name renames the field and "-" skips it. The xml options "attr" and
+// "chardata" are read like the tadl kinds "attr" and "chardata". Fields with other xml options, or
+// nested names like "a>b", are skipped, as Tadl has no equivalent. The option "omitempty" is kept for
+// the Encoder, all other options are ignored.
+func fallbackPlan(field *fieldPlan, tagName, structTag string) {
+	tags := strings.Split(structTag, ",")
+	name := tags[0]
+
+	if name == "-" && len(tags) == 1 {
+		field.as = unmarshalSkip
+
+		return
+	}
+
+	field.omitEmpty = slices.Contains(tags[1:], "omitempty")
+
+	if tagName == "xml" {
+		// The name may be preceded by a namespace, which is dropped.
+		if i := strings.LastIndexByte(name, ' '); i >= 0 {
+			name = name[i+1:]
+		}
+
+		if strings.Contains(name, ">") {
+			field.as = unmarshalSkip
+
+			return
+		}
+
+		for _, option := range tags[1:] {
+			switch option {
+			case "attr":
+				field.as = unmarshalAttribute
+			case "chardata":
+				field.as = unmarshalCharData
+			case "innerxml", "comment", "any":
+				field.as = unmarshalSkip
+
+				return
+			}
+		}
+	}
+
+	if name != "" {
+		field.name = name
+		field.renamed = true
+		// A rename makes tagged slices filter their elements by name, like a tadl tag.
+		field.tags = []string{name}
+	}
+}
@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package policy checks documents against central rules, like "no plaintext passwords".
+// A document is passed to an Evaluator as tree of Node values, which encode to JSON
+// in the shape policy engines like OPA expect as input:
+//
+//  {"path": "/root", "name": "root", "children": [
+//  	{"path": "/root/db[0]", "name": "db", "attributes": {"password": "secret"}}
+//  ]}
+//
+// Violations refer to elements by their path and are reported as diagnostics at the
+// position of the element. An adapter for rego only needs to implement Evaluator.
+package policy
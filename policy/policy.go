@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/golangee/tadl"
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/token"
+)
+
+// Node is the input representation of an element. Comments are left out and
+// the text children of an element are joined into Text.
+type Node struct {
+	// Path identifies the element, like "/root/server[1]". See parser.Document.Find for the syntax.
+	Path       string            `json:"path"`
+	Name       string            `json:"name"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Labels     []string          `json:"labels,omitempty"`
+	Text       string            `json:"text,omitempty"`
+	Children   []*Node           `json:"children,omitempty"`
+}
+
+// Walk calls visit for n and all of its descendants in document order.
+func (n *Node) Walk(visit func(node *Node)) {
+	visit(n)
+
+	for _, child := range n.Children {
+		child.Walk(visit)
+	}
+}
+
+// Violation is a broken rule.
+type Violation struct {
+	// Path is the path of the offending element. An empty path refers to the whole document.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Evaluator evaluates policies for the input of a document.
+type Evaluator interface {
+	Evaluate(ctx context.Context, input *Node) ([]Violation, error)
+}
+
+// EvaluatorFunc allows to use a function as Evaluator.
+type EvaluatorFunc func(ctx context.Context, input *Node) ([]Violation, error)
+
+// Evaluate calls f.
+func (f EvaluatorFunc) Evaluate(ctx context.Context, input *Node) ([]Violation, error) {
+	return f(ctx, input)
+}
+
+// Input converts tree into the input of an Evaluator.
+func Input(tree *parser.TreeNode) *Node {
+	input, _ := convert(tree)
+
+	return input
+}
+
+// Check evaluates all policies for tree and returns their violations as diagnostics,
+// positioned at the offending element.
+func Check(ctx context.Context, tree *parser.TreeNode, evaluators ...Evaluator) ([]tadl.Diagnostic, error) {
+	input, nodes := convert(tree)
+
+	var diags []tadl.Diagnostic
+
+	for _, evaluator := range evaluators {
+		violations, err := evaluator.Evaluate(ctx, input)
+		if err != nil {
+			return diags, err
+		}
+
+		for _, v := range violations {
+			diag := tadl.Diagnostic{
+				Pos:     token.Pos{File: tree.Range.BeginPos.File},
+				Message: v.Message,
+			}
+
+			if node, ok := nodes[v.Path]; ok {
+				diag.Pos = node.Range.BeginPos
+			} else if v.Path != "" {
+				diag.Message = v.Path + ": " + v.Message
+			}
+
+			diags = append(diags, diag)
+		}
+	}
+
+	return diags, nil
+}
+
+// convert returns the input for tree and the elements by their path.
+func convert(tree *parser.TreeNode) (*Node, map[string]*parser.TreeNode) {
+	nodes := map[string]*parser.TreeNode{}
+
+	var visit func(node *parser.TreeNode, path string) *Node
+	visit = func(node *parser.TreeNode, path string) *Node {
+		nodes[path] = node
+
+		n := &Node{
+			Path:   path,
+			Name:   node.Name,
+			Labels: node.Labels,
+		}
+
+		if node.Attributes.Len() > 0 {
+			n.Attributes = map[string]string{}
+		}
+
+		for i := 0; i < node.Attributes.Len(); i++ {
+			key, value := node.Attributes.Get(i)
+			n.Attributes[*key] = *value
+		}
+
+		var text strings.Builder
+
+		count := map[string]int{}
+
+		for _, child := range node.Children {
+			switch {
+			case child.IsText():
+				text.WriteString(*child.Text)
+			case child.IsNode():
+				childPath := path + "/" + child.Name + "[" + strconv.Itoa(count[child.Name]) + "]"
+				count[child.Name]++
+				n.Children = append(n.Children, visit(child, childPath))
+			}
+		}
+
+		n.Text = text.String()
+
+		return n
+	}
+
+	return visit(tree, "/"+tree.Name), nodes
+}
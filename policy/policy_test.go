@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+)
+
+func parse(t *testing.T, text string) *parser.TreeNode {
+	t.Helper()
+
+	tree, err := parser.NewParser("policy.tadl", strings.NewReader(text)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tree
+}
+
+// noPlaintextPasswords reports all password attributes, that are not references to a secret.
+var noPlaintextPasswords = EvaluatorFunc(func(ctx context.Context, input *Node) ([]Violation, error) {
+	var violations []Violation
+
+	input.Walk(func(node *Node) {
+		if password, ok := node.Attributes["password"]; ok && !strings.HasPrefix(password, "secret:") {
+			violations = append(violations, Violation{Path: node.Path, Message: "plaintext password"})
+		}
+	})
+
+	return violations, nil
+})
+
+func TestInput(t *testing.T) {
+	input := Input(parse(t, `#!{db @password="x" "main" {host "localhost"}, db}`))
+
+	buf, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"path":"/root","name":"root","children":[` +
+		`{"path":"/root/db[0]","name":"db","attributes":{"password":"x"},"labels":["main"],"children":[` +
+		`{"path":"/root/db[0]/host[0]","name":"host","text":"localhost"}]},` +
+		`{"path":"/root/db[1]","name":"db"}]}`
+	if string(buf) != want {
+		t.Errorf("expected\n%s\nbut got\n%s", want, buf)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tree := parse(t, "#!{\n\tdb @password=\"secret:db\",\n\tcache {\n\t\tredis @password=\"hunter2\"\n\t}\n}")
+
+	document := EvaluatorFunc(func(ctx context.Context, input *Node) ([]Violation, error) {
+		return []Violation{{Message: "document"}, {Path: "/root/missing[0]", Message: "missing"}}, nil
+	})
+
+	diags, err := Check(context.Background(), tree, noPlaintextPasswords, document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, diag := range diags {
+		got = append(got, diag.String())
+	}
+
+	want := []string{
+		"policy.tadl:4:3: plaintext password",
+		"policy.tadl: document",
+		"policy.tadl: /root/missing[0]: missing",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	failing := EvaluatorFunc(func(ctx context.Context, input *Node) ([]Violation, error) {
+		return nil, errors.New("policy failed")
+	})
+
+	if _, err := Check(context.Background(), tree, failing); err == nil {
+		t.Error("expected error")
+	}
+}
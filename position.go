@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"reflect"
+
+	"github.com/golangee/tadl/token"
+)
+
+// Position is the source range of the element, which a struct has been unmarshalled from.
+// A field of this type is not decoded from an element, but set to the range of the element of its struct,
+// so that programs can report semantic errors, like conflicting ports, at the line of the configuration:
+//
+//  type Server struct {
+//      Pos  tadl.Position
+//      Port int `tadl:"port"`
+//  }
+//
+//  if a.Port == b.Port {
+//      return fmt.Errorf("%s: port %d is used by %s as well", b.Pos.BeginPos, b.Port, a.Pos.BeginPos)
+//  }
+//
+// The tag 'pos' marks such a field explicitly, like `tadl:",pos"`.
+type Position = token.Position
+
+// positionType is set to the range of the element of a struct, see Position.
+var positionType = reflect.TypeOf(Position{})
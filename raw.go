@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/golangee/tadl/parser"
+)
+
+// Raw is the source text of an element, which is copied verbatim into the field instead of being decoded.
+// Use it to defer decoding of sections, like the configuration of plugins, which are unknown to the program.
+// The text starts with the element itself and can be parsed again, like in
+//
+//  type Config struct {
+//      Plugin tadl.Raw `tadl:"plugin"`
+//  }
+//
+//  // The field contains 'plugin @name="cache" {size 10}' for this document.
+//  #!{plugin @name="cache" {size 10}}
+type Raw []byte
+
+// rawType is decoded from the source text, see Raw.
+var rawType = reflect.TypeOf(Raw{})
+
+// raw returns the source text of node. A separating comma of G2 is not part of the text.
+func (u *unmarshaler) raw(node *parser.TreeNode) (Raw, error) {
+	begin, end := node.Range.BeginPos.Offset, node.Range.EndPos.Offset
+	if node.Range.Synthetic || node.Range.BeginPos.Line == 0 || begin > end || end > len(u.src) {
+		return nil, NewUnmarshalError(node, "source text is not available", nil)
+	}
+
+	text := u.src[begin:end]
+	if bytes.HasPrefix(bytes.TrimSpace(u.src), []byte("#!")) {
+		text = bytes.TrimRight(text, ", \t\r\n")
+	}
+
+	return append(Raw(nil), text...), nil
+}
@@ -0,0 +1,12 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package signature signs Tadl trees and verifies their signatures.
+// The signature covers the structural hash of package store, which ignores positions,
+// so reformatting a signed document does not invalidate its signature.
+//
+// A signature is either kept separately, see Sign and Verify, or embedded into the
+// document as last child of the root element:
+//  _signature @ed25519="<base64 signature>"
+// see Embed and VerifyEmbedded. RSA, ECDSA and Ed25519 keys are supported.
+package signature
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/store"
+)
+
+// Name is the name of the element that contains an embedded signature.
+const Name = "_signature"
+
+var (
+	// ErrInvalidSignature is returned, if a signature does not match the tree or the key.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrNoSignature is returned by VerifyEmbedded, if the tree contains no signature.
+	ErrNoSignature = errors.New("no embedded signature")
+)
+
+// Sign returns a detached signature of tree.
+func Sign(tree *parser.TreeNode, signer crypto.Signer) ([]byte, error) {
+	digest := store.Hash(tree)
+
+	// Ed25519 signs the message itself, the other algorithms its hash.
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		return signer.Sign(rand.Reader, digest[:], crypto.Hash(0))
+	}
+
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// Verify checks that sig is a signature of tree made with the private key of pub.
+func Verify(tree *parser.TreeNode, pub crypto.PublicKey, sig []byte) error {
+	digest := store.Hash(tree)
+
+	var ok bool
+
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, digest[:], sig)
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, digest[:], sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	if !ok {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Embed signs tree and appends the signature as Name element to its children.
+// An existing embedded signature is replaced.
+func Embed(tree *parser.TreeNode, signer crypto.Signer) error {
+	unsigned, _ := split(tree)
+
+	sig, err := Sign(unsigned, signer)
+	if err != nil {
+		return err
+	}
+
+	alg, err := algorithm(signer.Public())
+	if err != nil {
+		return err
+	}
+
+	node := parser.NewNode(Name).AddAttribute(alg, base64.StdEncoding.EncodeToString(sig))
+	node.Parent = tree
+
+	tree.Children = append(unsigned.Children, node)
+
+	return nil
+}
+
+// VerifyEmbedded checks the signature, which has been embedded into tree by Embed.
+func VerifyEmbedded(tree *parser.TreeNode, pub crypto.PublicKey) error {
+	unsigned, node := split(tree)
+	if node == nil {
+		return ErrNoSignature
+	}
+
+	alg, err := algorithm(pub)
+	if err != nil {
+		return err
+	}
+
+	if node.Attributes.Len() != 1 {
+		return ErrInvalidSignature
+	}
+
+	key, value := node.Attributes.Get(0)
+	if *key != alg {
+		return fmt.Errorf("%w: signed with %s, but key is %s", ErrInvalidSignature, *key, alg)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(*value)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	return Verify(unsigned, pub, sig)
+}
+
+// split returns a shallow copy of tree without its embedded signature, and the signature element.
+// node is nil, if the last child of tree is no signature.
+func split(tree *parser.TreeNode) (unsigned, node *parser.TreeNode) {
+	copied := *tree
+	copied.Children = append([]*parser.TreeNode(nil), tree.Children...)
+
+	if n := len(copied.Children); n > 0 && copied.Children[n-1].IsNode() && copied.Children[n-1].Name == Name {
+		node = copied.Children[n-1]
+		copied.Children = copied.Children[:n-1]
+	}
+
+	return &copied, node
+}
+
+// algorithm returns the name of the signature algorithm for the given key.
+func algorithm(pub crypto.PublicKey) (string, error) {
+	switch pub.(type) {
+	case ed25519.PublicKey:
+		return "ed25519", nil
+	case *ecdsa.PublicKey:
+		return "ecdsa", nil
+	case *rsa.PublicKey:
+		return "rsa", nil
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
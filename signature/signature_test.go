@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl/format"
+	"github.com/golangee/tadl/parser"
+)
+
+func parse(t *testing.T, text string) *parser.TreeNode {
+	t.Helper()
+
+	tree, err := parser.NewParser("signature_test.go", strings.NewReader(text)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tree
+}
+
+func signers(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]crypto.Signer{"ed25519": edKey, "ecdsa": ecKey, "rsa": rsaKey}
+}
+
+func TestSignVerify(t *testing.T) {
+	for name, signer := range signers(t) {
+		t.Run(name, func(t *testing.T) {
+			sig, err := Sign(parse(t, `#!{server @port="80"}`), signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The format of the document does not matter.
+			if err := Verify(parse(t, "#!{\n\tserver @port=\"80\"\n}"), signer.Public(), sig); err != nil {
+				t.Error(err)
+			}
+
+			if err := Verify(parse(t, `#!{server @port="8080"}`), signer.Public(), sig); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("expected invalid signature but got %v", err)
+			}
+		})
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	for name, signer := range signers(t) {
+		t.Run(name, func(t *testing.T) {
+			tree := parse(t, `#!{server @port="80"}`)
+			if err := Embed(tree, signer); err != nil {
+				t.Fatal(err)
+			}
+
+			// Signing again replaces the signature.
+			if err := Embed(tree, signer); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(tree.Children) != 2 || tree.Children[1].Name != Name {
+				t.Fatalf("expected embedded signature but got %s", format.Format(tree))
+			}
+
+			// The signature survives writing and parsing the document.
+			signed := parse(t, format.Format(tree))
+			if err := VerifyEmbedded(signed, signer.Public()); err != nil {
+				t.Error(err)
+			}
+
+			signed.Children[0].AddAttribute("port", "8080")
+			if err := VerifyEmbedded(signed, signer.Public()); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("expected invalid signature but got %v", err)
+			}
+		})
+	}
+
+	if err := VerifyEmbedded(parse(t, `#!{server}`), signers(t)["ed25519"].Public()); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("expected no signature but got %v", err)
+	}
+}
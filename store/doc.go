@@ -0,0 +1,12 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package store persists Tadl trees content-addressed by their structural hash.
+// Every node is stored as a record of its own content and the digests of its children,
+// so subtrees that appear in many documents are stored only once.
+//
+// Documents can refer to stored subtrees with reference elements of the form
+//  _ref @sha256{<hex digest>}
+// which are created by Reference and expanded again by Resolve. Duplicates finds the subtrees, which
+// several documents have in common, to decide what is worth to be referenced.
+package store
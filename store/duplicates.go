@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/golangee/tadl/parser"
+)
+
+// Occurrence is a subtree in the document of a file.
+type Occurrence struct {
+	File string
+	Node *parser.TreeNode
+}
+
+// Duplicate is a subtree, which appears with the same hash in the documents of several files.
+type Duplicate struct {
+	Digest Digest
+	// Size is the number of nodes of the subtree, including texts and comments.
+	Size int
+	// Occurrences are sorted by file and the order of the document.
+	Occurrences []Occurrence
+}
+
+// Duplicates returns the subtrees with at least minSize nodes, which appear in the documents of at least
+// two of the given files. Such subtrees are candidates to be saved once and to be replaced with reference
+// elements, see Reference. Subtrees of a reported duplicate are only reported again, if they also appear
+// somewhere else. The largest duplicates come first.
+func Duplicates(docs map[string]*parser.TreeNode, minSize int) []Duplicate {
+	files := make([]string, 0, len(docs))
+	for file := range docs {
+		files = append(files, file)
+	}
+
+	sort.Strings(files)
+
+	groups := map[Digest]*Duplicate{}
+	sizes := map[*parser.TreeNode]int{}
+
+	for _, file := range files {
+		// Encoding a record cannot fail, so neither can the visit function.
+		_, _ = walk(docs[file], func(node *parser.TreeNode, d Digest, _ []byte) error {
+			size := 1
+			for _, child := range node.Children {
+				size += sizes[child]
+			}
+
+			sizes[node] = size
+
+			if size < minSize {
+				return nil
+			}
+
+			group := groups[d]
+			if group == nil {
+				group = &Duplicate{Digest: d, Size: size}
+				groups[d] = group
+			}
+
+			group.Occurrences = append(group.Occurrences, Occurrence{File: file, Node: node})
+
+			return nil
+		})
+	}
+
+	var candidates []*Duplicate
+
+	for _, group := range groups {
+		first := group.Occurrences[0].File
+		for _, o := range group.Occurrences[1:] {
+			if o.File != first {
+				candidates = append(candidates, group)
+				break
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Size != candidates[j].Size {
+			return candidates[i].Size > candidates[j].Size
+		}
+
+		return bytes.Compare(candidates[i].Digest[:], candidates[j].Digest[:]) < 0
+	})
+
+	// covered are the nodes inside of the occurrences of reported duplicates.
+	covered := map[*parser.TreeNode]bool{}
+
+	var duplicates []Duplicate
+
+	for _, candidate := range candidates {
+		all := true
+		for _, o := range candidate.Occurrences {
+			all = all && covered[o.Node]
+		}
+
+		if all {
+			continue
+		}
+
+		for _, o := range candidate.Occurrences {
+			cover(o.Node, covered)
+		}
+
+		duplicates = append(duplicates, *candidate)
+	}
+
+	return duplicates
+}
+
+// cover adds all nodes below node to covered.
+func cover(node *parser.TreeNode, covered map[*parser.TreeNode]bool) {
+	stack := append([]*parser.TreeNode(nil), node.Children...)
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !covered[top] {
+			covered[top] = true
+			stack = append(stack, top.Children...)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNotFound is returned by a Store, if there is no record for a digest.
+var ErrNotFound = errors.New("record not found")
+
+// ErrCorrupted is returned by Load, if a record does not match its digest.
+var ErrCorrupted = errors.New("record does not match its digest")
+
+// Digest is the SHA-256 hash of the record of a node, see Hash.
+type Digest [32]byte
+
+// String returns the digest in hexadecimal form.
+func (d Digest) String() string {
+	return hex.EncodeToString(d[:])
+}
+
+// MarshalText encodes the digest in hexadecimal form.
+func (d Digest) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText decodes a digest in hexadecimal form.
+func (d *Digest) UnmarshalText(text []byte) error {
+	parsed, err := ParseDigest(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = parsed
+
+	return nil
+}
+
+// ParseDigest parses a digest in hexadecimal form.
+func ParseDigest(s string) (Digest, error) {
+	var d Digest
+
+	buf, err := hex.DecodeString(s)
+	if err != nil {
+		return d, fmt.Errorf("invalid digest '%s': %w", s, err)
+	}
+
+	if len(buf) != len(d) {
+		return d, fmt.Errorf("invalid digest '%s': expected %d bytes but got %d", s, len(d), len(buf))
+	}
+
+	copy(d[:], buf)
+
+	return d, nil
+}
+
+// Store keeps the records of nodes by their digest.
+// Records are immutable, so putting a record that exists already does nothing.
+type Store interface {
+	Put(d Digest, record []byte) error
+	// Get returns the record of d or ErrNotFound.
+	Get(d Digest) ([]byte, error)
+}
+
+// MemoryStore is a Store that keeps all records in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	mutex   sync.RWMutex
+	records map[Digest][]byte
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[Digest][]byte{}}
+}
+
+func (s *MemoryStore) Put(d Digest, record []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.records[d]; !ok {
+		s.records[d] = append([]byte(nil), record...)
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Get(d Digest) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	record, ok := s.records[d]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", d, ErrNotFound)
+	}
+
+	return record, nil
+}
+
+// Len returns the number of stored records.
+func (s *MemoryStore) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return len(s.records)
+}
+
+// DirStore is a Store that keeps every record in a file of a directory.
+// The files are distributed into subdirectories by the first two characters of their digest.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore creates a DirStore that keeps its records in dir, which is created if necessary.
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &DirStore{dir: dir}, nil
+}
+
+// file returns the name of the file that contains the record of d.
+func (s *DirStore) file(d Digest) string {
+	name := d.String()
+
+	return filepath.Join(s.dir, name[:2], name[2:])
+}
+
+func (s *DirStore) Put(d Digest, record []byte) error {
+	file := s.file(d)
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that a record is never seen half written.
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(record); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+func (s *DirStore) Get(d Digest) ([]byte, error) {
+	record, err := ioutil.ReadFile(s.file(d))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", d, ErrNotFound)
+	}
+
+	return record, err
+}
@@ -0,0 +1,224 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+)
+
+func parse(t *testing.T, text string) *parser.TreeNode {
+	t.Helper()
+
+	tree, err := parser.NewParser("store_test.go", strings.NewReader(text)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tree
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  string
+		equal bool
+	}{
+		{"same content at other positions", `#!{a @k="v" "l" {b "text"}}`, "#!{\n\ta @k=\"v\" \"l\" {\n\t\tb \"text\"\n\t}\n}", true},
+		{"other attribute", `#!{a @k="v"}`, `#!{a @k="w"}`, false},
+		{"other order", `#!{a, b}`, `#!{b, a}`, false},
+		{"other brackets", `#!{a {b}}`, `#!{a (b)}`, false},
+		{"text and comment", `#!{a "x"}`, "#!{a\n// x\n}", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := Hash(parse(t, tt.a)), Hash(parse(t, tt.b))
+			if (a == b) != tt.equal {
+				t.Errorf("expected equal=%v, but got %s and %s", tt.equal, a, b)
+			}
+		})
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tadl-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	dirStore, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []Store{NewMemoryStore(), dirStore} {
+		tree := parse(t, `#!{server @id="1" "web" {port "80"}, server @id="2" "web" {port "80"}}`)
+
+		d, err := Save(s, tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d != Hash(tree) {
+			t.Errorf("expected digest %s but got %s", Hash(tree), d)
+		}
+
+		loaded, err := Load(s, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if Hash(loaded) != d {
+			t.Errorf("%T: loaded tree differs", s)
+		}
+
+		if _, err := Load(s, Digest{}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%T: expected ErrNotFound but got %v", s, err)
+		}
+	}
+
+	// The equal port elements and their texts are stored only once.
+	s := NewMemoryStore()
+	if _, err := Save(s, parse(t, `#!{a {port "80"}, b {port "80"}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Len() != 5 {
+		t.Errorf("expected 5 records but got %d", s.Len())
+	}
+
+	// Records, which do not match their digest, are rejected.
+	d := Hash(parser.NewNode("a"))
+	if err := s.Put(d, []byte(`{"name":"b"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(s, d); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted but got %v", err)
+	}
+}
+
+func TestReferenceResolve(t *testing.T) {
+	s := NewMemoryStore()
+	tree := parse(t, `#!{config {db {host "localhost"}}, other}`)
+	want := Hash(tree)
+
+	tree, err := Reference(s, tree, func(node *parser.TreeNode) bool {
+		return node.Name == "db"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := tree.Children[0].Children[0]
+	d, ok, err := IsRef(ref)
+	if err != nil || !ok {
+		t.Fatalf("expected reference but got %+v", ref)
+	}
+
+	if d != Hash(parse(t, `#!{db {host "localhost"}}`).Children[0]) {
+		t.Errorf("unexpected digest %s", d)
+	}
+
+	tree, err = Resolve(s, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := Hash(tree); got != want {
+		t.Errorf("expected resolved tree to equal the original")
+	}
+
+	// References in stored subtrees are resolved as well.
+	root, err := Reference(s, NewRef(d), func(*parser.TreeNode) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := Resolve(s, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resolved.Name != "db" || resolved.Children[0].Name != "host" {
+		t.Errorf("unexpected resolved tree %+v", resolved)
+	}
+
+	// A crafted reference to itself cannot be resolved.
+	var self Digest
+	self[0] = 1
+
+	rec := fmt.Sprintf(`{"name":%q,"attributes":[[%q,%q]]}`, RefName, RefAttribute, self)
+	if err := s.Put(self, []byte(rec)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Resolve(s, NewRef(self)); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted but got %v", err)
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	docs := map[string]*parser.TreeNode{
+		"a.tadl": parse(t, `#!{db {host "localhost", port "5432"}, cache {ttl "60"}, log {level "info"}}`),
+		"b.tadl": parse(t, `#!{db {host "localhost", port "5432"}, log {level "debug"}, cache {ttl "60"}}`),
+		"c.tadl": parse(t, `#!{backup {db {host "localhost", port "5432"}}, x {host "localhost"}}`),
+	}
+
+	tests := []struct {
+		minSize int
+		want    []string
+	}{
+		{minSize: 3, want: []string{"db 5 [a.tadl b.tadl c.tadl]", "cache 3 [a.tadl b.tadl]"}},
+		// host is also found outside of db, but ttl and port are not reported again.
+		{minSize: 2, want: []string{"db 5 [a.tadl b.tadl c.tadl]", "cache 3 [a.tadl b.tadl]", "host 2 [a.tadl b.tadl c.tadl c.tadl]"}},
+		{minSize: 6, want: nil},
+	}
+
+	for _, tt := range tests {
+		var got []string
+
+		for _, d := range Duplicates(docs, tt.minSize) {
+			var files []string
+			for _, o := range d.Occurrences {
+				files = append(files, o.File)
+			}
+
+			if d.Digest != Hash(d.Occurrences[0].Node) {
+				t.Errorf("unexpected digest of %s", d.Occurrences[0].Node.Name)
+			}
+
+			got = append(got, fmt.Sprintf("%s %d %v", d.Occurrences[0].Node.Name, d.Size, files))
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("minSize %d: expected %v but got %v", tt.minSize, tt.want, got)
+		}
+	}
+}
+
+func TestParseDigest(t *testing.T) {
+	d := Hash(parser.NewNode("a"))
+
+	parsed, err := ParseDigest(d.String())
+	if err != nil || parsed != d {
+		t.Errorf("expected %s but got %s: %v", d, parsed, err)
+	}
+
+	for _, invalid := range []string{"", "xyz", "abcd"} {
+		if _, err := ParseDigest(invalid); err == nil {
+			t.Errorf("expected error for '%s'", invalid)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/golangee/tadl/parser"
+)
+
+const (
+	// RefName is the name of elements that refer to a stored subtree.
+	RefName = "_ref"
+	// RefAttribute is the attribute of a reference element that contains the digest.
+	RefAttribute = "sha256"
+)
+
+// record is the stored form of a single node. Positions are not part of the record,
+// so equal subtrees of different documents have the same digest.
+type record struct {
+	Name       string      `json:"name,omitempty"`
+	Text       *string     `json:"text,omitempty"`
+	Comment    *string     `json:"comment,omitempty"`
+	Attributes [][2]string `json:"attributes,omitempty"`
+	Labels     []string    `json:"labels,omitempty"`
+	BlockType  string      `json:"blockType,omitempty"`
+	Children   []Digest    `json:"children,omitempty"`
+}
+
+// walk encodes the records of all nodes of tree, children before their parent,
+// and calls visit for each of them. It returns the digest of tree.
+func walk(tree *parser.TreeNode, visit func(node *parser.TreeNode, d Digest, rec []byte) error) (Digest, error) {
+	type item struct {
+		node     *parser.TreeNode
+		expanded bool
+	}
+
+	digests := map[*parser.TreeNode]Digest{}
+	stack := []item{{node: tree}}
+
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if !top.expanded {
+			top.expanded = true
+			node := top.node
+
+			for i := len(node.Children) - 1; i >= 0; i-- {
+				stack = append(stack, item{node: node.Children[i]})
+			}
+
+			continue
+		}
+
+		node := top.node
+		stack = stack[:len(stack)-1]
+
+		rec := record{
+			Name:      node.Name,
+			Text:      node.Text,
+			Comment:   node.Comment,
+			Labels:    node.Labels,
+			BlockType: string(node.BlockType),
+		}
+
+		for i := 0; i < node.Attributes.Len(); i++ {
+			key, value := node.Attributes.Get(i)
+			rec.Attributes = append(rec.Attributes, [2]string{*key, *value})
+		}
+
+		for _, child := range node.Children {
+			rec.Children = append(rec.Children, digests[child])
+			delete(digests, child)
+		}
+
+		buf, err := json.Marshal(rec)
+		if err != nil {
+			return Digest{}, err
+		}
+
+		d := Digest(sha256.Sum256(buf))
+		digests[node] = d
+
+		if visit != nil {
+			if err := visit(node, d, buf); err != nil {
+				return Digest{}, err
+			}
+		}
+	}
+
+	return digests[tree], nil
+}
+
+// Hash returns the structural hash of a tree. Trees with the same names, texts, comments,
+// attributes, labels and brackets have the same hash, no matter where they were parsed from.
+func Hash(tree *parser.TreeNode) Digest {
+	// Encoding a record cannot fail, so neither can walk without a visit function.
+	d, _ := walk(tree, nil)
+
+	return d
+}
+
+// Save puts the records of all nodes of tree into s and returns the digest of tree.
+func Save(s Store, tree *parser.TreeNode) (Digest, error) {
+	return walk(tree, func(_ *parser.TreeNode, d Digest, rec []byte) error {
+		return s.Put(d, rec)
+	})
+}
+
+// Load reads the tree with digest d from s. Every record is checked against its digest,
+// so a corrupted or crafted store cannot make Load or Resolve read an unexpected tree or
+// follow a reference cycle.
+func Load(s Store, d Digest) (*parser.TreeNode, error) {
+	type item struct {
+		digest Digest
+		parent *parser.TreeNode
+	}
+
+	var root *parser.TreeNode
+
+	stack := []item{{digest: d}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		buf, err := s.Get(top.digest)
+		if err != nil {
+			return nil, err
+		}
+
+		if Digest(sha256.Sum256(buf)) != top.digest {
+			return nil, fmt.Errorf("invalid record %s: %w", top.digest, ErrCorrupted)
+		}
+
+		var rec record
+		if err := json.Unmarshal(buf, &rec); err != nil {
+			return nil, fmt.Errorf("invalid record %s: %w", top.digest, err)
+		}
+
+		node := parser.NewNode(rec.Name).Block(parser.BlockType(rec.BlockType))
+		node.Text = rec.Text
+		node.Comment = rec.Comment
+		node.Labels = rec.Labels
+
+		for _, attr := range rec.Attributes {
+			node.AddAttribute(attr[0], attr[1])
+		}
+
+		if top.parent == nil {
+			root = node
+		} else {
+			top.parent.Children = append(top.parent.Children, node)
+		}
+
+		for i := len(rec.Children) - 1; i >= 0; i-- {
+			stack = append(stack, item{digest: rec.Children[i], parent: node})
+		}
+	}
+
+	return root, nil
+}
+
+// NewRef creates a reference element for the subtree with digest d.
+func NewRef(d Digest) *parser.TreeNode {
+	return parser.NewNode(RefName).AddAttribute(RefAttribute, d.String())
+}
+
+// IsRef returns the digest of a reference element. ok is false, if node is no reference.
+func IsRef(node *parser.TreeNode) (d Digest, ok bool, err error) {
+	if !node.IsNode() || node.Name != RefName {
+		return d, false, nil
+	}
+
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, value := node.Attributes.Get(i)
+		if *key == RefAttribute {
+			d, err = ParseDigest(*value)
+
+			return d, err == nil, err
+		}
+	}
+
+	return d, false, nil
+}
+
+// Reference saves every subtree of tree for which shouldStore returns true into s
+// and replaces it with a reference element. Subtrees of a stored subtree are not
+// visited. The tree is modified in place, the returned root differs only if the root
+// itself was replaced.
+func Reference(s Store, tree *parser.TreeNode, shouldStore func(node *parser.TreeNode) bool) (*parser.TreeNode, error) {
+	if shouldStore(tree) {
+		d, err := Save(s, tree)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewRef(d), nil
+	}
+
+	stack := []*parser.TreeNode{tree}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for i, child := range node.Children {
+			if !shouldStore(child) {
+				stack = append(stack, child)
+				continue
+			}
+
+			d, err := Save(s, child)
+			if err != nil {
+				return nil, err
+			}
+
+			node.Children[i] = NewRef(d)
+		}
+	}
+
+	return tree, nil
+}
+
+// Resolve replaces all reference elements in tree with the subtrees loaded from s.
+// The tree is modified in place, the returned root differs only if the root itself was a reference.
+func Resolve(s Store, tree *parser.TreeNode) (*parser.TreeNode, error) {
+	// resolve loads the subtree of a reference, which may be a reference again.
+	resolve := func(node *parser.TreeNode) (*parser.TreeNode, error) {
+		for {
+			d, ok, err := IsRef(node)
+			if err != nil || !ok {
+				return node, err
+			}
+
+			node, err = Load(s, d)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tree, err := resolve(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	stack := []*parser.TreeNode{tree}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for i, child := range node.Children {
+			resolved, err := resolve(child)
+			if err != nil {
+				return nil, err
+			}
+
+			node.Children[i] = resolved
+			stack = append(stack, resolved)
+		}
+	}
+
+	return tree, nil
+}
@@ -0,0 +1,7 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package tabular converts between CSV/TSV records and Tadl trees.
+// Each record becomes a child element of the root, the header of the records decides
+// how the cells are represented, see HeaderMode.
+package tabular
@@ -0,0 +1,252 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tabular
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/golangee/tadl/token"
+)
+
+// HeaderMode describes how the header row is used to represent the cells of a record.
+type HeaderMode int
+
+const (
+	// HeaderRow keeps the header as the first row element. The cells of every row are text children.
+	// This is the form that can be unmarshalled with the 'table' struct tag.
+	HeaderRow HeaderMode = iota
+	// HeaderNames uses the header as names for child elements of each row,
+	// which contain the cell as text.
+	HeaderNames
+	// HeaderAttributes uses the header as attribute keys of each row.
+	HeaderAttributes
+)
+
+// Options configure the conversion.
+type Options struct {
+	// Comma is the field delimiter. It defaults to ',', use '\t' for TSV.
+	Comma rune
+	// RowName is the name of the element for each record. It defaults to "row".
+	RowName string
+	// Header decides how the cells are represented in the tree.
+	Header HeaderMode
+}
+
+// CSV returns the default options for comma separated values.
+func CSV() Options {
+	return Options{Comma: ',', RowName: "row"}
+}
+
+// TSV returns the default options for tab separated values.
+func TSV() Options {
+	return Options{Comma: '\t', RowName: "row"}
+}
+
+func (o Options) comma() rune {
+	if o.Comma == 0 {
+		return ','
+	}
+
+	return o.Comma
+}
+
+func (o Options) rowName() string {
+	if o.RowName == "" {
+		return "row"
+	}
+
+	return o.RowName
+}
+
+// Read reads all records from r into a tree. The first record is the header. For HeaderNames,
+// each header must be an identifier, see token.IsIdentifier, as it becomes the name of an element.
+func Read(r io.Reader, opts Options) (*parser.TreeNode, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = opts.comma()
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read records: %w", err)
+	}
+
+	root := parser.NewNode("root").Block(parser.BlockNormal)
+	if len(records) == 0 {
+		return root, nil
+	}
+
+	header := records[0]
+
+	if opts.Header == HeaderRow {
+		for _, record := range records {
+			row := parser.NewNode(opts.rowName()).Block(parser.BlockGroup)
+			for _, cell := range record {
+				row.AddChildren(parser.NewStringNode(cell))
+			}
+
+			root.AddChildren(row)
+		}
+
+		return root, nil
+	}
+
+	if opts.Header == HeaderNames {
+		// The names must be written and parsed back as element names.
+		for j, name := range header {
+			if !token.IsIdentifier(name) {
+				return nil, fmt.Errorf("record 1, field %d: header %q is no valid element name", j+1, name)
+			}
+		}
+	}
+
+	for i, record := range records[1:] {
+		if len(record) > len(header) {
+			return nil, fmt.Errorf("record %d has %d fields, but the header only %d", i+2, len(record), len(header))
+		}
+
+		row := parser.NewNode(opts.rowName())
+
+		for j, cell := range record {
+			switch opts.Header {
+			case HeaderNames:
+				row.Block(parser.BlockNormal)
+				row.AddChildren(parser.NewNode(header[j]).AddChildren(parser.NewStringNode(cell)))
+			case HeaderAttributes:
+				row.AddAttribute(header[j], cell)
+			default:
+				return nil, fmt.Errorf("invalid header mode %d", opts.Header)
+			}
+		}
+
+		root.AddChildren(row)
+	}
+
+	return root, nil
+}
+
+// Write writes the rows of tree to w. Only child elements of tree named like the configured
+// row name are written. For HeaderNames and HeaderAttributes the header is the union of all
+// names or keys in the order of their first appearance. Missing cells are left empty.
+func Write(w io.Writer, tree *parser.TreeNode, opts Options) error {
+	var rows []*parser.TreeNode
+
+	for _, child := range tree.Children {
+		if child.IsNode() && child.Name == opts.rowName() {
+			rows = append(rows, child)
+		}
+	}
+
+	var records [][]string
+
+	if opts.Header == HeaderRow {
+		for _, row := range rows {
+			var record []string
+
+			for _, cell := range row.Children {
+				text, err := cellText(cell)
+				if err != nil {
+					return err
+				}
+
+				record = append(record, text)
+			}
+
+			records = append(records, record)
+		}
+	} else {
+		var header []string
+
+		index := map[string]int{}
+		cells := make([]map[string]string, len(rows))
+
+		for i, row := range rows {
+			cells[i] = map[string]string{}
+
+			add := func(key, value string) {
+				if _, ok := index[key]; !ok {
+					index[key] = len(header)
+					header = append(header, key)
+				}
+
+				cells[i][key] = value
+			}
+
+			switch opts.Header {
+			case HeaderNames:
+				for _, child := range row.Children {
+					if !child.IsNode() {
+						continue
+					}
+
+					text, err := innerText(child)
+					if err != nil {
+						return err
+					}
+
+					add(child.Name, text)
+				}
+			case HeaderAttributes:
+				for j := 0; j < row.Attributes.Len(); j++ {
+					key, value := row.Attributes.Get(j)
+					add(*key, *value)
+				}
+			default:
+				return fmt.Errorf("invalid header mode %d", opts.Header)
+			}
+		}
+
+		records = append(records, header)
+
+		for i := range rows {
+			record := make([]string, len(header))
+			for key, value := range cells[i] {
+				record[index[key]] = value
+			}
+
+			records = append(records, record)
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = opts.comma()
+
+	if err := writer.WriteAll(records); err != nil {
+		return fmt.Errorf("cannot write records: %w", err)
+	}
+
+	return nil
+}
+
+// cellText returns the text of a cell, which is either a text or an element without children.
+func cellText(cell *parser.TreeNode) (string, error) {
+	if cell.IsText() {
+		return *cell.Text, nil
+	}
+
+	if cell.IsNode() && len(cell.Children) == 0 {
+		return cell.Name, nil
+	}
+
+	return "", fmt.Errorf("cell '%s' must be text or an element without children", cell.Name)
+}
+
+// innerText returns the concatenated text children of node.
+func innerText(node *parser.TreeNode) (string, error) {
+	var text string
+
+	for _, child := range node.Children {
+		if child.IsNode() {
+			return "", fmt.Errorf("cell '%s' must only contain text", node.Name)
+		}
+
+		if child.IsText() {
+			text += *child.Text
+		}
+	}
+
+	return text, nil
+}
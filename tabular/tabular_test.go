@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tabular
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+	"github.com/r3labs/diff/v2"
+)
+
+func TestReadWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		opts    Options
+		want    *parser.TreeNode
+		wantErr string
+	}{
+		{
+			name: "header row",
+			text: "name,age\nAlice,30\n",
+			opts: CSV(),
+			want: parser.NewNode("root").Block(parser.BlockNormal).AddChildren(
+				parser.NewNode("row").Block(parser.BlockGroup).AddChildren(
+					parser.NewStringNode("name"),
+					parser.NewStringNode("age"),
+				),
+				parser.NewNode("row").Block(parser.BlockGroup).AddChildren(
+					parser.NewStringNode("Alice"),
+					parser.NewStringNode("30"),
+				),
+			),
+		},
+		{
+			name: "header names",
+			text: "name\tage\nAlice\t30\n",
+			opts: Options{Comma: '\t', RowName: "person", Header: HeaderNames},
+			want: parser.NewNode("root").Block(parser.BlockNormal).AddChildren(
+				parser.NewNode("person").Block(parser.BlockNormal).AddChildren(
+					parser.NewNode("name").AddChildren(parser.NewStringNode("Alice")),
+					parser.NewNode("age").AddChildren(parser.NewStringNode("30")),
+				),
+			),
+		},
+		{
+			name: "header attributes",
+			text: "name,age\nAlice,30\n",
+			opts: Options{Header: HeaderAttributes},
+			want: parser.NewNode("root").Block(parser.BlockNormal).AddChildren(
+				parser.NewNode("row").
+					AddAttribute("name", "Alice").
+					AddAttribute("age", "30"),
+			),
+		},
+		{
+			name:    "record longer than header",
+			text:    "name\nAlice,30\n",
+			opts:    Options{Header: HeaderNames},
+			wantErr: "record 2 has 2 fields, but the header only 1",
+		},
+		{
+			name:    "header name with a space",
+			text:    "id,first name\n1,Alice\n",
+			opts:    Options{Header: HeaderNames},
+			wantErr: `record 1, field 2: header "first name" is no valid element name`,
+		},
+		{
+			name:    "empty header name",
+			text:    ",age\nAlice,30\n",
+			opts:    Options{Header: HeaderNames},
+			wantErr: `record 1, field 1: header "" is no valid element name`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := Read(strings.NewReader(tt.text), tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, but got %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			differences, err := diff.Diff(tt.want, tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, d := range differences {
+				t.Errorf("property '%s' differs, expected %v but got %v", strings.Join(d.Path, "."), d.From, d.To)
+			}
+
+			var sb strings.Builder
+			if err := Write(&sb, tree, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			if sb.String() != tt.text {
+				t.Errorf("expected round trip to %q, but got %q", tt.text, sb.String())
+			}
+		})
+	}
+}
+
+func TestWriteParsed(t *testing.T) {
+	tree, err := parser.NewParser("tabular_test.go", strings.NewReader(`#!{
+		row @name="Alice" @age="30",
+		row @age="25" @city="Berlin",
+		other,
+	}`)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sb strings.Builder
+	if err := Write(&sb, tree, Options{Header: HeaderAttributes}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "name,age,city\nAlice,30,\n,25,Berlin\n"
+	if sb.String() != want {
+		t.Errorf("expected %q, but got %q", want, sb.String())
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package token
+
+import (
+	"bytes"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// maxTextBufferHint limits how much a text buffer is grown up front.
+	maxTextBufferHint = 4 << 10
+	// maxPooledTextBuffer is the largest capacity of a text buffer that is returned to the pool.
+	// Larger buffers are left to the garbage collector, so that a single huge text does not
+	// keep its memory alive.
+	maxPooledTextBuffer = 64 << 10
+)
+
+// textBufferPool holds the buffers which are used to assemble the values of tokens.
+var textBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getTextBuffer returns an empty buffer from the pool. The buffer is sized to hold
+// the input that is already available in the reader, which is the upper bound for the
+// text that can be read without blocking.
+func (l *Lexer) getTextBuffer() *bytes.Buffer {
+	buf := textBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	hint := l.r.Buffered()
+	if hint > maxTextBufferHint {
+		hint = maxTextBufferHint
+	}
+
+	buf.Grow(hint)
+
+	return buf
+}
+
+// putTextBuffer returns a buffer obtained by getTextBuffer to the pool.
+// The buffer must not be used afterwards.
+func putTextBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledTextBuffer {
+		return
+	}
+
+	textBufferPool.Put(buf)
+}
+
+// writeRune appends r to buf. ASCII runes, which make up most of the usual input,
+// are written as a single byte without utf8 encoding.
+func writeRune(buf *bytes.Buffer, r rune) {
+	if r < utf8.RuneSelf {
+		buf.WriteByte(byte(r))
+
+		return
+	}
+
+	buf.WriteRune(r)
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package token
+
+import "strings"
+
+const (
+	// G1Escapable contains the runes, which are escaped by a preceding '\' in G1 text and attribute values.
+	// A '\' before any other rune is a literal backslash.
+	G1Escapable = `\#@{}`
+	// G2Escapable contains the runes, which are escaped by a preceding '\' in G2 quoted strings.
+	// A '\' before any other rune is a literal backslash.
+	G2Escapable = `\"`
+)
+
+// EscapeG1 escapes text, so that it is read back unchanged as G1 text or attribute value.
+func EscapeG1(text string) string {
+	return escape(text, G1Escapable)
+}
+
+// EscapeG2 escapes text, so that it is read back unchanged as G2 quoted string.
+// The surrounding quotes are not added.
+func EscapeG2(text string) string {
+	return escape(text, G2Escapable)
+}
+
+// escape puts a '\' before every rune in text, which is contained in escapable.
+func escape(text, escapable string) string {
+	if !strings.ContainsAny(text, escapable) {
+		return text
+	}
+
+	var sb strings.Builder
+
+	for _, r := range text {
+		if strings.ContainsRune(escapable, r) {
+			sb.WriteByte('\\')
+		}
+
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
+
+// IsIdentifier returns true, if text can be written as identifier, like the name of an element
+// or the key of an attribute. Identifiers consist of the runes [a-zA-Z0-9_] and cannot be escaped.
+// Other attribute keys must be quoted, see QuoteKey.
+func IsIdentifier(text string) bool {
+	if text == "" {
+		return false
+	}
+
+	for _, r := range text {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// QuoteKey returns key as it is written after the '@' of an attribute: unchanged, if it is an
+// identifier, and as G2 quoted string otherwise, like "content-type".
+func QuoteKey(key string) string {
+	if IsIdentifier(key) {
+		return key
+	}
+
+	return `"` + EscapeG2(key) + `"`
+}
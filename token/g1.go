@@ -4,21 +4,28 @@
 package token
 
 import (
-	"bytes"
 	"errors"
 	"io"
 	"strings"
 )
 
 // g1Text parses a text sequence until next rune is in stopAt or EOF.
+// A '\' escapes the following rune, if it is one of G1Escapable, and is kept literally otherwise.
 func (l *Lexer) g1Text(stopAt string) (*CharData, error) {
 	startPos := l.Pos()
 
-	var tmp bytes.Buffer
+	tmp := l.getTextBuffer()
+	defer putTextBuffer(tmp)
+
+	escaped := false
 
 	for {
 		r, err := l.nextR()
 		if errors.Is(err, io.EOF) {
+			if escaped {
+				writeRune(tmp, '\\')
+			}
+
 			if tmp.Len() == 0 {
 				return nil, io.EOF
 			}
@@ -30,27 +37,38 @@ func (l *Lexer) g1Text(stopAt string) (*CharData, error) {
 			return nil, err
 		}
 
-		if strings.ContainsRune(stopAt, r) {
-			if l.gIsEscaped() {
+		if escaped {
+			escaped = false
 
-				// Remove previous '\'
-				//tmp.Truncate(tmp.Len() - 1)
-				l.prevR()
-				break
-			} else {
-				l.prevR() // reset last read char
+			if l.lineContinuation && isNewline(r) {
+				// An escaped newline continues the line. Drop the '\' and the newline.
+				l.eatCRLF(r)
 
-				break
+				continue
 			}
-		} else {
-			if l.gIsEscaped() {
-				if r != '\\' {
-					return nil, NewPosError(l.node(), "lexer error - unexpected rune")
-				}
+
+			if strings.ContainsRune(G1Escapable, r) {
+				writeRune(tmp, r)
+
+				continue
 			}
+
+			writeRune(tmp, '\\')
+		}
+
+		if r == '\\' {
+			escaped = true
+
+			continue
+		}
+
+		if strings.ContainsRune(stopAt, r) {
+			l.prevR() // reset last read char
+
+			break
 		}
 
-		tmp.WriteRune(r)
+		writeRune(tmp, r)
 	}
 
 	text := &CharData{}
@@ -61,13 +79,17 @@ func (l *Lexer) g1Text(stopAt string) (*CharData, error) {
 	return text, nil
 }
 
+// g1LineEnd reads the newline that ends a G1 line. This may be a '\n', a "\r\n" or a lone '\r'.
 func (l *Lexer) g1LineEnd() (*G1LineEnd, error) {
 	startPos := l.Pos()
 
-	if r, _ := l.nextR(); r != '\n' {
+	r, _ := l.nextR()
+	if !isNewline(r) {
 		return nil, NewPosError(l.node(), "expected newline")
 	}
 
+	l.eatCRLF(r)
+
 	lineEnd := &G1LineEnd{}
 	lineEnd.Position.BeginPos = startPos
 	lineEnd.Position.EndPos = l.pos
@@ -4,9 +4,9 @@
 package token
 
 import (
-	"bytes"
 	"errors"
 	"io"
+	"strings"
 )
 
 // g2Preamble reads the '#!' preamble of G2 grammars.
@@ -50,6 +50,7 @@ func (l *Lexer) g2Arrow() (*G2Arrow, error) {
 }
 
 // g2CharData reads a "quoted string".
+// A '\' escapes the following rune, if it is one of G2Escapable, and is kept literally otherwise.
 func (l *Lexer) g2CharData() (*CharData, error) {
 	startPos := l.Pos()
 
@@ -59,7 +60,10 @@ func (l *Lexer) g2CharData() (*CharData, error) {
 		return nil, NewPosError(l.node(), "expected '\"'")
 	}
 
-	var tmp bytes.Buffer
+	tmp := l.getTextBuffer()
+	defer putTextBuffer(tmp)
+
+	escaped := false
 
 	for {
 		r, err := l.nextR()
@@ -67,16 +71,25 @@ func (l *Lexer) g2CharData() (*CharData, error) {
 			break
 		}
 
-		if r == '"' {
-			if l.gIsEscaped() {
-				// Remove previous '\'
-				tmp.Truncate(tmp.Len() - 1)
-			} else {
-				break
+		if err != nil {
+			return nil, err
+		}
+
+		if escaped {
+			escaped = false
+
+			if !strings.ContainsRune(G2Escapable, r) {
+				writeRune(tmp, '\\')
 			}
+		} else if r == '\\' {
+			escaped = true
+
+			continue
+		} else if r == '"' {
+			break
 		}
 
-		tmp.WriteRune(r)
+		writeRune(tmp, r)
 	}
 
 	chardata := &CharData{}
@@ -4,9 +4,9 @@
 package token
 
 import (
-	"bytes"
 	"errors"
 	"io"
+	"strconv"
 	"strings"
 )
 
@@ -52,8 +52,9 @@ func (l *Lexer) gBlockEnd() (*BlockEnd, error) {
 
 // gSkipWhitespace skips whitespace characters.
 // Any whitespace characters in dontSkip will not be skipped.
+// A '\n' in dontSkip stands for all newlines, including '\r'.
 func (l *Lexer) gSkipWhitespace(dontSkip ...rune) error {
-	whitespaces := " \n\t"
+	whitespaces := " \n\r\t"
 	dontSkipStr := string(dontSkip)
 
 	for {
@@ -62,7 +63,12 @@ func (l *Lexer) gSkipWhitespace(dontSkip ...rune) error {
 			return err
 		}
 
-		if strings.ContainsRune(whitespaces, r) && !strings.ContainsRune(dontSkipStr, r) {
+		check := r
+		if check == '\r' {
+			check = '\n'
+		}
+
+		if strings.ContainsRune(whitespaces, r) && !strings.ContainsRune(dontSkipStr, check) {
 			// skip this character
 			continue
 		} else {
@@ -78,7 +84,8 @@ func (l *Lexer) gSkipWhitespace(dontSkip ...rune) error {
 func (l *Lexer) gIdent() (*Identifier, error) {
 	startPos := l.Pos()
 
-	var tmp bytes.Buffer
+	tmp := l.getTextBuffer()
+	defer putTextBuffer(tmp)
 
 	for {
 		r, err := l.nextR()
@@ -100,7 +107,7 @@ func (l *Lexer) gIdent() (*Identifier, error) {
 			break
 		}
 
-		tmp.WriteRune(r)
+		writeRune(tmp, r)
 	}
 
 	if tmp.Len() == 0 {
@@ -115,6 +122,32 @@ func (l *Lexer) gIdent() (*Identifier, error) {
 	return ident, nil
 }
 
+// gAttributeKey reads the key of an attribute. Keys with other runes than those of an identifier,
+// like "content-type", are written as G2 quoted string.
+func (l *Lexer) gAttributeKey() (*Identifier, error) {
+	r, err := l.nextR()
+	if err != nil {
+		return nil, err
+	}
+
+	l.prevR()
+
+	if r != '"' {
+		return l.gIdent()
+	}
+
+	key, err := l.g2CharData()
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Value == "" {
+		return nil, NewPosError(key.Position, "expected attribute key")
+	}
+
+	return &Identifier{Position: key.Position, Value: key.Value}, nil
+}
+
 // gIdentChar is [a-zA-Z0-9_]
 func (l *Lexer) gIdentChar(r rune) bool {
 	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || (r == '_')
@@ -178,20 +211,14 @@ func (l *Lexer) gDefineElement() (*DefineElement, error) {
 	return define, nil
 }
 
-// gIsEscaped checks if the last read rune is a '\'.
-func (l *Lexer) gIsEscaped() bool {
-	if r, ok := l.lastRune(-2); ok {
-		return r == '\\'
-	}
-
-	return false
-}
-
 // gCommentLine reads arbitrary text for the rest of the line.
 func (l *Lexer) gCommentLine() (*CharData, error) {
 	startPos := l.Pos()
 
-	var tmp bytes.Buffer
+	tmp := l.getTextBuffer()
+	defer putTextBuffer(tmp)
+
+	newline := false
 
 	for {
 		r, err := l.nextR()
@@ -207,11 +234,15 @@ func (l *Lexer) gCommentLine() (*CharData, error) {
 			return nil, err
 		}
 
-		if r == '\n' {
+		if isNewline(r) {
+			l.eatCRLF(r)
+
+			newline = true
+
 			break
 		}
 
-		tmp.WriteRune(r)
+		writeRune(tmp, r)
 	}
 
 	text := &CharData{}
@@ -219,5 +250,54 @@ func (l *Lexer) gCommentLine() (*CharData, error) {
 	text.Position.BeginPos = startPos
 	text.Position.EndPos = l.pos
 
+	if l.lineDirectives && newline {
+		l.lineDirective(text.Value)
+	}
+
 	return text, nil
 }
+
+// eatCRLF consumes the '\n' of a "\r\n" sequence, if r is the '\r' of that sequence.
+func (l *Lexer) eatCRLF(r rune) {
+	if r != '\r' {
+		return
+	}
+
+	if next, err := l.nextR(); err == nil && next != '\n' {
+		l.prevR()
+	}
+}
+
+// lineDirective applies comment to the position of the following line, if it is a line directive
+// like "line gen.tadl:12", see WithLineDirectives.
+func (l *Lexer) lineDirective(comment string) {
+	directive := strings.TrimSpace(comment)
+	if !strings.HasPrefix(directive, "line ") {
+		return
+	}
+
+	directive = strings.TrimSpace(strings.TrimPrefix(directive, "line "))
+
+	// The file name may contain colons itself, like a drive letter.
+	i := strings.LastIndexByte(directive, ':')
+	if i < 0 {
+		return
+	}
+
+	line, err := strconv.Atoi(directive[i+1:])
+	if err != nil || line < 1 {
+		return
+	}
+
+	if file := directive[:i]; file != "" {
+		l.pos.File = file
+	}
+
+	// Runes of the following line may have been read ahead already.
+	delta := int32(line - l.pos.Line)
+	for j := l.bufPos; j < len(l.buf); j++ {
+		l.buf[j].line += delta
+	}
+
+	l.pos.Line = line
+}
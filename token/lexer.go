@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"unicode"
+	"unicode/utf8"
 )
 
 // GrammarMode is used to identify if the lexer is
@@ -29,6 +30,8 @@ const (
 	WantNothing     WantMode = "Nothing"
 	WantCommentLine WantMode = "CommentLine"
 	WantIdentifier  WantMode = "Identifier"
+	// WantAttributeKey expects the key of a G2 attribute, which may be quoted.
+	WantAttributeKey WantMode = "AttributeKey"
 	// G1 attributes are special, as the whole text inside the brackets has
 	// to be lexed as one CharData token. We need several new WantModes to
 	// properly expect all tokens in "@key{value}" after a "@" appeared.
@@ -50,6 +53,9 @@ type runeWithPos struct {
 	r    rune
 	line int32
 	col  int32
+	// offset is the byte offset of r and size its encoded length.
+	offset int32
+	size   int8
 }
 
 // Lexer can be used to get individual tokens.
@@ -64,20 +70,143 @@ type Lexer struct {
 	started bool
 	mode    GrammarMode
 	want    WantMode
+	// lineContinuation enables joining lines of G1 text that end with a '\\'.
+	lineContinuation bool
+	// tabWidth is the number of columns a tab advances to the next tab stop.
+	tabWidth int
+	// lineDirectives enables comments like "line gen.tadl:12", see WithLineDirectives.
+	lineDirectives bool
+	// rejectControl enables errors for control characters, see WithRejectControlCharacters.
+	rejectControl bool
+	// preambleAttributes is true while the attributes directly following the G2Preamble are lexed.
+	// These are written like G1 attributes.
+	preambleAttributes bool
+	// island is true while a G2 island inside G1 is lexed, like "#!{a, b}". islandDepth counts
+	// its open blocks, G1 continues after the block that started the island is closed.
+	island      bool
+	islandDepth int
+	// invalid is the error for invalid input, like a byte that is not UTF-8. It is returned again
+	// by every further read, so that it is not lost if it was only hit while peeking.
+	invalid *PosError
+}
+
+// Option configures optional behavior of a Lexer.
+type Option func(l *Lexer)
+
+// WithLineContinuation makes the lexer treat a newline that is escaped with a '\\'
+// as a continuation of the current line. Both, the '\\' and the newline, are removed
+// from the text. This also applies to G1 lines, which are not ended by an escaped newline.
+func WithLineContinuation() Option {
+	return func(l *Lexer) {
+		l.lineContinuation = true
+	}
+}
+
+// WithTabWidth sets the width of tab stops that is used to compute the columns of positions.
+// By default a tab counts as a single column. Use the tab width of your editor, so that the
+// columns of diagnostics line up with it. Widths smaller than one are ignored.
+func WithTabWidth(width int) Option {
+	return func(l *Lexer) {
+		if width > 0 {
+			l.tabWidth = width
+		}
+	}
+}
+
+// WithLineDirectives makes the lexer apply line directives, so that positions refer to the original
+// source of a generated document. A directive is a comment of its own line, which sets the file and
+// line number of the following line, like the "//line" comments of Go:
+//
+//  #!{
+//      //line users.csv:12
+//      user "alice"
+//  }
+//
+// In G1 it is written as "#?line users.csv:12". An empty file name keeps the current one and
+// comments, which are no valid directives, are left alone. Offsets are not changed, they always
+// refer to the lexed input.
+func WithLineDirectives() Option {
+	return func(l *Lexer) {
+		l.lineDirectives = true
+	}
+}
+
+// WithRejectControlCharacters makes the lexer fail on control characters other than tab,
+// line feed and carriage return. These usually only appear in binary data, so files which are
+// contaminated by it are reported with the offending bytes instead of an unexpected token.
+// By default control characters are read like any other rune, as text cannot escape them and
+// the serializers write them unchanged.
+func WithRejectControlCharacters() Option {
+	return func(l *Lexer) {
+		l.rejectControl = true
+	}
 }
 
 // NewLexer creates a new instance, ready to start parsing
-func NewLexer(filename string, r io.Reader) *Lexer {
+func NewLexer(filename string, r io.Reader, opts ...Option) *Lexer {
 	l := &Lexer{}
 	l.r = bufio.NewReader(r)
 	l.pos.File = filename
 	l.pos.Line = 1
 	l.pos.Col = 1
 	l.want = WantNothing
+	l.tabWidth = 1
+
+	for _, opt := range opts {
+		opt(l)
+	}
 
 	return l
 }
 
+// maxReusedRunes is the largest capacity of the rune buffer, which is kept by Reset.
+const maxReusedRunes = 64 << 10
+
+// Reset makes the lexer read r from the start, like a new lexer with the same options.
+// Its buffers are kept, so that a lexer can be reused for many inputs.
+func (l *Lexer) Reset(filename string, r io.Reader) {
+	buf := l.buf[:0]
+	if cap(buf) > maxReusedRunes {
+		buf = nil
+	}
+
+	l.r.Reset(r)
+
+	*l = Lexer{
+		r:                l.r,
+		buf:              buf,
+		lineContinuation: l.lineContinuation,
+		tabWidth:         l.tabWidth,
+		lineDirectives:   l.lineDirectives,
+		rejectControl:    l.rejectControl,
+	}
+
+	l.pos.File = filename
+	l.pos.Line = 1
+	l.pos.Col = 1
+	l.want = WantNothing
+}
+
+// DetectMode reports the grammar of the input without lexing it.
+// Only the first bytes are looked at: the input is G2 if it starts with the '#!' preamble,
+// whose position is returned as well, and G1 otherwise.
+// The bytes are only peeked, so no input is consumed and r can be passed to a lexer afterwards.
+func DetectMode(r *bufio.Reader) (GrammarMode, Position, error) {
+	b, err := r.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return G1, Position{}, err
+	}
+
+	if len(b) < 2 || b[0] != '#' || b[1] != '!' {
+		return G1, Position{}, nil
+	}
+
+	return G2, Position{
+		BeginPos: Pos{Line: 1, Col: 1},
+		EndPos:   Pos{Line: 1, Col: 3, Offset: 2},
+	}, nil
+}
+
 // Token returns the next TADL token in the input stream.
 // At the end of the input stream, Token returns nil, io.EOF.
 func (l *Lexer) Token() (Token, error) {
@@ -102,6 +231,7 @@ func (l *Lexer) Token() (Token, error) {
 		// Find out if we should switch to g2 by checking if the first two runes are '#!'
 		if r1 == '#' && r2 == '!' {
 			l.mode = G2
+			l.preambleAttributes = true
 			tok, err = l.g2Preamble()
 			l.gSkipWhitespace()
 
@@ -112,7 +242,7 @@ func (l *Lexer) Token() (Token, error) {
 	// Special handling for G1 attributes
 	switch l.want {
 	case WantG1AttributeIdent:
-		tok, err = l.gIdent()
+		tok, err = l.gAttributeKey()
 		if err != nil {
 			return nil, err
 		}
@@ -137,7 +267,7 @@ func (l *Lexer) Token() (Token, error) {
 		return tok, err
 	case WantG1AttributeCharData:
 		if l.mode == G1Line {
-			tok, err = l.g1Text("}\n")
+			tok, err = l.g1Text("}\r\n")
 		} else {
 			tok, err = l.g1Text("}")
 		}
@@ -179,6 +309,12 @@ func (l *Lexer) Token() (Token, error) {
 			tok, err = l.g1CommentStart()
 			l.want = WantCommentLine
 			l.gSkipWhitespace()
+		} else if r1 == '#' && r2 == '!' {
+			// A '#!' inside G1 starts a G2 island.
+			tok, err = l.g2Preamble()
+			l.mode = G2
+			l.island = true
+			l.gSkipWhitespace()
 		} else if r1 == '#' {
 			tok, err = l.gDefineElement()
 			l.want = WantIdentifier
@@ -195,7 +331,7 @@ func (l *Lexer) Token() (Token, error) {
 			tok, err = l.g1Text("#}")
 		}
 	case G1Line:
-		if r1 == '\n' {
+		if isNewline(r1) {
 			// Newline marks the end of this G1Line. Switch back to G2.
 			tok, err = l.g1LineEnd()
 			l.mode = G2
@@ -218,36 +354,55 @@ func (l *Lexer) Token() (Token, error) {
 			tok, err = l.gBlockEnd()
 			l.gSkipWhitespace('\n')
 		} else {
-			tok, err = l.g1Text("#}\n")
+			tok, err = l.g1Text("#}\r\n")
 		}
 	case G2:
+		if r1 != '@' {
+			l.preambleAttributes = false
+		}
+
 		if l.want == WantCommentLine {
 			tok, err = l.gCommentLine()
 			l.want = WantNothing
 			l.gSkipWhitespace()
+		} else if l.want == WantAttributeKey {
+			tok, err = l.gAttributeKey()
+			l.want = WantNothing
+			l.gSkipWhitespace()
 		} else if r1 == '{' {
 			tok, err = l.gBlockStart()
+			l.islandBlock(1)
 			l.gSkipWhitespace()
 		} else if r1 == '}' {
 			tok, err = l.gBlockEnd()
+			l.islandBlock(-1)
 			l.gSkipWhitespace()
 		} else if r1 == '(' {
 			tok, err = l.g2GroupStart()
+			l.islandBlock(1)
 			l.gSkipWhitespace()
 		} else if r1 == ')' {
 			tok, err = l.g2GroupEnd()
+			l.islandBlock(-1)
 			l.gSkipWhitespace()
 		} else if r1 == '<' {
 			tok, err = l.g2GenericStart()
+			l.islandBlock(1)
 			l.gSkipWhitespace()
 		} else if r1 == '>' {
 			tok, err = l.g2GenericEnd()
+			l.islandBlock(-1)
 			l.gSkipWhitespace()
 		} else if r1 == '"' {
 			tok, err = l.g2CharData()
 			l.gSkipWhitespace()
 		} else if r1 == '@' {
 			tok, err = l.gDefineAttribute()
+			if l.preambleAttributes {
+				l.want = WantG1AttributeIdent
+			} else {
+				l.want = WantAttributeKey
+			}
 		} else if r1 == '#' {
 			// A '#' marks the start of a G1 line.
 			tok, err = l.gDefineElement()
@@ -292,48 +447,122 @@ func (l *Lexer) Token() (Token, error) {
 	return tok, nil
 }
 
+// islandBlock counts a block that is opened (1) or closed (-1) in G2. When the block that
+// started a G2 island is closed, the lexer switches back to G1.
+func (l *Lexer) islandBlock(delta int) {
+	if !l.island {
+		return
+	}
+
+	l.islandDepth += delta
+	if l.islandDepth == 0 {
+		l.island = false
+		l.mode = G1
+	}
+}
+
 // nextR reads the next rune and updates the position.
+// A "\r\n" sequence and a lone '\r' are both counted as a single line break.
 func (l *Lexer) nextR() (rune, error) {
 	if l.bufPos < len(l.buf) {
 		r := l.buf[l.bufPos]
+		prevCR := l.bufPos > 0 && l.buf[l.bufPos-1].r == '\r'
 		l.bufPos++
 		l.pos.Line = int(r.line)
-		// col needs to be incremented so that the lexer points to the next rune.
-		l.pos.Col = int(r.col) + 1
-
-		if r.r == '\n' {
-			l.pos.Line++
-			l.pos.Col = 1
-		}
+		l.pos.Col = int(r.col)
+		l.pos.Offset = int(r.offset) + int(r.size)
+		l.advance(r.r, prevCR)
 
 		return r.r, nil
 	}
 
+	if l.invalid != nil {
+		return unicode.ReplacementChar, l.invalid
+	}
+
 	r, size, err := l.r.ReadRune()
-	if r == unicode.ReplacementChar {
-		return r, NewPosError(l.node(), "invalid unicode sequence")
+	if r == unicode.ReplacementChar && size == 1 {
+		// An encoded U+FFFD is valid and has a size of 3.
+		l.invalid = NewPosError(l.node(), fmt.Sprintf("invalid UTF-8 byte at offset %d", l.pos.Offset)).
+			SetHint(l.dump(nil) + ", the input may be binary or not be encoded as UTF-8")
+
+		return r, l.invalid
 	}
 
 	if err != nil {
 		return r, NewPosError(l.node(), "unable to read next rune").SetCause(err)
 	}
 
+	if l.rejectControl && isDisallowedControl(r) {
+		buf := make([]byte, size)
+		utf8.EncodeRune(buf, r)
+		l.invalid = NewPosError(l.node(), fmt.Sprintf("control character %U at offset %d is not allowed", r, l.pos.Offset)).
+			SetHint(l.dump(buf) + ", only tab, line feed and carriage return may be used")
+
+		return r, l.invalid
+	}
+
+	prevCR := len(l.buf) > 0 && l.buf[len(l.buf)-1].r == '\r'
+
 	l.buf = append(l.buf, runeWithPos{
-		r:    r,
-		line: int32(l.pos.Line),
-		col:  int32(l.pos.Col),
+		r:      r,
+		line:   int32(l.pos.Line),
+		col:    int32(l.pos.Col),
+		offset: int32(l.pos.Offset),
+		size:   int8(size),
 	})
 	l.bufPos++
 
 	l.pos.Offset += size
-	l.pos.Col++
+	l.advance(r, prevCR)
+
+	return r, err
+}
+
+// dumpLen is the number of bytes, which are shown by dump.
+const dumpLen = 8
+
+// dump returns a hex dump of read, which are the last bytes read, followed by the next unread bytes,
+// up to dumpLen bytes in total. If read is nil, the last read byte is used.
+func (l *Lexer) dump(read []byte) string {
+	if read == nil {
+		// The reader has just read a rune, so that it can be unread to get the byte itself.
+		_ = l.r.UnreadRune()
+		b, _ := l.r.ReadByte()
+		read = []byte{b}
+	}
 
-	if r == '\n' {
+	next, _ := l.r.Peek(dumpLen - len(read))
+
+	return fmt.Sprintf("bytes at offset %d: % x", l.pos.Offset, append(read, next...))
+}
+
+// isDisallowedControl returns true if r is a control character other than tab, line feed
+// and carriage return, which usually only appear in binary data.
+func isDisallowedControl(r rune) bool {
+	return unicode.IsControl(r) && r != '\t' && !isNewline(r)
+}
+
+// advance moves the position past the rune r.
+// prevCR must be true if the rune before r was a '\r'.
+func (l *Lexer) advance(r rune, prevCR bool) {
+	switch {
+	case r == '\n' && prevCR:
+		// This is the second half of a "\r\n", the line was already advanced by the '\r'.
+	case isNewline(r):
 		l.pos.Line++
 		l.pos.Col = 1
+	case r == '\t':
+		// Advance to the next tab stop.
+		l.pos.Col = (l.pos.Col-1)/l.tabWidth*l.tabWidth + l.tabWidth + 1
+	default:
+		l.pos.Col++
 	}
+}
 
-	return r, err
+// isNewline returns true if r is a '\n' or a '\r'.
+func isNewline(r rune) bool {
+	return r == '\n' || r == '\r'
 }
 
 // prevR unreads the current rune. panics if out of balance with nextR
@@ -342,6 +571,7 @@ func (l *Lexer) prevR() rune {
 	r := l.buf[l.bufPos]
 	l.pos.Line = int(r.line)
 	l.pos.Col = int(r.col)
+	l.pos.Offset = int(r.offset)
 
 	return r.r
 }
@@ -4,12 +4,14 @@
 package token
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -21,6 +23,8 @@ func TestLexer(t *testing.T) {
 		wantErr bool
 		// positions is optional to test the correct lexing of positions.
 		positions []Position
+		// opts are optional lexer options.
+		opts []Option
 	}{
 		{
 			name: "empty",
@@ -49,6 +53,29 @@ func TestLexer(t *testing.T) {
 				CharData(`hello \wo#rl}d`),
 		},
 
+		{
+			name: "escaped backslash in text",
+			text: `a\\#b \@\{c\}`,
+			want: NewTestSet().
+				CharData(`a\`).
+				DefineElement(false).
+				Identifier("b").
+				CharData(`@{c}`),
+		},
+
+		{
+			name: "escaped attribute value",
+			text: `#a @k{\{v\}\\}`,
+			want: NewTestSet().
+				DefineElement(false).
+				Identifier("a").
+				DefineAttribute(false).
+				Identifier("k").
+				BlockStart().
+				CharData(`{v}\`).
+				BlockEnd(),
+		},
+
 		{
 			name: "simple element",
 			text: `#hello`,
@@ -242,6 +269,17 @@ func TestLexer(t *testing.T) {
 				BlockEnd(),
 		},
 
+		{
+			name: "g2 string with escaped backslash",
+			text: `#!{"C:\tmp\\" "\\\""}`,
+			want: NewTestSet().
+				G2Preamble().
+				BlockStart().
+				CharData(`C:\tmp\`).
+				CharData(`\"`).
+				BlockEnd(),
+		},
+
 		{
 			name: "g2 with attributes",
 			text: `#!{x @key="value" @@num="5" y}`,
@@ -261,6 +299,49 @@ func TestLexer(t *testing.T) {
 				BlockEnd(),
 		},
 
+		{
+			name: "g2 with quoted attribute keys",
+			text: `#!@"gen-by"{x} {x @"content-type"="json" @@"a \"b\""="5"}`,
+			want: NewTestSet().
+				G2Preamble().
+				DefineAttribute(false).
+				Identifier("gen-by").
+				BlockStart().
+				CharData("x").
+				BlockEnd().
+				BlockStart().
+				Identifier("x").
+				DefineAttribute(false).
+				Identifier("content-type").
+				Assign().
+				CharData("json").
+				DefineAttribute(true).
+				Identifier(`a "b"`).
+				Assign().
+				CharData("5").
+				BlockEnd(),
+		},
+
+		{
+			name: "g1 with quoted attribute key",
+			text: `#item @"content-type"{json} text`,
+			want: NewTestSet().
+				DefineElement(false).
+				Identifier("item").
+				DefineAttribute(false).
+				Identifier("content-type").
+				BlockStart().
+				CharData("json").
+				BlockEnd().
+				CharData("text"),
+		},
+
+		{
+			name:    "empty quoted attribute key",
+			text:    `#!{x @""="json"}`,
+			wantErr: true,
+		},
+
 		{
 			name: "g2 with g1 line",
 			text: `#!{# here is another #item @color{blue}}`,
@@ -279,6 +360,28 @@ func TestLexer(t *testing.T) {
 				BlockEnd(),
 		},
 
+		{
+			name: "g2 island in g1",
+			text: "text #!{a, b(c)} more #p{x}",
+			want: NewTestSet().
+				CharData("text ").
+				G2Preamble().
+				BlockStart().
+				Identifier("a").
+				Comma().
+				Identifier("b").
+				GroupStart().
+				Identifier("c").
+				GroupEnd().
+				BlockEnd().
+				CharData("more ").
+				DefineElement(false).
+				Identifier("p").
+				BlockStart().
+				CharData("x").
+				BlockEnd(),
+		},
+
 		{
 			name: "g1 lines with different endings",
 			text: `#!{
@@ -425,11 +528,93 @@ func TestLexer(t *testing.T) {
 				G2Arrow().
 				BlockEnd(),
 		},
+
+		{
+			name: "crlf positions",
+			text: "#A\r\n#B\r#C",
+			want: NewTestSet().
+				DefineElement(false).
+				Identifier("A").
+				DefineElement(false).
+				Identifier("B").
+				DefineElement(false).
+				Identifier("C"),
+			positions: newTestPositions(
+				1, 1, 1, 2,
+				1, 2, 1, 3,
+				2, 1, 2, 2,
+				2, 2, 2, 3,
+				3, 1, 3, 2,
+				3, 2, 3, 3,
+			),
+		},
+
+		{
+			name: "tab width",
+			text: "#!{\n\titem\n  \tother}",
+			want: NewTestSet().
+				G2Preamble().
+				BlockStart().
+				Identifier("item").
+				Identifier("other").
+				BlockEnd(),
+			positions: newTestPositions(
+				1, 1, 1, 3,
+				1, 3, 1, 4,
+				2, 5, 2, 9,
+				3, 5, 3, 10,
+				3, 10, 3, 11,
+			),
+			opts: []Option{WithTabWidth(4)},
+		},
+
+		{
+			name: "g2 with crlf g1 lines",
+			text: "#!{\r\n# hello\r\n# world\r// comment\r\n}",
+			want: NewTestSet().
+				G2Preamble().
+				BlockStart().
+				DefineElement(false).
+				CharData("hello").
+				G1LineEnd().
+				DefineElement(false).
+				CharData("world").
+				G1LineEnd().
+				G2Comment().
+				CharData("comment").
+				BlockEnd(),
+		},
+
+		{
+			name: "escaped newline without line continuation",
+			text: "#!{\n# hello \\\nitem\n}",
+			want: NewTestSet().
+				G2Preamble().
+				BlockStart().
+				DefineElement(false).
+				CharData("hello \\").
+				G1LineEnd().
+				Identifier("item").
+				BlockEnd(),
+		},
+
+		{
+			name: "line continuation",
+			text: "#!{\n# hello \\\r\nworld\n}",
+			want: NewTestSet().
+				G2Preamble().
+				BlockStart().
+				DefineElement(false).
+				CharData("hello world").
+				G1LineEnd().
+				BlockEnd(),
+			opts: []Option{WithLineContinuation()},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tokens, err := parseTokens(tt.text)
+			tokens, err := parseTokens(tt.text, tt.opts...)
 
 			if tt.wantErr {
 				if err == nil {
@@ -747,12 +932,12 @@ func comparePos(a, b Position) bool {
 		a.End().Col == b.End().Col && a.End().Line == b.End().Line
 }
 
-func newTestLexer(text string) *Lexer {
-	return NewLexer("lexer_test.go", bytes.NewBuffer([]byte(text)))
+func newTestLexer(text string, opts ...Option) *Lexer {
+	return NewLexer("lexer_test.go", bytes.NewBuffer([]byte(text)), opts...)
 }
 
-func parseTokens(text string) ([]Token, error) {
-	dec := newTestLexer(text)
+func parseTokens(text string, opts ...Option) ([]Token, error) {
+	dec := newTestLexer(text, opts...)
 
 	var res []Token
 
@@ -780,3 +965,261 @@ func toString(i interface{}) string {
 
 	return string(buf)
 }
+
+func TestLexerOffsets(t *testing.T) {
+	tests := []string{
+		"#!{a \"ä\" @key=\"välue\" {child}, other}",
+		"#item @key{välue} text #other{x}",
+		"#!{\r\n\tname \"x\" // cömment\r\n\tnext\n}",
+	}
+
+	for _, text := range tests {
+		t.Run(text, func(t *testing.T) {
+			tokens, err := parseTokens(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tok := range tokens {
+				ident, ok := tok.(*Identifier)
+				if !ok {
+					continue
+				}
+
+				begin, end := ident.Begin().Offset, ident.End().Offset
+				if got := text[begin:end]; got != ident.Value {
+					t.Errorf("expected %q at offsets %d-%d but got %q", ident.Value, begin, end, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectMode(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want GrammarMode
+	}{
+		{"empty", "", G1},
+		{"single rune", "#", G1},
+		{"g1", "#item{hello}", G1},
+		{"g1 comment", "#? not a preamble", G1},
+		{"g2", "#!{item}", G2},
+		{"preamble not at start", " #!{item}", G1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(bytes.NewBufferString(tt.text))
+
+			mode, pos, err := DetectMode(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if mode != tt.want {
+				t.Errorf("expected mode %v but got %v", tt.want, mode)
+			}
+
+			if mode == G2 && pos.BeginPos.String() != ":1:1" {
+				t.Errorf("expected preamble at :1:1 but got %s", pos.BeginPos)
+			}
+
+			// Nothing must have been consumed from the reader.
+			rest, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(rest) != tt.text {
+				t.Errorf("expected input to be untouched but got %q", rest)
+			}
+		})
+	}
+}
+
+func TestLexerInvalidInput(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		msg  string
+		hint string
+		pos  string
+		opts []Option
+	}{
+		{
+			name: "invalid utf8 in g1 text",
+			text: "hello\xff\xfeworld",
+			msg:  "invalid UTF-8 byte at offset 5",
+			hint: "bytes at offset 5: ff fe 77 6f 72 6c 64",
+			pos:  ":1:6",
+		},
+		{
+			name: "invalid utf8 after first rune",
+			text: "a\xff",
+			msg:  "invalid UTF-8 byte at offset 1",
+			hint: "bytes at offset 1: ff,",
+			pos:  ":1:2",
+		},
+		{
+			name: "nul in g2",
+			text: "#!{\n\ta\x00\x00b}",
+			msg:  "control character U+0000 at offset 6 is not allowed",
+			hint: "bytes at offset 6: 00 00 62 7d",
+			pos:  ":2:3",
+			opts: []Option{WithRejectControlCharacters()},
+		},
+		{
+			name: "c1 control in g2 string",
+			text: "#!{a \"x\u0085\"}",
+			msg:  "control character U+0085 at offset 7 is not allowed",
+			hint: "bytes at offset 7: c2 85 22 7d",
+			pos:  ":1:8",
+			opts: []Option{WithRejectControlCharacters()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTokens(tt.text, tt.opts...)
+
+			var posErr *PosError
+			if !errors.As(err, &posErr) {
+				t.Fatalf("expected a PosError but got %v", err)
+			}
+
+			if posErr.Error() != tt.msg {
+				t.Errorf("expected message %q but got %q", tt.msg, posErr.Error())
+			}
+
+			if !strings.Contains(posErr.Hint, tt.hint) {
+				t.Errorf("expected hint to contain %q but got %q", tt.hint, posErr.Hint)
+			}
+
+			if got := posErr.firstDetail().Node.Begin().String(); got != "lexer_test.go"+tt.pos {
+				t.Errorf("expected error at %s but got %s", tt.pos, got)
+			}
+		})
+	}
+
+	// Tabs, newlines and carriage returns are no disallowed control characters.
+	if _, err := parseTokens("#!{\r\n\ta \"b\tc\"\n}", WithRejectControlCharacters()); err != nil {
+		t.Errorf("expected no error but got %v", err)
+	}
+
+	// Without the option, control characters are read like other runes.
+	if _, err := parseTokens("#!{a \"\b\f\v\x1b\x00\"}"); err != nil {
+		t.Errorf("expected no error but got %v", err)
+	}
+}
+
+func TestLineDirectives(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// want is the position of the identifier "a".
+		want string
+		opts []Option
+	}{
+		{
+			name: "g2",
+			text: "#!{\n\t//line users.csv:12\n\ta\n}",
+			want: "users.csv:12:2",
+			opts: []Option{WithLineDirectives()},
+		},
+		{
+			name: "g2 crlf and following lines",
+			text: "#!{\r\n//line users.csv:12\r\n\r\nb,\r\na\r\n}",
+			want: "users.csv:14:1",
+			opts: []Option{WithLineDirectives()},
+		},
+		{
+			name: "g1",
+			text: "#?line gen/users.csv:3\n#a",
+			want: "gen/users.csv:3:2",
+			opts: []Option{WithLineDirectives()},
+		},
+		{
+			name: "empty file name",
+			text: "#!{\n//line :7\na\n}",
+			want: "lexer_test.go:7:1",
+			opts: []Option{WithLineDirectives()},
+		},
+		{
+			name: "drive letter",
+			text: "#!{\n//line C:\\users.csv:7\na\n}",
+			want: "C:\\users.csv:7:1",
+			opts: []Option{WithLineDirectives()},
+		},
+		{
+			name: "no directive",
+			text: "#!{\n//line users.csv\na\n}",
+			want: "lexer_test.go:3:1",
+			opts: []Option{WithLineDirectives()},
+		},
+		{
+			name: "disabled",
+			text: "#!{\n//line users.csv:12\na\n}",
+			want: "lexer_test.go:3:1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := parseTokens(tt.text, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tok := range tokens {
+				if ident, ok := tok.(*Identifier); ok && ident.Value == "a" {
+					if got := ident.Begin().String(); got != tt.want {
+						t.Errorf("expected %s but got %s", tt.want, got)
+					}
+
+					return
+				}
+			}
+
+			t.Error("identifier 'a' not found")
+		})
+	}
+}
+
+func TestLexerReset(t *testing.T) {
+	lexer := NewLexer("first.tadl", bytes.NewBufferString("#!{a \"b\x00"), WithTabWidth(4))
+
+	// Leave the lexer in the middle of G2 with an error.
+	for {
+		if _, err := lexer.Token(); err != nil {
+			break
+		}
+	}
+
+	lexer.Reset("second.tadl", bytes.NewBufferString("\t#a"))
+
+	want := NewTestSet().CharData("\t").DefineElement(false).Identifier("a")
+
+	var got []Token
+
+	for {
+		tok, err := lexer.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, tok)
+	}
+
+	want.Assert(got, t)
+
+	// The tab width is kept.
+	if pos := got[1].Pos().Begin(); pos.String() != "second.tadl:1:5" {
+		t.Errorf("expected position second.tadl:1:5 but got %s", pos)
+	}
+}
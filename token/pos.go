@@ -46,6 +46,20 @@ func (p Pos) String() string {
 
 type Position struct {
 	BeginPos, EndPos Pos
+	// Synthetic is true for tokens and nodes that do not appear in the input, but were
+	// generated while parsing, like the root element. BeginPos and EndPos then span the
+	// construct that caused the generation, see Synthesize.
+	Synthetic bool
+}
+
+// Synthesize returns the position of a token or node that was generated because of origin,
+// like the root element that is generated for the G2 preamble.
+func Synthesize(origin Node) Position {
+	return Position{
+		BeginPos:  origin.Begin(),
+		EndPos:    origin.End(),
+		Synthetic: true,
+	}
 }
 
 // After returns true, if this position end is beyond the other position begin.
@@ -82,7 +96,7 @@ func (d Position) End() Pos {
 }
 
 func NewNode(begin, end Pos) Node {
-	return Position{begin, end}
+	return Position{BeginPos: begin, EndPos: end}
 }
 
 // NewFileNode returns a fake node which just points to 1:1 of the file, whatever that is.
@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/golangee/tadl/parser"
+)
+
+// usage is an element, or an attribute of an element, which has been matched by a field.
+type usage struct {
+	node      *parser.TreeNode
+	attribute string
+}
+
+// use marks node, or its attribute if not empty, as unmarshalled, see WithUnusedWarnings.
+func (u *unmarshaler) use(node *parser.TreeNode, attribute string) {
+	if u.used != nil {
+		u.used[usage{node: node, attribute: attribute}] = true
+	}
+}
+
+// unusedEntry is an element or attribute, which has not been used by a field, and its parent.
+type unusedEntry struct {
+	parent     *parser.TreeNode
+	diagnostic Diagnostic
+	// detail describes the entry for errors, see DecodeOptions.DisallowUnknownFields.
+	detail string
+}
+
+// reportUnused reports the attributes and child elements of all nodes unmarshalled into structs,
+// which have not been used by a field, see WithUnusedWarnings. If unknown fields are disallowed,
+// they are returned as error instead.
+func (u *unmarshaler) reportUnused(tree *parser.TreeNode) error {
+	if u.unused == nil && !u.disallowUnknown {
+		return nil
+	}
+
+	var entries []unusedEntry
+
+	for node := range tree.All() {
+		types := u.structs[node]
+		if len(types) == 0 {
+			continue
+		}
+
+		for i := 0; i < node.Attributes.Len(); i++ {
+			key, _ := node.Attributes.Get(i)
+			if !u.used[usage{node: node, attribute: *key}] {
+				keyRange, _ := node.Attributes.Range(i)
+				entries = append(entries, unusedEntry{
+					parent: node,
+					diagnostic: Diagnostic{
+						Pos:     keyRange.BeginPos,
+						Message: fmt.Sprintf("attribute '%s' is not used", *key),
+					},
+					detail: fmt.Sprintf("unknown attribute '%s'", *key) + u.suggest(types, *key, true),
+				})
+			}
+		}
+
+		for _, child := range node.Children {
+			if child.IsNode() && !u.used[usage{node: child}] {
+				entries = append(entries, unusedEntry{
+					parent: node,
+					diagnostic: Diagnostic{
+						Pos:     child.Range.BeginPos,
+						Message: fmt.Sprintf("'%s' is not used", child.Name),
+					},
+					detail: fmt.Sprintf("unknown element '%s'", child.Name) + u.suggest(types, child.Name, false),
+				})
+			}
+		}
+	}
+
+	// The children of a struct are checked before the elements nested in them.
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].diagnostic.Pos.Offset < entries[j].diagnostic.Pos.Offset
+	})
+
+	if u.disallowUnknown {
+		for _, entry := range entries {
+			err := NewUnmarshalError(entry.parent, entry.detail, nil)
+			err.pos = entry.diagnostic.Pos
+
+			if !u.allErrors {
+				return err
+			}
+
+			u.errs = append(u.errs, err)
+		}
+
+		return nil
+	}
+
+	for _, entry := range entries {
+		u.unused(entry.diagnostic)
+	}
+
+	return nil
+}
+
+// suggest returns the name of the field of types, which is most similar to the unknown element or
+// attribute name, as ", did you mean '...'?". It returns "" if no name is similar enough.
+func (u *unmarshaler) suggest(types []reflect.Type, name string, attribute bool) string {
+	limit := 1
+	if len(name) > 5 {
+		limit = 2
+	}
+
+	best, bestDistance := "", limit+1
+
+	for _, t := range types {
+		for _, plan := range structPlan(t, u.tagFallback...) {
+			switch {
+			case attribute && plan.as != unmarshalAttribute:
+				continue
+			case !attribute && plan.as != unmarshalNormal && plan.as != unmarshalTable:
+				continue
+			}
+
+			fieldName := plan.name
+			if !plan.renamed && u.nameMapper != nil {
+				fieldName = u.nameMapper(fieldName)
+			}
+
+			if d := distance(strings.ToLower(name), strings.ToLower(fieldName)); d < bestDistance {
+				best, bestDistance = fieldName, d
+			}
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(", did you mean '%s'?", best)
+}
+
+// distance returns the number of inserted, deleted, replaced or swapped runes to change a into b.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// rows are the last three rows of the matrix of distances between prefixes of a and b.
+	rows := [3][]int{make([]int, len(rb)+1), make([]int, len(rb)+1), make([]int, len(rb)+1)}
+	for j := range rows[1] {
+		rows[1][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		prev2, prev, cur := rows[0], rows[1], rows[2]
+		cur[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+
+		rows[0], rows[1], rows[2] = prev, cur, prev2
+	}
+
+	return rows[1][len(rb)]
+}
@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/golangee/tadl/token"
+)
+
+// Diagnostic is a problem that was found while validating a document, see ValidateAll.
+type Diagnostic struct {
+	// Pos is the position of the problem. It only contains the file, if the
+	// position of the problem is unknown.
+	Pos     token.Pos
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Pos.Line == 0 {
+		return d.Pos.File + ": " + d.Message
+	}
+
+	return d.Pos.String() + ": " + d.Message
+}
+
+// ValidateAll validates all files ending with ".tadl" in fsys with the given number of workers.
+// A file is valid, if it can be parsed and strictly unmarshalled into a new value of the type
+// of schema, like Config{} or &Config{}. If schema is nil, only the syntax is checked.
+// All problems of a file are reported, not only the first one.
+//
+// progress, if not nil, is called once for every validated file, also for valid ones.
+// It is never called concurrently. The returned map contains the diagnostics of all invalid files.
+// When ctx is cancelled, the files that were not yet validated are skipped and ctx.Err() is returned.
+// A concurrency smaller than one uses one worker per CPU.
+func ValidateAll(ctx context.Context, fsys fs.FS, schema interface{}, concurrency int,
+	progress func(file string, diags []Diagnostic)) (map[string][]Diagnostic, error) {
+	var files []string
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() && strings.HasSuffix(name, ".tadl") {
+			files = append(files, name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU()
+	}
+
+	type validation struct {
+		file  string
+		diags []Diagnostic
+	}
+
+	jobs := make(chan string)
+	results := make(chan validation)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for file := range jobs {
+				results <- validation{file: file, diags: validateFile(fsys, file, schema)}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+
+		for _, file := range files {
+			select {
+			case jobs <- file:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	all := map[string][]Diagnostic{}
+
+	for result := range results {
+		if len(result.diags) > 0 {
+			all[result.file] = result.diags
+		}
+
+		if progress != nil {
+			progress(result.file, result.diags)
+		}
+	}
+
+	return all, ctx.Err()
+}
+
+// validateFile validates a single file of fsys, see ValidateAll.
+func validateFile(fsys fs.FS, file string, schema interface{}) []Diagnostic {
+	f, err := fsys.Open(file)
+	if err != nil {
+		return []Diagnostic{{Pos: token.Pos{File: file}, Message: err.Error()}}
+	}
+
+	defer f.Close()
+
+	var into interface{} = &struct{}{}
+	strict := false
+
+	if schema != nil {
+		t := reflect.TypeOf(schema)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		into = reflect.New(t).Interface()
+		strict = true
+	}
+
+	err = unmarshal(file, f, into, strict, WithAllErrors())
+	if err == nil {
+		return nil
+	}
+
+	var errs UnmarshalErrors
+	if !errors.As(err, &errs) {
+		errs = UnmarshalErrors{err}
+	}
+
+	diags := make([]Diagnostic, 0, len(errs))
+	for _, err := range errs {
+		diags = append(diags, diagnostic(file, err))
+	}
+
+	return diags
+}
+
+// diagnostic converts an error of parsing or unmarshalling into a Diagnostic.
+func diagnostic(file string, err error) Diagnostic {
+	diag := Diagnostic{Pos: token.Pos{File: file}, Message: err.Error()}
+
+	var posErr *token.PosError
+	if errors.As(err, &posErr) && len(posErr.Details) > 0 {
+		diag.Pos = posErr.Details[0].Node.Begin()
+	} else if pos, ok := errorPosition(err); ok {
+		diag.Pos = pos
+	}
+
+	return diag
+}
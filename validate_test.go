@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package tadl
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+func TestValidateAll(t *testing.T) {
+	type Config struct {
+		Port int    `tadl:"port"`
+		Name string `tadl:"name"`
+	}
+
+	fsys := fstest.MapFS{
+		"valid.tadl":        {Data: []byte("#port 80 #name web")},
+		"nested/valid.tadl": {Data: []byte("#!{port \"8080\", name \"api\"}")},
+		"syntax.tadl":       {Data: []byte("#!{port 80")},
+		"schema.tadl":       {Data: []byte("#port http\n#name")},
+		"ignored.txt":       {Data: []byte("#!{")},
+	}
+
+	tests := []struct {
+		name   string
+		schema interface{}
+		want   map[string]string
+	}{
+		{
+			name:   "syntax only",
+			schema: nil,
+			want: map[string]string{
+				"syntax.tadl": "syntax.tadl:1:11",
+			},
+		},
+		{
+			name:   "schema",
+			schema: &Config{},
+			want: map[string]string{
+				"syntax.tadl": "syntax.tadl:1:11",
+				"schema.tadl": "schema.tadl:1:1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var validated []string
+
+			got, err := ValidateAll(context.Background(), fsys, tt.schema, 2, func(file string, diags []Diagnostic) {
+				validated = append(validated, file)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Strings(validated)
+			if want := []string{"nested/valid.tadl", "schema.tadl", "syntax.tadl", "valid.tadl"}; len(validated) != len(want) {
+				t.Errorf("expected progress for %v but got %v", want, validated)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("expected diagnostics for %d files but got %v", len(tt.want), got)
+			}
+
+			for file, pos := range tt.want {
+				diags := got[file]
+				if len(diags) == 0 {
+					t.Errorf("expected diagnostics for %s", file)
+					continue
+				}
+
+				if diags[0].Pos.String() != pos {
+					t.Errorf("expected first diagnostic of %s at %s but got %s", file, pos, diags[0])
+				}
+			}
+		})
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := ValidateAll(ctx, fsys, nil, 1, nil); err == nil {
+			t.Error("expected error of cancelled context")
+		}
+	})
+}
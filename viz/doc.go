@@ -0,0 +1,7 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package viz renders Tadl trees as diagrams in the Graphviz DOT and the Mermaid flowchart syntax.
+// Every node of the tree becomes a node of the diagram, which is connected to its parent.
+// Elements are labeled with their name, labels, brackets and attributes.
+package viz
@@ -0,0 +1,274 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package viz
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golangee/tadl/parser"
+)
+
+// Style describes how a single node is drawn. Empty fields use the defaults.
+type Style struct {
+	// Color is the fill color, like "lightblue" or "#add8e6".
+	Color string
+	// Shape is the Graphviz shape of the node, like "box" or "ellipse".
+	// Mermaid diagrams ignore it.
+	Shape string
+}
+
+// DefaultColors are the colors used by ColorByBlockType, if no colors are given.
+var DefaultColors = map[parser.BlockType]string{
+	parser.BlockNormal:  "lightblue",
+	parser.BlockGroup:   "lightyellow",
+	parser.BlockGeneric: "lightpink",
+}
+
+// Option configures the rendering of a diagram.
+type Option func(r *renderer)
+
+// ColorByBlockType fills elements with the color of their BlockType.
+// If colors is nil, DefaultColors are used.
+func ColorByBlockType(colors map[parser.BlockType]string) Option {
+	return func(r *renderer) {
+		if colors == nil {
+			colors = DefaultColors
+		}
+
+		r.colors = colors
+	}
+}
+
+// CollapseText adds the text children of an element to its label,
+// instead of drawing them as nodes of their own.
+func CollapseText() Option {
+	return func(r *renderer) {
+		r.collapseText = true
+	}
+}
+
+// WithStyle sets a hook that decides the style of every node.
+// Non-empty fields of the returned Style take precedence over all other options.
+func WithStyle(style func(node *parser.TreeNode) Style) Option {
+	return func(r *renderer) {
+		r.style = style
+	}
+}
+
+// renderer collects the nodes and edges of a diagram, which are then written
+// in the syntax of Dot or Mermaid.
+type renderer struct {
+	colors       map[parser.BlockType]string
+	collapseText bool
+	style        func(node *parser.TreeNode) Style
+
+	nodes []vizNode
+}
+
+// vizNode is a single node of the diagram.
+type vizNode struct {
+	// id is the index of the node, parent is the index of the parent or -1 for the root.
+	id, parent int
+	label      string
+	style      Style
+	kind       kind
+}
+
+// kind distinguishes elements from text and comment nodes, which are drawn differently.
+type kind int
+
+const (
+	kindElement kind = iota
+	kindText
+	kindComment
+)
+
+// newRenderer collects the nodes of tree in document order.
+func newRenderer(tree *parser.TreeNode, opts []Option) *renderer {
+	r := &renderer{}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	type item struct {
+		node   *parser.TreeNode
+		parent int
+	}
+
+	stack := []item{{tree, -1}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		id := len(r.nodes)
+		r.nodes = append(r.nodes, r.newNode(id, top.parent, top.node))
+
+		// Push in reverse, so that children are numbered in document order.
+		for i := len(top.node.Children) - 1; i >= 0; i-- {
+			child := top.node.Children[i]
+			if r.collapseText && child.IsText() {
+				continue
+			}
+
+			stack = append(stack, item{child, id})
+		}
+	}
+
+	return r
+}
+
+// newNode creates the diagram node for a node of the tree.
+func (r *renderer) newNode(id, parent int, node *parser.TreeNode) vizNode {
+	n := vizNode{id: id, parent: parent}
+
+	switch {
+	case node.IsText():
+		n.kind = kindText
+		n.label = *node.Text
+	case node.IsComment():
+		n.kind = kindComment
+		n.label = *node.Comment
+	default:
+		n.label = elementLabel(node, r.collapseText)
+		n.style.Color = r.colors[node.BlockType]
+	}
+
+	if r.style != nil {
+		style := r.style(node)
+		if style.Color != "" {
+			n.style.Color = style.Color
+		}
+
+		if style.Shape != "" {
+			n.style.Shape = style.Shape
+		}
+	}
+
+	return n
+}
+
+// elementLabel describes an element with its name, labels, brackets and attributes,
+// which are separated by newlines. With collapseText its text children are appended.
+func elementLabel(node *parser.TreeNode, collapseText bool) string {
+	var sb strings.Builder
+	sb.WriteString(node.Name)
+
+	for _, label := range node.Labels {
+		sb.WriteString(" ")
+		sb.WriteString(strconv.Quote(label))
+	}
+
+	sb.WriteString(string(node.BlockType))
+
+	for i := 0; i < node.Attributes.Len(); i++ {
+		key, value := node.Attributes.Get(i)
+		fmt.Fprintf(&sb, "\n@%s=%s", *key, *value)
+	}
+
+	if collapseText {
+		for _, child := range node.Children {
+			if child.IsText() {
+				sb.WriteString("\n")
+				sb.WriteString(strings.TrimSpace(*child.Text))
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// Dot renders tree as Graphviz DOT graph. Text nodes are drawn as boxes and comments as notes.
+func Dot(tree *parser.TreeNode, opts ...Option) string {
+	r := newRenderer(tree, opts)
+
+	var sb strings.Builder
+	sb.WriteString("digraph tadl {\n")
+
+	for _, n := range r.nodes {
+		shape := n.style.Shape
+		if shape == "" {
+			switch n.kind {
+			case kindText:
+				shape = "box"
+			case kindComment:
+				shape = "note"
+			}
+		}
+
+		attrs := []string{"label=" + dotQuote(n.label)}
+		if shape != "" {
+			attrs = append(attrs, "shape="+shape)
+		}
+
+		if n.style.Color != "" {
+			attrs = append(attrs, "style=filled", "fillcolor="+dotQuote(n.style.Color))
+		}
+
+		fmt.Fprintf(&sb, "  n%d [%s];\n", n.id, strings.Join(attrs, ", "))
+
+		if n.parent >= 0 {
+			fmt.Fprintf(&sb, "  n%d -> n%d;\n", n.parent, n.id)
+		}
+	}
+
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+// dotQuote quotes s as DOT string, in which newlines are line breaks.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\r", "")
+	s = strings.ReplaceAll(s, "\n", `\n`)
+
+	return `"` + s + `"`
+}
+
+// Mermaid renders tree as Mermaid flowchart. Text nodes are drawn with rounded
+// corners and comments as hexagons.
+func Mermaid(tree *parser.TreeNode, opts ...Option) string {
+	r := newRenderer(tree, opts)
+
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+
+	for _, n := range r.nodes {
+		label := mermaidQuote(n.label)
+
+		switch n.kind {
+		case kindText:
+			fmt.Fprintf(&sb, "  n%d(%s)\n", n.id, label)
+		case kindComment:
+			fmt.Fprintf(&sb, "  n%d{{%s}}\n", n.id, label)
+		default:
+			fmt.Fprintf(&sb, "  n%d[%s]\n", n.id, label)
+		}
+
+		if n.parent >= 0 {
+			fmt.Fprintf(&sb, "  n%d --> n%d\n", n.parent, n.id)
+		}
+
+		if n.style.Color != "" {
+			fmt.Fprintf(&sb, "  style n%d fill:%s\n", n.id, n.style.Color)
+		}
+	}
+
+	return sb.String()
+}
+
+// mermaidQuote quotes s as Mermaid label, which uses HTML entities and line breaks.
+func mermaidQuote(s string) string {
+	s = strings.ReplaceAll(s, "&", "#amp;")
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	s = strings.ReplaceAll(s, "<", "#lt;")
+	s = strings.ReplaceAll(s, ">", "#gt;")
+	s = strings.ReplaceAll(s, "\r", "")
+	s = strings.ReplaceAll(s, "\n", "<br/>")
+
+	return `"` + s + `"`
+}
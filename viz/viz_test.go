@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: © 2021 The tadl authors <https://github.com/golangee/tadl/blob/main/AUTHORS>
+// SPDX-License-Identifier: Apache-2.0
+
+package viz
+
+import (
+	"testing"
+
+	"github.com/golangee/tadl/parser"
+)
+
+func tree() *parser.TreeNode {
+	return parser.NewNode("root").Block(parser.BlockNormal).AddChildren(
+		parser.NewStringCommentNode("a \"server\""),
+		parser.NewNode("server").AddLabels("web").AddAttribute("id", "1").Block(parser.BlockGroup).AddChildren(
+			parser.NewStringNode("hello"),
+		),
+	)
+}
+
+func TestDot(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{
+			name: "plain",
+			want: `digraph tadl {
+  n0 [label="root{}"];
+  n1 [label="a \"server\"", shape=note];
+  n0 -> n1;
+  n2 [label="server \"web\"()\n@id=1"];
+  n0 -> n2;
+  n3 [label="hello", shape=box];
+  n2 -> n3;
+}
+`,
+		},
+		{
+			name: "colored and collapsed",
+			opts: []Option{ColorByBlockType(nil), CollapseText()},
+			want: `digraph tadl {
+  n0 [label="root{}", style=filled, fillcolor="lightblue"];
+  n1 [label="a \"server\"", shape=note];
+  n0 -> n1;
+  n2 [label="server \"web\"()\n@id=1\nhello", style=filled, fillcolor="lightyellow"];
+  n0 -> n2;
+}
+`,
+		},
+		{
+			name: "style hook",
+			opts: []Option{
+				ColorByBlockType(nil),
+				WithStyle(func(node *parser.TreeNode) Style {
+					if node.Name == "server" {
+						return Style{Color: "red", Shape: "hexagon"}
+					}
+					return Style{}
+				}),
+			},
+			want: `digraph tadl {
+  n0 [label="root{}", style=filled, fillcolor="lightblue"];
+  n1 [label="a \"server\"", shape=note];
+  n0 -> n1;
+  n2 [label="server \"web\"()\n@id=1", shape=hexagon, style=filled, fillcolor="red"];
+  n0 -> n2;
+  n3 [label="hello", shape=box];
+  n2 -> n3;
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Dot(tree(), tt.opts...); got != tt.want {
+				t.Errorf("expected\n%s\nbut got\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{
+			name: "plain",
+			want: `flowchart TD
+  n0["root{}"]
+  n1{{"a #quot;server#quot;"}}
+  n0 --> n1
+  n2["server #quot;web#quot;()<br/>@id=1"]
+  n0 --> n2
+  n3("hello")
+  n2 --> n3
+`,
+		},
+		{
+			name: "colored and collapsed",
+			opts: []Option{ColorByBlockType(map[parser.BlockType]string{parser.BlockGroup: "#ff0"}), CollapseText()},
+			want: `flowchart TD
+  n0["root{}"]
+  n1{{"a #quot;server#quot;"}}
+  n0 --> n1
+  n2["server #quot;web#quot;()<br/>@id=1<br/>hello"]
+  n0 --> n2
+  style n2 fill:#ff0
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Mermaid(tree(), tt.opts...); got != tt.want {
+				t.Errorf("expected\n%s\nbut got\n%s", tt.want, got)
+			}
+		})
+	}
+}